@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "bench",
+		usage:       "[flags] [-c <config file> | -synthetic <number of CIDRs>]",
+		description: "Run a config file or a synthetic one repeatedly, and report the duration of every input and output",
+		run:         runBench,
+	})
+}
+
+// benchDurations is the durations of a step over all runs
+type benchDurations struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	Max  time.Duration `json:"max"`
+
+	durations []time.Duration
+}
+
+// benchStep is an input or output
+type benchStep struct {
+	Stage  string `json:"stage"`
+	Index  int    `json:"index"`
+	Plugin string `json:"plugin"`
+	benchDurations
+}
+
+// benchResult is the result of all runs, durations are in nanoseconds in JSON
+type benchResult struct {
+	Runs  int             `json:"runs"`
+	Steps []*benchStep    `json:"steps"`
+	Total *benchDurations `json:"total"`
+	// Average bytes and number of heap objects allocated by a run
+	AllocBytes   uint64 `json:"allocBytes"`
+	AllocObjects uint64 `json:"allocObjects"`
+}
+
+// benchRecorder records durations of inputs and outputs reported as progress events
+type benchRecorder struct {
+	mu    sync.Mutex
+	steps map[string]*benchStep
+	order []*benchStep
+}
+
+func (r *benchRecorder) Report(ev *lib.ProgressEvent) {
+	if !ev.Done || (ev.Stage != lib.ProgressInput && ev.Stage != lib.ProgressOutput) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := fmt.Sprintf("%s/%d", ev.Stage, ev.Index)
+	step, found := r.steps[key]
+	if !found {
+		step = &benchStep{Stage: ev.Stage, Index: ev.Index, Plugin: ev.Plugin}
+		r.steps[key] = step
+		r.order = append(r.order, step)
+	}
+	step.durations = append(step.durations, ev.Duration)
+}
+
+func runBench(args []string) error {
+	cmd := commands["bench"]
+	fs := cmd.newFlagSet()
+	var configFiles configFlag
+	fs.Var(&configFiles, "c", "Path to the config file or directory to run, could be specified multiple times to merge them in order, ignored with -synthetic (default config.json)")
+	synthetic := fs.Int("synthetic", 0, "Number of random CIDRs of a synthetic config converting plaintext files to other formats in a temporary directory, 0 to run the config file")
+	syntheticLists := fs.Int("lists", 100, "Number of lists the random CIDRs of -synthetic are spread over")
+	seed := fs.Uint64("seed", 1, "Seed of the random CIDRs of -synthetic, the same seed generates the same CIDRs")
+	runs := fs.Int("runs", 3, "Number of runs")
+	concurrency := fs.Int("concurrency", 1, "Max number of inputs loading data from their sources concurrently")
+	offline := fs.Bool("offline", false, "Forbid network access and read all remote files from the download cache")
+	cpuProfile := fs.String("cpuprofile", "", "Path to write the pprof CPU profile of all runs")
+	memProfile := fs.String("memprofile", "", "Path to write the pprof heap profile after all runs")
+	jsonOutput := fs.Bool("json", false, "Print the results in JSON")
+	logLevel := fs.String("log-level", "warn", "Log level, the value is debug, info, warn or error")
+	fs.Parse(args)
+
+	if *runs <= 0 {
+		return errors.New("-runs must be positive")
+	}
+	if err := lib.SetupLogger(os.Stderr, *logLevel, lib.LogFormatText); err != nil {
+		return err
+	}
+	if *offline {
+		lib.SetDownloadOptions(&lib.DownloadOptions{Offline: true})
+	}
+
+	configs := configFiles.files()
+	if *synthetic > 0 {
+		if *syntheticLists <= 0 {
+			return errors.New("-lists must be positive")
+		}
+		dir, err := os.MkdirTemp("", "geoip-bench-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		config, err := writeSyntheticConfig(dir, *synthetic, *syntheticLists, *seed)
+		if err != nil {
+			return err
+		}
+		configs = []string{config}
+	}
+
+	recorder := &benchRecorder{steps: make(map[string]*benchStep)}
+	lib.SetProgressReporter(recorder)
+	defer lib.SetProgressReporter(nil)
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	result := &benchResult{Runs: *runs}
+	total := &benchDurations{}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for run := 0; run < *runs; run++ {
+		instance, err := lib.NewInstance()
+		if err != nil {
+			return err
+		}
+		if err := initConfigs(instance, configs); err != nil {
+			return err
+		}
+		instance.SetConcurrency(*concurrency)
+
+		start := time.Now()
+		if err := instance.RunContext(context.Background()); err != nil {
+			return fmt.Errorf("run %d failed: %w", run+1, err)
+		}
+		total.durations = append(total.durations, time.Since(start))
+	}
+	runtime.ReadMemStats(&after)
+	result.AllocBytes = (after.TotalAlloc - before.TotalAlloc) / uint64(*runs)
+	result.AllocObjects = (after.Mallocs - before.Mallocs) / uint64(*runs)
+
+	if *memProfile != "" {
+		runtime.GC()
+		if err := writeHeapProfile(*memProfile); err != nil {
+			return err
+		}
+	}
+
+	result.Steps = recorder.order
+	for _, step := range result.Steps {
+		step.summarize()
+	}
+	total.summarize()
+	result.Total = total
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return result.writeTable(os.Stdout)
+}
+
+// summarize sets the min, mean and max of the durations
+func (s *benchDurations) summarize() {
+	if len(s.durations) == 0 {
+		return
+	}
+	var sum time.Duration
+	for _, d := range s.durations {
+		sum += d
+	}
+	s.Min, s.Max = slices.Min(s.durations), slices.Max(s.durations)
+	s.Mean = sum / time.Duration(len(s.durations))
+}
+
+func (r *benchResult) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tPLUGIN\tMIN\tMEAN\tMAX")
+	for _, step := range r.Steps {
+		fmt.Fprintf(tw, "%s %d\t%s\t%s\t%s\t%s\n", step.Stage, step.Index+1, step.Plugin, formatBenchDuration(step.Min), formatBenchDuration(step.Mean), formatBenchDuration(step.Max))
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t%s\t%s\n", formatBenchDuration(r.Total.Min), formatBenchDuration(r.Total.Mean), formatBenchDuration(r.Total.Max))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d runs, %s in %d objects allocated per run\n", r.Runs, formatBenchBytes(r.AllocBytes), r.AllocObjects)
+	return err
+}
+
+func formatBenchDuration(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
+
+func formatBenchBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSyntheticConfig writes plaintext files of random CIDRs spread over lists in the
+// directory, and returns the path to a config file converting them to other formats
+// in the directory. About one in five CIDRs is IPv6.
+func writeSyntheticConfig(dir string, cidrs, lists int, seed uint64) (string, error) {
+	inputDir := filepath.Join(dir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		return "", err
+	}
+
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	contents := make([]strings.Builder, lists)
+	for range cidrs {
+		var prefix netip.Prefix
+		if rnd.IntN(5) == 0 {
+			var ip [16]byte
+			ip[0], ip[1] = 0x20, byte(rnd.IntN(0x10))
+			for idx := 2; idx < 8; idx++ {
+				ip[idx] = byte(rnd.Uint32())
+			}
+			prefix = netip.PrefixFrom(netip.AddrFrom16(ip), 28+rnd.IntN(21)).Masked()
+		} else {
+			var ip [4]byte
+			for idx := range ip {
+				ip[idx] = byte(rnd.Uint32())
+			}
+			prefix = netip.PrefixFrom(netip.AddrFrom4(ip), 12+rnd.IntN(13)).Masked()
+		}
+		b := &contents[rnd.IntN(lists)]
+		b.WriteString(prefix.String())
+		b.WriteByte('\n')
+	}
+	for idx := range contents {
+		file := filepath.Join(inputDir, fmt.Sprintf("list%d.txt", idx+1))
+		if err := os.WriteFile(file, []byte(contents[idx].String()), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	outputDir := filepath.Join(dir, "output")
+	config, err := json.Marshal(map[string]any{
+		"input": []map[string]any{
+			{"type": "text", "action": "add", "args": map[string]any{"inputDir": inputDir}},
+		},
+		"output": []map[string]any{
+			{"type": "v2rayGeoIPDat", "action": "output", "args": map[string]any{"outputDir": outputDir}},
+			{"type": "text", "action": "output", "args": map[string]any{"outputDir": outputDir}},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	configFile := filepath.Join(dir, "config.json")
+	return configFile, os.WriteFile(configFile, config, 0644)
+}
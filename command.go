@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+// command is a subcommand of the program, run as "geoip <name> [flags] [args]"
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+var commands = make(map[string]*command)
+
+func registerCommand(c *command) {
+	if _, found := commands[c.name]; found {
+		panic("command " + c.name + " has already been registered")
+	}
+	commands[c.name] = c
+}
+
+func listCommands() {
+	fmt.Println("All available commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  - %s (%s)\n", name, commands[name].description)
+	}
+}
+
+// newFlagSet returns a flag set printing the usage of the command on error
+func (c *command) newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: geoip %s %s\n\n%s\n\n", c.name, c.usage, c.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// configFlag is the -c flag of config files, which could be specified multiple times
+// to merge the config files in order
+type configFlag []string
+
+func (f *configFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *configFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// files returns the config files, config.json if none is specified
+func (f configFlag) files() []string {
+	if len(f) == 0 {
+		return []string{"config.json"}
+	}
+	return f
+}
+
+// initConfigs merges the config files into the instance in order
+func initConfigs(instance lib.Instance, files []string) error {
+	for _, file := range files {
+		if err := instance.InitConfig(file); err != nil {
+			if len(files) > 1 {
+				return &lib.RunError{Kind: lib.ErrorKindConfig, Err: fmt.Errorf("failed to load %s: %w", file, err)}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Input formats of artifacts detected by file extension
+var artifactFormats = map[string]string{
+	".dat":  "v2rayGeoIPDat",
+	".mmdb": "maxmindMMDB",
+}
+
+// artifactFormat returns the format of the file, which is detected by the file
+// extension if not specified
+func artifactFormat(path, format string, isDir bool) string {
+	if format != "" {
+		return format
+	}
+	if f, found := artifactFormats[strings.ToLower(filepath.Ext(path))]; found && !isDir {
+		return f
+	}
+	return "text"
+}
+
+// loadArtifact loads the lists of a generated file into a new container
+func loadArtifact(path, format string, wantedList []string) (lib.Container, error) {
+	args := map[string]any{}
+	if len(wantedList) > 0 {
+		args["wantedList"] = wantedList
+	}
+
+	converter, err := newArtifactInput(path, format, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return converter.Input(lib.NewContainer())
+}
+
+// newArtifactInput creates an input converter of the format loading a file with args.
+// The format is detected by the file extension if not specified, a directory or
+// a file with unknown extension is loaded as plaintext, whose list is named after
+// the file if the name is not in args.
+func newArtifactInput(path, format string, args map[string]any) (lib.InputConverter, error) {
+	isDir := false
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		isDir = true
+	}
+
+	format = artifactFormat(path, format, isDir)
+
+	switch {
+	case format != "text":
+		args["uri"] = path
+	case isDir:
+		args["inputDir"] = path
+	default:
+		args["uri"] = path
+		if _, found := args["name"]; !found {
+			args["name"] = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	converter, err := lib.NewInputConverter(format, lib.ActionAdd, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s as %s: %w", path, format, err)
+	}
+
+	return converter, nil
+}
+
+// entryIPSet returns the set of both IPv4 and IPv6 addresses of the entry
+func entryIPSet(entry *lib.Entry) (*netipx.IPSet, error) {
+	var builder netipx.IPSetBuilder
+	// An entry without addresses of an IP type has no set of it
+	if ipv4set, err := entry.GetIPv4Set(); err == nil {
+		builder.AddSet(ipv4set)
+	}
+	if ipv6set, err := entry.GetIPv6Set(); err == nil {
+		builder.AddSet(ipv6set)
+	}
+	return builder.IPSet()
+}
+
+// splitList splits a comma separated flag value
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "convert",
+		usage:       "[flags] -to <output format> -in <file>",
+		description: "Convert a file to another format without a config file",
+		run:         runConvert,
+	})
+}
+
+func runConvert(args []string) error {
+	cmd := commands["convert"]
+	fs := cmd.newFlagSet()
+	from := fs.String("from", "", "Input format, detected by file extension of -in if not specified")
+	to := fs.String("to", "", "Output format (required)")
+	in := fs.String("in", "", "Path or URL of the file or directory to convert (required)")
+	name := fs.String("name", "", "Name of the list of a plaintext file, the file name by default")
+	out := fs.String("out", "", "Output directory, the default one of the output format if not specified")
+	inArgs := fs.String("inargs", "", "Other args of the input format in JSON")
+	outArgs := fs.String("outargs", "", "Other args of the output format in JSON")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	if *to == "" || *in == "" {
+		fs.Usage()
+		return errors.New("-to and -in must be specified")
+	}
+
+	inputArgs, err := parseArgsFlag("inargs", *inArgs)
+	if err != nil {
+		return err
+	}
+	if *name != "" {
+		inputArgs["name"] = *name
+	}
+	input, err := newArtifactInput(*in, *from, inputArgs)
+	if err != nil {
+		return err
+	}
+
+	outputArgs, err := parseArgsFlag("outargs", *outArgs)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		outputArgs["outputDir"] = *out
+	}
+	data, err := json.Marshal(outputArgs)
+	if err != nil {
+		return err
+	}
+	output, err := lib.NewOutputConverter(*to, data)
+	if err != nil {
+		return fmt.Errorf("failed to create output format %s: %w", *to, err)
+	}
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return err
+	}
+	instance.AddInput(input)
+	instance.AddOutput(output)
+
+	return instance.Run()
+}
+
+// parseArgsFlag parses a flag value of args in JSON
+func parseArgsFlag(flagName, value string) (map[string]any, error) {
+	args := make(map[string]any)
+	if value == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(value), &args); err != nil {
+		return nil, fmt.Errorf("invalid -%s: %w", flagName, err)
+	}
+	return args, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	diffStatusAdded   = "added"
+	diffStatusRemoved = "removed"
+	diffStatusChanged = "changed"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "diff",
+		usage:       "[flags] <old file> <new file>",
+		description: "Compare lists of two generated files and report added and removed CIDRs",
+		run:         runDiff,
+	})
+}
+
+// listDiff is the difference of a list between two files
+type listDiff struct {
+	Name         string   `json:"name"`
+	Status       string   `json:"status"`
+	AddedCount   int      `json:"addedCount"`
+	RemovedCount int      `json:"removedCount"`
+	Added        []string `json:"added,omitempty"`
+	Removed      []string `json:"removed,omitempty"`
+}
+
+func runDiff(args []string) error {
+	cmd := commands["diff"]
+	fs := cmd.newFlagSet()
+	oldFormat := fs.String("oldformat", "", "Input format of the old file, detected by file extension if not specified")
+	newFormat := fs.String("newformat", "", "Input format of the new file, detected by file extension if not specified")
+	wantedList := fs.String("list", "", "Comma separated lists to compare, all lists by default")
+	jsonOutput := fs.Bool("json", false, "Print the differences in JSON")
+	summary := fs.Bool("summary", false, "Only print the number of added and removed CIDRs of every list")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("old file and new file must be specified")
+	}
+
+	want := splitList(*wantedList)
+	oldContainer, err := loadArtifact(fs.Arg(0), *oldFormat, want)
+	if err != nil {
+		return err
+	}
+	newContainer, err := loadArtifact(fs.Arg(1), *newFormat, want)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := diffContainers(oldContainer, newContainer)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		if *summary {
+			for _, d := range diffs {
+				d.Added, d.Removed = nil, nil
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	}
+
+	printDiffs(os.Stdout, diffs, *summary)
+	return nil
+}
+
+// diffContainers returns the differences of lists changed, sorted by name
+func diffContainers(oldContainer, newContainer lib.Container) ([]*listDiff, error) {
+	names := make(map[string]bool)
+	for entry := range oldContainer.Loop() {
+		names[entry.GetName()] = true
+	}
+	for entry := range newContainer.Loop() {
+		names[entry.GetName()] = true
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	slices.Sort(sortedNames)
+
+	diffs := make([]*listDiff, 0)
+	for _, name := range sortedNames {
+		oldSet, oldFound, err := containerIPSet(oldContainer, name)
+		if err != nil {
+			return nil, err
+		}
+		newSet, newFound, err := containerIPSet(newContainer, name)
+		if err != nil {
+			return nil, err
+		}
+
+		added, err := subtractIPSet(newSet, oldSet)
+		if err != nil {
+			return nil, err
+		}
+		removed, err := subtractIPSet(oldSet, newSet)
+		if err != nil {
+			return nil, err
+		}
+
+		d := &listDiff{
+			Name:         name,
+			Status:       diffStatusChanged,
+			AddedCount:   len(added),
+			RemovedCount: len(removed),
+			Added:        prefixStrings(added),
+			Removed:      prefixStrings(removed),
+		}
+		switch {
+		case !oldFound:
+			d.Status = diffStatusAdded
+		case !newFound:
+			d.Status = diffStatusRemoved
+		case d.AddedCount == 0 && d.RemovedCount == 0:
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+
+	return diffs, nil
+}
+
+func containerIPSet(container lib.Container, name string) (*netipx.IPSet, bool, error) {
+	entry, found := container.GetEntry(name)
+	if !found {
+		return new(netipx.IPSet), false, nil
+	}
+	set, err := entryIPSet(entry)
+	return set, true, err
+}
+
+// subtractIPSet returns the prefixes of a - b
+func subtractIPSet(a, b *netipx.IPSet) ([]netip.Prefix, error) {
+	var builder netipx.IPSetBuilder
+	builder.AddSet(a)
+	builder.RemoveSet(b)
+	set, err := builder.IPSet()
+	if err != nil {
+		return nil, err
+	}
+	return set.Prefixes(), nil
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	list := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		list = append(list, prefix.String())
+	}
+	return list
+}
+
+func printDiffs(w io.Writer, diffs []*listDiff, summary bool) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No difference")
+		return
+	}
+
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s (%s): +%d -%d\n", strings.ToLower(d.Name), d.Status, d.AddedCount, d.RemovedCount)
+		if summary {
+			continue
+		}
+		for _, cidr := range d.Added {
+			fmt.Fprintf(w, "+ %s\n", cidr)
+		}
+		for _, cidr := range d.Removed {
+			fmt.Fprintf(w, "- %s\n", cidr)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "export",
+		usage:       "[flags] <file> [list]...",
+		description: "Print CIDRs of lists in a generated file, or names of all lists if no list is specified",
+		run:         runExport,
+	})
+}
+
+func runExport(args []string) error {
+	cmd := commands["export"]
+	fs := cmd.newFlagSet()
+	format := fs.String("format", "", "Input format of the file, detected by file extension if not specified")
+	onlyIPType := fs.String("onlyiptype", "", "The IP address type to be printed, the value is ipv4 or ipv6")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("file must be specified")
+	}
+
+	ipType := lib.IPType(strings.ToLower(*onlyIPType))
+	switch ipType {
+	case "", lib.IPv4, lib.IPv6:
+	default:
+		return fmt.Errorf("invalid onlyiptype %s, the value must be ipv4 or ipv6", *onlyIPType)
+	}
+
+	lists := fs.Args()[1:]
+	container, err := loadArtifact(fs.Arg(0), *format, lists)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	if len(lists) == 0 {
+		names := make([]string, 0, container.Len())
+		for entry := range container.Loop() {
+			names = append(names, strings.ToLower(entry.GetName()))
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+		return nil
+	}
+
+	// CIDRs of all the lists are merged
+	var builder netipx.IPSetBuilder
+	for _, name := range lists {
+		entry, found := container.GetEntry(name)
+		if !found {
+			return fmt.Errorf("list %s not found in %s", name, fs.Arg(0))
+		}
+		if ipType != lib.IPv6 {
+			if set, err := entry.GetIPv4Set(); err == nil {
+				builder.AddSet(set)
+			}
+		}
+		if ipType != lib.IPv4 {
+			if set, err := entry.GetIPv6Set(); err == nil {
+				builder.AddSet(set)
+			}
+		}
+	}
+
+	set, err := builder.IPSet()
+	if err != nil {
+		return err
+	}
+	for _, prefix := range set.Prefixes() {
+		fmt.Fprintln(w, prefix.String())
+	}
+
+	return nil
+}
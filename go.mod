@@ -5,11 +5,21 @@ go 1.23
 toolchain go1.23.2
 
 require (
-	github.com/oschwald/geoip2-golang v1.11.0
+	github.com/BurntSushi/toml v1.2.1
 	github.com/oschwald/maxminddb-golang v1.13.1
 	github.com/tailscale/hujson v0.0.0-20241010212012-29efb4a0184b
+	github.com/tetratelabs/wazero v1.9.0
+	github.com/ulikunitz/xz v0.5.17
 	go4.org/netipx v0.0.0-20231129151722-fdeea329fbba
+	golang.org/x/crypto v0.31.0
+	google.golang.org/grpc v1.67.1
 	google.golang.org/protobuf v1.35.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.21.0 // indirect
+require (
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
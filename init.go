@@ -1,8 +1,31 @@
 package main
 
 import (
+	_ "github.com/v2fly/geoip/plugin/artifact"
+	_ "github.com/v2fly/geoip/plugin/aws"
+	_ "github.com/v2fly/geoip/plugin/azure"
+	_ "github.com/v2fly/geoip/plugin/clash"
+	_ "github.com/v2fly/geoip/plugin/cloudflare"
+	_ "github.com/v2fly/geoip/plugin/crowdsec"
+	_ "github.com/v2fly/geoip/plugin/exec"
+	_ "github.com/v2fly/geoip/plugin/gcp"
+	_ "github.com/v2fly/geoip/plugin/geojson"
+	_ "github.com/v2fly/geoip/plugin/github"
+	_ "github.com/v2fly/geoip/plugin/keenetic"
+	_ "github.com/v2fly/geoip/plugin/kubernetes"
 	_ "github.com/v2fly/geoip/plugin/maxmind"
+	_ "github.com/v2fly/geoip/plugin/mirror"
+	_ "github.com/v2fly/geoip/plugin/openwrt"
+	_ "github.com/v2fly/geoip/plugin/paloalto"
+	_ "github.com/v2fly/geoip/plugin/pfsense"
 	_ "github.com/v2fly/geoip/plugin/plaintext"
+	_ "github.com/v2fly/geoip/plugin/prometheus"
+	_ "github.com/v2fly/geoip/plugin/records"
+	_ "github.com/v2fly/geoip/plugin/singbox"
 	_ "github.com/v2fly/geoip/plugin/special"
+	_ "github.com/v2fly/geoip/plugin/suricata"
+	_ "github.com/v2fly/geoip/plugin/terraform"
 	_ "github.com/v2fly/geoip/plugin/v2ray"
+	_ "github.com/v2fly/geoip/plugin/wireguard"
+	_ "github.com/v2fly/geoip/plugin/zeek"
 )
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TagASN is the tag of lists of autonomous systems added by ASN-aware inputs,
+// so that outputs could output country and ASN lists separately with tags
+const TagASN = "asn"
+
+// ASNName returns the name of the list of the autonomous system, like AS13335
+func ASNName(asn uint32) string {
+	return "AS" + strconv.FormatUint(uint64(asn), 10)
+}
+
+// ParseASN returns the number of the autonomous system of the list name, like
+// AS13335 in any case, or false if the name is not of an autonomous system.
+// Two letter names like AS, the country code of American Samoa, are not.
+func ParseASN(name string) (uint32, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	digits, found := strings.CutPrefix(name, "AS")
+	if !found || digits == "" || digits[0] == '+' || (len(digits) > 1 && digits[0] == '0') {
+		return 0, false
+	}
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(asn), true
+}
+
+// NormalizeASNName returns the name of the list of the autonomous system written
+// as a number like 13335, or a name like AS13335 in any case
+func NormalizeASNName(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if asn, ok := ParseASN(s); ok {
+		return ASNName(asn), nil
+	}
+	if asn, ok := ParseASN("AS" + s); ok {
+		return ASNName(asn), nil
+	}
+	return "", fmt.Errorf("invalid ASN %s", s)
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Version is the version of geoip, set at link time by
+// -ldflags "-X github.com/v2fly/geoip/lib.Version=v1.2.3", or the version of
+// the main module in the build info of the binary otherwise
+var Version string
+
+// ToolVersion returns the version of geoip, (devel) if unknown
+func ToolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// BuildInfo is the metadata of a build embedded in generated files of formats
+// supporting it, so that consumers could tell which build they are running
+type BuildInfo struct {
+	Tool      string    `json:"tool"`
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit,omitempty"`
+	BuildTime time.Time `json:"buildTime"`
+	// Manifest is the SHA-256 of the names, tags, prefixes and metadata of all
+	// lists loaded by inputs, which is the same for builds of the same data
+	Manifest string `json:"manifest"`
+}
+
+// buildInfoCommentPrefix is the prefix of build info in comments of text formats
+const buildInfoCommentPrefix = "geoip-build-info: "
+
+// NewBuildInfo returns the build info of the lists in the container, built at
+// BuildTime, which is SOURCE_DATE_EPOCH if set
+func NewBuildInfo(container Container) *BuildInfo {
+	info := &BuildInfo{
+		Tool:      "geoip",
+		Version:   ToolVersion(),
+		BuildTime: BuildTime().UTC(),
+		Manifest:  listsFingerprint(container),
+	}
+	// The commit is optional, it's unknown outside of git repositories and CI
+	if commit, err := gitCommit(); err == nil {
+		info.Commit = commit
+	}
+	return info
+}
+
+// Comment returns the build info as the text of a comment line, without the comment marker
+func (b *BuildInfo) Comment() string {
+	data, _ := json.Marshal(b)
+	return buildInfoCommentPrefix + string(data)
+}
+
+// ParseBuildInfoComment returns the build info in a comment line written by Comment,
+// whose comment marker like # or // is ignored
+func ParseBuildInfoComment(line string) (*BuildInfo, bool) {
+	line = strings.TrimLeft(strings.TrimSpace(line), "#/; ")
+	data, found := strings.CutPrefix(line, buildInfoCommentPrefix)
+	if !found {
+		return nil, false
+	}
+	info := new(BuildInfo)
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		return nil, false
+	}
+	return info, true
+}
+
+// BuildInfoReader returns the build info embedded in the content of a file, nil if none
+type BuildInfoReader func(data []byte) (*BuildInfo, error)
+
+var buildInfoReaders = make(map[string]BuildInfoReader)
+
+// RegisterBuildInfoReader registers the reader of build info embedded in files
+// of a format, which is not a comment line written by BuildInfo.Comment
+func RegisterBuildInfoReader(format string, reader BuildInfoReader) error {
+	format = strings.TrimSpace(format)
+	if _, ok := buildInfoReaders[format]; ok {
+		return ErrDuplicatedConverter
+	}
+	buildInfoReaders[format] = reader
+	return nil
+}
+
+// ReadBuildInfo returns the build info embedded in the content of a file of the
+// format, nil if none. Files of formats without registered readers are searched
+// for a comment line of build info in the comments at the beginning of them.
+func ReadBuildInfo(format string, data []byte) (*BuildInfo, error) {
+	if reader, found := buildInfoReaders[strings.TrimSpace(format)]; found {
+		return reader(data)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if info, found := ParseBuildInfoComment(line); found {
+			return info, nil
+		}
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, ";") {
+			break
+		}
+	}
+	return nil, scanner.Err()
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceDateEpoch returns the time set by the SOURCE_DATE_EPOCH environment variable
+// for reproducible builds, or nil if not set.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+func SourceDateEpoch() (*time.Time, error) {
+	value := strings.TrimSpace(os.Getenv("SOURCE_DATE_EPOCH"))
+	if value == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH %s, must be a UNIX timestamp", value)
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t, nil
+}
+
+// BuildTime returns the time to be embedded in generated files,
+// which is SOURCE_DATE_EPOCH if set, otherwise the current time
+func BuildTime() time.Time {
+	if t, err := SourceDateEpoch(); err == nil && t != nil {
+		return *t
+	}
+	return time.Now()
+}
+
+// ClampModTime returns the modification time of a file to be embedded in generated
+// files like archives, which is not later than SOURCE_DATE_EPOCH if set
+func ClampModTime(modTime time.Time) time.Time {
+	if t, err := SourceDateEpoch(); err == nil && t != nil && modTime.After(*t) {
+		return *t
+	}
+	return modTime
+}
@@ -1,34 +1,94 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"net/http"
+	"strings"
+	"unicode"
 )
 
 func GetRemoteURLContent(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+	return GetRemoteURLContentContext(context.Background(), url)
+}
+
+// GetRemoteURLContentContext downloads the content of the URL, which is canceled when the context is done
+func GetRemoteURLContentContext(ctx context.Context, url string) ([]byte, error) {
+	body, err := GetRemoteURLReaderContext(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status)
-	}
+	defer body.Close()
 
-	return io.ReadAll(resp.Body)
+	return io.ReadAll(body)
 }
 
 func GetRemoteURLReader(url string) (io.ReadCloser, error) {
-	resp, err := http.Get(url)
+	return GetRemoteURLReaderContext(context.Background(), url)
+}
+
+// GetRemoteURLReaderContext returns the body of the URL, which is canceled when the context is done
+func GetRemoteURLReaderContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	body, err := download(ctx, url)
 	if err != nil {
-		return nil, err
+		return nil, withErrorKind(ErrorKindDownload, err)
+	}
+	return recordRemoteSource(url, body), nil
+}
+
+// SplitLines splits lines into chunks, every chunk has at most maxLines lines
+// and takes at most maxBytes bytes when written with a trailing newline per line.
+// Zero maxLines or maxBytes means no limit.
+func SplitLines(lines []string, maxLines, maxBytes int) ([][]string, error) {
+	chunks := make([][]string, 0, 1)
+	start, size := 0, 0
+	for i, line := range lines {
+		lineSize := len(line) + 1
+		if maxBytes > 0 && lineSize > maxBytes {
+			return nil, fmt.Errorf("line %q exceeds the size limit of %d bytes", line, maxBytes)
+		}
+
+		if (maxLines > 0 && i-start >= maxLines) || (maxBytes > 0 && size+lineSize > maxBytes) {
+			chunks = append(chunks, lines[start:i])
+			start, size = i, 0
+		}
+		size += lineSize
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get remote content -> %s: %s", url, resp.Status)
+	if start < len(lines) || len(chunks) == 0 {
+		chunks = append(chunks, lines[start:])
 	}
 
-	return resp.Body, nil
+	return chunks, nil
+}
+
+// QuoteHCL returns the string as a quoted string of HCL, the language of Terraform.
+// Template sequences are escaped as $${ and %%{, so that the string is read as is.
+func QuoteHCL(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		case !unicode.IsPrint(r) && r <= 0xFFFF:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\U%08X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// parseComposites normalizes the composite lists defined by the config file,
+// and sorts their names in the order they could be materialized, since a
+// composite list could be built from other composite lists.
+func parseComposites(composites map[string][]string) (map[string][]string, []string, error) {
+	normalized := make(map[string][]string, len(composites))
+	for name, members := range composites {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			return nil, nil, fmt.Errorf("name of composite list must not be empty")
+		}
+		if _, found := normalized[name]; found {
+			return nil, nil, fmt.Errorf("composite list %s is defined more than once", name)
+		}
+
+		list := make([]string, 0, len(members))
+		for _, member := range members {
+			if IsListMacro(member) {
+				if _, err := ExpandListMacro(member); err != nil {
+					return nil, nil, fmt.Errorf("%v in composite list %s", err, name)
+				}
+			}
+			if member = strings.ToUpper(strings.TrimSpace(member)); member != "" && !slices.Contains(list, member) {
+				list = append(list, member)
+			}
+		}
+		if len(list) == 0 {
+			return nil, nil, fmt.Errorf("composite list %s must be built from other lists", name)
+		}
+		normalized[name] = list
+	}
+
+	names := make([]string, 0, len(normalized))
+	for name := range normalized {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	order := make([]string, 0, len(names))
+	state := make(map[string]int) // 1: visiting, 2: visited
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("composite list %s is built from itself", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, member := range normalized[name] {
+			if _, found := normalized[member]; found {
+				if err := visit(member); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return normalized, order, nil
+}
+
+// materializeComposites adds the union of the member lists to every composite list.
+// Macros of members are expanded to the lists of their country codes which exist.
+func materializeComposites(container Container, composites map[string][]string, order []string) error {
+	for _, name := range order {
+		for _, member := range expandCompositeMembers(container, composites[name]) {
+			entry, found := container.GetEntry(member)
+			if !found {
+				slog.Warn("entry of composite list not found", "entry", member, "composite", name)
+				continue
+			}
+			copied, err := entry.Copy(name)
+			if err != nil {
+				return err
+			}
+			if err := container.Add(copied); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandCompositeMembers expands macros of the members to the names of lists in the container
+func expandCompositeMembers(container Container, members []string) []string {
+	expanded := make([]string, 0, len(members))
+	for _, member := range members {
+		if !IsListMacro(member) {
+			expanded = append(expanded, member)
+			continue
+		}
+		// Macros have been validated when the config is parsed
+		codes, _ := ExpandListMacro(member)
+		for _, code := range codes {
+			if _, found := container.GetEntry(code); found && !slices.Contains(expanded, code) {
+				expanded = append(expanded, code)
+			}
+		}
+	}
+	return expanded
+}
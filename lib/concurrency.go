@@ -0,0 +1,66 @@
+package lib
+
+import "context"
+
+// loadResult is the container loaded by an input run on an empty container
+type loadResult struct {
+	container Container
+	err       error
+}
+
+// SetConcurrency sets the max number of inputs run concurrently, 1 by default
+func (i *instance) SetConcurrency(concurrency int) {
+	i.concurrency = concurrency
+}
+
+// isConcurrentInput reports whether the input could be run on an empty container
+// regardless of the inputs before it
+func isConcurrentInput(ic InputConverter) bool {
+	source, ok := ic.(SourceInputConverter)
+	return ok && source.IsSourceInput() && ic.GetAction() == ActionAdd
+}
+
+// loadInputs starts to run the inputs which could be run concurrently on empty
+// containers, bounded by concurrency. The results are sent to the channels with
+// the same indexes as the inputs, or the channels are nil if the inputs are not
+// run concurrently.
+func (i *instance) loadInputs(ctx context.Context) []chan *loadResult {
+	results := make([]chan *loadResult, len(i.input))
+	if i.concurrency <= 1 {
+		return results
+	}
+
+	for idx, ic := range i.input {
+		if isConcurrentInput(ic) {
+			results[idx] = make(chan *loadResult, 1)
+		}
+	}
+
+	// Inputs are started in order, so that the earlier ones are merged first
+	go func() {
+		sem := make(chan struct{}, i.concurrency)
+		for idx, ic := range i.input {
+			if results[idx] == nil {
+				continue
+			}
+			// Not started if canceled, even if the semaphore is also ready
+			if err := ctx.Err(); err != nil {
+				results[idx] <- &loadResult{err: err}
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[idx] <- &loadResult{err: ctx.Err()}
+				continue
+			}
+			go func(ic InputConverter, result chan<- *loadResult) {
+				defer func() { <-sem }()
+				container, err := runInput(ctx, ic, NewContainer())
+				result <- &loadResult{container: container, err: err}
+			}(ic, results[idx])
+		}
+	}()
+
+	return results
+}
@@ -0,0 +1,396 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// profile is the name of the build profile, which conditions of inputs and outputs could check
+var profile string
+
+// SetProfile sets the name of the build profile, like nightly or hourly
+func SetProfile(name string) {
+	profile = strings.TrimSpace(name)
+}
+
+// Profile returns the name of the build profile
+func Profile() string {
+	return profile
+}
+
+// condition is the expression of the "enabled" arg of an input or output, evaluated
+// before every run, so that one config file could serve several kinds of builds, like
+//
+//	env.FULL_BUILD && weekday in ("saturday", "sunday") || profile == "nightly"
+//
+// The "profiles" arg is the same as the expression profile in ("full", "lite").
+type condition struct {
+	expr     string
+	root     conditionNode
+	profiles []string // profiles of the "profiles" arg, which must be defined by the config file
+}
+
+// conditionEnv has the values identifiers of conditions are evaluated to
+type conditionEnv struct {
+	profile string
+	weekday string // lowercase English name in local time, like monday
+	hour    string // 0 to 23 in local time
+	getenv  func(string) string
+}
+
+// currentConditionEnv returns the values of identifiers now, where the profile is the
+// default one if not set
+func currentConditionEnv(defaultProfile string) *conditionEnv {
+	// In local time, the same as schedules of the serve command
+	now := BuildTime()
+	p := profile
+	if p == "" {
+		p = defaultProfile
+	}
+	return &conditionEnv{
+		profile: p,
+		weekday: strings.ToLower(now.Weekday().String()),
+		hour:    strconv.Itoa(now.Hour()),
+		getenv:  os.Getenv,
+	}
+}
+
+// parseCondition parses the "enabled" and "profiles" args of an input or output,
+// or returns nil if not set
+func parseCondition(args json.RawMessage) (*condition, error) {
+	var tmp struct {
+		Enabled  *string  `json:"enabled"`
+		Profiles []string `json:"profiles"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &tmp); err != nil {
+			return nil, err
+		}
+	}
+	if tmp.Enabled == nil && tmp.Profiles == nil {
+		return nil, nil
+	}
+
+	c := new(condition)
+	if tmp.Profiles != nil {
+		if len(tmp.Profiles) == 0 {
+			return nil, fmt.Errorf("profiles must not be empty")
+		}
+		in := &conditionCompare{left: conditionOperand{text: "profile"}, op: "in"}
+		quoted := make([]string, 0, len(tmp.Profiles))
+		for _, name := range tmp.Profiles {
+			name = strings.TrimSpace(name)
+			c.profiles = append(c.profiles, name)
+			in.right = append(in.right, conditionOperand{literal: true, text: name})
+			quoted = append(quoted, "'"+name+"'")
+		}
+		c.expr, c.root = fmt.Sprintf("profile in (%s)", strings.Join(quoted, ", ")), in
+	}
+	if tmp.Enabled == nil {
+		return c, nil
+	}
+
+	expr := strings.TrimSpace(*tmp.Enabled)
+	p := &conditionParser{tokens: tokenizeCondition(expr)}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid enabled expression %q: %w", expr, err)
+	}
+	if c.root != nil {
+		c.expr, c.root = fmt.Sprintf("%s && (%s)", c.expr, expr), &conditionAnd{c.root, root}
+	} else {
+		c.expr, c.root = expr, root
+	}
+	return c, nil
+}
+
+// enabled reports whether the step is enabled, which is true if there is no condition
+func (c *condition) enabled(env *conditionEnv) bool {
+	return c == nil || c.root.eval(env)
+}
+
+func (c *condition) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.expr
+}
+
+type conditionNode interface {
+	eval(env *conditionEnv) bool
+}
+
+type (
+	conditionOr      struct{ left, right conditionNode }
+	conditionAnd     struct{ left, right conditionNode }
+	conditionNot     struct{ node conditionNode }
+	conditionTruthy  struct{ operand conditionOperand }
+	conditionCompare struct {
+		left  conditionOperand
+		op    string // ==, != or in
+		right []conditionOperand
+	}
+)
+
+func (n *conditionOr) eval(env *conditionEnv) bool  { return n.left.eval(env) || n.right.eval(env) }
+func (n *conditionAnd) eval(env *conditionEnv) bool { return n.left.eval(env) && n.right.eval(env) }
+func (n *conditionNot) eval(env *conditionEnv) bool { return !n.node.eval(env) }
+
+// eval reports whether the value is not empty, 0, false, no or off
+func (n *conditionTruthy) eval(env *conditionEnv) bool {
+	switch strings.ToLower(n.operand.value(env)) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+func (n *conditionCompare) eval(env *conditionEnv) bool {
+	value := n.left.value(env)
+	found := slices.ContainsFunc(n.right, func(operand conditionOperand) bool {
+		return operand.value(env) == value
+	})
+	return found == (n.op != "!=")
+}
+
+// conditionOperand is a literal, or an identifier like env.NAME, profile, weekday or hour
+type conditionOperand struct {
+	literal bool
+	text    string
+}
+
+func (o conditionOperand) value(env *conditionEnv) string {
+	switch {
+	case o.literal:
+		return o.text
+	case o.text == "profile":
+		return env.profile
+	case o.text == "weekday":
+		return env.weekday
+	case o.text == "hour":
+		return env.hour
+	default:
+		return env.getenv(strings.TrimPrefix(o.text, "env."))
+	}
+}
+
+// tokenizeCondition splits the expression into operators, quoted strings and words,
+// where invalid characters are single tokens reported by the parser
+func tokenizeCondition(expr string) []string {
+	tokens := make([]string, 0)
+	for idx := 0; idx < len(expr); {
+		c := expr[idx]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			idx++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[idx+1:], c)
+			if end < 0 {
+				// Unterminated strings are reported by the parser
+				tokens = append(tokens, expr[idx:])
+				return tokens
+			}
+			tokens = append(tokens, expr[idx:idx+end+2])
+			idx += end + 2
+		case strings.HasPrefix(expr[idx:], "&&"), strings.HasPrefix(expr[idx:], "||"),
+			strings.HasPrefix(expr[idx:], "=="), strings.HasPrefix(expr[idx:], "!="):
+			tokens = append(tokens, expr[idx:idx+2])
+			idx += 2
+		case isConditionWordChar(c):
+			end := idx
+			for end < len(expr) && isConditionWordChar(expr[end]) {
+				end++
+			}
+			tokens = append(tokens, expr[idx:end])
+			idx = end
+		default:
+			tokens = append(tokens, expr[idx:idx+1])
+			idx++
+		}
+	}
+	return tokens
+}
+
+func isConditionWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// conditionParser parses expressions by precedence, from low to high:
+// ||, &&, !, then comparisons with ==, != and in
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right conditionNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &conditionOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right conditionNode
+		if right, err = p.parseUnary(); err == nil {
+			left = &conditionAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionNot{node}, nil
+	case "(":
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token != ")" {
+			return nil, fmt.Errorf("expected ) instead of %s", describeToken(token))
+		}
+		return node, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionCompare{left, op, []conditionOperand{right}}, nil
+	case "in":
+		p.next()
+		if token := p.next(); token != "(" {
+			return nil, fmt.Errorf("expected ( after in instead of %s", describeToken(token))
+		}
+		right := make([]conditionOperand, 0)
+		for {
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			right = append(right, operand)
+			if token := p.next(); token == ")" {
+				break
+			} else if token != "," {
+				return nil, fmt.Errorf("expected , or ) instead of %s", describeToken(token))
+			}
+		}
+		return &conditionCompare{left, op, right}, nil
+	}
+	return &conditionTruthy{left}, nil
+}
+
+func (p *conditionParser) parseOperand() (conditionOperand, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return conditionOperand{}, fmt.Errorf("unexpected end")
+	case token[0] == '"' || token[0] == '\'':
+		if len(token) < 2 || token[len(token)-1] != token[0] {
+			return conditionOperand{}, fmt.Errorf("unterminated string %s", token)
+		}
+		return conditionOperand{literal: true, text: token[1 : len(token)-1]}, nil
+	case token == "true", token == "false":
+		return conditionOperand{literal: true, text: token}, nil
+	case token == "profile", token == "weekday", token == "hour":
+		return conditionOperand{text: token}, nil
+	case strings.HasPrefix(token, "env.") && len(token) > len("env."):
+		return conditionOperand{text: token}, nil
+	}
+	if _, err := strconv.Atoi(token); err == nil {
+		return conditionOperand{literal: true, text: token}, nil
+	}
+	return conditionOperand{}, fmt.Errorf("unknown %s, must be env.NAME, profile, weekday, hour, a quoted string, a number, true or false", describeToken(token))
+}
+
+func describeToken(token string) string {
+	if token == "" {
+		return "end"
+	}
+	return token
+}
+
+// selectSteps keeps only the inputs and outputs enabled by their conditions for a run,
+// and returns the function restoring all of them after the run, and whether all inputs
+// or all outputs defined are disabled
+func (i *instance) selectSteps() (restore func(), allDisabled bool, err error) {
+	if err := i.validateProfiles(); err != nil {
+		return func() {}, false, err
+	}
+
+	input, inputPriorities, inputTags, inputConditions := i.input, i.inputPriorities, i.inputTags, i.inputConditions
+	output, outputOptions, outputConditions := i.output, i.outputOptions, i.outputConditions
+	restore = func() {
+		i.input, i.inputPriorities, i.inputTags, i.inputConditions = input, inputPriorities, inputTags, inputConditions
+		i.output, i.outputOptions, i.outputConditions = output, outputOptions, outputConditions
+	}
+
+	env := currentConditionEnv(i.defaultProfile())
+	i.input, i.inputPriorities, i.inputTags, i.inputConditions = nil, nil, nil, nil
+	for idx, ic := range input {
+		if !inputConditions[idx].enabled(env) {
+			slog.Info("input disabled", "index", idx, "plugin", ic.GetType(), "enabled", inputConditions[idx].String())
+			continue
+		}
+		i.input = append(i.input, ic)
+		i.inputPriorities = append(i.inputPriorities, inputPriorities[idx])
+		i.inputTags = append(i.inputTags, inputTags[idx])
+		i.inputConditions = append(i.inputConditions, inputConditions[idx])
+	}
+	i.output, i.outputOptions, i.outputConditions = nil, nil, nil
+	for idx, oc := range output {
+		if !outputConditions[idx].enabled(env) {
+			slog.Info("output disabled", "index", idx, "plugin", oc.GetType(), "enabled", outputConditions[idx].String())
+			continue
+		}
+		i.output = append(i.output, oc)
+		i.outputOptions = append(i.outputOptions, outputOptions[idx])
+		i.outputConditions = append(i.outputConditions, outputConditions[idx])
+	}
+
+	allDisabled = (len(input) > 0 && len(i.input) == 0) || (len(output) > 0 && len(i.output) == 0)
+	return restore, allDisabled, nil
+}
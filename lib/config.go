@@ -31,9 +31,28 @@ func createInputConfig(id string, action Action, data json.RawMessage) (InputCon
 	if !found {
 		return nil, errors.New("unknown config type")
 	}
+	if action == ActionReplace {
+		ic, err := fn(ActionAdd, data)
+		if err != nil {
+			return nil, err
+		}
+		return newReplaceInput(ic), nil
+	}
 	return fn(action, data)
 }
 
+// NewInputConverter creates an input converter of the type with args,
+// the same as an input defined in the config file
+func NewInputConverter(iType string, action Action, args json.RawMessage) (InputConverter, error) {
+	if !ActionsRegistry[action] {
+		return nil, fmt.Errorf("invalid action %s in type %s", action, iType)
+	}
+	if err := registerSourceOptions(args); err != nil {
+		return nil, err
+	}
+	return createInputConfig(iType, action, args)
+}
+
 func RegisterOutputConfigCreator(id string, fn outputConfigCreator) error {
 	id = strings.ToLower(id)
 	if _, found := outputConfigCreatorCache[id]; found {
@@ -49,18 +68,50 @@ func createOutputConfig(id string, action Action, data json.RawMessage) (OutputC
 	if !found {
 		return nil, errors.New("unknown config type")
 	}
+	if err := validateListFilters(data); err != nil {
+		return nil, err
+	}
+	if err := validateOutputTemplates(data); err != nil {
+		return nil, err
+	}
 	return fn(action, data)
 }
 
+// NewOutputConverter creates an output converter of the type with args,
+// the same as an output defined in the config file
+func NewOutputConverter(iType string, args json.RawMessage) (OutputConverter, error) {
+	return createOutputConfig(iType, ActionOutput, args)
+}
+
 type config struct {
-	Input  []*inputConvConfig  `json:"input"`
-	Output []*outputConvConfig `json:"output"`
+	Schema        string                     `json:"$schema"` // only used by editors
+	Include       []string                   `json:"include"`
+	Vars          map[string]string          `json:"vars"`
+	Plugins       map[string]string          `json:"plugins"`
+	Download      *DownloadOptions           `json:"download"`
+	Options       *OutputOptions             `json:"options"`
+	Composites    map[string][]string        `json:"composites"`
+	Routes        map[string]*RouteOptions   `json:"routes"`
+	Profiles      map[string]*ProfileOptions `json:"profiles"`
+	WantedList    []string                   `json:"wantedList"`
+	ExcludedList  []string                   `json:"excludedList"`
+	CountryCodes  *CountryCodeOptions        `json:"countryCodes"`
+	EmbeddedIPv4  *EmbeddedIPv4Options       `json:"embeddedIPv4"`
+	Overlaps      *OverlapOptions            `json:"overlaps"`
+	ShrinkGuard   *ShrinkGuardOptions        `json:"shrinkGuard"`
+	Notifications *NotificationOptions       `json:"notifications"`
+	Metrics       *MetricsOptions            `json:"metrics"`
+	Input         []*inputConvConfig         `json:"input"`
+	Output        []*outputConvConfig        `json:"output"`
 }
 
 type inputConvConfig struct {
 	iType     string
 	action    Action
 	converter InputConverter
+	priority  *int
+	tags      []string
+	condition *condition
 }
 
 func (i *inputConvConfig) UnmarshalJSON(data []byte) error {
@@ -83,9 +134,31 @@ func (i *inputConvConfig) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	priority, err := parseInputPriority(temp.Action, temp.Args)
+	if err != nil {
+		return err
+	}
+
+	tags, err := parseInputTags(temp.Action, temp.Args)
+	if err != nil {
+		return err
+	}
+
+	condition, err := parseCondition(temp.Args)
+	if err != nil {
+		return err
+	}
+
+	if err := registerSourceOptions(temp.Args); err != nil {
+		return err
+	}
+
 	i.iType = config.GetType()
 	i.action = config.GetAction()
 	i.converter = config
+	i.priority = priority
+	i.tags = tags
+	i.condition = condition
 
 	return nil
 }
@@ -94,6 +167,8 @@ type outputConvConfig struct {
 	iType     string
 	action    Action
 	converter OutputConverter
+	options   *OutputOptions
+	condition *condition
 }
 
 func (i *outputConvConfig) UnmarshalJSON(data []byte) error {
@@ -120,9 +195,21 @@ func (i *outputConvConfig) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	options, err := parseOutputOptions(temp.Args)
+	if err != nil {
+		return err
+	}
+
+	condition, err := parseCondition(temp.Args)
+	if err != nil {
+		return err
+	}
+
 	i.iType = config.GetType()
 	i.action = config.GetAction()
 	i.converter = config
+	i.options = options
+	i.condition = condition
 
 	return nil
 }
@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFormatJSON = "json"
+	configFormatYAML = "yaml"
+	configFormatTOML = "toml"
+)
+
+// configFormat detects the format of a config file by its extension,
+// JSON is the default one
+func configFormat(configFile string) string {
+	// Remove query of URL
+	configFile, _, _ = strings.Cut(configFile, "?")
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		return configFormatYAML
+	case ".toml":
+		return configFormatTOML
+	default:
+		return configFormatJSON
+	}
+}
+
+// convertConfigToJSON converts content of a YAML or TOML config file to JSON
+func convertConfigToJSON(content []byte, format string) ([]byte, error) {
+	var config map[string]any
+	switch format {
+	case configFormatYAML:
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("invalid YAML config: %w", err)
+		}
+	case configFormatTOML:
+		if err := toml.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("invalid TOML config: %w", err)
+		}
+	default:
+		return content, nil
+	}
+	return json.Marshal(config)
+}
@@ -2,21 +2,40 @@ package lib
 
 import (
 	"fmt"
+	"iter"
+	"slices"
 	"strings"
+	"sync"
 
 	"go4.org/netipx"
 )
 
+// Container is a set of entries by name, which is safe for concurrent use, so that
+// inputs could add to and remove from the same container concurrently. Entries in a
+// container are never changed by Add and Remove, which replace them with changed
+// copies, so entries got from a container could be read while it is changed. They
+// must not be changed while the container is used concurrently.
 type Container interface {
 	GetEntry(name string) (*Entry, bool)
 	Add(entry *Entry, opts ...IgnoreIPOption) error
 	Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error
 	Len() int
 	Loop() <-chan *Entry
+	// Entries returns an iterator over the entries in the order of names
+	Entries() iter.Seq[*Entry]
+	// Lookup returns the names of entries containing the whole IP address or CIDR,
+	// which could be the same types as Entry.AddPrefix, in the order of names
+	Lookup(cidr any) ([]string, error)
 }
 
 type container struct {
+	// mu guards entries, which are replaced instead of changed by Add and Remove
+	mu      sync.RWMutex
 	entries map[string]*Entry
+
+	// discardAdded discards the prefixes exactly as they are added to entries,
+	// when no output disables aggregation, to save memory
+	discardAdded bool
 }
 
 func NewContainer() Container {
@@ -25,11 +44,27 @@ func NewContainer() Container {
 	}
 }
 
+// newContainer returns a container which keeps the prefixes exactly as they
+// are added only if keepAdded is true
+func newContainer(keepAdded bool) Container {
+	return &container{
+		entries:      make(map[string]*Entry),
+		discardAdded: !keepAdded,
+	}
+}
+
 func (c *container) isValid() bool {
 	return c.entries != nil
 }
 
 func (c *container) GetEntry(name string) (*Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.getEntry(name)
+}
+
+// getEntry returns the entry of the name, with the lock held by the caller
+func (c *container) getEntry(name string) (*Entry, bool) {
 	if !c.isValid() {
 		return nil, false
 	}
@@ -41,23 +76,67 @@ func (c *container) GetEntry(name string) (*Entry, bool) {
 }
 
 func (c *container) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if !c.isValid() {
 		return 0
 	}
 	return len(c.entries)
 }
 
+// Loop returns the entries at the time it is called in the order of names, so that
+// the container could be changed while looping and iterations are stable
 func (c *container) Loop() <-chan *Entry {
 	ch := make(chan *Entry, c.Len())
-	go func() {
-		for _, val := range c.entries {
-			ch <- val
-		}
-		close(ch)
-	}()
+	for entry := range c.Entries() {
+		ch <- entry
+	}
+	close(ch)
 	return ch
 }
 
+// Entries returns the entries at the time it is called like Loop
+func (c *container) Entries() iter.Seq[*Entry] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	entries := make([]*Entry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, c.entries[name])
+	}
+	return slices.Values(entries)
+}
+
+func (c *container) Lookup(cidr any) ([]string, error) {
+	return lookupEntries(c.Entries(), cidr)
+}
+
+// lookupEntries returns the names of the entries containing the whole IP address or CIDR
+func lookupEntries(entries iter.Seq[*Entry], cidr any) ([]string, error) {
+	prefix, ipType, err := processPrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for entry := range entries {
+		found, err := entry.containsPrefix(prefix, ipType)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			names = append(names, entry.GetName())
+		}
+	}
+	return names, nil
+}
+
 func (c *container) Add(entry *Entry, opts ...IgnoreIPOption) error {
 	var ignoreIPType IPType
 	for _, opt := range opts {
@@ -66,53 +145,61 @@ func (c *container) Add(entry *Entry, opts ...IgnoreIPOption) error {
 		}
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	name := entry.GetName()
-	val, found := c.GetEntry(name)
+	val, found := c.getEntry(name)
 
 	switch found {
 	case true:
-		var ipv4set, ipv6set *netipx.IPSet
-		var err4, err6 error
-		if entry.hasIPv4Builder() {
-			ipv4set, err4 = entry.ipv4Builder.IPSet()
-			if err4 != nil {
-				return err4
-			}
-		}
-		if entry.hasIPv6Builder() {
-			ipv6set, err6 = entry.ipv6Builder.IPSet()
-			if err6 != nil {
-				return err6
+		// Entries in the container are never changed, but replaced by changed copies,
+		// as they could be read by others without the lock
+		merged := val.replacement()
+		merged.AddTag(entry.tags...)
+		merged.metadata = append(merged.metadata, entry.metadataOf(ignoreIPType)...)
+
+		for _, ipType := range []IPType{IPv4, IPv6} {
+			if ipType == ignoreIPType {
+				continue
 			}
-		}
-		switch ignoreIPType {
-		case IPv4:
-			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
+			src := entry.prefixSetOf(ipType, false)
+			if src == nil {
+				continue
 			}
-			val.ipv6Builder.AddSet(ipv6set)
-		case IPv6:
-			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+			set, err := src.ipSet()
+			if err != nil {
+				return err
 			}
-			val.ipv4Builder.AddSet(ipv4set)
-		default:
-			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
+			dst := merged.changedSetOf(ipType)
+			dst.addSet(set)
+			if !c.discardAdded {
+				dst.added = append(dst.added, src.added...)
 			}
-			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
-			}
-			val.ipv4Builder.AddSet(ipv4set)
-			val.ipv6Builder.AddSet(ipv6set)
 		}
+		if err := merged.compact(); err != nil {
+			return err
+		}
+		c.entries[name] = merged
 
 	case false:
+		entry.metadata = entry.metadataOf(ignoreIPType)
 		switch ignoreIPType {
 		case IPv4:
-			entry.ipv4Builder = nil
+			entry.ipv4 = nil
 		case IPv6:
-			entry.ipv6Builder = nil
+			entry.ipv6 = nil
+		}
+		if c.discardAdded {
+			for _, set := range []*prefixSet{entry.ipv4, entry.ipv6} {
+				if set != nil {
+					set.added = nil
+				}
+			}
+		}
+		// Entries are compacted when they are stored in the container
+		if err := entry.compact(); err != nil {
+			return err
 		}
 		c.entries[name] = entry
 	}
@@ -121,8 +208,11 @@ func (c *container) Add(entry *Entry, opts ...IgnoreIPOption) error {
 }
 
 func (c *container) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	name := entry.GetName()
-	val, found := c.GetEntry(name)
+	val, found := c.getEntry(name)
 	if !found {
 		return fmt.Errorf("entry %s not found", name)
 	}
@@ -136,49 +226,36 @@ func (c *container) Remove(entry *Entry, rCase CaseRemove, opts ...IgnoreIPOptio
 
 	switch rCase {
 	case CaseRemovePrefix:
-		var ipv4set, ipv6set *netipx.IPSet
-		var err4, err6 error
-		if entry.hasIPv4Builder() {
-			ipv4set, err4 = entry.ipv4Builder.IPSet()
-			if err4 != nil {
-				return err4
+		// Replaced by a changed copy like Add
+		removed := val.replacement()
+		for _, ipType := range []IPType{IPv4, IPv6} {
+			if ipType == ignoreIPType {
+				continue
 			}
-		}
-		if entry.hasIPv6Builder() {
-			ipv6set, err6 = entry.ipv6Builder.IPSet()
-			if err6 != nil {
-				return err6
+			var set *netipx.IPSet
+			if src := entry.prefixSetOf(ipType, false); src != nil {
+				var err error
+				if set, err = src.ipSet(); err != nil {
+					return err
+				}
 			}
+			removed.changedSetOf(ipType).removeSet(set)
 		}
-
-		switch ignoreIPType {
-		case IPv4:
-			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
-			}
-			val.ipv6Builder.RemoveSet(ipv6set)
-		case IPv6:
-			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
-			}
-			val.ipv4Builder.RemoveSet(ipv4set)
-		default:
-			if !val.hasIPv4Builder() {
-				val.ipv4Builder = new(netipx.IPSetBuilder)
-			}
-			if !val.hasIPv6Builder() {
-				val.ipv6Builder = new(netipx.IPSetBuilder)
-			}
-			val.ipv4Builder.RemoveSet(ipv4set)
-			val.ipv6Builder.RemoveSet(ipv6set)
+		if err := removed.compact(); err != nil {
+			return err
 		}
+		c.entries[name] = removed
 
 	case CaseRemoveEntry:
 		switch ignoreIPType {
-		case IPv4:
-			val.ipv6Builder = nil
-		case IPv6:
-			val.ipv4Builder = nil
+		case IPv4, IPv6:
+			removed := val.replacement()
+			if ignoreIPType == IPv4 {
+				removed.ipv6 = nil
+			} else {
+				removed.ipv4 = nil
+			}
+			c.entries[name] = removed
 		default:
 			delete(c.entries, name)
 		}
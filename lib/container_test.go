@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestContainerConcurrentUse changes a container while its entries are read,
+// and is meant to be run with -race
+func TestContainerConcurrentUse(t *testing.T) {
+	container := NewContainer()
+	seed := NewEntry("test")
+	if err := seed.AddPrefix("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.Add(seed); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	run := func(f func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				if err := f(i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	run(func(i int) error {
+		entry := NewEntry("test")
+		entry.AddTag(fmt.Sprintf("tag%d", i))
+		if err := entry.AddPrefix(fmt.Sprintf("192.168.%d.0/24", i)); err != nil {
+			return err
+		}
+		if err := entry.AddPrefix(fmt.Sprintf("2001:db8:%x::/48", i)); err != nil {
+			return err
+		}
+		return container.Add(entry)
+	})
+	run(func(i int) error {
+		entry := NewEntry("test")
+		if err := entry.AddPrefix(fmt.Sprintf("192.168.%d.0/25", i)); err != nil {
+			return err
+		}
+		return container.Remove(entry, CaseRemovePrefix)
+	})
+	run(func(i int) error {
+		names, err := container.Lookup("10.1.2.3")
+		if err != nil {
+			return err
+		}
+		if len(names) != 1 || names[0] != "TEST" {
+			return fmt.Errorf("lookup of 10.1.2.3 returns %v", names)
+		}
+		return nil
+	})
+	run(func(i int) error {
+		entry, found := container.GetEntry("test")
+		if !found {
+			return fmt.Errorf("entry test not found")
+		}
+		if _, err := entry.GetIPv4Set(); err != nil {
+			return err
+		}
+		entry.GetTags()
+		_, err := entry.MarshalPrefix()
+		return err
+	})
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
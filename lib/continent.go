@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// continentCountries are the ISO 3166-1 alpha-2 codes of every continent, by the
+// continent codes used by MaxMind. Countries across continents are in the one
+// MaxMind puts them in, like RU in EU and TR in AS.
+var continentCountries = map[string][]string{
+	"AF": strings.Fields(`AO BF BI BJ BW CD CF CG CI CM CV DJ DZ EG EH ER ET GA GH GM GN
+GQ GW KE KM LR LS LY MA MG ML MR MU MW MZ NA NE NG RE RW SC SD SH SL SN SO SS ST SZ TD TG
+TN TZ UG YT ZA ZM ZW`),
+	"AN": strings.Fields(`AQ BV GS HM TF`),
+	"AS": strings.Fields(`AE AF AM AZ BD BH BN BT CC CN CX GE HK ID IL IN IO IQ IR JO JP
+KG KH KP KR KW KZ LA LB LK MM MN MO MV MY NP OM PH PK PS QA SA SG SY TH TJ TL TM TR TW UZ
+VN YE`),
+	"EU": strings.Fields(`AD AL AT AX BA BE BG BY CH CY CZ DE DK EE ES FI FO FR GB GG GI
+GR HR HU IE IM IS IT JE LI LT LU LV MC MD ME MK MT NL NO PL PT RO RS RU SE SI SJ SK SM UA
+VA XK`),
+	"NA": strings.Fields(`AG AI AW BB BL BM BQ BS BZ CA CR CU CW DM DO GD GL GP GT HN HT
+JM KN KY LC MF MQ MS MX NI PA PM PR SV SX TC TT US VC VG VI`),
+	"OC": strings.Fields(`AS AU CK FJ FM GU KI MH MP NC NF NR NU NZ PF PG PN PW SB TK TO
+TV UM VU WF WS`),
+	"SA": strings.Fields(`AR BO BR CL CO EC FK GF GY PE PY SR UY VE`),
+}
+
+// Continents returns the sorted codes of continents, AF, AN, AS, EU, NA, OC and SA
+func Continents() []string {
+	return slices.Sorted(maps.Keys(continentCountries))
+}
+
+// IsContinent reports whether the code is a continent code, case-insensitive
+func IsContinent(code string) bool {
+	_, found := continentCountries[strings.ToUpper(strings.TrimSpace(code))]
+	return found
+}
+
+// ContinentOf returns the continent code of the ISO 3166-1 alpha-2 code, case-insensitive,
+// or empty if the code is unknown
+func ContinentOf(countryCode string) string {
+	countryCode = strings.ToUpper(strings.TrimSpace(countryCode))
+	for continent, countries := range continentCountries {
+		if slices.Contains(countries, countryCode) {
+			return continent
+		}
+	}
+	return ""
+}
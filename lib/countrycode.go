@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Policies of unknown country codes
+const (
+	UnknownCountryCodeIgnore = "ignore"
+	UnknownCountryCodeWarn   = "warn"
+	UnknownCountryCodeFail   = "fail"
+)
+
+// iso3166Alpha2 are the officially assigned codes of ISO 3166-1 alpha-2,
+// and XK used by MaxMind and others for Kosovo
+var iso3166Alpha2 = strings.Fields(`
+AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL
+BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV
+CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA GB GD
+GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM
+IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK
+LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW
+MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR
+PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS
+ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY
+UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW XK`)
+
+// countryCodeAliases map the codes commonly used instead of the ISO 3166-1 ones
+var countryCodeAliases = map[string]string{
+	"UK": "GB", // United Kingdom
+	"EL": "GR", // Greece, used by the European Union
+	"FX": "FR", // Metropolitan France
+	"TP": "TL", // East Timor
+	"ZR": "CD", // Zaire
+	"BU": "MM", // Burma
+}
+
+// CountryCodeOptions are the options of validating and normalizing lists named
+// like country codes, which are two letters, after all inputs
+type CountryCodeOptions struct {
+	// Aliases map more codes to the ISO 3166-1 ones, besides the built-in aliases
+	Aliases map[string]string `json:"aliases"`
+	// Known are more codes considered valid, like private or user-assigned codes
+	Known []string `json:"known"`
+	// Unknown is the policy of unknown codes, the value could be ignore, warn or fail
+	Unknown string `json:"unknown"`
+}
+
+func (o *CountryCodeOptions) validate() error {
+	switch strings.ToLower(strings.TrimSpace(o.Unknown)) {
+	case "", UnknownCountryCodeIgnore, UnknownCountryCodeWarn, UnknownCountryCodeFail:
+	default:
+		return fmt.Errorf("invalid unknown country code policy %s, the value must be %s, %s or %s", o.Unknown, UnknownCountryCodeIgnore, UnknownCountryCodeWarn, UnknownCountryCodeFail)
+	}
+	for from, to := range o.Aliases {
+		if !isCountryCodeLike(strings.ToUpper(strings.TrimSpace(from))) {
+			return fmt.Errorf("invalid alias %s of country code, it must be two letters", from)
+		}
+		if to = strings.ToUpper(strings.TrimSpace(to)); !IsCountryCode(to) && !slices.Contains(o.known(), to) {
+			return fmt.Errorf("alias %s is mapped to unknown country code %s", from, to)
+		}
+	}
+	return nil
+}
+
+// unknown returns the policy of unknown codes, defaults to warn
+func (o *CountryCodeOptions) unknown() string {
+	if policy := strings.ToLower(strings.TrimSpace(o.Unknown)); policy != "" {
+		return policy
+	}
+	return UnknownCountryCodeWarn
+}
+
+func (o *CountryCodeOptions) known() []string {
+	known := make([]string, 0, len(o.Known))
+	for _, code := range o.Known {
+		known = append(known, strings.ToUpper(strings.TrimSpace(code)))
+	}
+	return known
+}
+
+// alias returns the ISO 3166-1 code of the alias
+func (o *CountryCodeOptions) alias(name string) (string, bool) {
+	for from, to := range o.Aliases {
+		if strings.EqualFold(strings.TrimSpace(from), name) {
+			return strings.ToUpper(strings.TrimSpace(to)), true
+		}
+	}
+	to, found := countryCodeAliases[name]
+	return to, found
+}
+
+// IsCountryCode reports whether the name is an ISO 3166-1 alpha-2 code, case-insensitive
+func IsCountryCode(name string) bool {
+	return slices.Contains(iso3166Alpha2, strings.ToUpper(strings.TrimSpace(name)))
+}
+
+func isCountryCodeLike(name string) bool {
+	return len(name) == 2 && name[0] >= 'A' && name[0] <= 'Z' && name[1] >= 'A' && name[1] <= 'Z'
+}
+
+// normalizeCountryCodes merges lists named by aliases into the lists of their
+// ISO 3166-1 codes, then checks lists named like country codes by the policy
+func normalizeCountryCodes(container Container, opts *CountryCodeOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	names := make([]string, 0, container.Len())
+	for entry := range container.Loop() {
+		names = append(names, entry.GetName())
+	}
+	slices.Sort(names)
+
+	known := opts.known()
+	unknown := make([]string, 0)
+	for _, name := range names {
+		if !isCountryCodeLike(name) || IsCountryCode(name) || slices.Contains(known, name) {
+			continue
+		}
+
+		to, found := opts.alias(name)
+		if !found {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		entry, _ := container.GetEntry(name)
+		copied, err := entry.Copy(to)
+		if err != nil {
+			return err
+		}
+		if err := container.Remove(entry, CaseRemoveEntry); err != nil {
+			return err
+		}
+		if err := container.Add(copied); err != nil {
+			return err
+		}
+		slog.Info("list of country code alias merged", "alias", strings.ToLower(name), "list", strings.ToLower(to))
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+	for i := range unknown {
+		unknown[i] = strings.ToLower(unknown[i])
+	}
+	switch opts.unknown() {
+	case UnknownCountryCodeWarn:
+		slog.Warn("lists named by unknown country codes", "lists", strings.Join(unknown, ","))
+	case UnknownCountryCodeFail:
+		return fmt.Errorf("lists named by unknown country codes: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
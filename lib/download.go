@@ -0,0 +1,596 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadOptions control how remote files are downloaded by inputs,
+// set by the "download" field of the config file
+type DownloadOptions struct {
+	// CacheDir stores downloaded files, which are revalidated with
+	// ETag and Last-Modified instead of downloaded again
+	CacheDir string `json:"cacheDir"`
+	// Retry is the default retry policy of all remote files
+	Retry *RetryOptions `json:"retry"`
+	// Proxy is the default proxy of all remote files, see httpClient
+	Proxy string `json:"proxy"`
+	// Headers are sent with requests of all remote files
+	Headers map[string]string `json:"headers"`
+	// Timeout is the default timeout of every attempt to download a remote file
+	Timeout string `json:"timeout"`
+	// RateLimit limits all downloads together
+	RateLimit *RateLimitOptions `json:"rateLimit"`
+	// RateLimitPerHost limits downloads of every host separately
+	RateLimitPerHost *RateLimitOptions `json:"rateLimitPerHost"`
+	// Offline forbids network access, all remote files are read from CacheDir
+	Offline bool `json:"offline"`
+	// CacheTTL is the default time files in CacheDir are reused without any request, see parseTTL
+	CacheTTL string `json:"cacheTTL"`
+}
+
+var downloadOptions = new(DownloadOptions)
+
+func (o *DownloadOptions) validate() error {
+	if err := o.Retry.validate(); err != nil {
+		return err
+	}
+	if err := validateHeaders(o.Headers); err != nil {
+		return err
+	}
+	if err := validateTimeout(o.Timeout); err != nil {
+		return err
+	}
+	if err := o.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := o.RateLimitPerHost.validate(); err != nil {
+		return err
+	}
+	if err := validateTTL(o.CacheTTL); err != nil {
+		return err
+	}
+	return validateProxy(o.Proxy)
+}
+
+// SetDownloadOptions sets the options of downloading remote files,
+// empty fields are not changed
+func SetDownloadOptions(opts *DownloadOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.CacheDir != "" {
+		downloadOptions.CacheDir = opts.CacheDir
+	}
+	if opts.Retry != nil {
+		downloadOptions.Retry = opts.Retry
+	}
+	if opts.Proxy != "" {
+		downloadOptions.Proxy = opts.Proxy
+	}
+	if opts.Timeout != "" {
+		downloadOptions.Timeout = opts.Timeout
+	}
+	if opts.RateLimit != nil {
+		downloadOptions.RateLimit = opts.RateLimit
+	}
+	if opts.RateLimitPerHost != nil {
+		downloadOptions.RateLimitPerHost = opts.RateLimitPerHost
+	}
+	if opts.Offline {
+		downloadOptions.Offline = true
+	}
+	if opts.CacheTTL != "" {
+		downloadOptions.CacheTTL = opts.CacheTTL
+	}
+	setRateLimits(opts.RateLimit, opts.RateLimitPerHost)
+	for key, value := range opts.Headers {
+		if downloadOptions.Headers == nil {
+			downloadOptions.Headers = make(map[string]string)
+		}
+		downloadOptions.Headers[key] = value
+	}
+}
+
+// ResetDownloadOptions resets the options of downloading remote files set by
+// SetDownloadOptions and config files, including the ones of inputs, so that a
+// config file read again does not keep the options removed from it
+func ResetDownloadOptions() {
+	downloadOptions = new(DownloadOptions)
+	resetRateLimits()
+
+	sourceOptionsMu.Lock()
+	defer sourceOptionsMu.Unlock()
+	sourceOptions = make(map[string]*SourceOptions)
+}
+
+// SourceOptions are the args of every input to download its remote files
+type SourceOptions struct {
+	// Retry overrides the retry policy in the "download" field of the config file
+	Retry *RetryOptions `json:"retry"`
+	// Mirrors of the URL in the "uri" arg, tried in order if it fails
+	Mirrors []string `json:"mirrors"`
+	// Proxy overrides the proxy in the "download" field of the config file
+	Proxy string `json:"proxy"`
+	// Headers are sent with requests of the URL in the "uri" arg and its mirrors on the
+	// same host, overriding the ones in the "download" field of the config file
+	Headers map[string]string `json:"headers"`
+	// Checksum of the file in the "uri" arg, see validateChecksum
+	Checksum string `json:"checksum"`
+	// Timeout overrides the timeout in the "download" field of the config file
+	Timeout string `json:"timeout"`
+	// CacheTTL overrides the TTL of cached files in the "download" field of the config file
+	CacheTTL string `json:"cacheTTL"`
+}
+
+// RetryOptions is the policy to retry failed downloads
+type RetryOptions struct {
+	Attempts int    `json:"attempts"` // attempts of every URL, including the first one
+	Backoff  string `json:"backoff"`  // delay before the first retry, doubled after every retry
+}
+
+const defaultRetryBackoff = time.Second
+
+func (r *RetryOptions) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.Attempts < 0 {
+		return fmt.Errorf("retry attempts must not be negative")
+	}
+	if r.Backoff != "" {
+		if d, err := time.ParseDuration(r.Backoff); err != nil || d < 0 {
+			return fmt.Errorf("invalid retry backoff %q", r.Backoff)
+		}
+	}
+	return nil
+}
+
+// policy returns the attempts and the initial backoff of the retry policy
+func (r *RetryOptions) policy() (int, time.Duration) {
+	attempts, backoff := 1, defaultRetryBackoff
+	if r == nil {
+		return attempts, backoff
+	}
+	if r.Attempts > 0 {
+		attempts = r.Attempts
+	}
+	if d, err := time.ParseDuration(r.Backoff); err == nil {
+		backoff = d
+	}
+	return attempts, backoff
+}
+
+var (
+	sourceOptionsMu sync.RWMutex
+	sourceOptions   = make(map[string]*SourceOptions) // by URL of remote files of all inputs
+)
+
+// registerSourceOptions parses the source options from the args of an input,
+// which apply to all remote files in the args, except mirrors, headers and
+// checksum only applying to the file of the "uri" arg
+func registerSourceOptions(args json.RawMessage) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	var opts SourceOptions
+	if err := json.Unmarshal(args, &opts); err != nil {
+		return err
+	}
+	if err := opts.Retry.validate(); err != nil {
+		return err
+	}
+	if err := validateProxy(opts.Proxy); err != nil {
+		return err
+	}
+	if err := validateHeaders(opts.Headers); err != nil {
+		return err
+	}
+	if err := validateChecksum(opts.Checksum); err != nil {
+		return err
+	}
+	if err := validateTimeout(opts.Timeout); err != nil {
+		return err
+	}
+	if err := validateTTL(opts.CacheTTL); err != nil {
+		return err
+	}
+
+	var tmp struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(args, &tmp); err != nil {
+		return err
+	}
+	if len(opts.Mirrors) > 0 && !isRemoteURL(tmp.URI) {
+		return fmt.Errorf("mirrors are only supported for remote uri")
+	}
+	if opts.Checksum != "" && !isRemoteURL(tmp.URI) {
+		return fmt.Errorf("checksum is only supported for remote uri")
+	}
+	if len(opts.Headers) > 0 && !isRemoteURL(tmp.URI) {
+		return fmt.Errorf("headers are only supported for remote uri")
+	}
+	for _, mirror := range opts.Mirrors {
+		if !isRemoteURL(mirror) {
+			return fmt.Errorf("invalid mirror %s, must be a URL", mirror)
+		}
+	}
+
+	var values any
+	if err := json.Unmarshal(args, &values); err != nil {
+		return err
+	}
+
+	sourceOptionsMu.Lock()
+	defer sourceOptionsMu.Unlock()
+	for _, url := range remoteURLs(values) {
+		o := &SourceOptions{Retry: opts.Retry, Proxy: opts.Proxy, Timeout: opts.Timeout, CacheTTL: opts.CacheTTL}
+		if url == tmp.URI {
+			o.Checksum = opts.Checksum
+			if len(opts.Mirrors) > 0 {
+				o.Mirrors = opts.Mirrors
+			}
+			if len(opts.Headers) > 0 {
+				o.Headers = opts.Headers
+			}
+		}
+		// Options are registered by URL, so inputs sharing a URL must have the same
+		// options, including the ones without any
+		if registered, found := sourceOptions[url]; found && !reflect.DeepEqual(registered, o) {
+			return fmt.Errorf("remote file %s has different download options in inputs", url)
+		}
+		sourceOptions[url] = o
+	}
+
+	return nil
+}
+
+func getSourceOptions(url string) *SourceOptions {
+	sourceOptionsMu.RLock()
+	defer sourceOptionsMu.RUnlock()
+	if opts, found := sourceOptions[url]; found {
+		return opts
+	}
+	return new(SourceOptions)
+}
+
+func validateTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q", timeout)
+	}
+	return nil
+}
+
+func validateTTL(ttl string) error {
+	if ttl == "" {
+		return nil
+	}
+	if d, err := parseTTL(ttl); err != nil || d < 0 {
+		return fmt.Errorf("invalid cacheTTL %q", ttl)
+	}
+	return nil
+}
+
+// parseTTL parses a duration like 12h, or days like 7d, where 0 disables the TTL
+func parseTTL(ttl string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(ttl, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(ttl)
+}
+
+// cacheTTL returns the TTL of the cached file of the source options, overriding the one of downloads
+func cacheTTL(opts *SourceOptions) time.Duration {
+	ttl := opts.CacheTTL
+	if ttl == "" {
+		ttl = downloadOptions.CacheTTL
+	}
+	// The TTL has been validated when the config is parsed
+	d, _ := parseTTL(ttl)
+	return d
+}
+
+// validateHeaders checks names and values of HTTP headers
+func validateHeaders(headers map[string]string) error {
+	for key, value := range headers {
+		if key == "" || strings.ContainsAny(key, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value of header %s", key)
+		}
+	}
+	return nil
+}
+
+func isRemoteURL(s string) bool {
+	s = strings.ToLower(s)
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// remoteURLs returns all URLs in the string values of the parsed JSON,
+// except the ones of mirrors and checksum files
+func remoteURLs(value any) []string {
+	urls := make([]string, 0)
+	switch v := value.(type) {
+	case string:
+		if isRemoteURL(v) {
+			urls = append(urls, v)
+		}
+	case []any:
+		for _, item := range v {
+			urls = append(urls, remoteURLs(item)...)
+		}
+	case map[string]any:
+		for key, item := range v {
+			if strings.EqualFold(key, "mirrors") || strings.EqualFold(key, "checksum") {
+				continue
+			}
+			urls = append(urls, remoteURLs(item)...)
+		}
+	}
+	return urls
+}
+
+// statusError is returned if the server responds an unexpected status
+type statusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to get remote content -> %s: %s", e.url, e.status)
+}
+
+// retryable reports whether a failed download may succeed if retried,
+// client errors except rate limiting are not retried. Checksum mismatches
+// are retried as the file may be truncated.
+func retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	return true
+}
+
+// download returns the body of a remote URL, which is verified against the
+// lockfile in locked mode, and recorded by the lock command
+func download(ctx context.Context, url string) (io.ReadCloser, error) {
+	locked, err := lockedSHA256(url)
+	if err != nil {
+		return nil, err
+	}
+	if locked != "" {
+		if body, found := openLockedCache(url, locked); found {
+			return body, nil
+		}
+	}
+
+	body, err := downloadVerified(ctx, url, locked)
+	if err != nil {
+		return nil, err
+	}
+	return recordLockedSource(url, body)
+}
+
+// downloadVerified returns the body of a remote URL matching its checksum and the
+// locked digest if any, which is retried and fetched from its mirrors in order if it fails
+func downloadVerified(ctx context.Context, url, locked string) (io.ReadCloser, error) {
+	opts := getSourceOptions(url)
+	retry := opts.Retry
+	if retry == nil {
+		retry = downloadOptions.Retry
+	}
+	attempts, initialBackoff := retry.policy()
+	client, headers, attemptTimeout := requestSettings(opts)
+	sources := append([]string{url}, opts.Mirrors...)
+
+	var expected string
+	if opts.Checksum != "" {
+		var err error
+		if expected, err = expectedSHA256(ctx, opts.Checksum, url); err != nil {
+			return nil, err
+		}
+	}
+	if locked != "" {
+		if expected != "" && expected != locked {
+			return nil, fmt.Errorf("checksum of %s differs from the lockfile: sha256 %s, locked %s", url, expected, locked)
+		}
+		expected = locked
+	}
+
+	if downloadOptions.Offline {
+		body, err := openCache(url)
+		// Files downloaded from mirrors are cached by the URLs of the mirrors
+		for _, mirror := range opts.Mirrors {
+			if err == nil {
+				break
+			}
+			if cached, mirrorErr := openCache(mirror); mirrorErr == nil {
+				body, err = cached, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if expected != "" {
+			return verifyChecksum(body, url, expected)
+		}
+		return body, nil
+	}
+
+	for _, u := range sources {
+		body, found := openFreshCache(u, cacheTTL(opts))
+		if !found {
+			continue
+		}
+		if expected == "" {
+			return body, nil
+		}
+		verified, err := verifyChecksum(body, u, expected)
+		if err == nil {
+			return verified, nil
+		}
+		slog.Debug("cached file not matching the checksum, downloading it again", "uri", u, "error", err)
+		removeCache(u)
+	}
+
+	// Headers of the input could be credentials, which are not sent to mirrors on other hosts
+	mirrorHeaders := requestHeaders(new(SourceOptions))
+
+	var err error
+	for _, u := range sources {
+		h := headers
+		if !sameHost(u, url) {
+			h = mirrorHeaders
+		}
+		backoff := initialBackoff
+		for attempt := 1; attempt <= attempts; attempt++ {
+			var body io.ReadCloser
+			start := time.Now()
+			body, err = fetch(ctx, client, h, attemptTimeout, u)
+			if err == nil {
+				slog.Debug("remote file fetched", "uri", u, "attempt", attempt, "duration", time.Since(start))
+			}
+			if err == nil && expected != "" {
+				if body, err = verifyChecksum(body, u, expected); err != nil {
+					// Download again instead of revalidating the cached file
+					removeCache(u)
+				}
+			}
+			if err == nil {
+				return body, nil
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if !retryable(err) {
+				break
+			}
+			if attempt < attempts {
+				slog.Warn("download failed, retrying", "uri", u, "attempt", attempt, "attempts", attempts, "backoff", backoff, "error", err)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				backoff *= 2
+			}
+		}
+		if len(opts.Mirrors) > 0 {
+			slog.Warn("download failed", "uri", u, "error", err)
+		}
+	}
+
+	return nil, err
+}
+
+// requestSettings returns the client, headers and timeout of every attempt to download
+// a remote file with the source options, overriding the ones of downloads
+func requestSettings(opts *SourceOptions) (*http.Client, http.Header, time.Duration) {
+	proxy := opts.Proxy
+	if proxy == "" {
+		proxy = downloadOptions.Proxy
+	}
+
+	timeout := opts.Timeout
+	if timeout == "" {
+		timeout = downloadOptions.Timeout
+	}
+	// The timeout has been validated when the config is parsed
+	attemptTimeout, _ := time.ParseDuration(timeout)
+
+	return httpClient(proxy), requestHeaders(opts), attemptTimeout
+}
+
+// requestHeaders returns the headers of downloads overridden by the ones of the source options
+func requestHeaders(opts *SourceOptions) http.Header {
+	headers := make(http.Header)
+	for key, value := range downloadOptions.Headers {
+		headers.Set(key, value)
+	}
+	for key, value := range opts.Headers {
+		headers.Set(key, value)
+	}
+	return headers
+}
+
+// sameHost reports whether both URLs are on the same host and port
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+// fetch gets a URL once within the timeout if not zero, which is cached by the URL
+func fetch(ctx context.Context, client *http.Client, headers http.Header, timeout time.Duration, url string) (io.ReadCloser, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header = headers.Clone()
+
+	if downloadOptions.CacheDir != "" {
+		// The body has been written to the cache when returned
+		defer cancel()
+		return fetchWithCache(client, req, url, downloadOptions.CacheDir)
+	}
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, &statusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+
+	return &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// cancelOnClose cancels the context of the request when the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheMeta is stored along with the cached body of a URL
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// SHA256 of the body in hex, which is the name of the cached body shared by
+	// all URLs of the same content. Empty in caches written before, whose body
+	// is named by the URL.
+	SHA256    string    `json:"sha256,omitempty"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// ValidatedAt is the last time the body is downloaded or revalidated,
+	// which the TTL of the cache counts from
+	ValidatedAt time.Time `json:"validatedAt,omitempty"`
+}
+
+// cachePaths returns the paths of the cached body by URL and meta of a key, which
+// is the URL the file is fetched from, so that files of mirrors are cached apart
+// and validators of a host are never sent to others
+func cachePaths(cacheDir, key string) (string, string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(cacheDir, name+".body"), filepath.Join(cacheDir, name+".json")
+}
+
+// blobPath returns the path of the cached body of the content hash
+func blobPath(cacheDir, sum string) string {
+	return filepath.Join(blobDir(cacheDir), sum)
+}
+
+func blobDir(cacheDir string) string {
+	return filepath.Join(cacheDir, "sha256")
+}
+
+// cachedBody returns the path of the cached body of the key and its meta
+func cachedBody(cacheDir, key string) (string, *cacheMeta, error) {
+	bodyPath, metaPath := cachePaths(cacheDir, key)
+	meta, err := readCacheMeta(metaPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if meta.SHA256 != "" {
+		bodyPath = blobPath(cacheDir, meta.SHA256)
+	}
+	if _, err := os.Stat(bodyPath); err != nil {
+		return "", nil, err
+	}
+	return bodyPath, meta, nil
+}
+
+// openCache returns the cached body of the key without network access
+func openCache(key string) (io.ReadCloser, error) {
+	if downloadOptions.CacheDir == "" {
+		return nil, fmt.Errorf("failed to get %s in offline mode: cacheDir of download is not specified", key)
+	}
+	bodyPath, _, err := cachedBody(downloadOptions.CacheDir, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to get %s in offline mode: not found in download cache %s, run without offline mode to download it first", key, downloadOptions.CacheDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(bodyPath)
+}
+
+// openFreshCache returns the cached body of the key if it is downloaded or
+// revalidated within the TTL, which is reused without any request
+func openFreshCache(key string, ttl time.Duration) (io.ReadCloser, bool) {
+	if downloadOptions.CacheDir == "" || ttl <= 0 {
+		return nil, false
+	}
+	bodyPath, meta, err := cachedBody(downloadOptions.CacheDir, key)
+	if err != nil {
+		return nil, false
+	}
+	validatedAt := meta.ValidatedAt
+	if validatedAt.IsZero() {
+		validatedAt = meta.FetchedAt
+	}
+	age := time.Since(validatedAt)
+	if age < 0 || age >= ttl {
+		return nil, false
+	}
+	body, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, false
+	}
+	slog.Debug("remote file read from the download cache within its ttl", "uri", key, "age", age.Round(time.Second), "ttl", ttl)
+	return body, true
+}
+
+// removeCache removes the cached file of the key if any
+func removeCache(key string) {
+	if downloadOptions.CacheDir == "" {
+		return
+	}
+	bodyPath, metaPath := cachePaths(downloadOptions.CacheDir, key)
+	meta, _ := readCacheMeta(metaPath)
+	os.Remove(bodyPath)
+	os.Remove(metaPath)
+	if meta != nil && meta.SHA256 != "" {
+		removeUnreferencedBlob(downloadOptions.CacheDir, meta.SHA256)
+	}
+}
+
+// removeUnreferencedBlob removes the cached body of the content hash
+// if no URL in the cache has the content any more
+func removeUnreferencedBlob(cacheDir, sum string) {
+	metaPaths, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, metaPath := range metaPaths {
+		if meta, err := readCacheMeta(metaPath); err == nil && meta.SHA256 == sum {
+			return
+		}
+	}
+	os.Remove(blobPath(cacheDir, sum))
+}
+
+func readCacheMeta(metaPath string) (*cacheMeta, error) {
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	meta := new(cacheMeta)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func writeCacheMeta(metaPath string, meta *cacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+// fetchWithCache sends a conditional request if the file is cached by key,
+// and reuses the cached body if it is not modified
+func fetchWithCache(client *http.Client, req *http.Request, key, cacheDir string) (io.ReadCloser, error) {
+	url := req.URL.String()
+	legacyBodyPath, metaPath := cachePaths(cacheDir, key)
+
+	bodyPath, meta, err := cachedBody(cacheDir, key)
+	if err == nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if meta != nil {
+			meta.ValidatedAt = time.Now().UTC()
+			if err := writeCacheMeta(metaPath, meta); err != nil {
+				slog.Warn("failed to update the download cache", "uri", key, "error", err)
+			}
+		}
+		return os.Open(bodyPath)
+	case http.StatusOK:
+	default:
+		return nil, &statusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+
+	if err := os.MkdirAll(blobDir(cacheDir), 0755); err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file first, so that an interrupted download
+	// never replaces the cached body
+	tmp, err := os.CreateTemp(cacheDir, "download-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := os.Rename(tmp.Name(), blobPath(cacheDir, sum)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if err := writeCacheMeta(metaPath, &cacheMeta{
+		URL:          key,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       sum,
+		FetchedAt:    now,
+		ValidatedAt:  now,
+	}); err != nil {
+		return nil, err
+	}
+	os.Remove(legacyBodyPath)
+	if meta != nil && meta.SHA256 != "" && meta.SHA256 != sum {
+		removeUnreferencedBlob(cacheDir, meta.SHA256)
+	}
+
+	return os.Open(blobPath(cacheDir, sum))
+}
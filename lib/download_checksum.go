@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// checksumError is returned if a downloaded file does not match its checksum
+type checksumError struct {
+	url      string
+	expected string
+	actual   string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of %s: expected sha256 %s, got %s", e.url, e.expected, e.actual)
+}
+
+// validateChecksum checks the checksum is a SHA256 digest in hex,
+// optionally prefixed by "sha256:", or the URL of a checksum file
+func validateChecksum(checksum string) error {
+	if checksum == "" || isRemoteURL(checksum) {
+		return nil
+	}
+	if _, err := parseSHA256(checksum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseSHA256(s string) (string, error) {
+	digest := strings.ToLower(strings.TrimSpace(s))
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum %s, must be a SHA256 digest in hex or a URL", s)
+	}
+	return digest, nil
+}
+
+// expectedSHA256 returns the digest of the checksum of the file at url.
+// A checksum file is in the format of sha256sum, the line of the file name
+// is used, or the only line if the file has one digest.
+func expectedSHA256(ctx context.Context, checksum, url string) (string, error) {
+	if !isRemoteURL(checksum) {
+		return parseSHA256(checksum)
+	}
+
+	content, err := GetRemoteURLContentContext(ctx, checksum)
+	if err != nil {
+		return "", fmt.Errorf("failed to get checksum file %s: %w", checksum, err)
+	}
+
+	name := path.Base(strings.SplitN(url, "?", 2)[0])
+	digests := make([]string, 0, 1)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		digest, err := parseSHA256(fields[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid checksum file %s: %w", checksum, err)
+		}
+		if len(fields) > 1 && strings.TrimPrefix(fields[1], "*") == name {
+			return digest, nil
+		}
+		digests = append(digests, digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(digests) != 1 {
+		return "", fmt.Errorf("checksum of %s not found in %s", name, checksum)
+	}
+	return digests[0], nil
+}
+
+// verifyChecksum reads the whole body to verify it, and returns a reader of the body
+func verifyChecksum(body io.ReadCloser, url, expected string) (io.ReadCloser, error) {
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return nil, &checksumError{url: url, expected: expected, actual: actual}
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Modes of IPv6 addresses embedding IPv4 addresses
+const (
+	EmbeddedIPv4Keep   = "keep"   // keep them as IPv6 addresses
+	EmbeddedIPv4IPv4   = "ipv4"   // convert them to the IPv4 addresses embedded
+	EmbeddedIPv4Derive = "derive" // add them derived from IPv4 addresses of the same list
+)
+
+var (
+	ipv6Prefix6to4   = netip.MustParsePrefix("2002::/16")
+	ipv6PrefixTeredo = netip.MustParsePrefix("2001::/32")
+)
+
+// EmbeddedIPv4Options are the options of treating IPv6 addresses embedding IPv4
+// addresses after all inputs, so that lookups of them are consistent between
+// formats, set by the "embeddedIPv4" field of the config file
+type EmbeddedIPv4Options struct {
+	// IPv4Mapped is ipv4 or derive for ::ffff:0:0/96, ipv4 by default, as inputs
+	// always convert IPv4-mapped addresses to IPv4 ones
+	IPv4Mapped string `json:"ipv4Mapped"`
+	// SixToFour is keep, ipv4 or derive for 2002::/16, keep by default
+	SixToFour string `json:"6to4"`
+	// Teredo is keep or ipv4 for 2001::/32, keep by default
+	Teredo string `json:"teredo"`
+}
+
+func (o *EmbeddedIPv4Options) validate() error {
+	for _, mode := range []struct {
+		field, value string
+		allowed      []string
+	}{
+		{"ipv4Mapped", o.IPv4Mapped, []string{EmbeddedIPv4IPv4, EmbeddedIPv4Derive}},
+		{"6to4", o.SixToFour, []string{EmbeddedIPv4Keep, EmbeddedIPv4IPv4, EmbeddedIPv4Derive}},
+		// Teredo addresses embed the IPv4 addresses of clients in the last 32 bits,
+		// so those derived from IPv4 prefixes are not prefixes
+		{"teredo", o.Teredo, []string{EmbeddedIPv4Keep, EmbeddedIPv4IPv4}},
+	} {
+		value := strings.ToLower(strings.TrimSpace(mode.value))
+		if value == "" {
+			continue
+		}
+		if !slices.Contains(mode.allowed, value) {
+			return fmt.Errorf("invalid %s %s of embeddedIPv4, the value must be %s", mode.field, mode.value, strings.Join(mode.allowed, " or "))
+		}
+	}
+	return nil
+}
+
+// modes returns the modes of IPv4-mapped, 6to4 and Teredo addresses, with defaults
+func (o *EmbeddedIPv4Options) modes() (ipv4Mapped, sixToFour, teredo string) {
+	mode := func(value, fallback string) string {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			return value
+		}
+		return fallback
+	}
+	return mode(o.IPv4Mapped, EmbeddedIPv4IPv4), mode(o.SixToFour, EmbeddedIPv4Keep), mode(o.Teredo, EmbeddedIPv4Keep)
+}
+
+// normalizeEmbeddedIPv4 converts 6to4 and Teredo prefixes of every list to IPv4
+// prefixes, or derives IPv4-mapped and 6to4 prefixes from IPv4 prefixes of every
+// list, by the options
+func normalizeEmbeddedIPv4(container Container, opts *EmbeddedIPv4Options) error {
+	if opts == nil {
+		return nil
+	}
+	ipv4Mapped, sixToFour, teredo := opts.modes()
+	if ipv4Mapped == EmbeddedIPv4IPv4 && sixToFour == EmbeddedIPv4Keep && teredo == EmbeddedIPv4Keep {
+		return nil
+	}
+
+	changes := make([][2]*Entry, 0)
+	converted, derived := 0, 0
+	for entry := range container.Loop() {
+		removed, added := NewEntry(entry.GetName()), NewEntry(entry.GetName())
+		changed := false
+
+		if ipv6set, err := entry.GetIPv6Set(); err == nil {
+			for _, prefix := range ipv6set.Prefixes() {
+				var ipv4Prefix netip.Prefix
+				switch {
+				case sixToFour == EmbeddedIPv4IPv4 && ipv6Prefix6to4.Contains(prefix.Addr()):
+					ipv4Prefix = prefixFrom6to4(prefix)
+				case teredo == EmbeddedIPv4IPv4 && ipv6PrefixTeredo.Contains(prefix.Addr()):
+					ipv4Prefix = prefixFromTeredo(prefix)
+				}
+				if !ipv4Prefix.IsValid() {
+					continue
+				}
+				if err := removed.add(prefix, IPv6); err != nil {
+					return err
+				}
+				if err := added.add(ipv4Prefix, IPv4); err != nil {
+					return err
+				}
+				changed = true
+				converted++
+			}
+		}
+
+		if ipv4set, err := entry.GetIPv4Set(); err == nil && (ipv4Mapped == EmbeddedIPv4Derive || sixToFour == EmbeddedIPv4Derive) {
+			for _, prefix := range ipv4set.Prefixes() {
+				if ipv4Mapped == EmbeddedIPv4Derive {
+					// Added as IPv6 prefixes directly, as AddPrefix converts them back to IPv4
+					mapped := netip.PrefixFrom(netip.AddrFrom16(prefix.Addr().As16()), 96+prefix.Bits())
+					if err := added.add(mapped, IPv6); err != nil {
+						return err
+					}
+					derived++
+				}
+				if sixToFour == EmbeddedIPv4Derive {
+					if err := added.add(prefixTo6to4(prefix), IPv6); err != nil {
+						return err
+					}
+					derived++
+				}
+				changed = true
+			}
+		}
+
+		if changed {
+			changes = append(changes, [2]*Entry{removed, added})
+		}
+	}
+
+	for _, change := range changes {
+		if change[0].hasIPv6() {
+			if err := container.Remove(change[0], CaseRemovePrefix, IgnoreIPv4); err != nil {
+				return err
+			}
+		}
+		if err := container.Add(change[1]); err != nil {
+			return err
+		}
+	}
+
+	if converted > 0 || derived > 0 {
+		slog.Info("embedded IPv4 addresses normalized", "converted", converted, "derived", derived)
+	}
+	return nil
+}
+
+// prefixFrom6to4 returns the IPv4 prefix embedded in bits 16 to 48 of the 6to4
+// prefix, or an invalid prefix if it is 2002::/16 or shorter, which would be
+// all IPv4 addresses
+func prefixFrom6to4(prefix netip.Prefix) netip.Prefix {
+	if prefix.Bits() <= ipv6Prefix6to4.Bits() {
+		return netip.Prefix{}
+	}
+	b := prefix.Addr().As16()
+	return netip.PrefixFrom(netip.AddrFrom4([4]byte(b[2:6])), min(prefix.Bits()-16, 32)).Masked()
+}
+
+// prefixTo6to4 returns the 6to4 prefix of the IPv4 prefix
+func prefixTo6to4(prefix netip.Prefix) netip.Prefix {
+	var b [16]byte
+	b[0], b[1] = 0x20, 0x02
+	ipv4 := prefix.Addr().As4()
+	copy(b[2:6], ipv4[:])
+	return netip.PrefixFrom(netip.AddrFrom16(b), 16+prefix.Bits())
+}
+
+// prefixFromTeredo returns the IPv4 prefix of clients, which is obfuscated in the
+// last 32 bits of the Teredo prefix, or an invalid prefix if the Teredo prefix is
+// shorter than /96, which would be all IPv4 addresses
+func prefixFromTeredo(prefix netip.Prefix) netip.Prefix {
+	if prefix.Bits() < 96 {
+		return netip.Prefix{}
+	}
+	b := prefix.Addr().As16()
+	var ipv4 [4]byte
+	for i := range ipv4 {
+		ipv4[i] = ^b[12+i]
+	}
+	return netip.PrefixFrom(netip.AddrFrom4(ipv4), prefix.Bits()-96).Masked()
+}
@@ -2,19 +2,29 @@ package lib
 
 import (
 	"fmt"
+	"iter"
 	"net"
 	"net/netip"
+	"slices"
 	"strings"
 
 	"go4.org/netipx"
 )
 
 type Entry struct {
-	name        string
-	ipv4Builder *netipx.IPSetBuilder
-	ipv6Builder *netipx.IPSetBuilder
-	ipv4Set     *netipx.IPSet
-	ipv6Set     *netipx.IPSet
+	name string
+
+	// prefixes of every IP type, nil if the entry has no data of the IP type
+	ipv4 *prefixSet
+	ipv6 *prefixSet
+
+	// tags of the entry in lower case, sorted and unique
+	tags []string
+
+	// metadata of prefixes, in the order they are added
+	metadata []prefixMetadata
+
+	options *OutputOptions
 }
 
 func NewEntry(name string) *Entry {
@@ -27,253 +37,189 @@ func (e *Entry) GetName() string {
 	return e.name
 }
 
-func (e *Entry) hasIPv4Builder() bool {
-	return e.ipv4Builder != nil
+// GetTags returns the tags of the entry, sorted in lower case
+func (e *Entry) GetTags() []string {
+	return slices.Clone(e.tags)
 }
 
-func (e *Entry) hasIPv6Builder() bool {
-	return e.ipv6Builder != nil
+// AddTag adds the tags to the entry, which are case-insensitive
+func (e *Entry) AddTag(tags ...string) {
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			if idx, found := slices.BinarySearch(e.tags, tag); !found {
+				e.tags = slices.Insert(e.tags, idx, tag)
+			}
+		}
+	}
 }
 
-func (e *Entry) hasIPv4Set() bool {
-	return e.ipv4Set != nil
+// HasTag reports whether the entry has any of the tags
+func (e *Entry) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if _, found := slices.BinarySearch(e.tags, strings.ToLower(strings.TrimSpace(tag))); found {
+			return true
+		}
+	}
+	return false
 }
 
-func (e *Entry) hasIPv6Set() bool {
-	return e.ipv6Set != nil
+func (e *Entry) hasIPv4() bool {
+	return e.ipv4 != nil
 }
 
-func (e *Entry) GetIPv4Set() (*netipx.IPSet, error) {
-	if err := e.buildIPSet(); err != nil {
-		return nil, err
+func (e *Entry) hasIPv6() bool {
+	return e.ipv6 != nil
+}
+
+// prefixSetOf returns the prefix set of the IP type, created if create is true
+func (e *Entry) prefixSetOf(ipType IPType, create bool) *prefixSet {
+	switch ipType {
+	case IPv4:
+		if e.ipv4 == nil && create {
+			e.ipv4 = new(prefixSet)
+		}
+		return e.ipv4
+	case IPv6:
+		if e.ipv6 == nil && create {
+			e.ipv6 = new(prefixSet)
+		}
+		return e.ipv6
 	}
+	return nil
+}
 
-	if e.hasIPv4Set() {
-		return e.ipv4Set, nil
+func (e *Entry) GetIPv4Set() (*netipx.IPSet, error) {
+	if e.hasIPv4() {
+		return e.ipv4.ipSet()
 	}
 
-	return nil, fmt.Errorf("entry %s has no ipv4 set", e.GetName())
+	return nil, fmt.Errorf("entry %s has %w", e.GetName(), ErrNoIPv4Set)
 }
 
 func (e *Entry) GetIPv6Set() (*netipx.IPSet, error) {
-	if err := e.buildIPSet(); err != nil {
-		return nil, err
-	}
-
-	if e.hasIPv6Set() {
-		return e.ipv6Set, nil
+	if e.hasIPv6() {
+		return e.ipv6.ipSet()
 	}
 
-	return nil, fmt.Errorf("entry %s has no ipv6 set", e.GetName())
+	return nil, fmt.Errorf("entry %s has %w", e.GetName(), ErrNoIPv6Set)
 }
 
-func (e *Entry) processPrefix(src any) (*netip.Prefix, IPType, error) {
+// processPrefix parses the prefix of the source, which is masked, and
+// IPv4-mapped IPv6 addresses are converted to IPv4 ones
+func processPrefix(src any) (netip.Prefix, IPType, error) {
 	switch src := src.(type) {
+	case netip.Prefix:
+		return processNetipPrefix(src)
+
+	case *netip.Prefix:
+		return processNetipPrefix(*src)
+
+	case netip.Addr:
+		return processNetipAddr(src)
+
+	case *netip.Addr:
+		return processNetipAddr(*src)
+
+	case string:
+		return processPrefixString(src)
+
 	case net.IP:
-		ip, ok := netipx.FromStdIP(src)
+		ip, ok := netip.AddrFromSlice(src)
 		if !ok {
-			return nil, "", ErrInvalidIP
-		}
-		ip = ip.Unmap()
-		switch {
-		case ip.Is4():
-			prefix := netip.PrefixFrom(ip, 32)
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix := netip.PrefixFrom(ip, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
+			return netip.Prefix{}, "", ErrInvalidIP
 		}
+		return processNetipAddr(ip)
 
 	case *net.IPNet:
 		prefix, ok := netipx.FromStdIPNet(src)
 		if !ok {
-			return nil, "", ErrInvalidIPNet
-		}
-		ip := prefix.Addr().Unmap()
-		switch {
-		case ip.Is4():
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
-
-	case netip.Addr:
-		src = src.Unmap()
-		switch {
-		case src.Is4():
-			prefix := netip.PrefixFrom(src, 32)
-			return &prefix, IPv4, nil
-		case src.Is6():
-			prefix := netip.PrefixFrom(src, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
-
-	case *netip.Addr:
-		*src = (*src).Unmap()
-		switch {
-		case src.Is4():
-			prefix := netip.PrefixFrom(*src, 32)
-			return &prefix, IPv4, nil
-		case src.Is6():
-			prefix := netip.PrefixFrom(*src, 128)
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
+			return netip.Prefix{}, "", ErrInvalidIPNet
 		}
+		return processNetipPrefix(prefix)
+	}
 
-	case netip.Prefix:
-		ip := src.Addr()
-		switch {
-		case ip.Is4():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is4In6():
-			ip = ip.Unmap()
-			bits := src.Bits()
-			if bits < 96 {
-				return nil, "", ErrInvalidPrefix
-			}
-			prefix, err := ip.Prefix(bits - 96)
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+	return netip.Prefix{}, "", ErrInvalidPrefixType
+}
 
-	case *netip.Prefix:
-		ip := src.Addr()
-		switch {
-		case ip.Is4():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is4In6():
-			ip = ip.Unmap()
-			bits := src.Bits()
-			if bits < 96 {
-				return nil, "", ErrInvalidPrefix
-			}
-			prefix, err := ip.Prefix(bits - 96)
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv4, nil
-		case ip.Is6():
-			prefix, err := ip.Prefix(src.Bits())
-			if err != nil {
-				return nil, "", ErrInvalidPrefix
-			}
-			return &prefix, IPv6, nil
-		default:
-			return nil, "", ErrInvalidIPLength
-		}
+func processNetipAddr(ip netip.Addr) (netip.Prefix, IPType, error) {
+	ip = ip.Unmap()
+	switch {
+	case ip.Is4():
+		return netip.PrefixFrom(ip, 32), IPv4, nil
+	case ip.Is6():
+		return netip.PrefixFrom(ip, 128), IPv6, nil
+	default:
+		return netip.Prefix{}, "", ErrInvalidIPLength
+	}
+}
 
-	case string:
-		src, _, _ = strings.Cut(src, "#")
-		src, _, _ = strings.Cut(src, "//")
-		src, _, _ = strings.Cut(src, "/*")
-		src = strings.TrimSpace(src)
-		if src == "" {
-			return nil, "", ErrCommentLine
+func processNetipPrefix(prefix netip.Prefix) (netip.Prefix, IPType, error) {
+	ip, bits := prefix.Addr(), prefix.Bits()
+	if ip.Is4In6() {
+		if bits < 96 {
+			return netip.Prefix{}, "", ErrInvalidPrefix
 		}
+		ip, bits = ip.Unmap(), bits-96
+	}
 
-		switch strings.Contains(src, "/") {
-		case true: // src is CIDR notation
-			ip, network, err := net.ParseCIDR(src)
-			if err != nil {
-				return nil, "", ErrInvalidCIDR
-			}
-			addr, ok := netipx.FromStdIP(ip)
-			if !ok {
-				return nil, "", ErrInvalidIP
-			}
-			if addr.Unmap().Is4() && strings.Contains(network.String(), "::") { // src is invalid IPv4-mapped IPv6 address
-				return nil, "", ErrInvalidCIDR
-			}
-			prefix, ok := netipx.FromStdIPNet(network)
-			if !ok {
-				return nil, "", ErrInvalidIPNet
-			}
+	prefix, err := ip.Prefix(bits)
+	switch {
+	case !ip.IsValid():
+		return netip.Prefix{}, "", ErrInvalidIPLength
+	case err != nil:
+		return netip.Prefix{}, "", ErrInvalidPrefix
+	case ip.Is4():
+		return prefix, IPv4, nil
+	default:
+		return prefix, IPv6, nil
+	}
+}
 
-			addr = prefix.Addr().Unmap()
-			switch {
-			case addr.Is4():
-				return &prefix, IPv4, nil
-			case addr.Is6():
-				return &prefix, IPv6, nil
-			default:
-				return nil, "", ErrInvalidIPLength
-			}
+// processPrefixString parses the IP address or CIDR of the line,
+// without converting it to net.IP or net.IPNet first
+func processPrefixString(src string) (netip.Prefix, IPType, error) {
+	src, _, _ = strings.Cut(src, "#")
+	src, _, _ = strings.Cut(src, "//")
+	src, _, _ = strings.Cut(src, "/*")
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return netip.Prefix{}, "", ErrCommentLine
+	}
 
-		case false: // src is IP address
-			ip, err := netip.ParseAddr(src)
-			if err != nil {
-				return nil, "", ErrInvalidIP
-			}
-			ip = ip.Unmap()
-			switch {
-			case ip.Is4():
-				prefix := netip.PrefixFrom(ip, 32)
-				return &prefix, IPv4, nil
-			case ip.Is6():
-				prefix := netip.PrefixFrom(ip, 128)
-				return &prefix, IPv6, nil
-			default:
-				return nil, "", ErrInvalidIPLength
-			}
+	if !strings.Contains(src, "/") {
+		ip, err := netip.ParseAddr(src)
+		if err != nil {
+			return netip.Prefix{}, "", ErrInvalidIP
 		}
+		return processNetipAddr(ip.WithZone(""))
 	}
 
-	return nil, "", ErrInvalidPrefixType
+	prefix, err := netip.ParsePrefix(src)
+	if err != nil {
+		return netip.Prefix{}, "", ErrInvalidCIDR
+	}
+	// CIDRs of IPv4-mapped IPv6 addresses are invalid
+	if prefix.Addr().Is4In6() {
+		return netip.Prefix{}, "", ErrInvalidCIDR
+	}
+	return processNetipPrefix(prefix)
 }
 
-func (e *Entry) add(prefix *netip.Prefix, ipType IPType) error {
-	switch ipType {
-	case IPv4:
-		if !e.hasIPv4Builder() {
-			e.ipv4Builder = new(netipx.IPSetBuilder)
-		}
-		e.ipv4Builder.AddPrefix(*prefix)
-	case IPv6:
-		if !e.hasIPv6Builder() {
-			e.ipv6Builder = new(netipx.IPSetBuilder)
-		}
-		e.ipv6Builder.AddPrefix(*prefix)
-	default:
+func (e *Entry) add(prefix netip.Prefix, ipType IPType) error {
+	set := e.prefixSetOf(ipType, true)
+	if set == nil {
 		return ErrInvalidIPType
 	}
+	set.addPrefix(prefix, true)
 
 	return nil
 }
 
-func (e *Entry) remove(prefix *netip.Prefix, ipType IPType) error {
+func (e *Entry) remove(prefix netip.Prefix, ipType IPType) error {
 	switch ipType {
-	case IPv4:
-		if e.hasIPv4Builder() {
-			e.ipv4Builder.RemovePrefix(*prefix)
-		}
-	case IPv6:
-		if e.hasIPv6Builder() {
-			e.ipv6Builder.RemovePrefix(*prefix)
+	case IPv4, IPv6:
+		if set := e.prefixSetOf(ipType, false); set != nil {
+			set.removePrefix(prefix)
 		}
 	default:
 		return ErrInvalidIPType
@@ -282,75 +228,140 @@ func (e *Entry) remove(prefix *netip.Prefix, ipType IPType) error {
 	return nil
 }
 
+// AddPrefix adds the IP address or CIDR to the entry, which could be a string,
+// netip.Prefix, netip.Addr, net.IP or *net.IPNet. Empty and comment lines are ignored.
 func (e *Entry) AddPrefix(cidr any) error {
-	prefix, ipType, err := e.processPrefix(cidr)
-	if err != nil && err != ErrCommentLine {
-		return err
+	prefix, ipType, err := processPrefix(cidr)
+	if err == ErrCommentLine {
+		return nil
 	}
-	if err := e.add(prefix, ipType); err != nil {
+	if err != nil {
 		return err
 	}
-	return nil
+	return e.add(prefix, ipType)
 }
 
-func (e *Entry) RemovePrefix(cidr string) error {
-	prefix, ipType, err := e.processPrefix(cidr)
-	if err != nil && err != ErrCommentLine {
-		return err
+// RemovePrefix removes the IP address or CIDR from the entry, which could be
+// the same types as AddPrefix
+func (e *Entry) RemovePrefix(cidr any) error {
+	prefix, ipType, err := processPrefix(cidr)
+	if err == ErrCommentLine {
+		return nil
 	}
-	if err := e.remove(prefix, ipType); err != nil {
+	if err != nil {
 		return err
 	}
-	return nil
+	return e.remove(prefix, ipType)
 }
 
 func (e *Entry) buildIPSet() error {
-	if e.hasIPv4Builder() && !e.hasIPv4Set() {
-		ipv4set, err := e.ipv4Builder.IPSet()
-		if err != nil {
+	if e.hasIPv4() {
+		if _, err := e.ipv4.ipSet(); err != nil {
 			return err
 		}
-		e.ipv4Set = ipv4set
 	}
 
-	if e.hasIPv6Builder() && !e.hasIPv6Set() {
-		ipv6set, err := e.ipv6Builder.IPSet()
-		if err != nil {
+	if e.hasIPv6() {
+		if _, err := e.ipv6.ipSet(); err != nil {
 			return err
 		}
-		e.ipv6Set = ipv6set
 	}
 
 	return nil
 }
 
-func (e *Entry) MarshalPrefix(opts ...IgnoreIPOption) ([]netip.Prefix, error) {
-	var ignoreIPType IPType
-	for _, opt := range opts {
-		if opt != nil {
-			ignoreIPType = opt()
-		}
-	}
-	disableIPv4, disableIPv6 := false, false
-	switch ignoreIPType {
+// replacement returns a shallow copy of the entry of a container to be changed instead
+// of it, as entries of containers could be read without the lock. Tags and metadata
+// are copied when they are changed, and prefix sets are shared until changedSetOf.
+func (e *Entry) replacement() *Entry {
+	entry := *e
+	entry.tags = slices.Clip(e.tags)
+	entry.metadata = slices.Clip(e.metadata)
+	return &entry
+}
+
+// changedSetOf replaces the prefix set of the IP type of a replacement with a copy
+// to be changed, see prefixSet.changed. It is called at most once for every IP type.
+func (e *Entry) changedSetOf(ipType IPType) *prefixSet {
+	switch ipType {
 	case IPv4:
-		disableIPv4 = true
-	case IPv6:
-		disableIPv6 = true
+		e.ipv4 = e.ipv4.changed()
+		return e.ipv4
+	default:
+		e.ipv6 = e.ipv6.changed()
+		return e.ipv6
 	}
+}
 
+// compact compacts the prefix sets of the entry, see prefixSet.compact
+func (e *Entry) compact() error {
+	for _, set := range []*prefixSet{e.ipv4, e.ipv6} {
+		if set == nil {
+			continue
+		}
+		if err := set.compact(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withOutputOptions returns a copy of the entry marshaled with the options,
+// sharing the IP sets already built
+func (e *Entry) withOutputOptions(options *OutputOptions) *Entry {
+	// Errors are returned again when the copy is marshaled
+	_ = e.buildIPSet()
+
+	entry := *e
+	entry.options = options
+	return &entry
+}
+
+func (e *Entry) marshalPrefix(disableIPv4, disableIPv6 bool) ([]netip.Prefix, error) {
 	if err := e.buildIPSet(); err != nil {
 		return nil, err
 	}
 
 	prefixes := make([]netip.Prefix, 0, 1024)
 
-	if !disableIPv4 && e.hasIPv4Set() {
-		prefixes = append(prefixes, e.ipv4Set.Prefixes()...)
+	if !disableIPv4 && e.hasIPv4() {
+		ipv4Prefixes, err := e.processPrefixes(e.ipv4.set, e.ipv4.added, e.options.maxIPv4PrefixLength())
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, ipv4Prefixes...)
 	}
 
-	if !disableIPv6 && e.hasIPv6Set() {
-		prefixes = append(prefixes, e.ipv6Set.Prefixes()...)
+	if !disableIPv6 && e.hasIPv6() {
+		ipv6Prefixes, err := e.processPrefixes(e.ipv6.set, e.ipv6.added, e.options.maxIPv6PrefixLength())
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, ipv6Prefixes...)
+	}
+
+	return prefixes, nil
+}
+
+// processPrefixes returns prefixes of one IP type processed with the output options
+func (e *Entry) processPrefixes(set *netipx.IPSet, added []netip.Prefix, maxBits int) ([]netip.Prefix, error) {
+	aggregate := e.options.aggregate()
+
+	prefixes := set.Prefixes()
+	if !aggregate {
+		var err error
+		if prefixes, err = preservePrefixes(added, set); err != nil {
+			return nil, err
+		}
+	}
+
+	return clampPrefixes(prefixes, maxBits, aggregate)
+}
+
+func (e *Entry) MarshalPrefix(opts ...IgnoreIPOption) ([]netip.Prefix, error) {
+	prefixes, err := e.marshalPrefix(disabledIPTypes(opts))
+	if err != nil {
+		return nil, err
 	}
 
 	if len(prefixes) > 0 {
@@ -361,41 +372,95 @@ func (e *Entry) MarshalPrefix(opts ...IgnoreIPOption) ([]netip.Prefix, error) {
 }
 
 func (e *Entry) MarshalText(opts ...IgnoreIPOption) ([]string, error) {
-	var ignoreIPType IPType
-	for _, opt := range opts {
-		if opt != nil {
-			ignoreIPType = opt()
-		}
+	prefixes, err := e.marshalPrefix(disabledIPTypes(opts))
+	if err != nil {
+		return nil, err
 	}
-	disableIPv4, disableIPv6 := false, false
-	switch ignoreIPType {
-	case IPv4:
-		disableIPv4 = true
-	case IPv6:
-		disableIPv6 = true
+
+	cidrList := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidrList = append(cidrList, prefix.String())
 	}
 
-	if err := e.buildIPSet(); err != nil {
-		return nil, err
+	if len(cidrList) > 0 {
+		return cidrList, nil
 	}
 
-	cidrList := make([]string, 0, 1024)
+	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+}
 
-	if !disableIPv4 && e.hasIPv4Set() {
-		for _, prefix := range e.ipv4Set.Prefixes() {
-			cidrList = append(cidrList, prefix.String())
+// Prefixes returns an iterator over the prefixes of the entry marshaled with the
+// output options, IPv4 ones first in ascending order. An error is yielded with a
+// zero prefix and ends the iteration.
+func (e *Entry) Prefixes(opts ...IgnoreIPOption) iter.Seq2[netip.Prefix, error] {
+	return func(yield func(netip.Prefix, error) bool) {
+		prefixes, err := e.marshalPrefix(disabledIPTypes(opts))
+		if err != nil {
+			yield(netip.Prefix{}, err)
+			return
+		}
+		for _, prefix := range prefixes {
+			if !yield(prefix, nil) {
+				return
+			}
 		}
 	}
+}
 
-	if !disableIPv6 && e.hasIPv6Set() {
-		for _, prefix := range e.ipv6Set.Prefixes() {
-			cidrList = append(cidrList, prefix.String())
+// Contains reports whether the entry contains the whole IP address or CIDR,
+// which could be the same types as AddPrefix. Output options are ignored.
+func (e *Entry) Contains(cidr any) (bool, error) {
+	prefix, ipType, err := processPrefix(cidr)
+	if err != nil {
+		return false, err
+	}
+	return e.containsPrefix(prefix, ipType)
+}
+
+func (e *Entry) containsPrefix(prefix netip.Prefix, ipType IPType) (bool, error) {
+	set := e.prefixSetOf(ipType, false)
+	if set == nil {
+		return false, nil
+	}
+	ipSet, err := set.ipSet()
+	if err != nil {
+		return false, err
+	}
+	return ipSet.ContainsPrefix(prefix), nil
+}
+
+// disabledIPTypes returns whether IPv4 and IPv6 are ignored by the options
+func disabledIPTypes(opts []IgnoreIPOption) (disableIPv4, disableIPv6 bool) {
+	var ignoreIPType IPType
+	for _, opt := range opts {
+		if opt != nil {
+			ignoreIPType = opt()
 		}
 	}
+	return ignoreIPType == IPv4, ignoreIPType == IPv6
+}
 
-	if len(cidrList) > 0 {
-		return cidrList, nil
+// Copy returns a copy of the entry with a new name, and the same tags and metadata
+func (e *Entry) Copy(name string) (*Entry, error) {
+	entry := NewEntry(name)
+	entry.tags = slices.Clone(e.tags)
+	entry.metadata = slices.Clone(e.metadata)
+
+	if e.hasIPv4() {
+		ipv4, err := e.ipv4.clone()
+		if err != nil {
+			return nil, err
+		}
+		entry.ipv4 = ipv4
 	}
 
-	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+	if e.hasIPv6() {
+		ipv6, err := e.ipv6.clone()
+		if err != nil {
+			return nil, err
+		}
+		entry.ipv6 = ipv6
+	}
+
+	return entry, nil
 }
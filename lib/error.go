@@ -13,4 +13,46 @@ var (
 	ErrInvalidPrefix       = errors.New("invalid prefix")
 	ErrInvalidPrefixType   = errors.New("invalid prefix type")
 	ErrCommentLine         = errors.New("comment line")
+	ErrNoIPv4Set           = errors.New("no ipv4 set") // the entry has no IPv4 prefixes
+	ErrNoIPv6Set           = errors.New("no ipv6 set") // the entry has no IPv6 prefixes
 )
+
+// Kinds of errors failing a run, telling which stage failed
+const (
+	ErrorKindConfig   = "config"
+	ErrorKindDownload = "download"
+	ErrorKindInput    = "input"
+	ErrorKindOutput   = "output"
+)
+
+// RunError is an error failing a stage of a run, whose message is the one of the wrapped error
+type RunError struct {
+	Kind string
+	Err  error
+}
+
+func (e *RunError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorKind returns the kind of the error failing a run, empty if unknown
+func ErrorKind(err error) string {
+	var runErr *RunError
+	if errors.As(err, &runErr) {
+		return runErr.Kind
+	}
+	return ""
+}
+
+// withErrorKind returns the error as a RunError of the kind, unless it has a kind already,
+// like a download error failing an input
+func withErrorKind(kind string, err error) error {
+	if err == nil || ErrorKind(err) != "" {
+		return err
+	}
+	return &RunError{Kind: kind, Err: err}
+}
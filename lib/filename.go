@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// outputPathData is the data of templates in directories and names of files written by outputs
+type outputPathData struct {
+	BuildTime time.Time // time of the build, SOURCE_DATE_EPOCH if set
+	Date      string    // date of the build in UTC, like 20240102
+	Hash      string    // SHA-256 of the content of the file in hex
+	ShortHash string    // first 8 characters of Hash
+	List      string    // name of the file up to its first dot, which is the list of files per list
+}
+
+// Commit returns the git commit of the build, from the environment variables of CI,
+// or the repository of the current directory
+func (outputPathData) Commit() (string, error) {
+	return gitCommit()
+}
+
+// ShortCommit returns the first 7 characters of Commit
+func (d outputPathData) ShortCommit() (string, error) {
+	commit, err := d.Commit()
+	if err != nil {
+		return "", err
+	}
+	return commit[:min(len(commit), 7)], nil
+}
+
+// Environment variables of the git commit set by CI, in order
+var commitEnvs = []string{"GIT_COMMIT", "GITHUB_SHA", "CI_COMMIT_SHA"}
+
+var gitCommit = sync.OnceValues(func() (string, error) {
+	for _, env := range commitEnvs {
+		if commit := strings.TrimSpace(os.Getenv(env)); commit != "" {
+			return commit, nil
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("git commit is unknown, set %s: %w", commitEnvs[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+})
+
+// ResolveOutputPath expands templates like {{.Date}} and {{.ShortHash}} in the
+// directory and the name of a file written by an output with the content, and
+// returns the directory and the name to write the file to
+func ResolveOutputPath(dir, filename string, content []byte) (string, string, error) {
+	if !isOutputTemplate(dir) && !isOutputTemplate(filename) {
+		return dir, filename, nil
+	}
+
+	buildTime := BuildTime().UTC()
+	sum := sha256.Sum256(content)
+	data := outputPathData{
+		BuildTime: buildTime,
+		Date:      buildTime.Format("20060102"),
+		Hash:      hex.EncodeToString(sum[:]),
+	}
+	data.ShortHash = data.Hash[:8]
+
+	var err error
+	if filename, err = expandOutputTemplate(filename, data); err != nil {
+		return "", "", err
+	}
+	data.List, _, _ = strings.Cut(filename, ".")
+	if dir, err = expandOutputTemplate(dir, data); err != nil {
+		return "", "", err
+	}
+	return dir, filename, nil
+}
+
+// ExpandBuildTemplate expands templates like {{.Date}} and {{.ShortCommit}} in
+// names not of files, like tags of releases, where templates of the content and
+// the list of a file are empty
+func ExpandBuildTemplate(s string) (string, error) {
+	if !isOutputTemplate(s) {
+		return s, nil
+	}
+	buildTime := BuildTime().UTC()
+	return expandOutputTemplate(s, outputPathData{BuildTime: buildTime, Date: buildTime.Format("20060102")})
+}
+
+func isOutputTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func expandOutputTemplate(s string, data outputPathData) (string, error) {
+	if !isOutputTemplate(s) {
+		return s, nil
+	}
+	t, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %s: %w", s, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to expand template %s: %w", s, err)
+	}
+	return b.String(), nil
+}
+
+// Args of outputs which could be templates
+var outputTemplateArgs = []string{"outputDir", "outputName", "outputExtension"}
+
+// validateOutputTemplates validates templates in args of an output
+func validateOutputTemplates(args json.RawMessage) error {
+	var values map[string]any
+	if len(args) == 0 || json.Unmarshal(args, &values) != nil {
+		return nil
+	}
+	for _, key := range outputTemplateArgs {
+		value, ok := values[key].(string)
+		if !ok || !isOutputTemplate(value) {
+			continue
+		}
+		if _, err := template.New("").Parse(value); err != nil {
+			return fmt.Errorf("invalid template in %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func isRemoteConfig(configFile string) bool {
+	lower := strings.ToLower(configFile)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// resolveInclude returns the config files of an include of the config file.
+// Relative paths are resolved against the directory of the config file, and
+// glob patterns of local paths are expanded in lexical order.
+func resolveInclude(configFile, include string) ([]string, error) {
+	include = strings.TrimSpace(include)
+	if include == "" {
+		return nil, fmt.Errorf("include must not be empty")
+	}
+
+	if isRemoteConfig(include) {
+		return []string{include}, nil
+	}
+
+	if isRemoteConfig(configFile) {
+		base, err := url.Parse(configFile)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := url.Parse(include)
+		if err != nil {
+			return nil, err
+		}
+		return []string{base.ResolveReference(ref).String()}, nil
+	}
+
+	if !filepath.IsAbs(include) && configFile != "" {
+		include = filepath.Join(filepath.Dir(configFile), include)
+	}
+
+	files, err := filepath.Glob(include)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file matches include %s", include)
+	}
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// initConfigDir merges all config files in the directory in lexical order
+func (i *instance) initConfigDir(dir string) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(dirEntry.Name())) {
+		case ".json", ".jsonc", ".yaml", ".yml", ".toml":
+		default:
+			continue
+		}
+		found = true
+		file := filepath.Join(dir, dirEntry.Name())
+		if err := i.InitConfig(file); err != nil {
+			return fmt.Errorf("failed to load %s: %w", file, err)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no config file found in %s", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"go4.org/netipx"
+)
+
+// buildState is saved to the state file of incremental builds after every run
+type buildState struct {
+	Inputs  string            `json:"inputs"`  // fingerprint of the config of inputs
+	Sources map[string]string `json:"sources"` // fingerprints of files and URLs read by inputs
+	Lists   string            `json:"lists"`   // fingerprint of the lists generated by inputs
+	Outputs []string          `json:"outputs"` // fingerprints of the config of outputs run with the lists
+}
+
+// SetStateFile enables incremental builds, whose state is kept in the file between runs.
+// The run is skipped if the config and the sources of inputs haven't changed since the
+// last run, and so are the outputs whose config and lists haven't changed.
+func (i *instance) SetStateFile(file string) {
+	i.stateFile = file
+}
+
+func readBuildState(file string) (*buildState, error) {
+	content, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := new(buildState)
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", file, err)
+	}
+	return state, nil
+}
+
+func (s *buildState) writeFile(file string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// hasOutputs reports whether all outputs have been run with the lists of the state
+func (s *buildState) hasOutputs(fingerprints []string) bool {
+	for _, fingerprint := range fingerprints {
+		if fingerprint == "" || !slices.Contains(s.Outputs, fingerprint) {
+			return false
+		}
+	}
+	return true
+}
+
+// sourcesUnchanged reports whether all sources read by inputs in the last run are unchanged
+func (s *buildState) sourcesUnchanged(ctx context.Context) bool {
+	for source, fingerprint := range s.Sources {
+		current, err := sourceFingerprint(ctx, source)
+		if err != nil {
+			slog.Debug("failed to check source", "source", source, "error", err)
+			return false
+		}
+		if fingerprint == "" || current != fingerprint {
+			slog.Debug("source changed", "source", source)
+			return false
+		}
+	}
+	return true
+}
+
+// sourceFingerprint returns the hash of the content of a URL, a file, or all files in a directory
+func sourceFingerprint(ctx context.Context, source string) (string, error) {
+	h := sha256.New()
+
+	if isRemoteSource(source) {
+		body, err := download(ctx, source)
+		if err != nil {
+			return "", withErrorKind(ErrorKindDownload, err)
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%s\n", filepath.ToSlash(rel))
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isRemoteSource(source string) bool {
+	return isRemoteConfig(source)
+}
+
+// sourceRecorder records the sources read by inputs in a run of incremental builds
+type sourceRecorder struct {
+	sync.Mutex
+	sources map[string]string // fingerprints of remote sources, empty for local ones
+}
+
+var activeRecorder struct {
+	sync.Mutex
+	recorder *sourceRecorder
+}
+
+func startRecordingSources() *sourceRecorder {
+	activeRecorder.Lock()
+	defer activeRecorder.Unlock()
+	activeRecorder.recorder = &sourceRecorder{sources: make(map[string]string)}
+	return activeRecorder.recorder
+}
+
+func stopRecordingSources() {
+	activeRecorder.Lock()
+	defer activeRecorder.Unlock()
+	activeRecorder.recorder = nil
+}
+
+func currentRecorder() *sourceRecorder {
+	activeRecorder.Lock()
+	defer activeRecorder.Unlock()
+	return activeRecorder.recorder
+}
+
+// RecordSource records a local file or directory read by an input as its source,
+// so that the input is run again by incremental builds when it changes
+func RecordSource(path string) {
+	if r := currentRecorder(); r != nil {
+		r.Lock()
+		r.sources[path] = ""
+		r.Unlock()
+	}
+}
+
+// recordRemoteSource records the body of a URL read by an input, whose hash
+// is recorded when it is read to the end
+func recordRemoteSource(url string, body io.ReadCloser) io.ReadCloser {
+	r := currentRecorder()
+	if r == nil {
+		return body
+	}
+	r.Lock()
+	// A URL not read to the end is unknown, and always considered changed
+	if _, found := r.sources[url]; !found {
+		r.sources[url] = ""
+	}
+	r.Unlock()
+	return &recordedBody{ReadCloser: body, recorder: r, url: url, hash: sha256.New()}
+}
+
+type recordedBody struct {
+	io.ReadCloser
+	recorder *sourceRecorder
+	url      string
+	hash     hash.Hash
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.recorder.Lock()
+		b.recorder.sources[b.url] = hex.EncodeToString(b.hash.Sum(nil))
+		b.recorder.Unlock()
+	}
+	return n, err
+}
+
+// fingerprints returns the fingerprints of all recorded sources, local ones are hashed now
+func (r *sourceRecorder) fingerprints(ctx context.Context) (map[string]string, error) {
+	r.Lock()
+	defer r.Unlock()
+	sources := make(map[string]string, len(r.sources))
+	for source, fingerprint := range r.sources {
+		if !isRemoteSource(source) {
+			var err error
+			if fingerprint, err = sourceFingerprint(ctx, source); err != nil {
+				return nil, err
+			}
+		}
+		sources[source] = fingerprint
+	}
+	return sources, nil
+}
+
+// converterFingerprint returns the hash of the config of a converter, which is
+// the converter itself in JSON, or empty if it couldn't be encoded
+func converterFingerprint(converter any, extra ...any) string {
+	h := sha256.New()
+	encoder := json.NewEncoder(h)
+	for _, v := range append([]any{fmt.Sprintf("%T", converter), converter}, extra...) {
+		if err := encoder.Encode(v); err != nil {
+			return ""
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// inputsFingerprint returns the hash of the config of all inputs, composite lists, country codes,
+// embedded IPv4 addresses, wanted and excluded lists and overlaps
+func (i *instance) inputsFingerprint() string {
+	h := sha256.New()
+	for idx, ic := range i.input {
+		fingerprint := converterFingerprint(ic, i.inputPriorities[idx], i.inputTags[idx])
+		if fingerprint == "" {
+			return ""
+		}
+		fmt.Fprintln(h, fingerprint)
+	}
+	if err := json.NewEncoder(h).Encode(i.composites); err != nil {
+		return ""
+	}
+	if err := json.NewEncoder(h).Encode(i.countryCodes); err != nil {
+		return ""
+	}
+	if err := json.NewEncoder(h).Encode(i.embeddedIPv4); err != nil {
+		return ""
+	}
+	if err := json.NewEncoder(h).Encode([]*ListMatcher{i.wantedList, i.excludedList}); err != nil {
+		return ""
+	}
+	if err := json.NewEncoder(h).Encode(i.overlaps); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// outputFingerprints returns the hashes of the config of every output, with its options and routes
+func (i *instance) outputFingerprints() []string {
+	fingerprints := make([]string, 0, len(i.output))
+	for idx, oc := range i.output {
+		fingerprints = append(fingerprints, converterFingerprint(oc, i.options.merge(i.outputOptions[idx]), i.routes))
+	}
+	return fingerprints
+}
+
+// listsFingerprint returns the hash of the names, tags, prefixes and metadata of all lists in the container
+func listsFingerprint(container Container) string {
+	h := sha256.New()
+	for entry := range container.Loop() {
+		fmt.Fprintf(h, "%s %s\n", entry.GetName(), strings.Join(entry.tags, ","))
+		// An entry without addresses of an IP type has no set of it
+		for _, getSet := range []func() (*netipx.IPSet, error){entry.GetIPv4Set, entry.GetIPv6Set} {
+			if set, err := getSet(); err == nil {
+				for _, prefix := range set.Prefixes() {
+					fmt.Fprintf(h, "%s\n", prefix)
+				}
+			}
+		}
+		for _, pm := range entry.metadata {
+			fmt.Fprintf(h, "%s %+v\n", pm.prefix, pm.metadata)
+		}
+		fmt.Fprintln(h)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// runIncremental runs inputs and outputs unless they are unchanged since the last run,
+// and saves the state of the run, even if an output fails, to resume from it next time
+func (i *instance) runIncremental(ctx context.Context) error {
+	previous, err := readBuildState(i.stateFile)
+	if err != nil {
+		return err
+	}
+
+	state := &buildState{Inputs: i.inputsFingerprint(), Outputs: make([]string, 0, len(i.output))}
+	outputs := i.outputFingerprints()
+	if previous != nil && state.Inputs != "" && previous.Inputs == state.Inputs &&
+		previous.hasOutputs(outputs) && previous.sourcesUnchanged(ctx) {
+		slog.Info("build skipped, nothing changed since the last run", "state", i.stateFile)
+		i.skipped = true
+		return nil
+	}
+
+	recorder := startRecordingSources()
+	container, err := i.loadContainer(ctx)
+	stopRecordingSources()
+	if err != nil {
+		return err
+	}
+	if state.Sources, err = recorder.fingerprints(ctx); err != nil {
+		return err
+	}
+	state.Lists = listsFingerprint(container)
+
+	var outputErr error
+	for idx, oc := range i.output {
+		// Outputs are skipped only if they have been run with the same lists
+		if previous != nil && outputs[idx] != "" && previous.Lists == state.Lists && slices.Contains(previous.Outputs, outputs[idx]) {
+			slog.Info("output skipped, unchanged since the last run", "index", idx, "plugin", oc.GetType())
+		} else if outputErr = i.runOutputAt(ctx, idx, container); outputErr != nil {
+			break
+		}
+		if outputs[idx] != "" {
+			state.Outputs = append(state.Outputs, outputs[idx])
+		}
+	}
+
+	if err := state.writeFile(i.stateFile); err != nil {
+		return err
+	}
+	return outputErr
+}
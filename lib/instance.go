@@ -1,10 +1,16 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/tailscale/hujson"
 )
@@ -17,27 +23,94 @@ type Instance interface {
 	ResetInput()
 	ResetOutput()
 	RunInput(Container) error
+	RunInputContext(context.Context, Container) error
 	RunOutput(Container) error
+	SetConcurrency(int)
 	Run() error
+	RunContext(context.Context) error
+	SetReport(bool)
+	Report() *BuildReport
+	SetStateFile(string)
+	SetSnapshotFile(string)
+	SetRestoreFile(string)
+	PrintPlan(io.Writer) error
+	LockContext(ctx context.Context, file string) error
 }
 
 type instance struct {
 	input  []InputConverter
 	output []OutputConverter
+
+	inputPriorities []*int       // priorities of every input, in the same order as input
+	inputTags       [][]string   // tags added to lists of every input, in the same order as input
+	inputConditions []*condition // conditions enabling every input, in the same order as input
+
+	composites     map[string][]string // composite lists materialized after all inputs
+	compositeOrder []string
+
+	routes map[string]*RouteOptions // lists only sent to the outputs of every route, by name
+
+	profiles map[string]*ProfileOptions // build profiles inputs and outputs are selected by, by name
+
+	countryCodes *CountryCodeOptions  // options of validating and normalizing country codes after all inputs
+	embeddedIPv4 *EmbeddedIPv4Options // options of IPv6 addresses embedding IPv4 addresses after all inputs
+
+	wantedList   *ListMatcher // lists kept after all inputs, for all outputs
+	excludedList *ListMatcher // lists removed after all inputs, for all outputs
+
+	overlaps *OverlapOptions // options of analyzing prefixes in multiple lists after all inputs
+
+	shrinkGuard   *ShrinkGuardOptions  // thresholds of lists shrinking versus the last successful run
+	notifications *NotificationOptions // options of notifying the result of every run
+	metrics       *MetricsOptions      // options of exporting metrics of every run
+
+	concurrency int // max number of inputs run concurrently
+
+	reportEnabled bool
+	sources       map[string][]string // inputs adding prefixes to every list, for the report
+	report        *BuildReport        // report of the last run
+	skipped       bool                // whether the last run is skipped by incremental builds
+
+	stateFile    string // state file of incremental builds
+	snapshotFile string // file to save the lists loaded by inputs to
+	restoreFile  string // file to restore the lists from instead of running inputs
+
+	including map[string]bool   // config files being included, to detect cycles
+	merged    map[string]bool   // config files merged, to merge every one only once
+	vars      map[string]string // variables of the config file being parsed
+
+	options          *OutputOptions   // options for all outputs
+	outputOptions    []*OutputOptions // options of every output, in the same order as output
+	outputConditions []*condition     // conditions enabling every output, in the same order as output
 }
 
 func NewInstance() (Instance, error) {
 	return &instance{
-		input:  make([]InputConverter, 0),
-		output: make([]OutputConverter, 0),
+		input:            make([]InputConverter, 0),
+		output:           make([]OutputConverter, 0),
+		inputPriorities:  make([]*int, 0),
+		inputTags:        make([][]string, 0),
+		inputConditions:  make([]*condition, 0),
+		outputOptions:    make([]*OutputOptions, 0),
+		outputConditions: make([]*condition, 0),
 	}, nil
 }
 
 func (i *instance) InitConfig(configFile string) error {
+	return withErrorKind(ErrorKindConfig, i.initConfigFile(configFile))
+}
+
+func (i *instance) initConfigFile(configFile string) error {
+	configFile = strings.TrimSpace(configFile)
+	if !isRemoteConfig(configFile) {
+		if info, err := os.Stat(configFile); err == nil && info.IsDir() {
+			return i.initConfigDir(configFile)
+		}
+	}
+
 	var content []byte
 	var err error
-	configFile = strings.TrimSpace(configFile)
-	if strings.HasPrefix(strings.ToLower(configFile), "http://") || strings.HasPrefix(strings.ToLower(configFile), "https://") {
+	if isRemoteConfig(configFile) {
 		content, err = GetRemoteURLContent(configFile)
 	} else {
 		content, err = os.ReadFile(configFile)
@@ -46,25 +119,206 @@ func (i *instance) InitConfig(configFile string) error {
 		return err
 	}
 
-	return i.InitConfigFromBytes(content)
+	// Support YAML and TOML config files detected by extension
+	if format := configFormat(configFile); format != configFormatJSON {
+		if content, err = convertConfigToJSON(content, format); err != nil {
+			return err
+		}
+	}
+
+	key := configFile
+	if !isRemoteConfig(configFile) {
+		if key, err = filepath.Abs(configFile); err != nil {
+			return err
+		}
+	}
+	if i.including == nil {
+		i.including = make(map[string]bool)
+	}
+	if i.including[key] {
+		return fmt.Errorf("config file %s is included by itself", configFile)
+	}
+	// A config file included by several ones is merged only once, the first time
+	if i.merged[key] {
+		slog.Debug("config file already merged", "file", configFile)
+		return nil
+	}
+	i.including[key] = true
+	defer delete(i.including, key)
+	if i.merged == nil {
+		i.merged = make(map[string]bool)
+	}
+	i.merged[key] = true
+
+	return i.initConfig(content, configFile)
 }
 
 func (i *instance) InitConfigFromBytes(content []byte) error {
+	return withErrorKind(ErrorKindConfig, i.initConfig(content, ""))
+}
+
+// initConfig parses the content of the config file, whose includes are
+// resolved relative to the config file, or the current directory if empty
+func (i *instance) initConfig(content []byte, configFile string) error {
 	config := new(config)
 
 	// Support JSON with comments and trailing commas
 	content, _ = hujson.Standardize(content)
 
+	// Variables are visible to the config file and the ones it includes
+	content, vars, err := expandConfigVars(content, i.vars)
+	if err != nil {
+		return err
+	}
+	inherited := i.vars
+	i.vars = vars
+	defer func() { i.vars = inherited }()
+
+	// Plugins are registered as types before the converters using them are parsed
+	var plugins struct {
+		Plugins map[string]string `json:"plugins"`
+	}
+	if err := json.Unmarshal(content, &plugins); err != nil {
+		return err
+	}
+	if err := loadPlugins(plugins.Plugins, configFile); err != nil {
+		return err
+	}
+
+	if err := validateConfig(content); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
 	if err := json.Unmarshal(content, &config); err != nil {
 		return err
 	}
 
+	// Included config files are merged before the current one
+	for _, include := range config.Include {
+		files, err := resolveInclude(configFile, include)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := i.InitConfig(file); err != nil {
+				return fmt.Errorf("failed to include %s: %w", file, err)
+			}
+		}
+	}
+
 	for _, input := range config.Input {
 		i.input = append(i.input, input.converter)
+		i.inputPriorities = append(i.inputPriorities, input.priority)
+		i.inputTags = append(i.inputTags, input.tags)
+		i.inputConditions = append(i.inputConditions, input.condition)
+	}
+
+	if config.Download != nil {
+		if err := config.Download.validate(); err != nil {
+			return err
+		}
+		SetDownloadOptions(config.Download)
+	}
+
+	if len(config.Composites) > 0 {
+		composites, _, err := parseComposites(config.Composites)
+		if err != nil {
+			return err
+		}
+		if i.composites == nil {
+			i.composites = make(map[string][]string)
+		}
+		for name, members := range composites {
+			if _, found := i.composites[name]; found {
+				return fmt.Errorf("composite list %s is defined more than once", name)
+			}
+			i.composites[name] = members
+		}
+		if _, i.compositeOrder, err = parseComposites(i.composites); err != nil {
+			return err
+		}
+	}
+
+	if err := i.addRoutes(config.Routes); err != nil {
+		return err
+	}
+
+	if err := i.addProfiles(config.Profiles); err != nil {
+		return err
+	}
+
+	// Wanted and excluded lists of the current config file override the included ones
+	if config.WantedList != nil {
+		if i.wantedList, err = NewListMatcher(config.WantedList); err != nil {
+			return fmt.Errorf("%v in wantedList", err)
+		}
+	}
+	if config.ExcludedList != nil {
+		if i.excludedList, err = NewListMatcher(config.ExcludedList); err != nil {
+			return fmt.Errorf("%v in excludedList", err)
+		}
+	}
+
+	if config.CountryCodes != nil {
+		if err := config.CountryCodes.validate(); err != nil {
+			return err
+		}
+		// Country codes options of the current config file override the included ones
+		i.countryCodes = config.CountryCodes
+	}
+
+	if config.EmbeddedIPv4 != nil {
+		if err := config.EmbeddedIPv4.validate(); err != nil {
+			return err
+		}
+		// Embedded IPv4 options of the current config file override the included ones
+		i.embeddedIPv4 = config.EmbeddedIPv4
+	}
+
+	if config.Overlaps != nil {
+		if err := config.Overlaps.validate(); err != nil {
+			return err
+		}
+		// Overlaps options of the current config file override the included ones
+		i.overlaps = config.Overlaps
+	}
+
+	if config.ShrinkGuard != nil {
+		if err := config.ShrinkGuard.validate(); err != nil {
+			return err
+		}
+		// Shrink guard of the current config file overrides the included one
+		i.shrinkGuard = config.ShrinkGuard
+	}
+
+	if config.Notifications != nil {
+		if err := config.Notifications.validate(); err != nil {
+			return err
+		}
+		// Notifications of the current config file override the included ones
+		i.notifications = config.Notifications
+	}
+
+	if config.Metrics != nil {
+		if err := config.Metrics.validate(); err != nil {
+			return err
+		}
+		// Metrics of the current config file override the included ones
+		i.metrics = config.Metrics
+	}
+
+	if config.Options != nil {
+		if err := config.Options.validate(); err != nil {
+			return err
+		}
+		// Options of the current config file override the included ones
+		i.options = i.options.merge(config.Options)
 	}
 
 	for _, output := range config.Output {
 		i.output = append(i.output, output.converter)
+		i.outputOptions = append(i.outputOptions, output.options)
+		i.outputConditions = append(i.outputConditions, output.condition)
 	}
 
 	return nil
@@ -72,35 +326,141 @@ func (i *instance) InitConfigFromBytes(content []byte) error {
 
 func (i *instance) AddInput(ic InputConverter) {
 	i.input = append(i.input, ic)
+	i.inputPriorities = append(i.inputPriorities, nil)
+	i.inputTags = append(i.inputTags, nil)
+	i.inputConditions = append(i.inputConditions, nil)
 }
 
 func (i *instance) AddOutput(oc OutputConverter) {
 	i.output = append(i.output, oc)
+	i.outputOptions = append(i.outputOptions, nil)
+	i.outputConditions = append(i.outputConditions, nil)
 }
 
 func (i *instance) ResetInput() {
 	i.input = make([]InputConverter, 0)
+	i.inputPriorities = make([]*int, 0)
+	i.inputTags = make([][]string, 0)
+	i.inputConditions = make([]*condition, 0)
 }
 
 func (i *instance) ResetOutput() {
 	i.output = make([]OutputConverter, 0)
+	i.outputOptions = make([]*OutputOptions, 0)
+	i.outputConditions = make([]*condition, 0)
 }
 
 func (i *instance) RunInput(container Container) error {
+	return i.RunInputContext(context.Background(), container)
+}
+
+// RunInputContext runs all inputs on the container, which are canceled when the context is done
+func (i *instance) RunInputContext(ctx context.Context, container Container) error {
+	restore, _, err := i.selectSteps()
+	defer restore()
+	if err != nil {
+		return err
+	}
+	return i.runInputs(ctx, container)
+}
+
+func (i *instance) runInputs(ctx context.Context, container Container) error {
+	// Inputs loaded concurrently are canceled if the run fails before them
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var err error
-	for _, ic := range i.input {
-		container, err = ic.Input(container)
+	results := i.loadInputs(ctx)
+	claims := make([]*claim, 0)
+	i.sources = nil
+	if i.needReport() {
+		startRecordingDrops()
+		defer stopRecordingDrops()
+	}
+	for idx, ic := range i.input {
+		priority, tags := i.inputPriorities[idx], i.inputTags[idx]
+		start := time.Now()
+
+		// Inputs with priority or tags, or loaded concurrently are run on empty
+		// containers, then merged in order
+		var loaded Container
+		switch {
+		case results[idx] != nil:
+			result := <-results[idx]
+			if result.err != nil {
+				return result.err
+			}
+			loaded = result.container
+		case priority != nil, len(tags) > 0, i.trackSources() && isConcurrentInput(ic):
+			// Sources of lists are tracked by running inputs on empty containers
+			if loaded, err = runInput(ctx, ic, NewContainer()); err != nil {
+				return err
+			}
+		default:
+			if container, err = runInput(ctx, ic, container); err != nil {
+				return err
+			}
+			logInputDone(ic, idx, len(i.input), container, start)
+			continue
+		}
+
+		c, err := mergeLoaded(loaded, container, priority, tags)
 		if err != nil {
 			return err
 		}
+		claims = append(claims, c...)
+		if i.trackSources() {
+			i.addSources(idx, ic, loaded)
+		}
+		logInputDone(ic, idx, len(i.input), container, start)
+	}
+
+	if len(claims) > 0 {
+		if err := resolveClaims(container, claims); err != nil {
+			return withErrorKind(ErrorKindInput, err)
+		}
+	}
+
+	if err := normalizeCountryCodes(container, i.countryCodes); err != nil {
+		return withErrorKind(ErrorKindInput, err)
+	}
+
+	if err := normalizeEmbeddedIPv4(container, i.embeddedIPv4); err != nil {
+		return withErrorKind(ErrorKindInput, err)
+	}
+
+	if err := materializeComposites(container, i.composites, i.compositeOrder); err != nil {
+		return withErrorKind(ErrorKindInput, err)
+	}
+
+	// Members of composite lists are filtered after they are materialized
+	if err := filterLists(container, i.wantedList, i.excludedList); err != nil {
+		return withErrorKind(ErrorKindInput, err)
+	}
+
+	if err := i.analyzeOverlaps(container); err != nil {
+		return withErrorKind(ErrorKindInput, err)
+	}
+
+	if i.needReport() {
+		i.report = newBuildReport(container, i.sources, stopRecordingDrops())
 	}
 
 	return nil
 }
 
 func (i *instance) RunOutput(container Container) error {
-	for _, oc := range i.output {
-		if err := oc.Output(container); err != nil {
+	restore, _, err := i.selectSteps()
+	defer restore()
+	if err != nil {
+		return err
+	}
+	return i.runOutputs(context.Background(), container)
+}
+
+func (i *instance) runOutputs(ctx context.Context, container Container) error {
+	for idx := range i.output {
+		if err := i.runOutputAt(ctx, idx, container); err != nil {
 			return err
 		}
 	}
@@ -108,20 +468,143 @@ func (i *instance) RunOutput(container Container) error {
 	return nil
 }
 
+// runOutputAt runs the output at the index with its options
+func (i *instance) runOutputAt(ctx context.Context, idx int, container Container) error {
+	oc := i.output[idx]
+	start := time.Now()
+	options := i.options.merge(i.outputOptions[idx])
+	options.routes = i.routes
+	if err := runOutput(ctx, oc, withOutputOptions(container, options)); err != nil {
+		return err
+	}
+	duration := time.Since(start)
+	slog.Info("output done", "index", idx, "plugin", oc.GetType(), "duration", duration)
+	ReportProgress(&ProgressEvent{Stage: ProgressOutput, Plugin: oc.GetType(), Index: idx, Total: len(i.output), Duration: duration, Done: true})
+	return nil
+}
+
 func (i *instance) Run() error {
-	if len(i.input) == 0 || len(i.output) == 0 {
-		return errors.New("input type and output type must be specified")
+	return i.RunContext(context.Background())
+}
+
+// RunContext runs all inputs and outputs enabled, which are canceled when the context
+// is done, then notifies the result and exports metrics of the run if configured
+func (i *instance) RunContext(ctx context.Context) error {
+	start := time.Now()
+	i.report, i.skipped = nil, false
+	restore, allDisabled, err := i.selectSteps()
+	defer restore()
+	if err != nil {
+		return err
+	}
+	if allDisabled {
+		slog.Info("run skipped, all inputs or outputs are disabled")
+		return nil
+	}
+
+	var collector *metricsCollector
+	if i.metrics != nil {
+		reporter := progressReporter
+		collector = newMetricsCollector(reporter)
+		SetProgressReporter(collector)
+		defer SetProgressReporter(reporter)
 	}
 
-	container := NewContainer()
+	err = i.run(ctx)
+	if err == nil {
+		i.shrinkGuard.save(i.report)
+	}
+	i.notify(ctx, start, err)
+	if collector != nil {
+		i.exportMetrics(ctx, collector, start, err)
+	}
+	return err
+}
 
-	if err := i.RunInput(container); err != nil {
+func (i *instance) run(ctx context.Context) error {
+	if (len(i.input) == 0 && i.restoreFile == "") || len(i.output) == 0 {
+		return withErrorKind(ErrorKindConfig, errors.New("input type and output type must be specified"))
+	}
+	if err := i.validateRoutes(); err != nil {
+		return err
+	}
+	if err := i.validateAggregation(); err != nil {
 		return err
 	}
 
-	if err := i.RunOutput(container); err != nil {
+	if i.stateFile != "" {
+		if i.restoreFile != "" {
+			return withErrorKind(ErrorKindConfig, errors.New("snapshots could not be restored in incremental builds"))
+		}
+		return i.runIncremental(ctx)
+	}
+
+	container, err := i.loadContainer(ctx)
+	if err != nil {
 		return err
 	}
 
+	if err := i.runOutputs(ctx, container); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// keepAddedPrefixes reports whether any output disables aggregation,
+// which needs the prefixes exactly as they are added
+func (i *instance) keepAddedPrefixes() bool {
+	for idx := range i.output {
+		if !i.options.merge(i.outputOptions[idx]).aggregate() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAggregation checks no input requiring aggregation is used with outputs
+// disabling it, whose prefixes exactly as they are added are not changed by the input
+func (i *instance) validateAggregation() error {
+	if !i.keepAddedPrefixes() {
+		return nil
+	}
+	for idx, ic := range i.input {
+		if ic, ok := ic.(AggregatedInputConverter); ok && ic.RequiresAggregation() {
+			return withErrorKind(ErrorKindConfig, fmt.Errorf("input %d (%s) requires aggregation, which is disabled by outputs", idx, ic.GetType()))
+		}
+	}
 	return nil
 }
+
+// logInputDone logs and reports the input with its duration. The duration of an input
+// loaded concurrently includes the time waiting for the inputs before it.
+func logInputDone(ic InputConverter, idx, total int, container Container, start time.Time) {
+	duration := time.Since(start)
+	slog.Info("input done", "index", idx, "plugin", ic.GetType(), "action", ic.GetAction(), "duration", duration)
+	ReportProgress(&ProgressEvent{Stage: ProgressInput, Plugin: ic.GetType(), Index: idx, Total: total, Entries: container.Len(), Duration: duration, Done: true})
+}
+
+// runInput runs the input with the context if it supports one
+func runInput(ctx context.Context, ic InputConverter, container Container) (Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var err error
+	if c, ok := ic.(ContextInputConverter); ok {
+		container, err = c.InputContext(ctx, container)
+	} else {
+		container, err = ic.Input(container)
+	}
+	return container, withErrorKind(ErrorKindInput, err)
+}
+
+// runOutput runs the output with the context if it supports one
+func runOutput(ctx context.Context, oc OutputConverter, container Container) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c, ok := oc.(ContextOutputConverter); ok {
+		return withErrorKind(ErrorKindOutput, c.OutputContext(ctx, container))
+	}
+	return withErrorKind(ErrorKindOutput, oc.Output(container))
+}
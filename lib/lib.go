@@ -1,9 +1,13 @@
 package lib
 
+import "context"
+
 const (
 	ActionAdd    Action = "add"
 	ActionRemove Action = "remove"
 	ActionOutput Action = "output"
+	// ActionReplace runs inputs with add action, whose lists replace the ones of the same names
+	ActionReplace Action = "replace"
 
 	IPv4 IPType = "ipv4"
 	IPv6 IPType = "ipv6"
@@ -13,9 +17,10 @@ const (
 )
 
 var ActionsRegistry = map[Action]bool{
-	ActionAdd:    true,
-	ActionRemove: true,
-	ActionOutput: true,
+	ActionAdd:     true,
+	ActionRemove:  true,
+	ActionOutput:  true,
+	ActionReplace: true,
 }
 
 type Action string
@@ -43,6 +48,22 @@ type InputConverter interface {
 	Input(Container) (Container, error)
 }
 
+// SourceInputConverter is implemented by input converters loading data only from
+// their sources, regardless of the lists of previous steps. With action add, they
+// could be run on empty containers concurrently, whose results are merged in order.
+type SourceInputConverter interface {
+	InputConverter
+	IsSourceInput() bool
+}
+
+// AggregatedInputConverter is implemented by input converters whose results only hold
+// for aggregated prefixes, like capping the number of prefixes of lists. They could not
+// be used with outputs disabling aggregation.
+type AggregatedInputConverter interface {
+	InputConverter
+	RequiresAggregation() bool
+}
+
 type OutputConverter interface {
 	Typer
 	Actioner
@@ -50,6 +71,20 @@ type OutputConverter interface {
 	Output(Container) error
 }
 
+// ContextInputConverter is implemented by input converters doing slow work like
+// downloading, which is canceled when the context is done
+type ContextInputConverter interface {
+	InputConverter
+	InputContext(context.Context, Container) (Container, error)
+}
+
+// ContextOutputConverter is implemented by output converters doing slow work like
+// calling remote APIs, which is canceled when the context is done
+type ContextOutputConverter interface {
+	OutputConverter
+	OutputContext(context.Context, Container) error
+}
+
 type IgnoreIPOption func() IPType
 
 func IgnoreIPv4() IPType {
@@ -0,0 +1,30 @@
+package lib
+
+import "log/slog"
+
+// filterLists removes the lists not matching the wanted lists if not empty, or matching
+// the excluded lists, which are set for all inputs and outputs by the "wantedList" and
+// "excludedList" fields of the config file
+func filterLists(container Container, wanted, excluded *ListMatcher) error {
+	if wanted.IsEmpty() && excluded.IsEmpty() {
+		return nil
+	}
+
+	removed := make([]*Entry, 0)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if (!wanted.IsEmpty() && !wanted.Match(name)) || excluded.Match(name) {
+			removed = append(removed, entry)
+		}
+	}
+	for _, entry := range removed {
+		if err := container.Remove(entry, CaseRemoveEntry); err != nil {
+			return err
+		}
+	}
+
+	if len(removed) > 0 {
+		slog.Info("lists filtered", "removed", len(removed), "remaining", container.Len())
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const lockfileVersion = 1
+
+// Lockfile pins the remote files downloaded by inputs to their content, written by
+// the lock command, so that locked builds are reproducible and auditable
+type Lockfile struct {
+	Version int             `json:"version"`
+	Time    time.Time       `json:"time"`
+	Sources []*LockedSource `json:"sources"` // sorted by URL
+}
+
+// LockedSource is a remote file downloaded by inputs
+type LockedSource struct {
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+var lockState struct {
+	sync.Mutex
+	recording map[string]*LockedSource // remote files downloaded while locking
+	locked    map[string]*LockedSource // remote files of the lockfile in locked mode
+}
+
+// ReadLockfile reads the lockfile written by the lock command
+func ReadLockfile(file string) (*Lockfile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lockfile := new(Lockfile)
+	if err := json.Unmarshal(content, lockfile); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", file, err)
+	}
+	if lockfile.Version != lockfileVersion {
+		return nil, fmt.Errorf("unsupported version %d of lockfile %s", lockfile.Version, file)
+	}
+	for _, source := range lockfile.Sources {
+		if !isRemoteURL(source.URL) {
+			return nil, fmt.Errorf("invalid url %q of lockfile %s", source.URL, file)
+		}
+		if _, err := parseSHA256(source.SHA256); err != nil {
+			return nil, fmt.Errorf("invalid sha256 of %s of lockfile %s", source.URL, file)
+		}
+	}
+	return lockfile, nil
+}
+
+func (l *Lockfile) writeFile(file string) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// SetLockfile enables locked mode, where every remote file downloaded by inputs must
+// be in the lockfile and match its SHA256 digest. Locked content in the download cache
+// is read without network access.
+func SetLockfile(file string) error {
+	lockfile, err := ReadLockfile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("lockfile %s not found, run the lock command to write it first", file)
+	}
+	if err != nil {
+		return err
+	}
+
+	lockState.Lock()
+	defer lockState.Unlock()
+	lockState.locked = make(map[string]*LockedSource, len(lockfile.Sources))
+	for _, source := range lockfile.Sources {
+		lockState.locked[source.URL] = source
+	}
+	return nil
+}
+
+// lockedSHA256 returns the locked digest of the URL in locked mode, or an empty
+// string if not in locked mode
+func lockedSHA256(url string) (string, error) {
+	lockState.Lock()
+	defer lockState.Unlock()
+	if lockState.locked == nil {
+		return "", nil
+	}
+	source, found := lockState.locked[url]
+	if !found {
+		return "", fmt.Errorf("%s is not in the lockfile, run the lock command to update it", url)
+	}
+	return strings.ToLower(strings.TrimPrefix(source.SHA256, "sha256:")), nil
+}
+
+// openLockedCache returns the cached body of the URL if it matches the locked digest
+func openLockedCache(url, expected string) (io.ReadCloser, bool) {
+	if downloadOptions.CacheDir == "" {
+		return nil, false
+	}
+	bodyPath, _, err := cachedBody(downloadOptions.CacheDir, url)
+	if err != nil {
+		return nil, false
+	}
+	body, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, false
+	}
+	verified, err := verifyChecksum(body, url, expected)
+	if err != nil {
+		slog.Debug("cached file not locked, downloading it again", "uri", url, "error", err)
+		return nil, false
+	}
+	slog.Debug("locked file read from the download cache", "uri", url)
+	return verified, true
+}
+
+// recordLockedSource reads the whole body of the URL to record it while locking,
+// and returns a reader of the body
+func recordLockedSource(url string, body io.ReadCloser) (io.ReadCloser, error) {
+	lockState.Lock()
+	recording := lockState.recording != nil
+	lockState.Unlock()
+	if !recording {
+		return body, nil
+	}
+
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+
+	lockState.Lock()
+	defer lockState.Unlock()
+	if lockState.recording != nil {
+		lockState.recording[url] = &LockedSource{
+			URL:       url,
+			SHA256:    hex.EncodeToString(sum[:]),
+			Size:      int64(len(content)),
+			FetchedAt: time.Now().UTC(),
+		}
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// LockContext runs all inputs enabled, recording every remote file they download,
+// and writes the lockfile of them, without running outputs
+func (i *instance) LockContext(ctx context.Context, file string) error {
+	if len(i.input) == 0 {
+		return withErrorKind(ErrorKindConfig, errors.New("input type must be specified"))
+	}
+
+	lockState.Lock()
+	lockState.recording = make(map[string]*LockedSource)
+	// Remote files are downloaded again to be locked, instead of verified
+	locked := lockState.locked
+	lockState.locked = nil
+	lockState.Unlock()
+	defer func() {
+		lockState.Lock()
+		lockState.recording, lockState.locked = nil, locked
+		lockState.Unlock()
+	}()
+
+	if err := i.RunInputContext(ctx, NewContainer()); err != nil {
+		return err
+	}
+
+	lockState.Lock()
+	lockfile := &Lockfile{Version: lockfileVersion, Time: BuildTime().UTC(), Sources: make([]*LockedSource, 0, len(lockState.recording))}
+	for _, source := range lockState.recording {
+		lockfile.Sources = append(lockfile.Sources, source)
+	}
+	lockState.Unlock()
+	slices.SortFunc(lockfile.Sources, func(a, b *LockedSource) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	if err := lockfile.writeFile(file); err != nil {
+		return err
+	}
+	slog.Info("lockfile written", "file", file, "sources", len(lockfile.Sources))
+	return nil
+}
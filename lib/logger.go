@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats supported by SetupLogger
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// SetupLogger sets the default logger used by lib and plugins, which writes
+// records at or above the level (debug, info, warn or error) in the format
+func SetupLogger(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %s, must be debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %s, must be %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// listMacros are the country codes of political and economic groupings, which are
+// maintained here as memberships change, so that lists of them are not updated by
+// hand. Macros are written as @name in wantedList, excludedList and composite lists.
+var listMacros = map[string][]string{
+	// European Union
+	"EU": strings.Fields(`AT BE BG CY CZ DE DK EE ES FI FR GR HR HU IE IT LT LU LV MT NL PL PT RO SE SI SK`),
+	// European Economic Area, the EU with Iceland, Liechtenstein and Norway
+	"EEA": strings.Fields(`AT BE BG CY CZ DE DK EE ES FI FR GR HR HU IE IT LT LU LV MT NL PL PT RO SE SI SK IS LI NO`),
+	// Schengen Area, with Bulgaria and Romania since 2025
+	"SCHENGEN": strings.Fields(`AT BE BG CH CZ DE DK EE ES FI FR GR HR HU IS IT LI LT LU LV MT NL NO PL PT RO SE SI SK`),
+	// Association of Southeast Asian Nations, with Timor-Leste since 2025
+	"ASEAN": strings.Fields(`BN ID KH LA MM MY PH SG TH TL VN`),
+	// Gulf Cooperation Council
+	"GCC": strings.Fields(`AE BH KW OM QA SA`),
+	// Intelligence alliances
+	"FIVE-EYES":     strings.Fields(`AU CA GB NZ US`),
+	"NINE-EYES":     strings.Fields(`AU CA GB NZ US DK FR NL NO`),
+	"FOURTEEN-EYES": strings.Fields(`AU CA GB NZ US DK FR NL NO BE DE ES IT SE`),
+	// North Atlantic Treaty Organization, with Finland since 2023 and Sweden since 2024
+	"NATO": strings.Fields(`AL BE BG CA CZ DE DK EE ES FI FR GB GR HR HU IS IT LT LU LV ME MK NL NO PL PT RO SE SI SK TR US`),
+	"G7":   strings.Fields(`CA DE FR GB IT JP US`),
+	// BRICS, with Egypt, Ethiopia, Iran and the United Arab Emirates since 2024 and Indonesia since 2025
+	"BRICS": strings.Fields(`BR CN IN RU ZA EG ET IR AE ID`),
+}
+
+// continentMacros name the continents of continentCountries as macros
+var continentMacros = map[string]string{
+	"AFRICA":        "AF",
+	"ANTARCTICA":    "AN",
+	"ASIA":          "AS",
+	"EUROPE":        "EU",
+	"NORTH-AMERICA": "NA",
+	"OCEANIA":       "OC",
+	"SOUTH-AMERICA": "SA",
+}
+
+// IsListMacro reports whether the name is a macro like @eu
+func IsListMacro(name string) bool {
+	return strings.HasPrefix(strings.TrimSpace(name), "@")
+}
+
+// ExpandListMacro returns the upper case country codes of the macro like @eu
+func ExpandListMacro(macro string) ([]string, error) {
+	name := strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(macro), "@"))
+	if codes, found := listMacros[name]; found {
+		return slices.Clone(codes), nil
+	}
+	if continent, found := continentMacros[name]; found {
+		return slices.Clone(continentCountries[continent]), nil
+	}
+	macros := slices.Collect(maps.Keys(listMacros))
+	macros = slices.AppendSeq(macros, maps.Keys(continentMacros))
+	slices.Sort(macros)
+	return nil, fmt.Errorf("unknown macro %s of lists, the value must be one of @%s", macro, strings.ToLower(strings.Join(macros, ", @")))
+}
@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ListMatcher matches names of lists against exact names, glob patterns like A*,
+// regular expressions enclosed in slashes like /^AS\d+$/, and macros of country
+// codes like @eu, all case-insensitive
+type ListMatcher struct {
+	list     []string
+	names    map[string]bool
+	patterns []*regexp.Regexp
+	macros   map[string]bool // country codes of macros, which are matched like patterns
+}
+
+// NewListMatcher returns the matcher of the names and patterns, empty ones are ignored
+func NewListMatcher(list []string) (*ListMatcher, error) {
+	m := &ListMatcher{
+		list:  make([]string, 0, len(list)),
+		names: make(map[string]bool),
+	}
+	for _, name := range list {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		m.list = append(m.list, name)
+
+		if IsListMacro(name) {
+			codes, err := ExpandListMacro(name)
+			if err != nil {
+				return nil, err
+			}
+			if m.macros == nil {
+				m.macros = make(map[string]bool, len(codes))
+			}
+			for _, code := range codes {
+				m.macros[code] = true
+			}
+			continue
+		}
+		if !IsListPattern(name) {
+			m.names[strings.ToUpper(name)] = true
+			continue
+		}
+		re, err := compileListPattern(name)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+// IsListPattern reports whether the name is a glob pattern, a regular expression or a macro
+func IsListPattern(name string) bool {
+	name = strings.TrimSpace(name)
+	if IsListMacro(name) {
+		return true
+	}
+	if len(name) >= 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		return true
+	}
+	return strings.ContainsAny(name, "*?")
+}
+
+// HasListPattern reports whether any of the names is a glob pattern, a regular expression or a macro
+func HasListPattern(list []string) bool {
+	return slices.ContainsFunc(list, IsListPattern)
+}
+
+// ValidateListPatterns checks that the patterns of the names are valid
+func ValidateListPatterns(list []string) error {
+	_, err := NewListMatcher(list)
+	return err
+}
+
+func compileListPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s of lists: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()), nil
+}
+
+// IsEmpty reports whether the matcher has no names or patterns
+func (m *ListMatcher) IsEmpty() bool {
+	return m == nil || len(m.list) == 0
+}
+
+// Match reports whether the name of the list is one of the names or matches any pattern
+func (m *ListMatcher) Match(name string) bool {
+	if m == nil {
+		return false
+	}
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if m.names[name] || m.macros[name] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the exact names, and the names of lists in the container matching any pattern or macro
+func (m *ListMatcher) Expand(container Container) []string {
+	if m.IsEmpty() {
+		return nil
+	}
+	list := make([]string, 0, len(m.names))
+	for name := range m.names {
+		list = append(list, name)
+	}
+	if len(m.patterns) > 0 || len(m.macros) > 0 {
+		for entry := range container.Loop() {
+			if name := entry.GetName(); !m.names[name] && m.Match(name) {
+				list = append(list, name)
+			}
+		}
+	}
+	slices.Sort(list)
+	return list
+}
+
+func (m *ListMatcher) String() string {
+	return fmt.Sprintf("%v", m.list)
+}
+
+// MarshalJSON returns the names and patterns, so that converters are fingerprinted by them
+func (m *ListMatcher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.list)
+}
+
+// ExpandWantedList returns the wanted lists, with the patterns expanded to the names of lists in the container
+func ExpandWantedList(container Container, want []string) []string {
+	if !HasListPattern(want) {
+		return want
+	}
+	m, err := NewListMatcher(want)
+	if err != nil {
+		return nil
+	}
+	return m.Expand(container)
+}
+
+// validateListFilters checks the patterns of wantedList and excludedList
+// in args of outputs, which are matched when the lists are filtered
+func validateListFilters(args json.RawMessage) error {
+	if len(args) == 0 {
+		return nil
+	}
+	var tmp struct {
+		Want    []string `json:"wantedList"`
+		Exclude []string `json:"excludedList"`
+	}
+	if err := json.Unmarshal(args, &tmp); err != nil {
+		// Invalid args are reported by the converter
+		return nil
+	}
+	if err := ValidateListPatterns(tmp.Want); err != nil {
+		return err
+	}
+	return ValidateListPatterns(tmp.Exclude)
+}
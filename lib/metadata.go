@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// Metadata is the optional information of prefixes, kept by inputs which have it,
+// and output by outputs which could represent it
+type Metadata struct {
+	ASN        uint32  `json:"asn,omitempty"`        // number of the origin autonomous system
+	City       string  `json:"city,omitempty"`       // name of the city
+	Source     string  `json:"source,omitempty"`     // name of the feed where the prefix comes from
+	Confidence float64 `json:"confidence,omitempty"` // confidence of the data, between 0 and 1
+}
+
+// IsZero reports whether the metadata has no information
+func (m Metadata) IsZero() bool {
+	return m == Metadata{}
+}
+
+// prefixMetadata is the metadata of a prefix added to an entry
+type prefixMetadata struct {
+	prefix   netip.Prefix
+	metadata Metadata
+}
+
+// PrefixWithMetadata is a prefix of an entry with its metadata, which is nil if unknown
+type PrefixWithMetadata struct {
+	Prefix   netip.Prefix
+	Metadata *Metadata
+}
+
+// AddPrefixWithMetadata adds the prefix to the entry the same as AddPrefix,
+// and records the metadata of it if not zero
+func (e *Entry) AddPrefixWithMetadata(cidr any, metadata Metadata) error {
+	prefix, ipType, err := processPrefix(cidr)
+	if err != nil {
+		return err
+	}
+	if err := e.add(prefix, ipType); err != nil {
+		return err
+	}
+	if !metadata.IsZero() {
+		e.metadata = append(e.metadata, prefixMetadata{prefix: prefix.Masked(), metadata: metadata})
+	}
+	return nil
+}
+
+// AddMetadata records the metadata of the prefix without adding the prefix, so that
+// the metadata of prefixes already in the list of the same name in a container could
+// be added by Container.Add
+func (e *Entry) AddMetadata(cidr any, metadata Metadata) error {
+	prefix, _, err := processPrefix(cidr)
+	if err != nil {
+		return err
+	}
+	if !metadata.IsZero() {
+		e.metadata = append(e.metadata, prefixMetadata{prefix: prefix.Masked(), metadata: metadata})
+	}
+	return nil
+}
+
+// metadataOf returns the metadata of prefixes, except the ones of the ignored IP type
+func (e *Entry) metadataOf(ignoreIPType IPType) []prefixMetadata {
+	if ignoreIPType == "" {
+		return e.metadata
+	}
+	kept := make([]prefixMetadata, 0, len(e.metadata))
+	for _, pm := range e.metadata {
+		if pm.prefix.Addr().Is4() != (ignoreIPType == IPv4) {
+			kept = append(kept, pm)
+		}
+	}
+	return kept
+}
+
+// HasMetadata reports whether any prefix of the entry has metadata
+func (e *Entry) HasMetadata() bool {
+	return len(e.metadata) > 0
+}
+
+// MarshalPrefixWithMetadata returns the prefixes of the entry the same as MarshalPrefix,
+// which are split so that every prefix has only one metadata. When prefixes with
+// different metadata overlap, the most specific one wins, or the one added later
+// if they are the same prefix.
+func (e *Entry) MarshalPrefixWithMetadata(opts ...IgnoreIPOption) ([]PrefixWithMetadata, error) {
+	if !e.HasMetadata() {
+		prefixes, err := e.MarshalPrefix(opts...)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]PrefixWithMetadata, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			result = append(result, PrefixWithMetadata{Prefix: prefix})
+		}
+		return result, nil
+	}
+
+	var ignoreIPType IPType
+	for _, opt := range opts {
+		if opt != nil {
+			ignoreIPType = opt()
+		}
+	}
+
+	if err := e.buildIPSet(); err != nil {
+		return nil, err
+	}
+
+	result := make([]PrefixWithMetadata, 0, 1024)
+	if ignoreIPType != IPv4 && e.hasIPv4() {
+		prefixes, err := e.splitByMetadata(e.ipv4.set, e.ipv4.added, true, e.options.maxIPv4PrefixLength())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, prefixes...)
+	}
+	if ignoreIPType != IPv6 && e.hasIPv6() {
+		prefixes, err := e.splitByMetadata(e.ipv6.set, e.ipv6.added, false, e.options.maxIPv6PrefixLength())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, prefixes...)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+	}
+	return result, nil
+}
+
+// splitByMetadata splits the set of one IP type into prefixes by their metadata
+func (e *Entry) splitByMetadata(set *netipx.IPSet, added []netip.Prefix, is4 bool, maxBits int) ([]PrefixWithMetadata, error) {
+	// Only the last metadata of the same prefix is kept
+	pms := make([]prefixMetadata, 0, len(e.metadata))
+	for _, pm := range e.metadata {
+		if pm.prefix.Addr().Is4() == is4 {
+			pms = append(pms, pm)
+		}
+	}
+	slices.SortStableFunc(pms, func(a, b prefixMetadata) int {
+		return comparePrefix(a.prefix, b.prefix)
+	})
+	pms = compactLast(pms)
+
+	// Prefixes are sorted by address then length, so that the more specific
+	// prefixes contained in a prefix follow it
+	groups := make(map[Metadata]*netipx.IPSetBuilder)
+	var withMetadata netipx.IPSetBuilder
+	for idx, pm := range pms {
+		builder, found := groups[pm.metadata]
+		if !found {
+			builder = new(netipx.IPSetBuilder)
+			groups[pm.metadata] = builder
+		}
+		builder.AddPrefix(pm.prefix)
+		withMetadata.AddPrefix(pm.prefix)
+		for _, next := range pms[idx+1:] {
+			if !pm.prefix.Contains(next.prefix.Addr()) {
+				break
+			}
+			if next.metadata != pm.metadata {
+				builder.RemovePrefix(next.prefix)
+			}
+		}
+	}
+
+	result := make([]PrefixWithMetadata, 0, len(added))
+	appendGroup := func(builder *netipx.IPSetBuilder, metadata *Metadata) error {
+		builder.Intersect(set)
+		groupSet, err := builder.IPSet()
+		if err != nil {
+			return err
+		}
+		prefixes, err := e.processPrefixes(groupSet, added, maxBits)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range prefixes {
+			result = append(result, PrefixWithMetadata{Prefix: prefix, Metadata: metadata})
+		}
+		return nil
+	}
+
+	// Groups are sorted, so that the same prefixes collapsed by the max prefix
+	// length always keep the same metadata
+	metadataList := make([]Metadata, 0, len(groups))
+	for metadata := range groups {
+		metadataList = append(metadataList, metadata)
+	}
+	slices.SortFunc(metadataList, compareMetadata)
+	for _, metadata := range metadataList {
+		if err := appendGroup(groups[metadata], &metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	withMetadataSet, err := withMetadata.IPSet()
+	if err != nil {
+		return nil, err
+	}
+	var withoutMetadata netipx.IPSetBuilder
+	withoutMetadata.AddSet(set)
+	withoutMetadata.RemoveSet(withMetadataSet)
+	if err := appendGroup(&withoutMetadata, nil); err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(result, func(a, b PrefixWithMetadata) int {
+		return comparePrefix(a.Prefix, b.Prefix)
+	})
+	// Prefixes collapsed by the max prefix length could be the same
+	return slices.CompactFunc(result, func(a, b PrefixWithMetadata) bool {
+		return a.Prefix == b.Prefix
+	}), nil
+}
+
+// compactLast removes the sorted prefixes which are the same as the next one
+func compactLast(pms []prefixMetadata) []prefixMetadata {
+	compacted := pms[:0]
+	for idx, pm := range pms {
+		if idx+1 < len(pms) && pms[idx+1].prefix == pm.prefix {
+			continue
+		}
+		compacted = append(compacted, pm)
+	}
+	return compacted
+}
+
+func compareMetadata(a, b Metadata) int {
+	return cmp.Or(
+		cmp.Compare(a.ASN, b.ASN),
+		cmp.Compare(a.City, b.City),
+		cmp.Compare(a.Source, b.Source),
+		cmp.Compare(a.Confidence, b.Confidence),
+	)
+}
@@ -0,0 +1,414 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetricsJob     = "geoip"
+	defaultMetricsTimeout = 30 * time.Second
+)
+
+// MetricsOptions are the options of exporting metrics of every run, set by the
+// "metrics" field of the config file, so that many scheduled builders could be
+// monitored centrally
+type MetricsOptions struct {
+	// Pushgateway is the Prometheus Pushgateway metrics are pushed to
+	Pushgateway *PushgatewayOptions `json:"pushgateway"`
+	// OTLP is the OpenTelemetry collector metrics are exported to
+	OTLP *OTLPOptions `json:"otlp"`
+	// Labels identify the builder, like instance, which are the grouping key of
+	// Pushgateway and attributes of the resource of OTLP
+	Labels map[string]string `json:"labels"`
+	// Proxy of requests, see httpClient
+	Proxy string `json:"proxy"`
+	// Timeout of all exports of a run, 30s by default
+	Timeout string `json:"timeout"`
+}
+
+// PushgatewayOptions are the options of pushing metrics to a Prometheus Pushgateway
+type PushgatewayOptions struct {
+	// URL of the Pushgateway, like http://pushgateway:9091
+	URL string `json:"url"`
+	// Job of the grouping key, geoip by default
+	Job string `json:"job"`
+	// Headers are sent with requests, like Authorization
+	Headers map[string]string `json:"headers"`
+}
+
+// OTLPOptions are the options of exporting metrics by OTLP over HTTP in JSON
+type OTLPOptions struct {
+	// Endpoint of metrics of the collector, like http://collector:4318/v1/metrics
+	Endpoint string `json:"endpoint"`
+	// Headers are sent with requests, like Authorization
+	Headers map[string]string `json:"headers"`
+}
+
+func (o *MetricsOptions) validate() error {
+	if o.Pushgateway == nil && o.OTLP == nil {
+		return errors.New("invalid metrics: pushgateway or otlp must be specified")
+	}
+	if err := validateProxy(o.Proxy); err != nil {
+		return err
+	}
+	if err := validateTimeout(o.Timeout); err != nil {
+		return err
+	}
+	for name := range o.Labels {
+		if !isMetricName(name) || strings.HasPrefix(name, "__") || name == "job" {
+			return fmt.Errorf("invalid metrics label %q", name)
+		}
+	}
+	if p := o.Pushgateway; p != nil {
+		if err := validateNotifyURL(p.URL); err != nil {
+			return fmt.Errorf("invalid pushgateway: %w", err)
+		}
+		if err := validateHeaders(p.Headers); err != nil {
+			return fmt.Errorf("invalid pushgateway: %w", err)
+		}
+	}
+	if o.OTLP != nil {
+		if err := validateNotifyURL(o.OTLP.Endpoint); err != nil {
+			return fmt.Errorf("invalid otlp: %w", err)
+		}
+		if err := validateHeaders(o.OTLP.Headers); err != nil {
+			return fmt.Errorf("invalid otlp: %w", err)
+		}
+	}
+	return nil
+}
+
+func isMetricName(name string) bool {
+	for idx, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (idx == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// metric is a gauge with its data points
+type metric struct {
+	name   string
+	help   string
+	unit   string // unit of OTLP, like s or By
+	points []*metricPoint
+}
+
+type metricPoint struct {
+	labels [][2]string
+	value  float64
+}
+
+// metricsCollector collects metrics of a run from progress events, which are passed on to next
+type metricsCollector struct {
+	mu        sync.Mutex
+	next      ProgressReporter
+	downloads map[string]*ProgressEvent    // last events by URI
+	parses    map[[2]string]*ProgressEvent // last events by plugin and source
+	inputs    []*ProgressEvent
+	outputs   []*ProgressEvent
+}
+
+func newMetricsCollector(next ProgressReporter) *metricsCollector {
+	return &metricsCollector{
+		next:      next,
+		downloads: make(map[string]*ProgressEvent),
+		parses:    make(map[[2]string]*ProgressEvent),
+	}
+}
+
+func (c *metricsCollector) Report(ev *ProgressEvent) {
+	if c.next != nil {
+		c.next.Report(ev)
+	}
+	if !ev.Done {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch ev.Stage {
+	case ProgressDownload:
+		c.downloads[metricsURI(ev.URI)] = ev
+	case ProgressParse:
+		source := ev.List
+		if ev.URI != "" {
+			source = metricsURI(ev.URI)
+		}
+		c.parses[[2]string{ev.Plugin, source}] = ev
+	case ProgressInput:
+		c.inputs = append(c.inputs, ev)
+	case ProgressOutput:
+		c.outputs = append(c.outputs, ev)
+	}
+}
+
+// metricsURI removes the credentials, query and fragment of URLs, which may contain secrets
+func metricsURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return uri
+	}
+	u.User, u.RawQuery, u.ForceQuery, u.Fragment = nil, "", false, ""
+	return u.String()
+}
+
+// metrics returns the metrics of the run, sorted by name
+func (c *metricsCollector) metrics(start time.Time, runErr error, report *BuildReport) []*metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	success := 0.0
+	if runErr == nil {
+		success = 1
+	}
+	metrics := []*metric{
+		{name: "geoip_build_duration_seconds", help: "Duration of the last build.", unit: "s",
+			points: []*metricPoint{{value: time.Since(start).Seconds()}}},
+		{name: "geoip_build_success", help: "Whether the last build succeeded.",
+			points: []*metricPoint{{value: success}}},
+		{name: "geoip_build_timestamp_seconds", help: "Start time of the last build in Unix seconds.", unit: "s",
+			points: []*metricPoint{{value: float64(start.UnixMilli()) / 1000}}},
+	}
+
+	downloadBytes := &metric{name: "geoip_download_bytes", help: "Bytes of remote files downloaded.", unit: "By"}
+	downloadDuration := &metric{name: "geoip_download_duration_seconds", help: "Duration of downloading remote files.", unit: "s"}
+	for uri, ev := range c.downloads {
+		labels := [][2]string{{"uri", uri}}
+		downloadBytes.points = append(downloadBytes.points, &metricPoint{labels: labels, value: float64(ev.Bytes)})
+		downloadDuration.points = append(downloadDuration.points, &metricPoint{labels: labels, value: ev.Duration.Seconds()})
+	}
+
+	parseLines := &metric{name: "geoip_parse_lines", help: "Lines of files parsed by inputs."}
+	parseDuration := &metric{name: "geoip_parse_duration_seconds", help: "Duration of parsing files by inputs.", unit: "s"}
+	for key, ev := range c.parses {
+		labels := [][2]string{{"plugin", key[0]}, {"source", key[1]}}
+		parseLines.points = append(parseLines.points, &metricPoint{labels: labels, value: float64(ev.Lines)})
+		parseDuration.points = append(parseDuration.points, &metricPoint{labels: labels, value: ev.Duration.Seconds()})
+	}
+
+	inputDuration := &metric{name: "geoip_input_duration_seconds", help: "Duration of inputs.", unit: "s"}
+	inputLists := &metric{name: "geoip_input_lists", help: "Lists in the container after inputs."}
+	for _, ev := range c.inputs {
+		labels := [][2]string{{"index", strconv.Itoa(ev.Index)}, {"plugin", ev.Plugin}}
+		inputDuration.points = append(inputDuration.points, &metricPoint{labels: labels, value: ev.Duration.Seconds()})
+		inputLists.points = append(inputLists.points, &metricPoint{labels: labels, value: float64(ev.Entries)})
+	}
+
+	outputDuration := &metric{name: "geoip_output_duration_seconds", help: "Duration of outputs writing files.", unit: "s"}
+	for _, ev := range c.outputs {
+		labels := [][2]string{{"index", strconv.Itoa(ev.Index)}, {"plugin", ev.Plugin}}
+		outputDuration.points = append(outputDuration.points, &metricPoint{labels: labels, value: ev.Duration.Seconds()})
+	}
+
+	metrics = append(metrics, downloadBytes, downloadDuration, parseLines, parseDuration, inputDuration, inputLists, outputDuration)
+
+	if report != nil {
+		var ipv4, ipv6 int
+		for _, list := range report.Lists {
+			ipv4 += list.IPv4Prefixes
+			ipv6 += list.IPv6Prefixes
+		}
+		metrics = append(metrics,
+			&metric{name: "geoip_lists", help: "Lists generated by the last successful build.",
+				points: []*metricPoint{{value: float64(len(report.Lists))}}},
+			&metric{name: "geoip_prefixes", help: "Prefixes of all lists generated by the last successful build.",
+				points: []*metricPoint{{labels: [][2]string{{"family", "ipv4"}}, value: float64(ipv4)}, {labels: [][2]string{{"family", "ipv6"}}, value: float64(ipv6)}}},
+		)
+	}
+
+	metrics = slices.DeleteFunc(metrics, func(m *metric) bool {
+		return len(m.points) == 0
+	})
+	for _, m := range metrics {
+		slices.SortFunc(m.points, func(a, b *metricPoint) int {
+			return slices.CompareFunc(a.labels, b.labels, func(x, y [2]string) int {
+				return strings.Compare(x[1], y[1])
+			})
+		})
+	}
+	slices.SortFunc(metrics, func(a, b *metric) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return metrics
+}
+
+// exportMetrics pushes the metrics of the run to the Pushgateway and the OTLP collector.
+// Failures of exports are logged without failing the run.
+func (i *instance) exportMetrics(ctx context.Context, collector *metricsCollector, start time.Time, runErr error) {
+	opts := i.metrics
+	var report *BuildReport
+	if runErr == nil {
+		report = i.report
+	}
+	metrics := collector.metrics(start, runErr, report)
+
+	timeout := defaultMetricsTimeout
+	if opts.Timeout != "" {
+		// The timeout has been validated when the config is parsed
+		timeout, _ = time.ParseDuration(opts.Timeout)
+	}
+	// Failures are exported even if the run is canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	client := httpClient(opts.Proxy)
+	if opts.Pushgateway != nil {
+		if err := opts.pushPrometheus(ctx, client, metrics); err != nil {
+			slog.Warn("failed to push metrics to the pushgateway", "err", err)
+		} else {
+			slog.Info("metrics pushed to the pushgateway", "metrics", len(metrics))
+		}
+	}
+	if opts.OTLP != nil {
+		if err := opts.exportOTLP(ctx, client, metrics, start); err != nil {
+			slog.Warn("failed to export metrics by otlp", "err", err)
+		} else {
+			slog.Info("metrics exported by otlp", "metrics", len(metrics))
+		}
+	}
+}
+
+// pushPrometheus PUTs the metrics in the Prometheus text format to the grouping key
+// of the job and labels, replacing all metrics of the last run
+func (o *MetricsOptions) pushPrometheus(ctx context.Context, client *http.Client, metrics []*metric) error {
+	job := o.Pushgateway.Job
+	if job == "" {
+		job = defaultMetricsJob
+	}
+	endpoint := strings.TrimSuffix(o.Pushgateway.URL, "/") + "/metrics" + groupingPath("job", job)
+	names := make([]string, 0, len(o.Labels))
+	for name := range o.Labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		endpoint += groupingPath(name, o.Labels[name])
+	}
+
+	var b bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, point := range m.points {
+			b.WriteString(m.name)
+			if len(point.labels) > 0 {
+				b.WriteByte('{')
+				for idx, label := range point.labels {
+					if idx > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", label[0], labelValueReplacer.Replace(label[1]))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteString(" " + strconv.FormatFloat(point.value, 'g', -1, 64) + "\n")
+		}
+	}
+	return postMetrics(ctx, client, http.MethodPut, endpoint, "text/plain; version=0.0.4", b.Bytes(), o.Pushgateway.Headers)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// groupingPath returns the path of a label of the grouping key of Pushgateway,
+// in base64 if the value is empty or has slashes
+func groupingPath(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+// exportOTLP POSTs the metrics as gauges to the OTLP collector, in the JSON encoding of OTLP over HTTP
+func (o *MetricsOptions) exportOTLP(ctx context.Context, client *http.Client, metrics []*metric, start time.Time) error {
+	type point struct {
+		StartTimeUnixNano string  `json:"startTimeUnixNano"`
+		TimeUnixNano      string  `json:"timeUnixNano"`
+		AsDouble          float64 `json:"asDouble"`
+		Attributes        []any   `json:"attributes,omitempty"`
+	}
+	attribute := func(key, value string) any {
+		return map[string]any{"key": key, "value": map[string]string{"stringValue": value}}
+	}
+
+	startTime, now := strconv.FormatInt(start.UnixNano(), 10), strconv.FormatInt(time.Now().UnixNano(), 10)
+	otlpMetrics := make([]any, 0, len(metrics))
+	for _, m := range metrics {
+		points := make([]*point, 0, len(m.points))
+		for _, p := range m.points {
+			attributes := make([]any, 0, len(p.labels))
+			for _, label := range p.labels {
+				attributes = append(attributes, attribute(label[0], label[1]))
+			}
+			points = append(points, &point{StartTimeUnixNano: startTime, TimeUnixNano: now, AsDouble: p.value, Attributes: attributes})
+		}
+		otlpMetric := map[string]any{"name": m.name, "description": m.help, "gauge": map[string]any{"dataPoints": points}}
+		if m.unit != "" {
+			otlpMetric["unit"] = m.unit
+		}
+		otlpMetrics = append(otlpMetrics, otlpMetric)
+	}
+
+	resource := []any{attribute("service.name", defaultMetricsJob), attribute("service.version", ToolVersion())}
+	names := make([]string, 0, len(o.Labels))
+	for name := range o.Labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		resource = append(resource, attribute(name, o.Labels[name]))
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": resource},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": defaultMetricsJob, "version": ToolVersion()},
+				"metrics": otlpMetrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return postMetrics(ctx, client, http.MethodPost, o.OTLP.Endpoint, "application/json", body, o.OTLP.Headers)
+}
+
+func postMetrics(ctx context.Context, client *http.Client, method, endpoint, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "geoip/"+ToolVersion())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,351 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Types of notification targets
+const (
+	NotificationWebhook  = "webhook"
+	NotificationTelegram = "telegram"
+	NotificationSlack    = "slack"
+)
+
+// Events notified after runs
+const (
+	NotifyOnSuccess = "success"
+	NotifyOnFailure = "failure"
+	NotifyOnChange  = "change" // a successful run changing lists versus the last one
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	defaultNotifyTimeout  = 30 * time.Second
+	maxNotifyHighlights   = 10
+)
+
+// NotificationOptions are the options of notifying the result of every run,
+// set by the "notifications" field of the config file
+type NotificationOptions struct {
+	// ReportFile keeps the build report of the last successful run, which lists
+	// are compared with for highlights of changes
+	ReportFile string `json:"reportFile"`
+	// Proxy of requests, see httpClient
+	Proxy string `json:"proxy"`
+	// Timeout of all notifications of a run, 30s by default
+	Timeout string `json:"timeout"`
+	// Targets are the webhooks and chats to notify
+	Targets []*NotificationTarget `json:"targets"`
+}
+
+// NotificationTarget is a webhook or chat to notify
+type NotificationTarget struct {
+	// Type is webhook, telegram or slack
+	Type string `json:"type"`
+	// On are the events to notify, success and failure by default
+	On []string `json:"on"`
+	// URL of the webhook, or the incoming webhook of Slack, SLACK_WEBHOOK_URL in environment by default
+	URL string `json:"url"`
+	// Headers are sent with requests of the webhook
+	Headers map[string]string `json:"headers"`
+	// BotToken of Telegram, TELEGRAM_BOT_TOKEN in environment by default
+	BotToken string `json:"botToken"`
+	// ChatID of Telegram, TELEGRAM_CHAT_ID in environment by default
+	ChatID string `json:"chatID"`
+	// APIURL of Telegram, for self-hosted Bot API servers
+	APIURL string `json:"apiURL"`
+}
+
+// Notification is the JSON payload POSTed to webhooks
+type Notification struct {
+	Event      string       `json:"event"`
+	Success    bool         `json:"success"`
+	Skipped    bool         `json:"skipped,omitempty"` // incremental builds skipped as nothing changed
+	Error      string       `json:"error,omitempty"`
+	ErrorKind  string       `json:"errorKind,omitempty"`
+	Start      time.Time    `json:"start"`
+	Duration   string       `json:"duration"`
+	Version    string       `json:"version"`
+	Summary    string       `json:"summary"`
+	Highlights []string     `json:"highlights,omitempty"` // changes of lists versus the last run
+	Report     *BuildReport `json:"report,omitempty"`
+}
+
+func (o *NotificationOptions) validate() error {
+	if err := validateProxy(o.Proxy); err != nil {
+		return err
+	}
+	if err := validateTimeout(o.Timeout); err != nil {
+		return err
+	}
+	for idx, target := range o.Targets {
+		if err := target.validate(); err != nil {
+			return fmt.Errorf("invalid notification target %d: %w", idx, err)
+		}
+	}
+	return nil
+}
+
+func (t *NotificationTarget) validate() error {
+	switch t.Type = strings.ToLower(strings.TrimSpace(t.Type)); t.Type {
+	case NotificationWebhook:
+		if err := validateNotifyURL(t.URL); err != nil {
+			return err
+		}
+		if err := validateHeaders(t.Headers); err != nil {
+			return err
+		}
+	case NotificationSlack:
+		// The URL could be in the environment, which is a secret
+		if t.URL != "" {
+			if err := validateNotifyURL(t.URL); err != nil {
+				return err
+			}
+		}
+	case NotificationTelegram:
+		if t.APIURL != "" {
+			if err := validateNotifyURL(t.APIURL); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %q, the value must be %s, %s or %s", t.Type, NotificationWebhook, NotificationTelegram, NotificationSlack)
+	}
+
+	for _, event := range t.On {
+		switch strings.ToLower(strings.TrimSpace(event)) {
+		case NotifyOnSuccess, NotifyOnFailure, NotifyOnChange:
+		default:
+			return fmt.Errorf("invalid event %q, the value must be %s, %s or %s", event, NotifyOnSuccess, NotifyOnFailure, NotifyOnChange)
+		}
+	}
+	return nil
+}
+
+func validateNotifyURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q, must be an http or https URL", rawURL)
+	}
+	return nil
+}
+
+// on reports whether the target is notified of the event
+func (t *NotificationTarget) on(event string) bool {
+	if len(t.On) == 0 {
+		return event == NotifyOnSuccess || event == NotifyOnFailure
+	}
+	return slices.ContainsFunc(t.On, func(e string) bool {
+		return strings.EqualFold(strings.TrimSpace(e), event)
+	})
+}
+
+// notify sends the result of the run to all targets. Failures of notifications
+// are logged without failing the run.
+func (i *instance) notify(ctx context.Context, start time.Time, runErr error) {
+	opts := i.notifications
+	if opts == nil || len(opts.Targets) == 0 {
+		return
+	}
+
+	n := &Notification{
+		Event:    NotifyOnSuccess,
+		Success:  runErr == nil,
+		Skipped:  runErr == nil && i.skipped,
+		Start:    start.UTC(),
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Version:  ToolVersion(),
+	}
+	if runErr != nil {
+		n.Event = NotifyOnFailure
+		n.Error = runErr.Error()
+		n.ErrorKind = ErrorKind(runErr)
+	} else if i.report != nil {
+		n.Report = i.report
+		if opts.ReportFile != "" {
+			previous, err := ReadBuildReport(opts.ReportFile)
+			if err != nil {
+				slog.Warn("failed to read the report of notifications", "file", opts.ReportFile, "err", err)
+			}
+			n.Report.Compare(previous)
+			if err := n.Report.WriteFile(opts.ReportFile); err != nil {
+				slog.Warn("failed to write the report of notifications", "file", opts.ReportFile, "err", err)
+			}
+		}
+		n.Highlights = reportHighlights(n.Report)
+	}
+	n.Summary = n.summary()
+
+	timeout := defaultNotifyTimeout
+	if opts.Timeout != "" {
+		// The timeout has been validated when the config is parsed
+		timeout, _ = time.ParseDuration(opts.Timeout)
+	}
+	// Failures are notified even if the run is canceled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	client := httpClient(opts.Proxy)
+	for idx, target := range opts.Targets {
+		if !target.on(n.Event) && !(n.Success && len(n.Highlights) > 0 && target.on(NotifyOnChange)) {
+			continue
+		}
+		if err := target.send(ctx, client, n); err != nil {
+			slog.Warn("failed to notify", "index", idx, "type", target.Type, "err", err)
+			continue
+		}
+		slog.Info("notified", "index", idx, "type", target.Type, "event", n.Event)
+	}
+}
+
+// summary returns the first line of messages
+func (n *Notification) summary() string {
+	if !n.Success {
+		return fmt.Sprintf("geoip build failed after %s: %s", n.Duration, n.Error)
+	}
+	if n.Skipped {
+		return "geoip build skipped, nothing changed since the last run"
+	}
+	if n.Report == nil {
+		return fmt.Sprintf("geoip build succeeded in %s", n.Duration)
+	}
+	return fmt.Sprintf("geoip build succeeded in %s, %d lists, %d changed", n.Duration, len(n.Report.Lists), len(n.Highlights))
+}
+
+// message returns the text of chat messages, the summary followed by highlights
+func (n *Notification) message() string {
+	var b strings.Builder
+	if n.Success {
+		b.WriteString("✅ ")
+	} else {
+		b.WriteString("❌ ")
+	}
+	b.WriteString(n.Summary)
+	for idx, highlight := range n.Highlights {
+		if idx == maxNotifyHighlights {
+			fmt.Fprintf(&b, "\n• and %d more", len(n.Highlights)-idx)
+			break
+		}
+		b.WriteString("\n• " + highlight)
+	}
+	return b.String()
+}
+
+// reportHighlights describes the lists changed versus the last run,
+// which are new, removed or with different prefixes or addresses
+func reportHighlights(r *BuildReport) []string {
+	highlights := make([]string, 0)
+	for _, list := range r.Lists {
+		delta := list.Delta
+		if delta == nil {
+			continue
+		}
+		if delta.New {
+			highlights = append(highlights, fmt.Sprintf("%s: new, %d IPv4 and %d IPv6 prefixes", list.Name, list.IPv4Prefixes, list.IPv6Prefixes))
+			continue
+		}
+		changes := make([]string, 0, 4)
+		if delta.IPv4Prefixes != 0 {
+			changes = append(changes, "IPv4 prefixes"+formatDelta(big.NewInt(int64(delta.IPv4Prefixes))))
+		}
+		if delta.IPv6Prefixes != 0 {
+			changes = append(changes, "IPv6 prefixes"+formatDelta(big.NewInt(int64(delta.IPv6Prefixes))))
+		}
+		if delta.IPv4Addresses != nil && delta.IPv4Addresses.Sign() != 0 {
+			changes = append(changes, "IPv4 addresses"+formatDelta(delta.IPv4Addresses))
+		}
+		if delta.IPv6Addresses != nil && delta.IPv6Addresses.Sign() != 0 {
+			changes = append(changes, "IPv6 addresses"+formatDelta(delta.IPv6Addresses))
+		}
+		if len(changes) > 0 {
+			highlights = append(highlights, list.Name+": "+strings.Join(changes, ", "))
+		}
+	}
+	for _, name := range r.RemovedLists {
+		highlights = append(highlights, name+": removed")
+	}
+	return highlights
+}
+
+// send POSTs the notification to the target
+func (t *NotificationTarget) send(ctx context.Context, client *http.Client, n *Notification) error {
+	var endpoint string
+	var payload any
+	headers := map[string]string{}
+
+	switch t.Type {
+	case NotificationWebhook:
+		endpoint, payload, headers = t.URL, n, t.Headers
+	case NotificationSlack:
+		if endpoint = t.URL; endpoint == "" {
+			endpoint = os.Getenv("SLACK_WEBHOOK_URL")
+		}
+		if endpoint == "" {
+			return errors.New("url of the incoming webhook must be specified in config or SLACK_WEBHOOK_URL")
+		}
+		payload = map[string]string{"text": n.message()}
+	case NotificationTelegram:
+		token, chatID := t.BotToken, t.ChatID
+		if token == "" {
+			token = os.Getenv("TELEGRAM_BOT_TOKEN")
+		}
+		if chatID == "" {
+			chatID = os.Getenv("TELEGRAM_CHAT_ID")
+		}
+		if token == "" || chatID == "" {
+			return errors.New("botToken and chatID must be specified in config or TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID")
+		}
+		apiURL := t.APIURL
+		if apiURL == "" {
+			apiURL = defaultTelegramAPIURL
+		}
+		endpoint = strings.TrimSuffix(apiURL, "/") + "/bot" + token + "/sendMessage"
+		payload = map[string]any{"chat_id": chatID, "text": n.message(), "disable_web_page_preview": true}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		// The URL may contain secrets, like the bot token
+		return errors.New("invalid url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "geoip/"+ToolVersion())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// Do not log the URL, which may contain secrets
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("http status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
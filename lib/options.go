@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// OutputOptions control which entries are output, and how their prefixes are
+// marshaled for outputs. They are set for all outputs by the "options" field of
+// the config file, and could be overridden by the args with the same names of
+// every output.
+type OutputOptions struct {
+	// Aggregate merges adjacent and overlapping prefixes into the minimal
+	// covering set when true (default), or preserves the prefixes exactly
+	// as they are added by inputs when false.
+	Aggregate *bool `json:"aggregate"`
+
+	// MaxIPv4PrefixLength and MaxIPv6PrefixLength collapse prefixes longer
+	// than them into their parent prefixes, zero means no limit.
+	MaxIPv4PrefixLength int `json:"maxIPv4PrefixLength"`
+	MaxIPv6PrefixLength int `json:"maxIPv6PrefixLength"`
+
+	// WantedTags and ExcludedTags filter entries by their tags. Only entries
+	// with any of WantedTags are output if not empty, and entries with any of
+	// ExcludedTags are never output.
+	WantedTags   []string `json:"wantedTags"`
+	ExcludedTags []string `json:"excludedTags"`
+
+	// Route is the name of the route in the "routes" field of the config file,
+	// whose lists are the only ones output. Outputs without a route only output
+	// the lists not in any route.
+	Route string `json:"route"`
+
+	// routes are all routes of the config file, set when the output is run
+	routes map[string]*RouteOptions
+}
+
+// parseOutputOptions reads output options from the args of an output
+func parseOutputOptions(args json.RawMessage) (*OutputOptions, error) {
+	opts := new(OutputOptions)
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// merge returns options with unset fields of override filled by o
+func (o *OutputOptions) merge(override *OutputOptions) *OutputOptions {
+	merged := new(OutputOptions)
+	if o != nil {
+		*merged = *o
+	}
+	if override == nil {
+		return merged
+	}
+	if override.Aggregate != nil {
+		merged.Aggregate = override.Aggregate
+	}
+	if override.MaxIPv4PrefixLength != 0 {
+		merged.MaxIPv4PrefixLength = override.MaxIPv4PrefixLength
+	}
+	if override.MaxIPv6PrefixLength != 0 {
+		merged.MaxIPv6PrefixLength = override.MaxIPv6PrefixLength
+	}
+	if override.WantedTags != nil {
+		merged.WantedTags = override.WantedTags
+	}
+	if override.ExcludedTags != nil {
+		merged.ExcludedTags = override.ExcludedTags
+	}
+	if override.Route != "" {
+		merged.Route = override.Route
+	}
+	return merged
+}
+
+func (o *OutputOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.MaxIPv4PrefixLength < 0 || o.MaxIPv4PrefixLength > 32 {
+		return fmt.Errorf("invalid maxIPv4PrefixLength %d, the value must be between 0 and 32", o.MaxIPv4PrefixLength)
+	}
+	if o.MaxIPv6PrefixLength < 0 || o.MaxIPv6PrefixLength > 128 {
+		return fmt.Errorf("invalid maxIPv6PrefixLength %d, the value must be between 0 and 128", o.MaxIPv6PrefixLength)
+	}
+	return nil
+}
+
+func (o *OutputOptions) isDefault() bool {
+	return o == nil || (o.Aggregate == nil && o.MaxIPv4PrefixLength == 0 && o.MaxIPv6PrefixLength == 0 &&
+		len(o.WantedTags) == 0 && len(o.ExcludedTags) == 0 && o.Route == "" && len(o.routes) == 0)
+}
+
+// wanted reports whether the entry is output by its tags and routes
+func (o *OutputOptions) wanted(entry *Entry) bool {
+	if o == nil {
+		return true
+	}
+	if len(o.WantedTags) > 0 && !entry.HasTag(o.WantedTags...) {
+		return false
+	}
+	return !entry.HasTag(o.ExcludedTags...) && o.routed(entry)
+}
+
+func (o *OutputOptions) aggregate() bool {
+	return o == nil || o.Aggregate == nil || *o.Aggregate
+}
+
+func (o *OutputOptions) maxIPv4PrefixLength() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxIPv4PrefixLength
+}
+
+func (o *OutputOptions) maxIPv6PrefixLength() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxIPv6PrefixLength
+}
+
+// optionsContainer is a read-only view of a container for an output,
+// whose entries are filtered by tags and marshaled with the options
+type optionsContainer struct {
+	Container
+	options *OutputOptions
+}
+
+func withOutputOptions(container Container, options *OutputOptions) Container {
+	if options.isDefault() {
+		return container
+	}
+	return &optionsContainer{
+		Container: container,
+		options:   options,
+	}
+}
+
+func (c *optionsContainer) GetEntry(name string) (*Entry, bool) {
+	entry, found := c.Container.GetEntry(name)
+	if !found || !c.options.wanted(entry) {
+		return nil, false
+	}
+	return entry.withOutputOptions(c.options), true
+}
+
+func (c *optionsContainer) Len() int {
+	count := 0
+	for entry := range c.Container.Loop() {
+		if c.options.wanted(entry) {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *optionsContainer) Loop() <-chan *Entry {
+	ch := make(chan *Entry, c.Container.Len())
+	go func() {
+		for entry := range c.Container.Loop() {
+			if c.options.wanted(entry) {
+				ch <- entry.withOutputOptions(c.options)
+			}
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+func (c *optionsContainer) Entries() iter.Seq[*Entry] {
+	return func(yield func(*Entry) bool) {
+		for entry := range c.Container.Entries() {
+			if c.options.wanted(entry) && !yield(entry.withOutputOptions(c.options)) {
+				return
+			}
+		}
+	}
+}
+
+// Lookup ignores the options other than wanted and excluded tags
+func (c *optionsContainer) Lookup(cidr any) ([]string, error) {
+	return lookupEntries(c.Entries(), cidr)
+}
+
+// preservePrefixes returns the prefixes added to the entry which are still
+// in the final set. Prefixes partially removed are reduced to the remaining parts.
+func preservePrefixes(added []netip.Prefix, set *netipx.IPSet) ([]netip.Prefix, error) {
+	added = slices.Clone(added)
+	slices.SortFunc(added, comparePrefix)
+	added = slices.Compact(added)
+
+	prefixes := make([]netip.Prefix, 0, len(added))
+	for _, prefix := range added {
+		if set.ContainsPrefix(prefix) {
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+		if !set.OverlapsPrefix(prefix) {
+			continue
+		}
+
+		var builder netipx.IPSetBuilder
+		builder.AddPrefix(prefix)
+		builder.Intersect(set)
+		remaining, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, remaining.Prefixes()...)
+	}
+
+	return prefixes, nil
+}
+
+// clampPrefixes collapses prefixes longer than maxBits into their parent prefixes.
+// The result is aggregated again when aggregate is true, otherwise only
+// duplicates are removed.
+func clampPrefixes(prefixes []netip.Prefix, maxBits int, aggregate bool) ([]netip.Prefix, error) {
+	if maxBits <= 0 {
+		return prefixes, nil
+	}
+
+	clamped := make([]netip.Prefix, 0, len(prefixes))
+	changed := false
+	for _, prefix := range prefixes {
+		if prefix.Bits() > maxBits {
+			prefix = netip.PrefixFrom(prefix.Addr(), maxBits).Masked()
+			changed = true
+		}
+		clamped = append(clamped, prefix)
+	}
+
+	if !changed {
+		return prefixes, nil
+	}
+
+	if !aggregate {
+		slices.SortFunc(clamped, comparePrefix)
+		return slices.Compact(clamped), nil
+	}
+
+	var builder netipx.IPSetBuilder
+	for _, prefix := range clamped {
+		builder.AddPrefix(prefix)
+	}
+	set, err := builder.IPSet()
+	if err != nil {
+		return nil, err
+	}
+	return set.Prefixes(), nil
+}
+
+func comparePrefix(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
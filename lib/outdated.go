@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Statuses of remote files checked by CheckSources
+const (
+	SourceUnchanged = "unchanged" // no new data
+	SourceOutdated  = "outdated"  // new data
+	SourceUnknown   = "unknown"   // failed to check
+)
+
+// SourceStatus is the freshness of a remote file
+type SourceStatus struct {
+	URL          string `json:"url"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason"`
+	LastModified string `json:"lastModified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+}
+
+// CheckSources checks whether the remote files of the lockfile, or the ones in the download
+// cache if the lockfile is nil, have new data, without writing them to the download cache.
+// Files are revalidated by their ETag and Last-Modified in the download cache if any, then
+// compared by SHA256 digests if downloaded.
+func CheckSources(ctx context.Context, lockfile *Lockfile) ([]*SourceStatus, error) {
+	if downloadOptions.Offline {
+		return nil, errors.New("sources could not be checked in offline mode")
+	}
+
+	locked := make(map[string]string)
+	if lockfile != nil {
+		for _, source := range lockfile.Sources {
+			locked[source.URL] = strings.ToLower(strings.TrimPrefix(source.SHA256, "sha256:"))
+		}
+	} else {
+		if downloadOptions.CacheDir == "" {
+			return nil, errors.New("no lockfile or cacheDir of download to check sources against")
+		}
+		metaPaths, err := filepath.Glob(filepath.Join(downloadOptions.CacheDir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, metaPath := range metaPaths {
+			if meta, err := readCacheMeta(metaPath); err == nil && meta.URL != "" {
+				locked[meta.URL] = ""
+			}
+		}
+	}
+
+	statuses := make([]*SourceStatus, 0, len(locked))
+	for url, digest := range locked {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		status := &SourceStatus{URL: url}
+		if err := checkSource(ctx, status, digest); err != nil {
+			status.Status, status.Reason = SourceUnknown, err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b *SourceStatus) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+	return statuses, nil
+}
+
+// checkSource checks the remote file against the locked digest, or the cached one if empty
+func checkSource(ctx context.Context, status *SourceStatus, locked string) error {
+	client, headers, timeout := requestSettings(getSourceOptions(status.URL))
+
+	var meta *cacheMeta
+	var cached string
+	if downloadOptions.CacheDir != "" {
+		if bodyPath, m, err := cachedBody(downloadOptions.CacheDir, status.URL); err == nil {
+			if digest, err := fileSHA256(bodyPath); err == nil {
+				meta, cached = m, digest
+			}
+		}
+	}
+	expected := locked
+	if expected == "" {
+		expected = cached
+	}
+	if expected == "" {
+		return errors.New("not in the download cache")
+	}
+
+	// Validators of the cached file are only valid if it is the content expected
+	if meta != nil && cached == expected {
+		if meta.ETag != "" {
+			headers.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			headers.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = headers
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	status.LastModified, status.ETag = resp.Header.Get("Last-Modified"), resp.Header.Get("ETag")
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		status.Status, status.Reason = SourceUnchanged, "not modified"
+		return nil
+	case http.StatusOK:
+	default:
+		return &statusError{url: status.URL, status: resp.Status, code: resp.StatusCode}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", status.URL, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) == expected {
+		status.Status, status.Reason = SourceUnchanged, "same content"
+	} else {
+		status.Status, status.Reason = SourceOutdated, "content changed"
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,271 @@
+package lib
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go4.org/netipx"
+)
+
+// Actions of conflicts found between lists
+const (
+	ConflictActionFail = "fail"
+	ConflictActionWarn = "warn"
+)
+
+const maxLoggedConflicts = 10
+
+// OverlapOptions are the options of analyzing prefixes in multiple lists after
+// all inputs, set by the "overlaps" field of the config file
+type OverlapOptions struct {
+	// File is the path of the JSON file of overlaps and conflicts, for review
+	File string `json:"file"`
+	// Lists are the names or patterns of lists analyzed, all lists by default
+	Lists []string `json:"lists"`
+	// Conflicts are groups of names or patterns of lists which must not overlap,
+	// like ["cn", "us"]. Lists matching the same name or pattern of a group
+	// could overlap, like ["private", "/^[a-z]{2}$/"] only forbids prefixes in
+	// both private and any list of country codes.
+	Conflicts [][]string `json:"conflicts"`
+	// Action is fail or warn, fail by default
+	Action string `json:"action"`
+
+	lists     *ListMatcher
+	conflicts [][]*ListMatcher
+}
+
+// OverlapReport has the prefixes in multiple lists
+type OverlapReport struct {
+	Time      time.Time  `json:"time"`
+	Overlaps  []*Overlap `json:"overlaps"`
+	Conflicts []*Overlap `json:"conflicts,omitempty"`
+}
+
+// Overlap has the prefixes in all the lists, and in no other analyzed list
+type Overlap struct {
+	Lists        []string            `json:"lists"`
+	IPv4Prefixes int                 `json:"ipv4Prefixes"`
+	IPv6Prefixes int                 `json:"ipv6Prefixes"`
+	Prefixes     []string            `json:"prefixes"`
+	Sources      map[string][]string `json:"sources,omitempty"` // inputs adding prefixes to the lists
+}
+
+func (o *OverlapOptions) validate() error {
+	var err error
+	if o.lists, err = NewListMatcher(o.Lists); err != nil {
+		return fmt.Errorf("%v in lists of overlaps", err)
+	}
+
+	o.conflicts = make([][]*ListMatcher, 0, len(o.Conflicts))
+	for idx, group := range o.Conflicts {
+		if len(group) < 2 {
+			return fmt.Errorf("conflict %d of overlaps must have at least 2 lists", idx)
+		}
+		matchers := make([]*ListMatcher, 0, len(group))
+		for _, name := range group {
+			m, err := NewListMatcher([]string{name})
+			if err != nil {
+				return fmt.Errorf("%v in conflict %d of overlaps", err, idx)
+			}
+			if m.IsEmpty() {
+				return fmt.Errorf("empty list in conflict %d of overlaps", idx)
+			}
+			matchers = append(matchers, m)
+		}
+		o.conflicts = append(o.conflicts, matchers)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(o.Action)) {
+	case "", ConflictActionFail, ConflictActionWarn:
+	default:
+		return fmt.Errorf("invalid action %s of overlaps, the value must be %s or %s", o.Action, ConflictActionFail, ConflictActionWarn)
+	}
+	return nil
+}
+
+// conflicting reports whether the lists match at least two names or patterns of any conflict group
+func (o *OverlapOptions) conflicting(lists []string) bool {
+	for _, group := range o.conflicts {
+		matched := 0
+		for _, m := range group {
+			if slices.ContainsFunc(lists, m.Match) {
+				matched++
+			}
+		}
+		if matched >= 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapRange is a range of addresses in the lists
+type overlapRange struct {
+	lists []string
+	r     netipx.IPRange
+}
+
+// findOverlaps returns the ranges in multiple sets, sweeping the boundaries of all
+// ranges of the sets in order, instead of intersecting every pair of sets
+func findOverlaps(names []string, sets []*netipx.IPSet, last netip.Addr) []overlapRange {
+	type boundary struct {
+		addr  netip.Addr
+		list  int
+		start bool
+	}
+	boundaries := make([]boundary, 0)
+	for idx, set := range sets {
+		for _, r := range set.Ranges() {
+			boundaries = append(boundaries, boundary{r.From(), idx, true})
+			// Ranges to the last address end with the sweep
+			if next := r.To().Next(); next.IsValid() {
+				boundaries = append(boundaries, boundary{next, idx, false})
+			}
+		}
+	}
+	slices.SortFunc(boundaries, func(a, b boundary) int {
+		return a.addr.Compare(b.addr)
+	})
+
+	overlaps := make([]overlapRange, 0)
+	active := make(map[int]bool)
+	for k := 0; k < len(boundaries); {
+		from := boundaries[k].addr
+		for ; k < len(boundaries) && boundaries[k].addr == from; k++ {
+			if boundaries[k].start {
+				active[boundaries[k].list] = true
+			} else {
+				delete(active, boundaries[k].list)
+			}
+		}
+		if len(active) < 2 {
+			continue
+		}
+
+		to := last
+		if k < len(boundaries) {
+			to = boundaries[k].addr.Prev()
+		}
+		lists := make([]string, 0, len(active))
+		for idx := range active {
+			lists = append(lists, names[idx])
+		}
+		slices.Sort(lists)
+
+		// Adjacent ranges in the same lists are merged
+		if n := len(overlaps); n > 0 && overlaps[n-1].r.To().Next() == from && slices.Equal(overlaps[n-1].lists, lists) {
+			overlaps[n-1].r = netipx.IPRangeFrom(overlaps[n-1].r.From(), to)
+			continue
+		}
+		overlaps = append(overlaps, overlapRange{lists, netipx.IPRangeFrom(from, to)})
+	}
+	return overlaps
+}
+
+// analyzeOverlaps reports prefixes in multiple lists, grouped by the lists they
+// are in, then writes the report to the file and checks the conflicts
+func (i *instance) analyzeOverlaps(container Container) error {
+	o := i.overlaps
+	if o == nil {
+		return nil
+	}
+
+	names := make([]string, 0, container.Len())
+	ipv4Sets, ipv6Sets := make([]*netipx.IPSet, 0, container.Len()), make([]*netipx.IPSet, 0, container.Len())
+	for entry := range container.Loop() {
+		if !o.lists.IsEmpty() && !o.lists.Match(entry.GetName()) {
+			continue
+		}
+		ipv4Set, ipv6Set := new(netipx.IPSet), new(netipx.IPSet)
+		if set, err := entry.GetIPv4Set(); err == nil {
+			ipv4Set = set
+		}
+		if set, err := entry.GetIPv6Set(); err == nil {
+			ipv6Set = set
+		}
+		names = append(names, strings.ToLower(entry.GetName()))
+		ipv4Sets, ipv6Sets = append(ipv4Sets, ipv4Set), append(ipv6Sets, ipv6Set)
+	}
+
+	ranges := findOverlaps(names, ipv4Sets, netip.MustParseAddr("255.255.255.255"))
+	ranges = append(ranges, findOverlaps(names, ipv6Sets, netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))...)
+
+	groups := make(map[string]*Overlap)
+	for _, r := range ranges {
+		key := strings.Join(r.lists, ",")
+		overlap, found := groups[key]
+		if !found {
+			overlap = &Overlap{Lists: r.lists, Prefixes: make([]string, 0)}
+			for _, name := range r.lists {
+				if sources := i.sources[strings.ToUpper(name)]; len(sources) > 0 {
+					if overlap.Sources == nil {
+						overlap.Sources = make(map[string][]string)
+					}
+					overlap.Sources[name] = sources
+				}
+			}
+			groups[key] = overlap
+		}
+		for _, prefix := range r.r.Prefixes() {
+			if prefix.Addr().Is4() {
+				overlap.IPv4Prefixes++
+			} else {
+				overlap.IPv6Prefixes++
+			}
+			overlap.Prefixes = append(overlap.Prefixes, prefix.String())
+		}
+	}
+
+	report := &OverlapReport{
+		Time:     BuildTime().UTC(),
+		Overlaps: make([]*Overlap, 0, len(groups)),
+	}
+	for _, overlap := range groups {
+		report.Overlaps = append(report.Overlaps, overlap)
+		if o.conflicting(overlap.Lists) {
+			report.Conflicts = append(report.Conflicts, overlap)
+		}
+	}
+	compareOverlaps := func(a, b *Overlap) int {
+		return cmp.Compare(strings.Join(a.Lists, ","), strings.Join(b.Lists, ","))
+	}
+	slices.SortFunc(report.Overlaps, compareOverlaps)
+	slices.SortFunc(report.Conflicts, compareOverlaps)
+
+	slog.Info("overlaps of lists analyzed", "lists", len(names), "overlaps", len(report.Overlaps), "conflicts", len(report.Conflicts))
+
+	if o.File != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(o.File, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		slog.Info("overlaps written", "file", o.File)
+	}
+
+	if len(report.Conflicts) == 0 {
+		return nil
+	}
+	conflicts := make([]string, 0, maxLoggedConflicts)
+	for _, overlap := range report.Conflicts[:min(len(report.Conflicts), maxLoggedConflicts)] {
+		conflicts = append(conflicts, fmt.Sprintf("%d prefixes in %s, like %s", len(overlap.Prefixes), strings.Join(overlap.Lists, " and "), overlap.Prefixes[0]))
+	}
+	if len(report.Conflicts) > maxLoggedConflicts {
+		conflicts = append(conflicts, fmt.Sprintf("and %d more", len(report.Conflicts)-maxLoggedConflicts))
+	}
+	if strings.ToLower(strings.TrimSpace(o.Action)) == ConflictActionWarn {
+		slog.Warn("conflicts of lists found", "conflicts", strings.Join(conflicts, "; "))
+		return nil
+	}
+	return errors.New("conflicts of lists found: " + strings.Join(conflicts, "; "))
+}
@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// PrintPlan prints the pipeline planned by the config, without running it
+func (i *instance) PrintPlan(w io.Writer) error {
+	if len(i.input) == 0 || len(i.output) == 0 {
+		return fmt.Errorf("input type and output type must be specified")
+	}
+	if err := i.validateRoutes(); err != nil {
+		return err
+	}
+	if err := i.validateAggregation(); err != nil {
+		return err
+	}
+
+	if err := i.validateProfiles(); err != nil {
+		return err
+	}
+
+	// Conditions are evaluated as if the pipeline ran now
+	env := currentConditionEnv(i.defaultProfile())
+
+	if len(i.profiles) > 0 {
+		fmt.Fprintln(w, "Profiles:")
+		current := env.profile
+		for _, name := range i.profileNames() {
+			marks := make([]string, 0, 2)
+			if i.profiles[name].Default {
+				marks = append(marks, "default")
+			}
+			if name == current {
+				marks = append(marks, "selected")
+			}
+			line := "  - " + name
+			if len(marks) > 0 {
+				line += " (" + strings.Join(marks, ", ") + ")"
+			}
+			if description := i.profiles[name].Description; description != "" {
+				line += ": " + description
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	fmt.Fprintln(w, "Input:")
+	for idx, ic := range i.input {
+		settings := converterSettings(ic)
+		if priority := i.inputPriorities[idx]; priority != nil {
+			settings = append(settings, fmt.Sprintf("priority=%d", *priority))
+		}
+		if tags := i.inputTags[idx]; len(tags) > 0 {
+			settings = append(settings, "tags="+strings.Join(tags, ","))
+		}
+		if condition := i.inputConditions[idx]; condition != nil {
+			settings = append(settings, fmt.Sprintf("enabled=%q (%t now)", condition, condition.enabled(env)))
+		}
+		printPlanStep(w, idx, ic.GetType(), ic.GetAction(), settings)
+	}
+
+	if i.countryCodes != nil {
+		settings := []string{"unknown=" + i.countryCodes.unknown()}
+		if len(i.countryCodes.Aliases) > 0 {
+			aliases := make([]string, 0, len(i.countryCodes.Aliases))
+			for from, to := range i.countryCodes.Aliases {
+				aliases = append(aliases, strings.ToLower(strings.TrimSpace(from))+"→"+strings.ToLower(strings.TrimSpace(to)))
+			}
+			slices.Sort(aliases)
+			settings = append(settings, "aliases="+strings.Join(aliases, ","))
+		}
+		if known := i.countryCodes.known(); len(known) > 0 {
+			settings = append(settings, "known="+strings.ToLower(strings.Join(known, ",")))
+		}
+		fmt.Fprintf(w, "Country codes: %s\n", strings.Join(settings, " "))
+	}
+
+	if i.embeddedIPv4 != nil {
+		ipv4Mapped, sixToFour, teredo := i.embeddedIPv4.modes()
+		fmt.Fprintf(w, "Embedded IPv4: ipv4Mapped=%s 6to4=%s teredo=%s\n", ipv4Mapped, sixToFour, teredo)
+	}
+
+	if !i.wantedList.IsEmpty() || !i.excludedList.IsEmpty() {
+		settings := make([]string, 0, 2)
+		if !i.wantedList.IsEmpty() {
+			settings = append(settings, "wantedList="+i.wantedList.String())
+		}
+		if !i.excludedList.IsEmpty() {
+			settings = append(settings, "excludedList="+i.excludedList.String())
+		}
+		fmt.Fprintf(w, "Lists: %s\n", strings.Join(settings, " "))
+	}
+
+	if len(i.compositeOrder) > 0 {
+		fmt.Fprintln(w, "Composites:")
+		for _, name := range i.compositeOrder {
+			fmt.Fprintf(w, "  - %s = %s\n", strings.ToLower(name), strings.ToLower(strings.Join(i.composites[name], " ∪ ")))
+		}
+	}
+
+	if i.overlaps != nil {
+		settings := make([]string, 0, 4)
+		if i.overlaps.File != "" {
+			settings = append(settings, "file="+i.overlaps.File)
+		}
+		if !i.overlaps.lists.IsEmpty() {
+			settings = append(settings, "lists="+i.overlaps.lists.String())
+		}
+		if len(i.overlaps.Conflicts) > 0 {
+			conflicts := make([]string, 0, len(i.overlaps.Conflicts))
+			for _, group := range i.overlaps.Conflicts {
+				conflicts = append(conflicts, strings.ToLower(strings.Join(group, "+")))
+			}
+			action := strings.ToLower(strings.TrimSpace(i.overlaps.Action))
+			if action == "" {
+				action = ConflictActionFail
+			}
+			settings = append(settings, "conflicts="+strings.Join(conflicts, ","), "action="+action)
+		}
+		fmt.Fprintf(w, "Overlaps: %s\n", strings.Join(settings, " "))
+	}
+
+	if i.shrinkGuard != nil {
+		settings := []string{"reportFile=" + i.shrinkGuard.ReportFile}
+		if maxShrink, action := i.shrinkGuard.threshold(""); strings.TrimSpace(maxShrink) != "" {
+			settings = append(settings, "maxShrink="+strings.TrimSpace(maxShrink), "action="+action)
+		}
+		if len(i.shrinkGuard.Lists) > 0 {
+			lists := make([]string, 0, len(i.shrinkGuard.Lists))
+			for name := range i.shrinkGuard.Lists {
+				maxShrink, action := i.shrinkGuard.threshold(strings.ToLower(strings.TrimSpace(name)))
+				lists = append(lists, fmt.Sprintf("%s:%s:%s", strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(maxShrink), action))
+			}
+			slices.Sort(lists)
+			settings = append(settings, "lists="+strings.Join(lists, ","))
+		}
+		fmt.Fprintf(w, "Shrink guard: %s\n", strings.Join(settings, " "))
+	}
+
+	if len(i.routes) > 0 {
+		fmt.Fprintln(w, "Routes:")
+		names := make([]string, 0, len(i.routes))
+		for name := range i.routes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			route, settings := i.routes[name], make([]string, 0, 2)
+			if len(route.Lists) > 0 {
+				settings = append(settings, "lists="+strings.ToLower(strings.Join(route.Lists, ",")))
+			}
+			if len(route.Tags) > 0 {
+				settings = append(settings, "tags="+strings.Join(route.Tags, ","))
+			}
+			fmt.Fprintf(w, "  - %s %s\n", name, strings.Join(settings, " "))
+		}
+	}
+
+	fmt.Fprintln(w, "Output:")
+	for idx, oc := range i.output {
+		settings := converterSettings(oc)
+		if options := i.options.merge(i.outputOptions[idx]); !options.isDefault() {
+			settings = append(settings, fmt.Sprintf("aggregate=%t", options.aggregate()))
+			if options.MaxIPv4PrefixLength > 0 {
+				settings = append(settings, fmt.Sprintf("maxIPv4PrefixLength=%d", options.MaxIPv4PrefixLength))
+			}
+			if options.MaxIPv6PrefixLength > 0 {
+				settings = append(settings, fmt.Sprintf("maxIPv6PrefixLength=%d", options.MaxIPv6PrefixLength))
+			}
+			if len(options.WantedTags) > 0 {
+				settings = append(settings, "wantedTags="+strings.Join(options.WantedTags, ","))
+			}
+			if len(options.ExcludedTags) > 0 {
+				settings = append(settings, "excludedTags="+strings.Join(options.ExcludedTags, ","))
+			}
+			if options.Route != "" {
+				settings = append(settings, "route="+options.Route)
+			}
+		}
+		if condition := i.outputConditions[idx]; condition != nil {
+			settings = append(settings, fmt.Sprintf("enabled=%q (%t now)", condition, condition.enabled(env)))
+		}
+		printPlanStep(w, idx, oc.GetType(), oc.GetAction(), settings)
+	}
+
+	if i.notifications != nil && len(i.notifications.Targets) > 0 {
+		fmt.Fprintln(w, "Notifications:")
+		for _, target := range i.notifications.Targets {
+			on := target.On
+			if len(on) == 0 {
+				on = []string{NotifyOnSuccess, NotifyOnFailure}
+			}
+			fmt.Fprintf(w, "  - %s on=%s\n", target.Type, strings.ToLower(strings.Join(on, ",")))
+		}
+	}
+
+	if i.metrics != nil {
+		fmt.Fprintln(w, "Metrics:")
+		if i.metrics.Pushgateway != nil {
+			fmt.Fprintf(w, "  - pushgateway %s\n", i.metrics.Pushgateway.URL)
+		}
+		if i.metrics.OTLP != nil {
+			fmt.Fprintf(w, "  - otlp %s\n", i.metrics.OTLP.Endpoint)
+		}
+	}
+
+	return nil
+}
+
+func printPlanStep(w io.Writer, idx int, iType string, action Action, settings []string) {
+	fmt.Fprintf(w, "  %d. %s (%s)\n", idx+1, iType, action)
+	for _, setting := range settings {
+		fmt.Fprintf(w, "       %s\n", setting)
+	}
+}
+
+// converterSettings returns the non-empty exported fields of the converter,
+// like sources, wanted lists and output directories
+func converterSettings(converter any) []string {
+	if r, ok := converter.(*replaceInput); ok {
+		converter = r.InputConverter
+	}
+	v := reflect.ValueOf(converter)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	settings := make([]string, 0, v.NumField())
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Type().Field(idx)
+		value := v.Field(idx)
+		switch field.Name {
+		case "Type", "Action", "Description":
+			continue
+		}
+		if !field.IsExported() || value.IsZero() {
+			continue
+		}
+		if (value.Kind() == reflect.Map || value.Kind() == reflect.Slice) && value.Len() == 0 {
+			continue
+		}
+		if value.Kind() == reflect.Func || value.Kind() == reflect.Chan {
+			continue
+		}
+		// Empty matchers of wanted and excluded lists
+		if e, ok := value.Interface().(interface{ IsEmpty() bool }); ok && e.IsEmpty() {
+			continue
+		}
+
+		formatted := fmt.Sprintf("%v", value.Interface())
+		switch {
+		case isSecretSetting(field.Name):
+			formatted = "***"
+		case value.Kind() == reflect.Map && value.Type().Elem().Kind() == reflect.Bool:
+			// Sets of names, like wanted lists
+			keys := make([]string, 0, value.Len())
+			for _, key := range value.MapKeys() {
+				keys = append(keys, fmt.Sprintf("%v", key.Interface()))
+			}
+			slices.Sort(keys)
+			formatted = fmt.Sprintf("%v", keys)
+		}
+		settings = append(settings, fmt.Sprintf("%s=%s", field.Name, formatted))
+	}
+	return settings
+}
+
+func isSecretSetting(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"secret", "token", "password", "licensekey"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
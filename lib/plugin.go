@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PluginLoader loads the plugin file of the path, and registers its input and
+// output converters as the type of the name, to be used in the config file.
+// Loading the same plugin more than once must not fail, since the config file
+// could be loaded again, e.g. for every run of the serve command.
+type PluginLoader func(name, path string) error
+
+var pluginLoaderCache = make(map[string]PluginLoader)
+
+// RegisterPluginLoader registers the loader of plugin files with the extension, like ".wasm"
+func RegisterPluginLoader(ext string, loader PluginLoader) error {
+	ext = strings.ToLower(ext)
+	if _, found := pluginLoaderCache[ext]; found {
+		return errors.New("plugin loader has already been registered")
+	}
+	pluginLoaderCache[ext] = loader
+	return nil
+}
+
+// loadPlugins loads the plugins defined by the config file, whose paths
+// are resolved relative to the directory of the config file
+func loadPlugins(plugins map[string]string, configFile string) error {
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		path := strings.TrimSpace(plugins[name])
+		if name = strings.TrimSpace(name); name == "" || path == "" {
+			return fmt.Errorf("name and path of plugin must not be empty")
+		}
+
+		loader, found := pluginLoaderCache[strings.ToLower(filepath.Ext(path))]
+		if !found {
+			return fmt.Errorf("unsupported plugin %s: %s", name, path)
+		}
+
+		if !filepath.IsAbs(path) && configFile != "" {
+			if isRemoteConfig(configFile) {
+				return fmt.Errorf("path of plugin %s in remote config file must be absolute: %s", name, path)
+			}
+			path = filepath.Join(filepath.Dir(configFile), path)
+		}
+		if err := loader(name, path); err != nil {
+			return fmt.Errorf("failed to load plugin %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// prefixSet stores the prefixes of one IP type of a list. It holds either the
+// built set, or the builder of the set with pending changes, but never both,
+// so that prefixes are not stored twice. The builder is compacted to a set
+// when the list is stored in a container, so that lists at rest only keep
+// their merged ranges, instead of every prefix added.
+type prefixSet struct {
+	builder *netipx.IPSetBuilder
+	set     *netipx.IPSet
+
+	// prefixes exactly as they are added, used when aggregation is disabled
+	added []netip.Prefix
+}
+
+// mutable returns the builder of the set, created from the set if it is built
+func (s *prefixSet) mutable() *netipx.IPSetBuilder {
+	if s.builder == nil {
+		s.builder = new(netipx.IPSetBuilder)
+		if s.set != nil {
+			s.builder.AddSet(s.set)
+			s.set = nil
+		}
+	}
+	return s.builder
+}
+
+func (s *prefixSet) addPrefix(prefix netip.Prefix, keepAdded bool) {
+	s.mutable().AddPrefix(prefix)
+	if keepAdded {
+		s.added = append(s.added, prefix)
+	}
+}
+
+func (s *prefixSet) removePrefix(prefix netip.Prefix) {
+	s.mutable().RemovePrefix(prefix)
+}
+
+func (s *prefixSet) addSet(set *netipx.IPSet) {
+	if s.builder == nil && s.set == nil {
+		// Sets are immutable, so it is shared until the prefix set is changed
+		s.set = set
+		return
+	}
+	s.mutable().AddSet(set)
+}
+
+func (s *prefixSet) removeSet(set *netipx.IPSet) {
+	s.mutable().RemoveSet(set)
+}
+
+// compact builds the set of the builder, and trims the prefixes added,
+// so that the set is never changed when it is read
+func (s *prefixSet) compact() error {
+	// Compacted sets could be shared and read concurrently
+	if s.builder == nil && s.set != nil {
+		return nil
+	}
+	if _, err := s.ipSet(); err != nil {
+		return err
+	}
+	s.added = slices.Clip(s.added)
+	return nil
+}
+
+// changed returns a copy of the compacted prefix set to be changed instead of it,
+// sharing the built set, and the prefixes added until they are appended to
+func (s *prefixSet) changed() *prefixSet {
+	if s == nil {
+		return new(prefixSet)
+	}
+	return &prefixSet{set: s.set, added: slices.Clip(s.added)}
+}
+
+// ipSet returns the set of the prefixes, which must not be changed
+func (s *prefixSet) ipSet() (*netipx.IPSet, error) {
+	if s.builder != nil {
+		set, err := s.builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		s.set = set
+		s.builder = nil
+	}
+	if s.set == nil {
+		s.set = new(netipx.IPSet)
+	}
+	return s.set, nil
+}
+
+// clone returns a copy of the prefix set, sharing the built set
+func (s *prefixSet) clone() (*prefixSet, error) {
+	set, err := s.ipSet()
+	if err != nil {
+		return nil, err
+	}
+	return &prefixSet{set: set, added: slices.Clone(s.added)}, nil
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// parseInputPriority reads the optional priority from the args of an input.
+// Inputs with priority make lists mutually exclusive, see resolveClaims.
+func parseInputPriority(action Action, args json.RawMessage) (*int, error) {
+	var tmp struct {
+		Priority *int `json:"priority"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &tmp); err != nil {
+			return nil, err
+		}
+	}
+	if tmp.Priority != nil && action != ActionAdd {
+		return nil, fmt.Errorf("priority is only supported by action %s", ActionAdd)
+	}
+	return tmp.Priority, nil
+}
+
+// claim records the prefixes of a list loaded by an input with priority
+type claim struct {
+	priority int
+	name     string
+	ipv4Set  *netipx.IPSet
+	ipv6Set  *netipx.IPSet
+}
+
+// mergeLoaded adds the lists loaded by an input on an empty container to container,
+// with the tags of the input. If the input has priority, the prefixes loaded by it
+// are returned as claims.
+func mergeLoaded(loaded, container Container, priority *int, tags []string) ([]*claim, error) {
+	claims := make([]*claim, 0, loaded.Len())
+	for entry := range loaded.Loop() {
+		entry.AddTag(tags...)
+		if priority != nil {
+			c := &claim{
+				priority: *priority,
+				name:     entry.GetName(),
+			}
+			var err error
+			if entry.hasIPv4() {
+				if c.ipv4Set, err = entry.ipv4.ipSet(); err != nil {
+					return nil, err
+				}
+			}
+			if entry.hasIPv6() {
+				if c.ipv6Set, err = entry.ipv6.ipSet(); err != nil {
+					return nil, err
+				}
+			}
+			claims = append(claims, c)
+		}
+		if err := container.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// resolveClaims makes lists mutually exclusive. A prefix loaded by inputs with priority
+// is kept only by the list of the input with the highest priority, and removed from
+// all other lists. When priorities are equal, the input defined first wins.
+func resolveClaims(container Container, claims []*claim) error {
+	slices.SortStableFunc(claims, func(a, b *claim) int {
+		return b.priority - a.priority
+	})
+
+	carve4, err := resolveClaimsOfIPType(container, claims, IPv4)
+	if err != nil {
+		return err
+	}
+	carve6, err := resolveClaimsOfIPType(container, claims, IPv6)
+	if err != nil {
+		return err
+	}
+
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		carved := NewEntry(name)
+		if builder, found := carve4[name]; found && entry.hasIPv4() {
+			carved.ipv4 = &prefixSet{builder: builder}
+		}
+		if builder, found := carve6[name]; found && entry.hasIPv6() {
+			carved.ipv6 = &prefixSet{builder: builder}
+		}
+		if !carved.hasIPv4() && !carved.hasIPv6() {
+			continue
+		}
+		if err := container.Remove(carved, CaseRemovePrefix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveClaimsOfIPType returns the prefixes of one IP type to be removed from every list
+func resolveClaimsOfIPType(container Container, claims []*claim, ipType IPType) (map[string]*netipx.IPSetBuilder, error) {
+	var claimed netipx.IPSetBuilder
+	owned := make(map[string]*netipx.IPSetBuilder)
+
+	for _, c := range claims {
+		set := c.ipv4Set
+		if ipType == IPv6 {
+			set = c.ipv6Set
+		}
+		if set == nil {
+			continue
+		}
+
+		// Prefixes already claimed by inputs with higher priority are not owned
+		claimedSet, err := claimed.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		var builder netipx.IPSetBuilder
+		builder.AddSet(set)
+		builder.RemoveSet(claimedSet)
+		ownedSet, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, found := owned[c.name]; !found {
+			owned[c.name] = new(netipx.IPSetBuilder)
+		}
+		owned[c.name].AddSet(ownedSet)
+		claimed.AddSet(ownedSet)
+	}
+
+	claimedSet, err := claimed.IPSet()
+	if err != nil {
+		return nil, err
+	}
+
+	carve := make(map[string]*netipx.IPSetBuilder)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		builder := new(netipx.IPSetBuilder)
+		builder.AddSet(claimedSet)
+		if ownedBuilder, found := owned[name]; found {
+			ownedSet, err := ownedBuilder.IPSet()
+			if err != nil {
+				return nil, err
+			}
+			builder.RemoveSet(ownedSet)
+		}
+		carve[name] = builder
+	}
+
+	return carve, nil
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ProfileOptions describe a build profile, set by the "profiles" field of the config
+// file. Inputs and outputs select the profiles they are run in by their "profiles" arg.
+type ProfileOptions struct {
+	Description string `json:"description"`
+	// Default is the profile used if no profile is set, at most one profile is the default
+	Default bool `json:"default"`
+}
+
+// addProfiles adds the profiles of a config file, which must not be defined more than once
+func (i *instance) addProfiles(profiles map[string]*ProfileOptions) error {
+	for name, options := range profiles {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return errors.New("name of profile must not be empty")
+		}
+		if _, found := i.profiles[name]; found {
+			return fmt.Errorf("profile %s is defined more than once", name)
+		}
+		if options == nil {
+			options = new(ProfileOptions)
+		}
+		if options.Default {
+			if current := i.defaultProfile(); current != "" {
+				return fmt.Errorf("profiles %s and %s must not both be the default", current, name)
+			}
+		}
+		if i.profiles == nil {
+			i.profiles = make(map[string]*ProfileOptions)
+		}
+		i.profiles[name] = options
+	}
+	return nil
+}
+
+// defaultProfile returns the name of the default profile, or an empty string if none
+func (i *instance) defaultProfile() string {
+	for name, options := range i.profiles {
+		if options.Default {
+			return name
+		}
+	}
+	return ""
+}
+
+// profileNames returns the names of all profiles in order
+func (i *instance) profileNames() []string {
+	names := make([]string, 0, len(i.profiles))
+	for name := range i.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateProfiles checks the profile set and the profiles of all inputs and outputs
+// are defined by the config file. Without profiles defined, any profile could be set
+// for enabled expressions.
+func (i *instance) validateProfiles() error {
+	if profile != "" && len(i.profiles) > 0 && i.profiles[profile] == nil {
+		return withErrorKind(ErrorKindConfig, fmt.Errorf("profile %s is not defined, the value must be one of %s", profile, strings.Join(i.profileNames(), ", ")))
+	}
+	check := func(kind string, idx int, iType string, c *condition) error {
+		if c == nil {
+			return nil
+		}
+		for _, name := range c.profiles {
+			if i.profiles[name] == nil {
+				return withErrorKind(ErrorKindConfig, fmt.Errorf("profile %s of %s %d (%s) is not defined in profiles", name, kind, idx, iType))
+			}
+		}
+		return nil
+	}
+	for idx, ic := range i.input {
+		if err := check("input", idx, ic.GetType(), i.inputConditions[idx]); err != nil {
+			return err
+		}
+	}
+	for idx, oc := range i.output {
+		if err := check("output", idx, oc.GetType(), i.outputConditions[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stages of progress events
+const (
+	ProgressDownload = "download" // bytes of a remote file downloaded
+	ProgressParse    = "parse"    // lines of a file parsed by an input
+	ProgressInput    = "input"    // an input is done
+	ProgressOutput   = "output"   // an output is done
+)
+
+// ProgressEvent reports the progress of a stage of the run,
+// fields not related to the stage are zero
+type ProgressEvent struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Plugin  string    `json:"plugin,omitempty"`
+	Index   int       `json:"index"`           // index of the input or output
+	Total   int       `json:"total,omitempty"` // number of inputs or outputs
+	URI     string    `json:"uri,omitempty"`
+	List    string    `json:"list,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Size    int64     `json:"size,omitempty"` // size of the remote file, if known
+	Lines   int       `json:"lines,omitempty"`
+	Entries int       `json:"entries,omitempty"` // number of lists in the container
+	// Duration of the input, output, download or parsing done, in nanoseconds in JSON
+	Duration time.Duration `json:"duration,omitempty"`
+	Done     bool          `json:"done"`
+}
+
+// ProgressReporter receives progress events, which may be reported concurrently
+type ProgressReporter interface {
+	Report(*ProgressEvent)
+}
+
+var progressReporter ProgressReporter
+
+// SetProgressReporter sets the reporter of progress events, nil to disable
+func SetProgressReporter(r ProgressReporter) {
+	progressReporter = r
+}
+
+// ReportProgress reports the event to the reporter if any, used by plugins
+// to report progress of slow work like parsing large files
+func ReportProgress(ev *ProgressEvent) {
+	if progressReporter == nil {
+		return
+	}
+	ev.Time = time.Now()
+	progressReporter.Report(ev)
+}
+
+// ProgressReportInterval is the number of lines parsed between progress events
+const ProgressReportInterval = 100000
+
+// JSONProgress writes progress events in JSON lines, as a machine-readable stream
+type JSONProgress struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONProgress(w io.Writer) *JSONProgress {
+	return &JSONProgress{enc: json.NewEncoder(w)}
+}
+
+func (p *JSONProgress) Report(ev *ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enc.Encode(ev)
+}
+
+// TerminalProgress displays the latest progress in a line of a terminal,
+// which is redrawn at most every interval unless a stage is done
+type TerminalProgress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	interval time.Duration
+	last     time.Time
+	drawn    bool
+}
+
+func NewTerminalProgress(w io.Writer) *TerminalProgress {
+	return &TerminalProgress{w: w, interval: 100 * time.Millisecond}
+}
+
+func (p *TerminalProgress) Report(ev *ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !ev.Done && ev.Time.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = ev.Time
+	p.drawn = true
+
+	// Clear the line before redrawing it
+	fmt.Fprintf(p.w, "\r\033[K%s", formatProgress(ev))
+}
+
+// Finish ends the line of the progress
+func (p *TerminalProgress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprintln(p.w)
+		p.drawn = false
+	}
+}
+
+func formatProgress(ev *ProgressEvent) string {
+	var b strings.Builder
+	switch ev.Stage {
+	case ProgressDownload:
+		fmt.Fprintf(&b, "downloading %s: %s", ev.URI, formatBytes(ev.Bytes))
+		if ev.Size > 0 {
+			fmt.Fprintf(&b, " / %s (%d%%)", formatBytes(ev.Size), ev.Bytes*100/ev.Size)
+		}
+	case ProgressParse:
+		source := ev.List
+		if ev.URI != "" {
+			source = ev.URI
+		}
+		fmt.Fprintf(&b, "[%s] parsing %s: %d lines", ev.Plugin, source, ev.Lines)
+	case ProgressInput:
+		fmt.Fprintf(&b, "input %d/%d [%s] done: %d lists", ev.Index+1, ev.Total, ev.Plugin, ev.Entries)
+	case ProgressOutput:
+		fmt.Fprintf(&b, "output %d/%d [%s] done", ev.Index+1, ev.Total, ev.Plugin)
+	}
+	return b.String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressBytesInterval is the number of bytes downloaded between progress events
+const progressBytesInterval = 1 << 20
+
+// progressBody reports the bytes of a response body read
+type progressBody struct {
+	io.ReadCloser
+	uri      string
+	start    time.Time
+	size     int64
+	bytes    int64
+	reported int64
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err != io.EOF && b.bytes-b.reported < progressBytesInterval {
+		return n, err
+	}
+	b.reported = b.bytes
+	ev := &ProgressEvent{
+		Stage: ProgressDownload,
+		URI:   b.uri,
+		Bytes: b.bytes,
+		Size:  b.size,
+		Done:  err == io.EOF,
+	}
+	if ev.Done {
+		ev.Duration = time.Since(b.start)
+	}
+	ReportProgress(ev)
+	return n, err
+}
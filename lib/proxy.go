@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// proxyDirect disables the proxy of environment variables or the config file
+const proxyDirect = "direct"
+
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = make(map[string]*http.Client) // by proxy
+)
+
+// validateProxy checks the proxy is a URL of an HTTP, HTTPS or SOCKS5 proxy
+func validateProxy(proxy string) error {
+	if proxy == "" || strings.EqualFold(proxy, proxyDirect) {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy %s: %w", proxy, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("invalid proxy %s, the scheme must be http, https, socks5 or socks5h", proxy)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy %s, the host must be specified", proxy)
+	}
+	return nil
+}
+
+// httpClient returns the client downloading through the proxy, which is the URL
+// of a proxy, "direct" for no proxy, or empty for the proxy of environment variables
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func httpClient(proxy string) *http.Client {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	if client, found := httpClients[proxy]; found {
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch {
+	case proxy == "":
+		transport.Proxy = http.ProxyFromEnvironment
+	case strings.EqualFold(proxy, proxyDirect):
+		transport.Proxy = nil
+	default:
+		// The proxy has been validated when the config is parsed
+		proxyURL, _ := url.Parse(proxy)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	client := &http.Client{Transport: transport}
+	httpClients[proxy] = client
+	return client
+}
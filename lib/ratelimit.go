@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions limit the rate of requests and bandwidth of downloads
+type RateLimitOptions struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	BytesPerSecond    float64 `json:"bytesPerSecond"`
+}
+
+func (r *RateLimitOptions) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.RequestsPerSecond < 0 || r.BytesPerSecond < 0 {
+		return fmt.Errorf("rate limits must not be negative")
+	}
+	return nil
+}
+
+// limiter is a token bucket, whose tokens are refilled at rate per second up to
+// burst. Tokens are reserved even if not enough, so that waits are in order.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns nil if rate is zero, which means no limit
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst := max(rate, 1)
+	return &limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until n tokens are available or the context is done
+func (l *limiter) wait(ctx context.Context, n float64) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= n
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiters limit requests and bytes of all downloads, or downloads of a host
+type rateLimiters struct {
+	requests *limiter
+	bytes    *limiter
+}
+
+func newRateLimiters(opts *RateLimitOptions) *rateLimiters {
+	if opts == nil {
+		return &rateLimiters{}
+	}
+	return &rateLimiters{
+		requests: newLimiter(opts.RequestsPerSecond),
+		bytes:    newLimiter(opts.BytesPerSecond),
+	}
+}
+
+var (
+	rateLimitsMu      sync.Mutex
+	globalRateLimits  = new(rateLimiters)
+	hostRateLimits    = make(map[string]*rateLimiters)
+	hostRateLimitOpts *RateLimitOptions
+)
+
+// setRateLimits sets the limits of all downloads and of downloads of every host
+func setRateLimits(global, perHost *RateLimitOptions) {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	if global != nil {
+		globalRateLimits = newRateLimiters(global)
+	}
+	if perHost != nil {
+		hostRateLimitOpts = perHost
+		hostRateLimits = make(map[string]*rateLimiters)
+	}
+}
+
+// resetRateLimits removes the limits of all downloads and of downloads of every host
+func resetRateLimits() {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	globalRateLimits = new(rateLimiters)
+	hostRateLimitOpts = nil
+	hostRateLimits = make(map[string]*rateLimiters)
+}
+
+// rateLimitsOf returns the limiters of all downloads and of the host
+func rateLimitsOf(host string) (*rateLimiters, *rateLimiters) {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	limits, found := hostRateLimits[host]
+	if !found {
+		limits = newRateLimiters(hostRateLimitOpts)
+		hostRateLimits[host] = limits
+	}
+	return globalRateLimits, limits
+}
+
+// doRequest sends the request after the rate limits allow, and limits
+// the bandwidth of reading the response body
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	global, host := rateLimitsOf(req.URL.Host)
+	if err := global.requests.wait(ctx, 1); err != nil {
+		return nil, err
+	}
+	if err := host.requests.wait(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if progressReporter != nil {
+		resp.Body = &progressBody{ReadCloser: resp.Body, uri: req.URL.String(), start: time.Now(), size: resp.ContentLength}
+	}
+
+	if global.bytes != nil || host.bytes != nil {
+		resp.Body = &rateLimitedBody{
+			ReadCloser: resp.Body,
+			ctx:        ctx,
+			limiters:   []*limiter{global.bytes, host.bytes},
+		}
+	}
+	return resp, nil
+}
+
+type rateLimitedBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*limiter
+}
+
+func (b *rateLimitedBody) Read(p []byte) (int, error) {
+	// Read at most the burst of the limiters, so that the bandwidth is smooth
+	for _, l := range b.limiters {
+		if l != nil && float64(len(p)) > l.burst {
+			p = p[:int(l.burst)]
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	for _, l := range b.limiters {
+		if waitErr := l.wait(b.ctx, float64(n)); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
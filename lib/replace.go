@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+)
+
+// replaceInput runs the input converter with add action on an empty container,
+// then the lists loaded replace all prefixes of the lists of the same names, so
+// that an authoritative source fully owns its lists. The container is not
+// changed if the input fails.
+type replaceInput struct {
+	InputConverter
+}
+
+func newReplaceInput(ic InputConverter) *replaceInput {
+	return &replaceInput{InputConverter: ic}
+}
+
+func (r *replaceInput) GetAction() Action {
+	return ActionReplace
+}
+
+func (r *replaceInput) IsSourceInput() bool {
+	source, ok := r.InputConverter.(SourceInputConverter)
+	return ok && source.IsSourceInput()
+}
+
+func (r *replaceInput) Input(container Container) (Container, error) {
+	return r.InputContext(context.Background(), container)
+}
+
+func (r *replaceInput) InputContext(ctx context.Context, container Container) (Container, error) {
+	loaded, err := runInput(ctx, r.InputConverter, NewContainer())
+	if err != nil {
+		return nil, err
+	}
+
+	for entry := range loaded.Loop() {
+		if _, found := container.GetEntry(entry.GetName()); found {
+			if err := container.Remove(entry, CaseRemoveEntry); err != nil {
+				return nil, err
+			}
+			slog.Debug("list replaced", "plugin", r.GetType(), "list", entry.GetName())
+		}
+		if err := container.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
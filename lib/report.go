@@ -0,0 +1,353 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go4.org/netipx"
+)
+
+// BuildReport has the statistics of every list after all inputs of a run
+type BuildReport struct {
+	Time         time.Time     `json:"time"`
+	Manifest     string        `json:"manifest,omitempty"` // the same as the one of the build info embedded in files
+	Lists        []*ListReport `json:"lists"`
+	RemovedLists []string      `json:"removedLists,omitempty"` // lists of the previous run not generated any more
+}
+
+// ListReport has the statistics of a list
+type ListReport struct {
+	Name          string      `json:"name"`
+	IPv4Prefixes  int         `json:"ipv4Prefixes"`
+	IPv6Prefixes  int         `json:"ipv6Prefixes"`
+	IPv4Addresses *big.Int    `json:"ipv4Addresses"`
+	IPv6Addresses *big.Int    `json:"ipv6Addresses"`
+	Sources       []string    `json:"sources,omitempty"` // inputs adding prefixes to the list
+	Dropped       []*ListDrop `json:"dropped,omitempty"` // prefixes dropped by inputs, like limit
+	Delta         *ListDelta  `json:"delta,omitempty"`
+}
+
+// ListDrop is the prefixes dropped from a list by an input, recorded by RecordDropped
+type ListDrop struct {
+	Reason   string   `json:"reason"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// ListDelta is the change of a list versus the previous run
+type ListDelta struct {
+	New           bool     `json:"new,omitempty"`
+	IPv4Prefixes  int      `json:"ipv4Prefixes"`
+	IPv6Prefixes  int      `json:"ipv6Prefixes"`
+	IPv4Addresses *big.Int `json:"ipv4Addresses"`
+	IPv6Addresses *big.Int `json:"ipv6Addresses"`
+}
+
+// SetReport enables tracking the sources of lists for the build report
+func (i *instance) SetReport(enabled bool) {
+	i.reportEnabled = enabled
+}
+
+// needReport reports whether the build report is needed, by the report itself,
+// notifications, metrics or the shrink guard
+func (i *instance) needReport() bool {
+	return i.reportEnabled || i.notifications != nil || i.metrics != nil || i.shrinkGuard != nil
+}
+
+// trackSources reports whether the sources of lists are tracked, by the report or overlaps
+func (i *instance) trackSources() bool {
+	return i.reportEnabled || i.overlaps != nil
+}
+
+// Report returns the build report of the last run, or nil if not enabled
+func (i *instance) Report() *BuildReport {
+	return i.report
+}
+
+// sourceName names the input adding prefixes to lists in build reports
+func sourceName(idx int, ic InputConverter) string {
+	return fmt.Sprintf("input[%d] %s", idx, ic.GetType())
+}
+
+// addSources records the input as a source of the lists loaded by it
+func (i *instance) addSources(idx int, ic InputConverter, loaded Container) {
+	if i.sources == nil {
+		i.sources = make(map[string][]string)
+	}
+	for entry := range loaded.Loop() {
+		i.sources[entry.GetName()] = append(i.sources[entry.GetName()], sourceName(idx, ic))
+	}
+}
+
+// activeDrops are the prefixes dropped from lists by inputs in a run, by names of lists,
+// which are only recorded if the build report is needed
+var activeDrops struct {
+	sync.Mutex
+	drops map[string][]*ListDrop
+}
+
+func startRecordingDrops() {
+	activeDrops.Lock()
+	defer activeDrops.Unlock()
+	activeDrops.drops = make(map[string][]*ListDrop)
+}
+
+// stopRecordingDrops stops recording and returns the drops recorded
+func stopRecordingDrops() map[string][]*ListDrop {
+	activeDrops.Lock()
+	defer activeDrops.Unlock()
+	drops := activeDrops.drops
+	activeDrops.drops = nil
+	return drops
+}
+
+// RecordDropped records the prefixes dropped from the list by an input for the reason,
+// like the ones over the capacity of a target, so that they are listed in the build report
+func RecordDropped(list, reason string, prefixes []netip.Prefix) {
+	if len(prefixes) == 0 {
+		return
+	}
+	activeDrops.Lock()
+	defer activeDrops.Unlock()
+	if activeDrops.drops == nil {
+		return
+	}
+	drop := &ListDrop{Reason: reason, Prefixes: make([]string, 0, len(prefixes))}
+	for _, prefix := range prefixes {
+		drop.Prefixes = append(drop.Prefixes, prefix.String())
+	}
+	name := strings.ToUpper(strings.TrimSpace(list))
+	activeDrops.drops[name] = append(activeDrops.drops[name], drop)
+}
+
+// NewBuildReport returns the report of the lists in the container, without their sources
+func NewBuildReport(container Container) *BuildReport {
+	return newBuildReport(container, nil, nil)
+}
+
+func newBuildReport(container Container, sources map[string][]string, drops map[string][]*ListDrop) *BuildReport {
+	report := &BuildReport{
+		Time:     BuildTime().UTC(),
+		Manifest: listsFingerprint(container),
+		Lists:    make([]*ListReport, 0, container.Len()),
+	}
+
+	for entry := range container.Loop() {
+		list := &ListReport{
+			Name:          strings.ToLower(entry.GetName()),
+			IPv4Addresses: new(big.Int),
+			IPv6Addresses: new(big.Int),
+			Sources:       sources[entry.GetName()],
+			Dropped:       drops[entry.GetName()],
+		}
+		if set, err := entry.GetIPv4Set(); err == nil {
+			list.IPv4Prefixes, list.IPv4Addresses = countAddresses(set)
+		}
+		if set, err := entry.GetIPv6Set(); err == nil {
+			list.IPv6Prefixes, list.IPv6Addresses = countAddresses(set)
+		}
+		report.Lists = append(report.Lists, list)
+	}
+
+	slices.SortFunc(report.Lists, func(a, b *ListReport) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return report
+}
+
+// countAddresses returns the number of prefixes and addresses of the set
+func countAddresses(set *netipx.IPSet) (int, *big.Int) {
+	prefixes := set.Prefixes()
+	total := new(big.Int)
+	for _, prefix := range prefixes {
+		bits := prefix.Addr().BitLen() - prefix.Bits()
+		total.Add(total, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	}
+	return len(prefixes), total
+}
+
+// Compare sets the deltas of lists versus the report of the previous run,
+// replacing the ones set by previous calls
+func (r *BuildReport) Compare(previous *BuildReport) {
+	r.RemovedLists = nil
+	if previous == nil {
+		return
+	}
+
+	previousLists := make(map[string]*ListReport, len(previous.Lists))
+	for _, list := range previous.Lists {
+		previousLists[list.Name] = list
+	}
+
+	for _, list := range r.Lists {
+		prev, found := previousLists[list.Name]
+		if !found {
+			list.Delta = &ListDelta{
+				New:           true,
+				IPv4Prefixes:  list.IPv4Prefixes,
+				IPv6Prefixes:  list.IPv6Prefixes,
+				IPv4Addresses: list.IPv4Addresses,
+				IPv6Addresses: list.IPv6Addresses,
+			}
+			continue
+		}
+		delete(previousLists, list.Name)
+		list.Delta = &ListDelta{
+			IPv4Prefixes:  list.IPv4Prefixes - prev.IPv4Prefixes,
+			IPv6Prefixes:  list.IPv6Prefixes - prev.IPv6Prefixes,
+			IPv4Addresses: subAddresses(list.IPv4Addresses, prev.IPv4Addresses),
+			IPv6Addresses: subAddresses(list.IPv6Addresses, prev.IPv6Addresses),
+		}
+	}
+
+	for name := range previousLists {
+		r.RemovedLists = append(r.RemovedLists, name)
+	}
+	slices.Sort(r.RemovedLists)
+}
+
+func subAddresses(a, b *big.Int) *big.Int {
+	if a == nil {
+		a = new(big.Int)
+	}
+	if b == nil {
+		b = new(big.Int)
+	}
+	return new(big.Int).Sub(a, b)
+}
+
+// ReadBuildReport reads the report written by WriteFile,
+// it returns nil without error if the file does not exist
+func ReadBuildReport(path string) (*BuildReport, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := new(BuildReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("invalid build report %s: %w", path, err)
+	}
+	return report, nil
+}
+
+// WriteFile writes the report in JSON
+func (r *BuildReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// WriteTable writes the report as a table
+func (r *BuildReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIST\tIPV4 PREFIXES\tIPV6 PREFIXES\tIPV4 ADDRESSES\tIPV6 ADDRESSES\tSOURCES")
+	for _, list := range r.Lists {
+		ipv4Prefixes, ipv6Prefixes := fmt.Sprint(list.IPv4Prefixes), fmt.Sprint(list.IPv6Prefixes)
+		ipv4Addresses, ipv6Addresses := list.IPv4Addresses.String(), formatAddresses(list.IPv6Addresses)
+		name := list.Name
+		if delta := list.Delta; delta != nil {
+			if delta.New {
+				name += " (new)"
+			} else {
+				ipv4Prefixes += formatDelta(big.NewInt(int64(delta.IPv4Prefixes)))
+				ipv6Prefixes += formatDelta(big.NewInt(int64(delta.IPv6Prefixes)))
+				ipv4Addresses += formatDelta(delta.IPv4Addresses)
+				ipv6Addresses += formatDelta(delta.IPv6Addresses)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", name, ipv4Prefixes, ipv6Prefixes, ipv4Addresses, ipv6Addresses, strings.Join(list.Sources, ", "))
+	}
+	for _, name := range r.RemovedLists {
+		fmt.Fprintf(tw, "%s (removed)\n", name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, line := range r.droppedLines() {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// WriteMarkdown writes the report as a Markdown table, like in release notes
+func (r *BuildReport) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("| List | IPv4 prefixes | IPv6 prefixes | IPv4 addresses | IPv6 addresses |\n")
+	b.WriteString("| --- | ---: | ---: | ---: | ---: |\n")
+	for _, list := range r.Lists {
+		ipv4Prefixes, ipv6Prefixes := fmt.Sprint(list.IPv4Prefixes), fmt.Sprint(list.IPv6Prefixes)
+		ipv4Addresses, ipv6Addresses := list.IPv4Addresses.String(), formatAddresses(list.IPv6Addresses)
+		name := list.Name
+		if delta := list.Delta; delta != nil {
+			if delta.New {
+				name += " (new)"
+			} else {
+				ipv4Prefixes += formatDelta(big.NewInt(int64(delta.IPv4Prefixes)))
+				ipv6Prefixes += formatDelta(big.NewInt(int64(delta.IPv6Prefixes)))
+				ipv4Addresses += formatDelta(delta.IPv4Addresses)
+				ipv6Addresses += formatDelta(delta.IPv6Addresses)
+			}
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", name, ipv4Prefixes, ipv6Prefixes, ipv4Addresses, ipv6Addresses)
+	}
+	if len(r.RemovedLists) > 0 {
+		fmt.Fprintf(&b, "\nRemoved lists: %s\n", strings.Join(r.RemovedLists, ", "))
+	}
+	if lines := r.droppedLines(); len(lines) > 0 {
+		b.WriteString("\nDropped prefixes:\n\n")
+		for _, line := range lines {
+			b.WriteString("- " + line + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// droppedLines describes the prefixes dropped from lists, one line per drop
+func (r *BuildReport) droppedLines() []string {
+	lines := make([]string, 0)
+	for _, list := range r.Lists {
+		for _, drop := range list.Dropped {
+			lines = append(lines, fmt.Sprintf("%s: %d prefixes dropped, %s", list.Name, len(drop.Prefixes), drop.Reason))
+		}
+	}
+	return lines
+}
+
+// formatIPv6Addresses formats the number of IPv6 addresses as /64 subnets if large
+func formatAddresses(n *big.Int) string {
+	if n == nil {
+		return "0"
+	}
+	if n.BitLen() <= 64 {
+		return n.String()
+	}
+	return new(big.Int).Rsh(n, 64).String() + " /64"
+}
+
+func formatDelta(delta *big.Int) string {
+	switch delta.Sign() {
+	case 0:
+		return ""
+	case 1:
+		return " (+" + formatAddresses(delta) + ")"
+	default:
+		return " (-" + formatAddresses(new(big.Int).Neg(delta)) + ")"
+	}
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RouteOptions select the lists which are only sent to the outputs of the route,
+// set by the "routes" field of the config file. A list is in the route if it
+// matches any of Lists or has any of Tags.
+type RouteOptions struct {
+	// Lists are names and patterns of lists, the same as wantedList
+	Lists []string `json:"lists"`
+	// Tags of lists
+	Tags []string `json:"tags"`
+
+	matcher *ListMatcher
+}
+
+func (r *RouteOptions) validate() error {
+	if r == nil || (len(r.Lists) == 0 && len(r.Tags) == 0) {
+		return errors.New("lists or tags must be specified")
+	}
+	matcher, err := NewListMatcher(r.Lists)
+	if err != nil {
+		return err
+	}
+	r.matcher = matcher
+	return nil
+}
+
+// match reports whether the entry is in the route
+func (r *RouteOptions) match(entry *Entry) bool {
+	return r.matcher.Match(entry.GetName()) || (len(r.Tags) > 0 && entry.HasTag(r.Tags...))
+}
+
+// addRoutes adds the routes of a config file, which must not be defined more than once
+func (i *instance) addRoutes(routes map[string]*RouteOptions) error {
+	for name, route := range routes {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return errors.New("name of route must not be empty")
+		}
+		if err := route.validate(); err != nil {
+			return fmt.Errorf("invalid route %s: %w", name, err)
+		}
+		if _, found := i.routes[name]; found {
+			return fmt.Errorf("route %s is defined more than once", name)
+		}
+		if i.routes == nil {
+			i.routes = make(map[string]*RouteOptions)
+		}
+		i.routes[name] = route
+	}
+	return nil
+}
+
+// validateRoutes checks the routes of all outputs are defined
+func (i *instance) validateRoutes() error {
+	for idx, oc := range i.output {
+		route := i.options.merge(i.outputOptions[idx]).Route
+		if route == "" {
+			continue
+		}
+		if _, found := i.routes[route]; !found {
+			return withErrorKind(ErrorKindConfig, fmt.Errorf("route %s of output %d (%s) is not defined in routes", route, idx, oc.GetType()))
+		}
+	}
+	return nil
+}
+
+// routed reports whether the entry is sent to the output of the options. Outputs of
+// a route only get the lists in the route, and other outputs only get the lists not
+// in any route.
+func (o *OutputOptions) routed(entry *Entry) bool {
+	if len(o.routes) == 0 {
+		return true
+	}
+	if o.Route != "" {
+		return o.routes[o.Route].match(entry)
+	}
+	for _, route := range o.routes {
+		if route.match(entry) {
+			return false
+		}
+	}
+	return true
+}
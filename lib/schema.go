@@ -0,0 +1,349 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	inputArgsCache  = make(map[string]*registeredArgs)
+	outputArgsCache = make(map[string]*registeredArgs)
+)
+
+type registeredArgs struct {
+	id   string // type of the converter as registered
+	args reflect.Type
+}
+
+// RegisterInputArgs registers the struct of args of an input converter, which is
+// used to validate the config file before running, and generate the JSON schema.
+func RegisterInputArgs(id string, args any) error {
+	return registerArgs(inputArgsCache, id, args)
+}
+
+// RegisterOutputArgs registers the struct of args of an output converter, which is
+// used to validate the config file before running, and generate the JSON schema.
+func RegisterOutputArgs(id string, args any) error {
+	return registerArgs(outputArgsCache, id, args)
+}
+
+func registerArgs(cache map[string]*registeredArgs, id string, args any) error {
+	key := strings.ToLower(id)
+	if _, found := cache[key]; found {
+		return errors.New("args have already been registered")
+	}
+	t := reflect.TypeOf(args)
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("args of %s must be a struct", id)
+	}
+	cache[key] = &registeredArgs{id: id, args: t}
+	return nil
+}
+
+// Args handled by lib for every input and output, besides the ones of converters
+var (
+	commonInputArgs = reflect.TypeOf(struct {
+		Priority *int     `json:"priority"`
+		Tags     []string `json:"tags"`
+		SourceOptions
+	}{})
+	commonOutputArgs = reflect.TypeOf(OutputOptions{})
+	// Conditions of inputs and outputs, which are not options for all outputs
+	conditionArgs = reflect.TypeOf(struct {
+		Enabled  string   `json:"enabled"`
+		Profiles []string `json:"profiles"`
+	}{})
+)
+
+// jsonFields returns the types of the fields of the struct by JSON names
+func jsonFields(types ...reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, t := range types {
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			// Fields of embedded structs are promoted, the same as encoding/json
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				for embeddedName, embeddedType := range jsonFields(field.Type) {
+					fields[embeddedName] = embeddedType
+				}
+				continue
+			}
+			switch name {
+			case "-":
+				continue
+			case "":
+				name = field.Name
+			}
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// validateConfig reports unknown fields and type errors of the config with their paths,
+// which are silently ignored when the config is parsed
+func validateConfig(content []byte) error {
+	var fieldsOfConfig map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fieldsOfConfig); err != nil {
+		return err
+	}
+	// Converters and options are validated below with the paths of their fields
+	fields := jsonFields(reflect.TypeOf(config{}))
+	for _, name := range []string{"options", "input", "output"} {
+		fields[name] = reflect.TypeOf(json.RawMessage{})
+	}
+	if err := validateObject("", fieldsOfConfig, fields); err != nil {
+		return err
+	}
+
+	if raw, found := fieldsOfConfig["options"]; found {
+		if err := validateArgs("options", raw, commonOutputArgs); err != nil {
+			return err
+		}
+	}
+
+	if err := validateConverters("input", fieldsOfConfig["input"], inputArgsCache, commonInputArgs, conditionArgs); err != nil {
+		return err
+	}
+	return validateConverters("output", fieldsOfConfig["output"], outputArgsCache, commonOutputArgs, conditionArgs)
+}
+
+func validateConverters(path string, raw json.RawMessage, cache map[string]*registeredArgs, common ...reflect.Type) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var converters []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &converters); err != nil {
+		return fmt.Errorf("%s: must be an array of objects", path)
+	}
+
+	convFields := map[string]reflect.Type{
+		"type":   reflect.TypeOf(""),
+		"action": reflect.TypeOf(Action("")),
+		"args":   reflect.TypeOf(json.RawMessage{}),
+	}
+	for idx, converter := range converters {
+		convPath := fmt.Sprintf("%s[%d]", path, idx)
+		if err := validateObject(convPath, converter, convFields); err != nil {
+			return err
+		}
+
+		var iType string
+		if err := json.Unmarshal(converter["type"], &iType); err != nil || iType == "" {
+			return fmt.Errorf("%s.type: must be specified", convPath)
+		}
+		registered, found := cache[strings.ToLower(iType)]
+		if !found {
+			// Unknown types are reported when the converter is created
+			continue
+		}
+		if raw, found := converter["args"]; found {
+			if err := validateArgs(convPath+".args", raw, append([]reflect.Type{registered.args}, common...)...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateArgs(path string, raw json.RawMessage, types ...reflect.Type) error {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil
+	}
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return fmt.Errorf("%s: must be an object", path)
+	}
+	return validateObject(path, args, jsonFields(types...))
+}
+
+// validateObject checks that all fields of the object are known and of the right types
+func validateObject(path string, object map[string]json.RawMessage, fields map[string]reflect.Type) error {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		t, found := lookupField(fields, key)
+		if !found {
+			if suggestion := suggestField(fields, key); suggestion != "" {
+				return fmt.Errorf("%s: unknown field, did you mean %s?", fieldPath, suggestion)
+			}
+			return fmt.Errorf("%s: unknown field", fieldPath)
+		}
+
+		value := reflect.New(t).Interface()
+		if err := json.Unmarshal(object[key], value); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				if typeErr.Field != "" {
+					fieldPath += "." + typeErr.Field
+				}
+				return fmt.Errorf("%s: invalid %s value, expected %s", fieldPath, typeErr.Value, typeErr.Type)
+			}
+			return fmt.Errorf("%s: %w", fieldPath, err)
+		}
+	}
+
+	return nil
+}
+
+// lookupField matches names case-insensitively, the same as encoding/json
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, found := fields[key]; found {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// suggestField returns the known field most similar to an unknown one
+func suggestField(fields map[string]reflect.Type, key string) string {
+	suggestion, best := "", 3 // suggest only for at most 2 edits
+	for name := range fields {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(key)); d < best || (d == best && name < suggestion) {
+			suggestion, best = name, d
+		}
+	}
+	return suggestion
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// ConfigSchema returns the JSON schema of the config file, generated from the
+// registered args of all converters, for validation and completion in editors
+func ConfigSchema() ([]byte, error) {
+	schema := map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "geoip config",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"$schema":       typeSchema(reflect.TypeOf("")),
+			"include":       typeSchema(reflect.TypeOf([]string{})),
+			"vars":          typeSchema(reflect.TypeOf(map[string]string{})),
+			"plugins":       typeSchema(reflect.TypeOf(map[string]string{})),
+			"download":      typeSchema(reflect.TypeOf(DownloadOptions{})),
+			"options":       typeSchema(commonOutputArgs),
+			"composites":    typeSchema(reflect.TypeOf(map[string][]string{})),
+			"routes":        typeSchema(reflect.TypeOf(map[string]*RouteOptions{})),
+			"profiles":      typeSchema(reflect.TypeOf(map[string]*ProfileOptions{})),
+			"wantedList":    typeSchema(reflect.TypeOf([]string{})),
+			"excludedList":  typeSchema(reflect.TypeOf([]string{})),
+			"countryCodes":  typeSchema(reflect.TypeOf(CountryCodeOptions{})),
+			"embeddedIPv4":  typeSchema(reflect.TypeOf(EmbeddedIPv4Options{})),
+			"overlaps":      typeSchema(reflect.TypeOf(OverlapOptions{})),
+			"shrinkGuard":   typeSchema(reflect.TypeOf(ShrinkGuardOptions{})),
+			"notifications": typeSchema(reflect.TypeOf(NotificationOptions{})),
+			"metrics":       typeSchema(reflect.TypeOf(MetricsOptions{})),
+			"input":         convertersSchema(inputArgsCache, []Action{ActionAdd, ActionRemove, ActionReplace}, commonInputArgs, conditionArgs),
+			"output":        convertersSchema(outputArgsCache, []Action{ActionOutput}, commonOutputArgs, conditionArgs),
+		},
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func convertersSchema(cache map[string]*registeredArgs, actions []Action, common ...reflect.Type) map[string]any {
+	ids := make([]string, 0, len(cache))
+	for id := range cache {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	converters := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args := typeSchema(cache[id].args)
+		for _, t := range common {
+			for name, schema := range typeSchema(t)["properties"].(map[string]any) {
+				args["properties"].(map[string]any)[name] = schema
+			}
+		}
+		converters = append(converters, map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"required":             []string{"type"},
+			"properties": map[string]any{
+				"type":   map[string]any{"const": cache[id].id},
+				"action": map[string]any{"enum": actions},
+				"args":   args,
+			},
+		})
+	}
+
+	return map[string]any{
+		"type":  "array",
+		"items": map[string]any{"oneOf": converters},
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for name, fieldType := range jsonFields(t) {
+			properties[name] = typeSchema(fieldType)
+		}
+		return map[string]any{"type": "object", "additionalProperties": false, "properties": properties}
+	default:
+		return map[string]any{}
+	}
+}
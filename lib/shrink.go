@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Actions of lists shrinking more than the thresholds
+const (
+	ShrinkActionFail = "fail"
+	ShrinkActionWarn = "warn"
+)
+
+// ShrinkGuardOptions check lists do not shrink dramatically versus the last successful
+// run, which is a common symptom of a source returning an error page or an empty body,
+// set by the "shrinkGuard" field of the config file
+type ShrinkGuardOptions struct {
+	// ReportFile keeps the build report of the last successful run, which lists are compared with
+	ReportFile string `json:"reportFile"`
+	// MaxShrink is the threshold of all lists, like 1000 prefixes or 20%, empty to check only Lists
+	MaxShrink string `json:"maxShrink"`
+	// Action is fail or warn, fail by default
+	Action string `json:"action"`
+	// Lists are the thresholds of lists overriding the ones above
+	Lists map[string]*ShrinkThreshold `json:"lists"`
+}
+
+// ShrinkThreshold is the threshold of a list
+type ShrinkThreshold struct {
+	// MaxShrink is the max decrease of IPv4 or IPv6 prefixes, like 1000 or 20%, 0 to disable
+	MaxShrink string `json:"maxShrink"`
+	// Action is fail or warn, the one of all lists by default
+	Action string `json:"action"`
+}
+
+func (o *ShrinkGuardOptions) validate() error {
+	if strings.TrimSpace(o.ReportFile) == "" {
+		return errors.New("reportFile of shrinkGuard must be specified")
+	}
+	if _, _, err := parseMaxShrink(o.MaxShrink); err != nil {
+		return err
+	}
+	if err := validateShrinkAction(o.Action); err != nil {
+		return err
+	}
+	for name, threshold := range o.Lists {
+		if threshold == nil {
+			return fmt.Errorf("threshold of list %s must be specified", name)
+		}
+		if _, _, err := parseMaxShrink(threshold.MaxShrink); err != nil {
+			return fmt.Errorf("invalid threshold of list %s: %w", name, err)
+		}
+		if err := validateShrinkAction(threshold.Action); err != nil {
+			return fmt.Errorf("invalid threshold of list %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateShrinkAction(action string) error {
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "", ShrinkActionFail, ShrinkActionWarn:
+		return nil
+	default:
+		return fmt.Errorf("invalid action %s of shrinkGuard, the value must be %s or %s", action, ShrinkActionFail, ShrinkActionWarn)
+	}
+}
+
+// parseMaxShrink parses the threshold like 1000 or 20%, returning the number of
+// prefixes or the percentage. Both are 0 if the threshold is empty or 0.
+func parseMaxShrink(s string) (int, float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	if percent, found := strings.CutSuffix(s, "%"); found {
+		p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, 0, fmt.Errorf("invalid maxShrink %s, the percentage must be between 0%% and 100%%", s)
+		}
+		return 0, p, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("invalid maxShrink %s, the value must be a number of prefixes like 1000, or a percentage like 20%%", s)
+	}
+	return n, 0, nil
+}
+
+// threshold returns the threshold and the action of the list, whose name is lower case
+func (o *ShrinkGuardOptions) threshold(name string) (string, string) {
+	maxShrink, action := o.MaxShrink, o.Action
+	for listName, threshold := range o.Lists {
+		if strings.EqualFold(strings.TrimSpace(listName), name) {
+			maxShrink = threshold.MaxShrink
+			if threshold.Action != "" {
+				action = threshold.Action
+			}
+			break
+		}
+	}
+	if action = strings.ToLower(strings.TrimSpace(action)); action == "" {
+		action = ShrinkActionFail
+	}
+	return maxShrink, action
+}
+
+// check compares prefixes of lists in the report with the ones of the last successful run,
+// warning or failing if any list shrinks more than its threshold. Lists not generated any
+// more shrink to no prefixes.
+func (o *ShrinkGuardOptions) check(report *BuildReport) error {
+	if o == nil || report == nil {
+		return nil
+	}
+
+	previous, err := ReadBuildReport(o.ReportFile)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		slog.Info("shrink guard skipped, no report of the last successful run", "file", o.ReportFile)
+		return nil
+	}
+
+	current := make(map[string]*ListReport, len(report.Lists))
+	for _, list := range report.Lists {
+		current[list.Name] = list
+	}
+
+	failures := make([]string, 0)
+	for _, prev := range previous.Lists {
+		maxShrink, action := o.threshold(prev.Name)
+		// Thresholds have been validated when the config is parsed
+		maxPrefixes, maxPercent, _ := parseMaxShrink(maxShrink)
+		if maxPrefixes == 0 && maxPercent == 0 {
+			continue
+		}
+
+		list := current[prev.Name]
+		if list == nil {
+			list = &ListReport{Name: prev.Name}
+		}
+		for _, count := range []struct {
+			ipType        string
+			before, after int
+		}{
+			{"IPv4", prev.IPv4Prefixes, list.IPv4Prefixes},
+			{"IPv6", prev.IPv6Prefixes, list.IPv6Prefixes},
+		} {
+			decrease := count.before - count.after
+			if decrease <= 0 {
+				continue
+			}
+			percent := float64(decrease) * 100 / float64(count.before)
+			if (maxPrefixes > 0 && decrease > maxPrefixes) || (maxPercent > 0 && percent > maxPercent) {
+				msg := fmt.Sprintf("list %s shrinks from %d to %d %s prefixes (-%.1f%%), more than %s", prev.Name, count.before, count.after, count.ipType, percent, strings.TrimSpace(maxShrink))
+				if action == ShrinkActionWarn {
+					slog.Warn(msg, "file", o.ReportFile)
+					continue
+				}
+				failures = append(failures, msg)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("shrink guard failed versus the last successful run in %s: %s", o.ReportFile, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// save writes the report of the successful run to compare the next run with
+func (o *ShrinkGuardOptions) save(report *BuildReport) {
+	if o == nil || report == nil {
+		return
+	}
+	if err := report.WriteFile(o.ReportFile); err != nil {
+		slog.Warn("failed to write the report of shrink guard", "file", o.ReportFile, "err", err)
+	}
+}
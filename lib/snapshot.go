@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+)
+
+// snapshotVersion is the version of the format of snapshot files,
+// increased when the format changes incompatibly
+const snapshotVersion = 1
+
+// snapshot is the container saved to a snapshot file, encoded by gob and compressed by gzip
+type snapshot struct {
+	Version int
+	Inputs  string // fingerprint of the config of inputs which loaded the lists
+	Added   bool   // whether prefixes exactly as they are added are kept
+	Entries []*snapshotEntry
+}
+
+type snapshotEntry struct {
+	Name     string
+	Tags     []string
+	HasIPv4  bool
+	IPv4     snapshotSet
+	HasIPv6  bool
+	IPv6     snapshotSet
+	Metadata []snapshotMetadata
+}
+
+// snapshotSet is a prefix set, whose prefixes are the aggregated ones of the built set
+type snapshotSet struct {
+	Prefixes []netip.Prefix
+	Added    []netip.Prefix
+}
+
+type snapshotMetadata struct {
+	Prefix   netip.Prefix
+	Metadata Metadata
+}
+
+// SetSnapshotFile saves the lists loaded by inputs to the snapshot file, before outputs are run
+func (i *instance) SetSnapshotFile(file string) {
+	i.snapshotFile = file
+}
+
+// SetRestoreFile restores the lists from the snapshot file instead of running inputs,
+// so that outputs could be run again without fetching and parsing sources
+func (i *instance) SetRestoreFile(file string) {
+	i.restoreFile = file
+}
+
+// WriteSnapshot saves all lists of the container to the snapshot file
+func WriteSnapshot(container Container, file string) error {
+	return writeSnapshot(container, file, "")
+}
+
+// ReadSnapshot returns the container of the lists saved to the snapshot file
+func ReadSnapshot(file string) (Container, error) {
+	container, _, err := readSnapshot(file, true)
+	return container, err
+}
+
+func writeSnapshot(c Container, file, inputs string) error {
+	s := &snapshot{Version: snapshotVersion, Inputs: inputs, Added: true, Entries: make([]*snapshotEntry, 0, c.Len())}
+	if c, ok := c.(*container); ok && c.discardAdded {
+		s.Added = false
+	}
+
+	for entry := range c.Entries() {
+		se := &snapshotEntry{Name: entry.GetName(), Tags: entry.GetTags()}
+		var err error
+		if se.HasIPv4 = entry.hasIPv4(); se.HasIPv4 {
+			if se.IPv4, err = newSnapshotSet(entry.ipv4); err != nil {
+				return err
+			}
+		}
+		if se.HasIPv6 = entry.hasIPv6(); se.HasIPv6 {
+			if se.IPv6, err = newSnapshotSet(entry.ipv6); err != nil {
+				return err
+			}
+		}
+		for _, pm := range entry.metadata {
+			se.Metadata = append(se.Metadata, snapshotMetadata{Prefix: pm.prefix, Metadata: pm.metadata})
+		}
+		s.Entries = append(s.Entries, se)
+	}
+
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// Written to a temporary file first, so that a failed write keeps the previous snapshot
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+
+	zw := gzip.NewWriter(f)
+	if err := gob.NewEncoder(zw).Encode(s); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write snapshot %s: %w", file, err)
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return err
+	}
+
+	slog.Info("snapshot written", "file", file, "lists", len(s.Entries))
+	return nil
+}
+
+func newSnapshotSet(set *prefixSet) (snapshotSet, error) {
+	ipSet, err := set.ipSet()
+	if err != nil {
+		return snapshotSet{}, err
+	}
+	return snapshotSet{Prefixes: ipSet.Prefixes(), Added: set.added}, nil
+}
+
+// readSnapshot returns the container of the snapshot file, which keeps the
+// prefixes exactly as they are added if keepAdded is true, and the snapshot
+func readSnapshot(file string, keepAdded bool) (Container, *snapshot, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot %s: %w", file, err)
+	}
+	s := new(snapshot)
+	if err := gob.NewDecoder(zr).Decode(s); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot %s: %w", file, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, nil, fmt.Errorf("snapshot %s has unsupported version %d, must be %d", file, s.Version, snapshotVersion)
+	}
+
+	container := newContainer(keepAdded)
+	for _, se := range s.Entries {
+		entry := NewEntry(se.Name)
+		entry.AddTag(se.Tags...)
+		if se.HasIPv4 {
+			entry.ipv4 = se.IPv4.prefixSet(s.Added)
+		}
+		if se.HasIPv6 {
+			entry.ipv6 = se.IPv6.prefixSet(s.Added)
+		}
+		for _, m := range se.Metadata {
+			entry.metadata = append(entry.metadata, prefixMetadata{prefix: m.Prefix, metadata: m.Metadata})
+		}
+		if err := container.Add(entry); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return container, s, nil
+}
+
+// prefixSet returns the prefix set of the snapshot. Without the prefixes exactly
+// as they are added, the aggregated ones are used instead.
+func (s snapshotSet) prefixSet(added bool) *prefixSet {
+	set := new(prefixSet)
+	for _, prefix := range s.Prefixes {
+		set.addPrefix(prefix, !added)
+	}
+	if added {
+		set.added = s.Added
+	}
+	return set
+}
+
+// restoreSnapshot restores the container from the restore file instead of running inputs
+func (i *instance) restoreSnapshot() (Container, error) {
+	container, s, err := readSnapshot(i.restoreFile, i.keepAddedPrefixes())
+	if err != nil {
+		return nil, withErrorKind(ErrorKindInput, err)
+	}
+
+	if len(i.input) > 0 && s.Inputs != "" && s.Inputs != i.inputsFingerprint() {
+		slog.Warn("inputs of the config have changed since the snapshot was written", "file", i.restoreFile)
+	}
+	if !s.Added && i.keepAddedPrefixes() {
+		slog.Warn("snapshot has no prefixes exactly as they are added, aggregated ones are output instead", "file", i.restoreFile)
+	}
+	if i.needReport() {
+		i.report = newBuildReport(container, nil, nil)
+	}
+
+	slog.Info("snapshot restored", "file", i.restoreFile, "lists", container.Len())
+	return container, nil
+}
+
+// loadContainer runs inputs on a new container, or restores it from the restore file,
+// and saves it to the snapshot file if any
+func (i *instance) loadContainer(ctx context.Context) (Container, error) {
+	if i.restoreFile != "" {
+		return i.restoreSnapshot()
+	}
+
+	container := newContainer(i.keepAddedPrefixes())
+	if err := i.runInputs(ctx, container); err != nil {
+		return nil, err
+	}
+	if err := i.shrinkGuard.check(i.report); err != nil {
+		return nil, withErrorKind(ErrorKindInput, err)
+	}
+
+	if i.snapshotFile != "" {
+		if err := writeSnapshot(container, i.snapshotFile, i.inputsFingerprint()); err != nil {
+			return nil, err
+		}
+	}
+	return container, nil
+}
@@ -0,0 +1,27 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// parseInputTags reads the optional tags from the args of an input,
+// which are added to all lists loaded by the input
+func parseInputTags(action Action, args json.RawMessage) ([]string, error) {
+	var tmp struct {
+		Tags []string `json:"tags"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tags are normalized in the same way as the ones of entries
+	entry := NewEntry("")
+	entry.AddTag(tmp.Tags...)
+	if len(entry.tags) > 0 && action != ActionAdd {
+		return nil, fmt.Errorf("tags are only supported by action %s", ActionAdd)
+	}
+	return entry.tags, nil
+}
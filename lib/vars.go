@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+)
+
+// varPattern matches ${NAME} and ${NAME:-default}
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandVars replaces ${NAME} in a string with the value of the variable NAME
+// in vars, or the environment variable NAME if not in vars. ${NAME:-default}
+// uses default if the variable is not defined.
+func expandVars(s string, vars map[string]string) (string, error) {
+	var err error
+	expanded := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := varPattern.FindStringSubmatch(match)
+		name, hasDefault, defaultValue := groups[1], groups[2] != "", groups[3]
+		if value, found := vars[name]; found {
+			return value
+		}
+		if value, found := os.LookupEnv(name); found {
+			return value
+		}
+		if hasDefault {
+			return defaultValue
+		}
+		if err == nil {
+			err = fmt.Errorf("variable %s is not defined", name)
+		}
+		return match
+	})
+	return expanded, err
+}
+
+// expandConfigVars expands variables in all string values of the config,
+// with the vars section of it and inherited from the including config file.
+// It returns the config and the vars to be inherited by included config files.
+func expandConfigVars(content []byte, inherited map[string]string) ([]byte, map[string]string, error) {
+	if !bytes.Contains(content, []byte("${")) && !bytes.Contains(content, []byte(`"vars"`)) {
+		return content, inherited, nil
+	}
+
+	var config map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, nil, err
+	}
+
+	vars := maps.Clone(inherited)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	if rawVars, ok := config["vars"].(map[string]any); ok {
+		for name, value := range rawVars {
+			s, ok := value.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("value of variable %s must be a string", name)
+			}
+			// Variables could refer to environment variables
+			expanded, err := expandVars(s, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			vars[name] = expanded
+		}
+	}
+
+	// The vars section has been expanded above
+	rawVars := config["vars"]
+	delete(config, "vars")
+	expanded, err := expandValue(config, vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rawVars != nil {
+		config["vars"] = rawVars
+	}
+
+	content, err = json.Marshal(expanded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, vars, nil
+}
+
+func expandValue(value any, vars map[string]string) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return expandVars(v, vars)
+	case []any:
+		for idx, item := range v {
+			expanded, err := expandValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[idx] = expanded
+		}
+	case map[string]any:
+		for key, item := range v {
+			expanded, err := expandValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	}
+	return value, nil
+}
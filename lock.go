@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const defaultLockfile = "geoip.lock"
+
+func init() {
+	registerCommand(&command{
+		name:        "lock",
+		usage:       "[flags]",
+		description: "Run the inputs of the config file, and write the lockfile of the remote files they download with their SHA256 digests",
+		run:         runLock,
+	})
+}
+
+func runLock(args []string) error {
+	cmd := commands["lock"]
+	fs := cmd.newFlagSet()
+	var configFiles configFlag
+	fs.Var(&configFiles, "c", "Path to the config file or directory, could be specified multiple times to merge them in order (default config.json)")
+	lockfile := fs.String("lockfile", defaultLockfile, "Path to write the lockfile")
+	concurrency := fs.Int("concurrency", 1, "Max number of inputs loading data from their sources concurrently")
+	profile := fs.String("profile", "", "Name of the build profile, which selects inputs and outputs by their profiles args and enabled expressions")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+	lib.SetProfile(*profile)
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return err
+	}
+	if err := initConfigs(instance, configFiles.files()); err != nil {
+		return err
+	}
+	instance.SetConcurrency(*concurrency)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return instance.LockContext(ctx, *lockfile)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "lookup",
+		usage:       "[flags] <IP or CIDR> <file>...",
+		description: "Print the lists of generated files containing an IP address or CIDR",
+		run:         runLookup,
+	})
+}
+
+// lookupResult is the lists containing an IP address or CIDR in every file
+type lookupResult struct {
+	Query   string         `json:"query"`
+	Matches []*lookupMatch `json:"matches"`
+}
+
+type lookupMatch struct {
+	File  string   `json:"file"`
+	Lists []string `json:"lists"`
+}
+
+// lookupFile is a generated file loaded with its lists
+type lookupFile struct {
+	path      string
+	names     []string
+	container lib.Container
+}
+
+func runLookup(args []string) error {
+	cmd := commands["lookup"]
+	fs := cmd.newFlagSet()
+	format := fs.String("format", "", "Input format of the files, detected by file extension if not specified")
+	queryFile := fs.String("file", "", "Path to the file of IP addresses or CIDRs to look up, one per line, - for stdin")
+	jsonOutput := fs.Bool("json", false, "Print the results in JSON")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	fileArgs := fs.Args()
+	queries := make([]string, 0)
+	if *queryFile == "" {
+		if fs.NArg() < 2 {
+			fs.Usage()
+			return errors.New("IP address or CIDR and files must be specified")
+		}
+		queries = append(queries, fs.Arg(0))
+		fileArgs = fileArgs[1:]
+	} else {
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return errors.New("files must be specified")
+		}
+		var err error
+		if queries, err = readQueries(*queryFile); err != nil {
+			return err
+		}
+	}
+
+	files := make([]*lookupFile, 0, len(fileArgs))
+	for _, path := range fileArgs {
+		file, err := loadLookupFile(path, *format)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	results := make([]*lookupResult, 0, len(queries))
+	for _, query := range queries {
+		prefix, err := parseQuery(query)
+		if err != nil {
+			return err
+		}
+		result := &lookupResult{Query: query, Matches: make([]*lookupMatch, 0, len(files))}
+		for _, file := range files {
+			result.Matches = append(result.Matches, &lookupMatch{
+				File:  file.path,
+				Lists: file.lookup(prefix),
+			})
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	printLookupResults(os.Stdout, results)
+	return nil
+}
+
+func loadLookupFile(path, format string) (*lookupFile, error) {
+	container, err := loadArtifact(path, format, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &lookupFile{
+		path:      path,
+		names:     make([]string, 0, container.Len()),
+		container: container,
+	}
+	for entry := range container.Entries() {
+		file.names = append(file.names, entry.GetName())
+	}
+
+	return file, nil
+}
+
+// lookup returns the sorted names of lists containing the whole prefix
+func (f *lookupFile) lookup(prefix netip.Prefix) []string {
+	// Sets of lists loaded from files are always built, so lookups don't fail
+	lists, err := f.container.Lookup(prefix)
+	if err != nil {
+		return []string{}
+	}
+	return lists
+}
+
+// parseQuery parses an IP address or CIDR into a prefix
+func parseQuery(query string) (netip.Prefix, error) {
+	entry := lib.NewEntry("query")
+	if err := entry.AddPrefix(query); err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address or CIDR %s: %w", query, err)
+	}
+	prefixes, err := entry.MarshalPrefix()
+	if err != nil || len(prefixes) != 1 {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address or CIDR %s", query)
+	}
+	return prefixes[0], nil
+}
+
+// readQueries reads IP addresses or CIDRs from a file, skipping empty lines and comments
+func readQueries(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	queries := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		queries = append(queries, line)
+	}
+	return queries, scanner.Err()
+}
+
+func printLookupResults(w io.Writer, results []*lookupResult) {
+	for _, result := range results {
+		fmt.Fprintln(w, result.Query)
+		for _, match := range result.Matches {
+			lists := "(not found)"
+			if len(match.Lists) > 0 {
+				lists = strings.ToLower(strings.Join(match.Lists, ", "))
+			}
+			fmt.Fprintf(w, "  %s: %s\n", match.File, lists)
+		}
+	}
+}
@@ -1,38 +1,220 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/v2fly/geoip/lib"
 )
 
 var (
-	list       = flag.Bool("l", false, "List all available input and output formats")
-	configFile = flag.String("c", "config.json", "Path to the config file")
+	list         = flag.Bool("l", false, "List all available input and output formats, and commands")
+	dryRun       = flag.Bool("dry-run", false, "Print the pipeline planned by the config file and exit without running it")
+	concurrency  = flag.Int("concurrency", 1, "Max number of inputs loading data from their sources concurrently")
+	offline      = flag.Bool("offline", false, "Forbid network access and read all remote files from the download cache")
+	logLevel     = flag.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat    = flag.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	report       = flag.Bool("report", false, "Print statistics of every list after running")
+	reportFile   = flag.String("report-file", "", "Path to write statistics of every list in JSON, compared with the previous ones in the file if it exists")
+	stateFile    = flag.String("state", "", "Path to the state file of incremental builds, which skip the run or outputs if unchanged since the last run")
+	progress     = flag.String("progress", "auto", "Progress display, the value is auto (terminal if stderr is a terminal), terminal, json (events in JSON lines to stdout) or none")
+	snapshotFile = flag.String("snapshot", "", "Path to write the snapshot of the lists loaded by inputs, to run outputs again later by -restore")
+	restoreFile  = flag.String("restore", "", "Path to the snapshot to restore the lists from instead of running inputs")
+	summaryFile  = flag.String("summary", "", "Path to write the summary of the run in JSON, even if it fails, - for stdout")
+	profile      = flag.String("profile", "", "Name of the build profile, which selects inputs and outputs by their profiles args and enabled expressions")
+	locked       = flag.Bool("locked", false, "Only build from remote files in the lockfile matching their SHA256 digests, see the lock command")
+	lockfile     = flag.String("lockfile", defaultLockfile, "Path to the lockfile of -locked")
 )
 
+var configFiles configFlag
+
+func init() {
+	flag.Var(&configFiles, "c", "Path to the config file or directory, could be specified multiple times to merge them in order (default config.json)")
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, found := commands[os.Args[1]]; found {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		fatal(&lib.RunError{Kind: lib.ErrorKindConfig, Err: err})
+	}
+
+	var summary *runSummary
+	if *summaryFile != "" {
+		summary = newRunSummary()
+		slog.SetDefault(slog.New(&summaryHandler{Handler: slog.Default().Handler(), summary: summary}))
+	}
+
+	err := run(summary)
+	if summary != nil {
+		if err := summary.finish(err).write(*summaryFile); err != nil {
+			slog.Error("failed to write the summary", "error", err)
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// run runs the config file, and records the run in the summary if not nil
+func run(summary *runSummary) error {
+	if _, err := lib.SourceDateEpoch(); err != nil {
+		return &lib.RunError{Kind: lib.ErrorKindConfig, Err: err}
+	}
+
 	if *list {
 		lib.ListInputConverter()
 		fmt.Println()
 		lib.ListOutputConverter()
-		return
+		fmt.Println()
+		listCommands()
+		return nil
 	}
 
 	instance, err := lib.NewInstance()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	if *offline {
+		lib.SetDownloadOptions(&lib.DownloadOptions{Offline: true})
+	}
+	lib.SetProfile(*profile)
+	if *locked {
+		if err := lib.SetLockfile(*lockfile); err != nil {
+			return &lib.RunError{Kind: lib.ErrorKindConfig, Err: err}
+		}
+	}
+
+	if err := initConfigs(instance, configFiles.files()); err != nil {
+		return err
+	}
+
+	instance.SetConcurrency(*concurrency)
+
+	if *dryRun {
+		return instance.PrintPlan(os.Stdout)
+	}
+
+	// Interrupting cancels in-flight downloads and API calls instead of killing the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var reporter lib.ProgressReporter
+	switch *progress {
+	case "auto":
+		if isTerminal(os.Stderr) {
+			p := lib.NewTerminalProgress(os.Stderr)
+			reporter = p
+			defer p.Finish()
+		}
+	case "terminal":
+		p := lib.NewTerminalProgress(os.Stderr)
+		reporter = p
+		defer p.Finish()
+	case "json":
+		reporter = lib.NewJSONProgress(os.Stdout)
+	case "none":
+	default:
+		return &lib.RunError{Kind: lib.ErrorKindConfig, Err: fmt.Errorf("invalid progress %s, must be auto, terminal, json or none", *progress)}
+	}
+	if summary != nil {
+		summary.next = reporter
+		reporter = summary
+	}
+	if reporter != nil {
+		lib.SetProgressReporter(reporter)
+	}
+
+	instance.SetReport(*report || *reportFile != "")
+	instance.SetStateFile(*stateFile)
+	instance.SetSnapshotFile(*snapshotFile)
+	instance.SetRestoreFile(*restoreFile)
+
+	if err := instance.RunContext(ctx); err != nil {
+		return err
+	}
+
+	if r := instance.Report(); r != nil {
+		return writeReport(r, *report, *reportFile)
+	}
+	return nil
+}
+
+// writeReport prints the report and writes it to the file, compared with the previous one in the file
+func writeReport(r *lib.BuildReport, print bool, file string) error {
+	if file != "" {
+		previous, err := lib.ReadBuildReport(file)
+		if err != nil {
+			return err
+		}
+		r.Compare(previous)
+	}
+
+	if print {
+		if err := r.WriteTable(os.Stdout); err != nil {
+			return err
+		}
 	}
 
-	if err := instance.InitConfig(*configFile); err != nil {
-		log.Fatal(err)
+	if file != "" {
+		return r.WriteFile(file)
 	}
+	return nil
+}
+
+// Exit codes telling which stage of a run failed
+const (
+	exitFailure     = 1 // other errors
+	exitConfig      = 2 // invalid flags or config files, the same as the flag package
+	exitDownload    = 3 // failed to download remote files
+	exitInput       = 4 // failed to load or process lists
+	exitOutput      = 5 // failed to write or publish outputs
+	exitInterrupted = 130
+)
 
-	if err := instance.Run(); err != nil {
-		log.Fatal(err)
+// exitCode returns the exit code of the error
+func exitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	switch lib.ErrorKind(err) {
+	case lib.ErrorKindConfig:
+		return exitConfig
+	case lib.ErrorKindDownload:
+		return exitDownload
+	case lib.ErrorKindInput:
+		return exitInput
+	case lib.ErrorKindOutput:
+		return exitOutput
+	default:
+		return exitFailure
 	}
 }
+
+// fatal logs the error and exits with the exit code of the error
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(exitCode(err))
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "outdated",
+		usage:       "[flags]",
+		description: "Check whether the remote files of the lockfile or the download cache have new data, without building",
+		run:         runOutdated,
+	})
+}
+
+func runOutdated(args []string) error {
+	cmd := commands["outdated"]
+	fs := cmd.newFlagSet()
+	var configFiles configFlag
+	fs.Var(&configFiles, "c", "Path to the config file or directory, whose download options are used, could be specified multiple times to merge them in order (default config.json)")
+	lockfile := fs.String("lockfile", defaultLockfile, "Path to the lockfile to check the remote files of, the ones in the download cache are checked if it does not exist")
+	jsonOutput := fs.Bool("json", false, "Print the status of every remote file in JSON")
+	exitCode := fs.Bool("exit-code", false, "Exit with 1 if any remote file has new data or could not be checked, so that schedulers could skip builds otherwise")
+	logLevel := fs.String("log-level", "warn", "Log level, the value is debug, info, warn or error")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, lib.LogFormatText); err != nil {
+		return err
+	}
+
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return err
+	}
+	if err := initConfigs(instance, configFiles.files()); err != nil {
+		return err
+	}
+
+	locked, err := lib.ReadLockfile(*lockfile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	statuses, err := lib.CheckSources(ctx, locked)
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) == 0 {
+		slog.Warn("no remote file to check in the lockfile or the download cache")
+	}
+
+	changed := 0
+	for _, status := range statuses {
+		if status.Status != lib.SourceUnchanged {
+			changed++
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(statuses); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE\tSTATUS\tREASON\tLAST MODIFIED")
+		for _, status := range statuses {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status.URL, status.Status, status.Reason, status.LastModified)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if *exitCode && changed > 0 {
+		return fmt.Errorf("%d of %d remote files have new data or could not be checked", changed, len(statuses))
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Package geoip is the stable API to embed geoip in Go programs. It builds
+// pipelines of inputs and outputs in Go instead of config files, runs them,
+// and exposes the lists loaded by inputs as a Container of Entry.
+//
+// Importing the package registers all built-in input and output formats, the
+// same as the CLI. Custom formats are registered by RegisterInput and RegisterOutput.
+//
+//	input, err := geoip.NewInput("text", geoip.ActionAdd, map[string]any{
+//		"name": "cn",
+//		"uri":  "https://example.com/cn.txt",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	output, err := geoip.NewOutput("v2rayGeoIPDat", map[string]any{
+//		"outputDir": "./output",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	runner := &geoip.Runner{
+//		Inputs:  []geoip.InputConverter{input},
+//		Outputs: []geoip.OutputConverter{output},
+//	}
+//	if err := runner.Run(ctx); err != nil {
+//		return err
+//	}
+//
+// Types of this package are aliases of the ones of package lib, which is the
+// implementation shared with the CLI and may change without notice.
+package geoip
@@ -0,0 +1,186 @@
+package geoip
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+type (
+	// Container holds lists loaded by inputs, which are written by outputs
+	Container = lib.Container
+	// Entry is a list of IPv4 and IPv6 prefixes
+	Entry = lib.Entry
+	// Metadata is the optional information of prefixes, like the origin ASN
+	Metadata           = lib.Metadata
+	PrefixWithMetadata = lib.PrefixWithMetadata
+
+	Action         = lib.Action
+	IPType         = lib.IPType
+	CaseRemove     = lib.CaseRemove
+	IgnoreIPOption = lib.IgnoreIPOption
+
+	InputConverter         = lib.InputConverter
+	OutputConverter        = lib.OutputConverter
+	SourceInputConverter   = lib.SourceInputConverter
+	ContextInputConverter  = lib.ContextInputConverter
+	ContextOutputConverter = lib.ContextOutputConverter
+
+	BuildReport     = lib.BuildReport
+	DownloadOptions = lib.DownloadOptions
+	// RunError is an error failing a stage of a run, like downloading
+	RunError = lib.RunError
+	// BuildInfo is the metadata of a build embedded in generated files
+	BuildInfo = lib.BuildInfo
+)
+
+const (
+	ActionAdd    = lib.ActionAdd
+	ActionRemove = lib.ActionRemove
+	ActionOutput = lib.ActionOutput
+	// ActionReplace replaces lists of the same names with the ones of the input
+	ActionReplace = lib.ActionReplace
+
+	IPv4 = lib.IPv4
+	IPv6 = lib.IPv6
+
+	CaseRemovePrefix = lib.CaseRemovePrefix
+	CaseRemoveEntry  = lib.CaseRemoveEntry
+
+	// TagASN is the tag of lists of autonomous systems, like AS13335
+	TagASN = lib.TagASN
+
+	// Kinds of errors failing a run, returned by ErrorKind
+	ErrorKindConfig   = lib.ErrorKindConfig
+	ErrorKindDownload = lib.ErrorKindDownload
+	ErrorKindInput    = lib.ErrorKindInput
+	ErrorKindOutput   = lib.ErrorKindOutput
+)
+
+// IgnoreIPv4 and IgnoreIPv6 are options of Container and Entry to handle only one IP type
+var (
+	IgnoreIPv4 IgnoreIPOption = lib.IgnoreIPv4
+	IgnoreIPv6 IgnoreIPOption = lib.IgnoreIPv6
+)
+
+// ErrorKind returns the kind of the error failing a run, empty if unknown
+func ErrorKind(err error) string {
+	return lib.ErrorKind(err)
+}
+
+// NewContainer returns an empty container
+func NewContainer() Container {
+	return lib.NewContainer()
+}
+
+// WriteSnapshot saves all lists of the container to the snapshot file
+func WriteSnapshot(container Container, file string) error {
+	return lib.WriteSnapshot(container, file)
+}
+
+// ReadSnapshot returns the container of the lists saved to the snapshot file
+func ReadSnapshot(file string) (Container, error) {
+	return lib.ReadSnapshot(file)
+}
+
+// NewBuildInfo returns the build info of the lists in the container
+func NewBuildInfo(container Container) *BuildInfo {
+	return lib.NewBuildInfo(container)
+}
+
+// ReadBuildInfo returns the build info embedded in the content of a file of the format, nil if none
+func ReadBuildInfo(format string, data []byte) (*BuildInfo, error) {
+	return lib.ReadBuildInfo(format, data)
+}
+
+// ASNName returns the name of the list of the autonomous system, like AS13335
+func ASNName(asn uint32) string {
+	return lib.ASNName(asn)
+}
+
+// ParseASN returns the number of the autonomous system of the list name like AS13335
+func ParseASN(name string) (uint32, bool) {
+	return lib.ParseASN(name)
+}
+
+// IsCountryCode reports whether the name is an ISO 3166-1 alpha-2 code, case-insensitive
+func IsCountryCode(name string) bool {
+	return lib.IsCountryCode(name)
+}
+
+// NewEntry returns an empty list of the name, which is case-insensitive
+func NewEntry(name string) *Entry {
+	return lib.NewEntry(name)
+}
+
+// NewInput creates an input of the format with args, the same as the input in a
+// config file. Args could be a struct, a map, or JSON in json.RawMessage.
+func NewInput(format string, action Action, args any) (InputConverter, error) {
+	data, err := marshalArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return lib.NewInputConverter(format, action, data)
+}
+
+// NewOutput creates an output of the format with args, the same as the output in a
+// config file. Args could be a struct, a map, or JSON in json.RawMessage.
+func NewOutput(format string, args any) (OutputConverter, error) {
+	data, err := marshalArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return lib.NewOutputConverter(format, data)
+}
+
+func marshalArgs(args any) (json.RawMessage, error) {
+	switch v := args.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return v, nil
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid args: %w", err)
+	}
+	return data, nil
+}
+
+// RegisterInput registers a custom input format, which could be used in config files
+// and by NewInput. The converter describes the format in format lists, create makes a
+// converter from args in JSON, and args is the struct of args for config validation
+// and the JSON schema, or nil if the format has no args.
+func RegisterInput(format string, converter InputConverter, create func(Action, json.RawMessage) (InputConverter, error), args any) error {
+	if err := lib.RegisterInputConfigCreator(format, create); err != nil {
+		return err
+	}
+	if err := lib.RegisterInputConverter(format, converter); err != nil {
+		return err
+	}
+	if args == nil {
+		args = struct{}{}
+	}
+	return lib.RegisterInputArgs(format, args)
+}
+
+// RegisterOutput registers a custom output format, the same as RegisterInput
+func RegisterOutput(format string, converter OutputConverter, create func(Action, json.RawMessage) (OutputConverter, error), args any) error {
+	if err := lib.RegisterOutputConfigCreator(format, create); err != nil {
+		return err
+	}
+	if err := lib.RegisterOutputConverter(format, converter); err != nil {
+		return err
+	}
+	if args == nil {
+		args = struct{}{}
+	}
+	return lib.RegisterOutputArgs(format, args)
+}
+
+// SetDownloadOptions sets the options of downloading remote files for all inputs,
+// the same as download in config files
+func SetDownloadOptions(opts *DownloadOptions) {
+	lib.SetDownloadOptions(opts)
+}
@@ -0,0 +1,83 @@
+package geoip
+
+import (
+	"context"
+	"errors"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+// Runner runs inputs in order to load lists into a container, then outputs in order
+// to write them, the same as the config file with these inputs and outputs
+type Runner struct {
+	Inputs  []InputConverter
+	Outputs []OutputConverter
+
+	// Concurrency is the max number of inputs loading data from their sources concurrently, 1 if zero
+	Concurrency int
+
+	// StateFile enables incremental builds with the state in the file if not empty
+	StateFile string
+
+	// SnapshotFile is the file to save the lists loaded by inputs to if not empty
+	SnapshotFile string
+	// RestoreFile is the snapshot to restore the lists from instead of running inputs by Run if not empty
+	RestoreFile string
+
+	// EnableReport enables the build report of the last run returned by Report
+	EnableReport bool
+
+	report *BuildReport
+}
+
+func (r *Runner) newInstance() (lib.Instance, error) {
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range r.Inputs {
+		instance.AddInput(input)
+	}
+	for _, output := range r.Outputs {
+		instance.AddOutput(output)
+	}
+	instance.SetConcurrency(max(r.Concurrency, 1))
+	instance.SetStateFile(r.StateFile)
+	instance.SetSnapshotFile(r.SnapshotFile)
+	instance.SetRestoreFile(r.RestoreFile)
+	instance.SetReport(r.EnableReport)
+	return instance, nil
+}
+
+// Run runs all inputs and outputs, which are canceled when the context is done
+func (r *Runner) Run(ctx context.Context) error {
+	instance, err := r.newInstance()
+	if err != nil {
+		return err
+	}
+	err = instance.RunContext(ctx)
+	r.report = instance.Report()
+	return err
+}
+
+// Load runs only inputs, and returns the container of the lists loaded by them
+func (r *Runner) Load(ctx context.Context) (Container, error) {
+	if len(r.Inputs) == 0 {
+		return nil, errors.New("input type must be specified")
+	}
+	instance, err := r.newInstance()
+	if err != nil {
+		return nil, err
+	}
+	container := NewContainer()
+	if err := instance.RunInputContext(ctx, container); err != nil {
+		return nil, err
+	}
+	r.report = instance.Report()
+	return container, nil
+}
+
+// Report returns the build report of the last run if EnableReport is set, or nil
+func (r *Runner) Report() *BuildReport {
+	return r.report
+}
@@ -0,0 +1,341 @@
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeArchiveOut = "archive"
+	descArchiveOut = "Bundle output files into zip or tar archives"
+)
+
+const (
+	formatZip   = "zip"
+	formatTarGz = "tar.gz"
+	formatTarXz = "tar.xz"
+)
+
+var (
+	defaultArchiveInputDir   = filepath.Join("./", "output")
+	defaultArchiveOutputDir  = filepath.Join("./", "output", "archive")
+	defaultArchiveOutputName = "geoip-{date}"
+
+	archiveFormats = []string{formatZip, formatTarGz, formatTarXz}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeArchiveOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newArchiveOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeArchiveOut, &archiveOut{
+		Description: descArchiveOut,
+	})
+	lib.RegisterOutputArgs(typeArchiveOut, archiveOutArgs{})
+}
+
+// archiveOutArgs are the args of the output converter in config file
+type archiveOutArgs struct {
+	InputDir   string   `json:"inputDir"`
+	Files      []string `json:"files"`
+	OutputDir  string   `json:"outputDir"`
+	OutputName string   `json:"outputName"`
+	Format     string   `json:"format"`
+	PathPrefix string   `json:"pathPrefix"`
+	Flatten    bool     `json:"flatten"`
+}
+
+func newArchiveOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp archiveOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultArchiveInputDir
+	}
+
+	for _, pattern := range tmp.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid file pattern %s: %v", typeArchiveOut, action, pattern, err)
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultArchiveOutputDir
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultArchiveOutputName
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	if tmp.Format == "" {
+		tmp.Format = formatZip
+	}
+	if !slices.Contains(archiveFormats, tmp.Format) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be zip, tar.gz or tar.xz", typeArchiveOut, action, tmp.Format)
+	}
+
+	tmp.PathPrefix = strings.Trim(filepath.ToSlash(tmp.PathPrefix), "/")
+
+	return &archiveOut{
+		Type:        typeArchiveOut,
+		Action:      action,
+		Description: descArchiveOut,
+		InputDir:    tmp.InputDir,
+		Files:       tmp.Files,
+		OutputDir:   tmp.OutputDir,
+		OutputName:  tmp.OutputName,
+		Format:      tmp.Format,
+		PathPrefix:  tmp.PathPrefix,
+		Flatten:     tmp.Flatten,
+	}, nil
+}
+
+type archiveOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	InputDir    string
+	Files       []string
+	OutputDir   string
+	OutputName  string
+	Format      string
+	PathPrefix  string
+	Flatten     bool
+}
+
+// archiveFile is a file to be put into the archive
+type archiveFile struct {
+	Path string // path of the file on disk
+	Name string // path of the file in the archive
+	Info fs.FileInfo
+}
+
+func (a *archiveOut) GetType() string {
+	return a.Type
+}
+
+func (a *archiveOut) GetAction() lib.Action {
+	return a.Action
+}
+
+func (a *archiveOut) GetDescription() string {
+	return a.Description
+}
+
+// Output ignores the container and bundles files written by previous outputs
+// in InputDir into an archive
+func (a *archiveOut) Output(container lib.Container) error {
+	files, err := a.listFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no file found in %s", a.Type, a.Action, a.InputDir)
+	}
+
+	if err := os.MkdirAll(a.OutputDir, 0755); err != nil {
+		return err
+	}
+
+	filename := a.filename(lib.BuildTime())
+	f, err := os.Create(filepath.Join(a.OutputDir, filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch a.Format {
+	case formatZip:
+		err = a.writeZip(f, files)
+	case formatTarGz:
+		gw := gzip.NewWriter(f)
+		if err = a.writeTar(gw, files); err == nil {
+			err = gw.Close()
+		}
+	case formatTarXz:
+		var xw *xz.Writer
+		if xw, err = xz.NewWriter(f); err == nil {
+			if err = a.writeTar(xw, files); err == nil {
+				err = xw.Close()
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", a.Type, "file", filename, "dir", a.OutputDir)
+
+	return nil
+}
+
+// filename replaces placeholders in OutputName and appends the extension of the format
+func (a *archiveOut) filename(now time.Time) string {
+	now = now.UTC()
+	name := strings.NewReplacer(
+		"{date}", now.Format("20060102"),
+		"{datetime}", now.Format("20060102150405"),
+	).Replace(a.OutputName)
+	return name + "." + a.Format
+}
+
+// listFiles returns files in InputDir matching patterns of Files, skipping OutputDir
+func (a *archiveOut) listFiles() ([]*archiveFile, error) {
+	outputDir, err := filepath.Abs(a.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*archiveFile, 0)
+	names := make(map[string]string)
+	err = filepath.WalkDir(a.InputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if abs, err := filepath.Abs(p); err == nil && abs == outputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(a.InputDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !a.match(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name := rel
+		if a.Flatten {
+			name = path.Base(rel)
+		}
+		if a.PathPrefix != "" {
+			name = a.PathPrefix + "/" + name
+		}
+
+		if dup, found := names[name]; found {
+			return fmt.Errorf("❌ [type %s | action %s] both %s and %s are put into the archive as %s", a.Type, a.Action, dup, rel, name)
+		}
+		names[name] = rel
+
+		files = append(files, &archiveFile{Path: p, Name: name, Info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(files, func(x, y *archiveFile) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+	return files, nil
+}
+
+// match reports whether the path relative to InputDir matches any pattern of Files.
+// A pattern without slash matches the base name of files in any directory.
+func (a *archiveOut) match(rel string) bool {
+	if len(a.Files) == 0 {
+		return true
+	}
+	for _, pattern := range a.Files {
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *archiveOut) writeZip(w io.Writer, files []*archiveFile) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		header, err := zip.FileInfoHeader(file.Info)
+		if err != nil {
+			return err
+		}
+		header.Name = file.Name
+		header.Method = zip.Deflate
+		header.Modified = lib.ClampModTime(header.Modified)
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(fw, file.Path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (a *archiveOut) writeTar(w io.Writer, files []*archiveFile) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		header, err := tar.FileInfoHeader(file.Info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = file.Name
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.ModTime = lib.ClampModTime(header.ModTime)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, file.Path); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,265 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeChecksumOut = "checksum"
+	descChecksumOut = "Generate checksum files for output files"
+)
+
+var (
+	defaultChecksumInputDir     = filepath.Join("./", "output")
+	defaultChecksumAlgorithms   = []string{"sha256"}
+	defaultChecksumCombinedName = "checksums.txt"
+
+	checksumAlgorithms = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+	checksumExtensions = map[string]string{
+		"md5":    ".md5",
+		"sha1":   ".sha1sum",
+		"sha256": ".sha256sum",
+		"sha512": ".sha512sum",
+	}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeChecksumOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newChecksumOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeChecksumOut, &checksumOut{
+		Description: descChecksumOut,
+	})
+	lib.RegisterOutputArgs(typeChecksumOut, checksumOutArgs{})
+}
+
+// checksumOutArgs are the args of the output converter in config file
+type checksumOutArgs struct {
+	InputDir     string   `json:"inputDir"`
+	Algorithms   []string `json:"algorithms"`
+	Extensions   []string `json:"extensions"`
+	Sidecar      *bool    `json:"sidecar"`
+	CombinedName string   `json:"combinedName"`
+}
+
+func newChecksumOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp checksumOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultChecksumInputDir
+	}
+
+	algorithms := make([]string, 0, len(tmp.Algorithms))
+	for _, algorithm := range tmp.Algorithms {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if _, found := checksumAlgorithms[algorithm]; !found {
+			return nil, fmt.Errorf("❌ [type %s | action %s] unsupported algorithm %s", typeChecksumOut, action, algorithm)
+		}
+		if !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = defaultChecksumAlgorithms
+	}
+
+	extensions := make([]string, 0, len(tmp.Extensions))
+	for _, ext := range tmp.Extensions {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+
+	sidecar := true
+	if tmp.Sidecar != nil {
+		sidecar = *tmp.Sidecar
+	}
+
+	if tmp.CombinedName == "" {
+		tmp.CombinedName = defaultChecksumCombinedName
+	}
+
+	return &checksumOut{
+		Type:         typeChecksumOut,
+		Action:       action,
+		Description:  descChecksumOut,
+		InputDir:     tmp.InputDir,
+		Algorithms:   algorithms,
+		Extensions:   extensions,
+		Sidecar:      sidecar,
+		CombinedName: tmp.CombinedName,
+	}, nil
+}
+
+type checksumOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	InputDir     string
+	Algorithms   []string
+	Extensions   []string
+	Sidecar      bool
+	CombinedName string
+}
+
+func (c *checksumOut) GetType() string {
+	return c.Type
+}
+
+func (c *checksumOut) GetAction() lib.Action {
+	return c.Action
+}
+
+func (c *checksumOut) GetDescription() string {
+	return c.Description
+}
+
+// Output ignores the container and generates checksums for files
+// written by previous outputs in InputDir
+func (c *checksumOut) Output(container lib.Container) error {
+	files, err := c.listFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no file found in %s", c.Type, c.Action, c.InputDir)
+	}
+
+	var combined bytes.Buffer
+	for _, file := range files {
+		sums, err := c.sum(filepath.Join(c.InputDir, file))
+		if err != nil {
+			return err
+		}
+
+		// The format is the same as the output of coreutils, e.g. sha256sum
+		for i, algorithm := range c.Algorithms {
+			if c.Sidecar {
+				line := sums[algorithm] + "  " + filepath.Base(file) + "\n"
+				if err := c.writeFile(file+checksumExtensions[algorithm], []byte(line)); err != nil {
+					return err
+				}
+			}
+			if i == 0 {
+				combined.WriteString(sums[algorithm] + "  " + filepath.ToSlash(file) + "\n")
+			}
+		}
+	}
+
+	return c.writeFile(c.CombinedName, combined.Bytes())
+}
+
+// listFiles returns sorted paths relative to InputDir, excluding checksum files
+func (c *checksumOut) listFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(c.InputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(c.InputDir, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == c.CombinedName || c.isChecksumFile(rel) {
+			return nil
+		}
+		if len(c.Extensions) > 0 && !slices.Contains(c.Extensions, strings.ToLower(filepath.Ext(rel))) {
+			return nil
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+func (c *checksumOut) isChecksumFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, checksumExt := range checksumExtensions {
+		if ext == checksumExt {
+			return true
+		}
+	}
+	return false
+}
+
+// sum reads the file once and computes checksums of all algorithms
+func (c *checksumOut) sum(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]hash.Hash, len(c.Algorithms))
+	writers := make([]io.Writer, 0, len(c.Algorithms))
+	for _, algorithm := range c.Algorithms {
+		h := checksumAlgorithms[algorithm]()
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string, len(hashes))
+	for algorithm, h := range hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+func (c *checksumOut) writeFile(filename string, data []byte) error {
+	path := filepath.Join(c.InputDir, filename)
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", c.Type, "file", filepath.Base(filename), "dir", filepath.Dir(path))
+
+	return nil
+}
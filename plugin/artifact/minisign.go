@@ -0,0 +1,131 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// minisignKey is a secret key of minisign, see https://jedisct1.github.io/minisign/
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PrivateKey
+}
+
+const (
+	minisignSecretKeySize = 158
+	minisignKeynumSize    = 104 // key ID, secret key and checksum
+)
+
+// parseMinisignKey parses a secret key file of minisign,
+// which is decrypted with the password if encrypted
+func parseMinisignKey(data []byte, password string) (*minisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	encoded := strings.TrimSpace(lines[len(lines)-1])
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != minisignSecretKeySize {
+		return nil, errors.New("invalid minisign secret key")
+	}
+
+	sigAlg, kdfAlg, cksumAlg := raw[0:2], raw[2:4], raw[4:6]
+	salt := raw[6:38]
+	opsLimit := binary.LittleEndian.Uint64(raw[38:46])
+	memLimit := binary.LittleEndian.Uint64(raw[46:54])
+	keynum := bytes.Clone(raw[54:])
+
+	if string(sigAlg) != "Ed" || string(cksumAlg) != "B2" {
+		return nil, errors.New("unsupported algorithms of minisign secret key")
+	}
+
+	switch {
+	case string(kdfAlg) == "Sc":
+		if password == "" {
+			return nil, errors.New("minisign secret key is encrypted, but no password is specified")
+		}
+		n, r, p := scryptParams(opsLimit, memLimit)
+		stream, err := scrypt.Key([]byte(password), salt, n, r, p, minisignKeynumSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keynum {
+			keynum[i] ^= stream[i]
+		}
+	case kdfAlg[0] == 0 && kdfAlg[1] == 0:
+	default:
+		return nil, errors.New("unsupported key derivation of minisign secret key")
+	}
+
+	k := new(minisignKey)
+	copy(k.id[:], keynum[0:8])
+	k.key = ed25519.PrivateKey(bytes.Clone(keynum[8:72]))
+
+	h, _ := blake2b.New256(nil)
+	h.Write(sigAlg)
+	h.Write(k.id[:])
+	h.Write(k.key)
+	if subtle.ConstantTimeCompare(h.Sum(nil), keynum[72:104]) != 1 {
+		return nil, errors.New("wrong password of minisign secret key")
+	}
+
+	return k, nil
+}
+
+// scryptParams returns the parameters of scrypt from the limits,
+// the same as crypto_pwhash_scryptsalsa208sha256 of libsodium used by minisign
+func scryptParams(opsLimit, memLimit uint64) (n, r, p int) {
+	opsLimit = max(opsLimit, 32768)
+	r = 8
+	var maxN uint64
+	if opsLimit < memLimit/32 {
+		p = 1
+		maxN = opsLimit / uint64(r*4)
+	} else {
+		maxN = memLimit / uint64(r*128)
+	}
+
+	nLog2 := 1
+	for ; nLog2 < 63; nLog2++ {
+		if uint64(1)<<nLog2 > maxN/2 {
+			break
+		}
+	}
+
+	if opsLimit >= memLimit/32 {
+		maxRP := min((opsLimit/4)/(uint64(1)<<nLog2), 0x3fffffff)
+		p = int(maxRP) / r
+	}
+	return 1 << nLog2, r, p
+}
+
+// sign returns the signature of the content in the format of minisign,
+// which is prehashed, with the trusted comment signed as well
+func (k *minisignKey) sign(r io.Reader, trustedComment string) ([]byte, error) {
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	signature := ed25519.Sign(k.key, h.Sum(nil))
+	globalSignature := ed25519.Sign(k.key, append(bytes.Clone(signature), trustedComment...))
+
+	sig := make([]byte, 0, 74)
+	sig = append(sig, "ED"...)
+	sig = append(sig, k.id[:]...)
+	sig = append(sig, signature...)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "untrusted comment: signature from minisign secret key\n")
+	fmt.Fprintf(&b, "%s\n", base64.StdEncoding.EncodeToString(sig))
+	fmt.Fprintf(&b, "trusted comment: %s\n", trustedComment)
+	fmt.Fprintf(&b, "%s\n", base64.StdEncoding.EncodeToString(globalSignature))
+	return b.Bytes(), nil
+}
@@ -0,0 +1,326 @@
+package artifact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeSignOut = "sign"
+	descSignOut = "Generate detached signatures for output files with minisign or GPG"
+)
+
+const (
+	signFormatMinisign = "minisign"
+	signFormatGPG      = "gpg"
+)
+
+var (
+	defaultSignInputDir = filepath.Join("./", "output")
+
+	signExtensions = []string{".minisig", ".sig", ".asc"}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeSignOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newSignOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeSignOut, &signOut{
+		Description: descSignOut,
+	})
+	lib.RegisterOutputArgs(typeSignOut, signOutArgs{})
+}
+
+// signOutArgs are the args of the output converter in config file
+type signOutArgs struct {
+	InputDir       string   `json:"inputDir"`
+	Extensions     []string `json:"extensions"`
+	Format         string   `json:"format"`
+	KeyFile        string   `json:"keyFile"`
+	KeyEnv         string   `json:"keyEnv"`
+	PasswordEnv    string   `json:"passwordEnv"`
+	TrustedComment string   `json:"trustedComment"`
+	KeyID          string   `json:"keyID"`
+	Armor          bool     `json:"armor"`
+}
+
+func newSignOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp signOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultSignInputDir
+	}
+
+	format := strings.ToLower(strings.TrimSpace(tmp.Format))
+	switch format {
+	case "":
+		format = signFormatMinisign
+	case signFormatMinisign, signFormatGPG:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] unsupported format %s, must be %s or %s", typeSignOut, action, tmp.Format, signFormatMinisign, signFormatGPG)
+	}
+
+	tmp.KeyFile = strings.TrimSpace(tmp.KeyFile)
+	tmp.KeyEnv = strings.TrimSpace(tmp.KeyEnv)
+	if (tmp.KeyFile == "") == (tmp.KeyEnv == "") {
+		return nil, fmt.Errorf("❌ [type %s | action %s] one of keyFile and keyEnv must be specified", typeSignOut, action)
+	}
+
+	if format == signFormatGPG {
+		if tmp.TrustedComment != "" {
+			return nil, fmt.Errorf("❌ [type %s | action %s] trustedComment is only supported by format %s", typeSignOut, action, signFormatMinisign)
+		}
+	} else if tmp.KeyID != "" || tmp.Armor {
+		return nil, fmt.Errorf("❌ [type %s | action %s] keyID and armor are only supported by format %s", typeSignOut, action, signFormatGPG)
+	}
+
+	extensions := make([]string, 0, len(tmp.Extensions))
+	for _, ext := range tmp.Extensions {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+
+	return &signOut{
+		Type:           typeSignOut,
+		Action:         action,
+		Description:    descSignOut,
+		InputDir:       tmp.InputDir,
+		Extensions:     extensions,
+		Format:         format,
+		KeyFile:        tmp.KeyFile,
+		KeyEnv:         tmp.KeyEnv,
+		PasswordEnv:    strings.TrimSpace(tmp.PasswordEnv),
+		TrustedComment: tmp.TrustedComment,
+		KeyID:          strings.TrimSpace(tmp.KeyID),
+		Armor:          tmp.Armor,
+	}, nil
+}
+
+type signOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	InputDir       string
+	Extensions     []string
+	Format         string
+	KeyFile        string
+	KeyEnv         string
+	PasswordEnv    string
+	TrustedComment string
+	KeyID          string
+	Armor          bool
+}
+
+func (s *signOut) GetType() string {
+	return s.Type
+}
+
+func (s *signOut) GetAction() lib.Action {
+	return s.Action
+}
+
+func (s *signOut) GetDescription() string {
+	return s.Description
+}
+
+// Output ignores the container and signs files
+// written by previous outputs in InputDir
+func (s *signOut) Output(container lib.Container) error {
+	files, err := s.listFiles()
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no file found in %s", s.Type, s.Action, s.InputDir)
+	}
+
+	key, err := s.readKey()
+	if err != nil {
+		return err
+	}
+
+	var password string
+	if s.PasswordEnv != "" {
+		password = os.Getenv(s.PasswordEnv)
+	}
+
+	switch s.Format {
+	case signFormatGPG:
+		return s.signWithGPG(files, key, password)
+	default:
+		return s.signWithMinisign(files, key, password)
+	}
+}
+
+// readKey returns the content of the secret key from the file or the environment variable
+func (s *signOut) readKey() ([]byte, error) {
+	if s.KeyEnv != "" {
+		key := os.Getenv(s.KeyEnv)
+		if key == "" {
+			return nil, fmt.Errorf("❌ [type %s | action %s] environment variable %s of the key is empty", s.Type, s.Action, s.KeyEnv)
+		}
+		return []byte(key), nil
+	}
+
+	key, err := os.ReadFile(s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] failed to read key: %w", s.Type, s.Action, err)
+	}
+	return key, nil
+}
+
+// listFiles returns sorted paths relative to InputDir, excluding signature files
+func (s *signOut) listFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(s.InputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.InputDir, path)
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(rel))
+		if slices.Contains(signExtensions, ext) {
+			return nil
+		}
+		if len(s.Extensions) > 0 && !slices.Contains(s.Extensions, ext) {
+			return nil
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+func (s *signOut) signWithMinisign(files []string, key []byte, password string) error {
+	secretKey, err := parseMinisignKey(key, password)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %w", s.Type, s.Action, err)
+	}
+
+	timestamp := lib.BuildTime().Unix()
+	for _, file := range files {
+		// The same as the default trusted comment of minisign
+		trustedComment := s.TrustedComment
+		if trustedComment == "" {
+			trustedComment = fmt.Sprintf("timestamp:%d\tfile:%s\thashed", timestamp, filepath.Base(file))
+		}
+
+		f, err := os.Open(filepath.Join(s.InputDir, file))
+		if err != nil {
+			return err
+		}
+		signature, err := secretKey.sign(f, trustedComment)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := s.writeFile(file+".minisig", signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signWithGPG signs files with the gpg command, whose key is imported
+// into a temporary home directory, so that the keyring of the user is untouched
+func (s *signOut) signWithGPG(files []string, key []byte, password string) error {
+	homeDir, err := os.MkdirTemp("", "geoip-gpg-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(homeDir)
+
+	args := []string{"--homedir", homeDir, "--batch", "--yes"}
+	if _, err := s.runGPG(append(slices.Clone(args), "--import"), key); err != nil {
+		return err
+	}
+
+	// The password is read from stdin without any prompt
+	args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0", "--detach-sign")
+	if s.KeyID != "" {
+		args = append(args, "--local-user", s.KeyID)
+	}
+	ext := ".sig"
+	if s.Armor {
+		args = append(args, "--armor")
+		ext = ".asc"
+	}
+	// Signatures embed the signing time, which is fixed for reproducible builds
+	if t, err := lib.SourceDateEpoch(); err == nil && t != nil {
+		args = append(args, "--faked-system-time", strconv.FormatInt(t.Unix(), 10)+"!", "--ignore-time-conflict")
+	}
+
+	for _, file := range files {
+		path := filepath.Join(s.InputDir, file)
+		signature, err := s.runGPG(append(slices.Clone(args), "--output", "-", path), []byte(password))
+		if err != nil {
+			return err
+		}
+		if err := s.writeFile(file+ext, signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *signOut) runGPG(args []string, stdin []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] gpg failed: %w: %s", s.Type, s.Action, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s *signOut) writeFile(filename string, data []byte) error {
+	path := filepath.Join(s.InputDir, filename)
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", s.Type, "file", filepath.Base(filename), "dir", filepath.Dir(path))
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeVerifyOut = "verifyOutputs"
+	descVerifyOut = "Verify output files of different formats classify sampled IP addresses identically"
+)
+
+var (
+	defaultVerifySamples = 100
+	maxVerifyDivergences = 10 // divergences shown in the error
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeVerifyOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newVerifyOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeVerifyOut, &verifyOut{
+		Description: descVerifyOut,
+	})
+	lib.RegisterOutputArgs(typeVerifyOut, verifyOutArgs{})
+}
+
+// verifyOutArgs are the args of the output converter in config file
+type verifyOutArgs struct {
+	Files   []*verifyFile `json:"files"`
+	Samples int           `json:"samples"`
+	Seed    *uint64       `json:"seed"`
+}
+
+// verifyFile is an output file read back by an input format, the same as an input in config file
+type verifyFile struct {
+	Type string          `json:"type"`
+	Args json.RawMessage `json:"args"`
+}
+
+func newVerifyOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp verifyOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tmp.Files) < 2 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] at least 2 files must be specified in config", typeVerifyOut, action)
+	}
+
+	formats := make([]string, 0, len(tmp.Files))
+	readers := make([]lib.InputConverter, 0, len(tmp.Files))
+	for idx, file := range tmp.Files {
+		reader, err := lib.NewInputConverter(file.Type, lib.ActionAdd, file.Args)
+		if err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid files[%d] of type %s: %v", typeVerifyOut, action, idx, file.Type, err)
+		}
+		formats = append(formats, reader.GetType())
+		readers = append(readers, reader)
+	}
+
+	if tmp.Samples < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid samples %d", typeVerifyOut, action, tmp.Samples)
+	}
+	if tmp.Samples == 0 {
+		tmp.Samples = defaultVerifySamples
+	}
+
+	// The seed defaults to the build time, which is fixed by SOURCE_DATE_EPOCH
+	// for reproducible builds
+	seed := uint64(lib.BuildTime().Unix())
+	if tmp.Seed != nil {
+		seed = *tmp.Seed
+	}
+
+	return &verifyOut{
+		Type:        typeVerifyOut,
+		Action:      action,
+		Description: descVerifyOut,
+		Formats:     formats,
+		Samples:     tmp.Samples,
+		Seed:        seed,
+
+		readers: readers,
+	}, nil
+}
+
+type verifyOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Formats     []string
+	Samples     int
+	Seed        uint64
+
+	readers []lib.InputConverter
+}
+
+// verifiedFile has the lists read back from an output file
+type verifiedFile struct {
+	name  string // like files[1] text
+	lists map[string]*netipx.IPSet
+}
+
+func (v *verifyOut) GetType() string {
+	return v.Type
+}
+
+func (v *verifyOut) GetAction() lib.Action {
+	return v.Action
+}
+
+func (v *verifyOut) GetDescription() string {
+	return v.Description
+}
+
+func (v *verifyOut) Output(container lib.Container) error {
+	return v.OutputContext(context.Background(), container)
+}
+
+// OutputContext ignores the container and reads back the output files written by
+// previous outputs, then checks every sampled address of every list is in the
+// same lists of all files. Only lists in all files are compared, so that files
+// with different wanted lists could be verified together.
+func (v *verifyOut) OutputContext(ctx context.Context, container lib.Container) error {
+	files := make([]*verifiedFile, 0, len(v.readers))
+	for idx, reader := range v.readers {
+		file, err := readVerifiedFile(ctx, fmt.Sprintf("files[%d] %s", idx, reader.GetType()), reader)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] failed to read files[%d] of type %s: %v", v.Type, v.Action, idx, reader.GetType(), err)
+		}
+		files = append(files, file)
+	}
+
+	names := commonLists(files)
+	if len(names) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no list is found in all files", v.Type, v.Action)
+	}
+
+	rng := rand.New(rand.NewPCG(v.Seed, v.Seed))
+	divergences := make([]string, 0)
+	checked := make(map[netip.Addr]bool)
+	for _, name := range names {
+		for k := range v.Samples {
+			// Addresses are sampled from every file in turn, so that prefixes missing
+			// from or added to any file could be found
+			file := files[k%len(files)]
+			prefixes := file.lists[name].Prefixes()
+			if len(prefixes) == 0 {
+				continue
+			}
+			addr := sampleAddr(rng, prefixes[rng.IntN(len(prefixes))], k/len(files))
+			if !addr.IsValid() || checked[addr] {
+				continue
+			}
+			checked[addr] = true
+
+			if divergence := classify(files, names, addr); divergence != "" {
+				divergences = append(divergences, divergence)
+			}
+		}
+	}
+
+	if len(divergences) > 0 {
+		shown := divergences[:min(len(divergences), maxVerifyDivergences)]
+		return fmt.Errorf("❌ [type %s | action %s] %d of %d sampled addresses are classified differently, seed %d: %s", v.Type, v.Action, len(divergences), len(checked), v.Seed, strings.Join(shown, "; "))
+	}
+
+	slog.Info("output files verified", "plugin", v.Type, "files", len(files), "lists", len(names), "addresses", len(checked), "seed", v.Seed)
+	return nil
+}
+
+func readVerifiedFile(ctx context.Context, name string, reader lib.InputConverter) (*verifiedFile, error) {
+	var loaded lib.Container
+	var err error
+	if c, ok := reader.(lib.ContextInputConverter); ok {
+		loaded, err = c.InputContext(ctx, lib.NewContainer())
+	} else {
+		loaded, err = reader.Input(lib.NewContainer())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := &verifiedFile{name: name, lists: make(map[string]*netipx.IPSet, loaded.Len())}
+	for entry := range loaded.Loop() {
+		var builder netipx.IPSetBuilder
+		// An entry without addresses of an IP type has no set of it
+		if ipv4set, err := entry.GetIPv4Set(); err == nil {
+			builder.AddSet(ipv4set)
+		}
+		if ipv6set, err := entry.GetIPv6Set(); err == nil {
+			builder.AddSet(ipv6set)
+		}
+		set, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		file.lists[strings.ToLower(entry.GetName())] = set
+	}
+	return file, nil
+}
+
+// commonLists returns the sorted names of lists in all files
+func commonLists(files []*verifiedFile) []string {
+	names := make([]string, 0, len(files[0].lists))
+	for name := range files[0].lists {
+		if !slices.ContainsFunc(files[1:], func(file *verifiedFile) bool {
+			_, found := file.lists[name]
+			return !found
+		}) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sampleAddr returns the first, the last, the next to the last or a random address
+// of the prefix in turn, as bugs of writers are likely at the boundaries of prefixes.
+// The next to the last address may be invalid at the end of the address space.
+func sampleAddr(rng *rand.Rand, prefix netip.Prefix, turn int) netip.Addr {
+	prefix = prefix.Masked()
+	switch turn % 4 {
+	case 0:
+		return prefix.Addr()
+	case 1:
+		return netipx.PrefixLastIP(prefix)
+	case 2:
+		return netipx.PrefixLastIP(prefix).Next()
+	}
+
+	b := prefix.Addr().AsSlice()
+	for i := range b {
+		fixed := min(max(prefix.Bits()-8*i, 0), 8)
+		b[i] |= byte(rng.UintN(256)) & byte(0xff>>fixed)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// classify returns the description of the divergence if the address is not in
+// the same lists of all files, or empty if it is
+func classify(files []*verifiedFile, names []string, addr netip.Addr) string {
+	results := make([]string, len(files))
+	for idx, file := range files {
+		in := make([]string, 0)
+		for _, name := range names {
+			if file.lists[name].Contains(addr) {
+				in = append(in, name)
+			}
+		}
+		results[idx] = "[" + strings.Join(in, " ") + "]"
+	}
+
+	if !slices.ContainsFunc(results, func(result string) bool { return result != results[0] }) {
+		return ""
+	}
+
+	descriptions := make([]string, len(files))
+	for idx, file := range files {
+		descriptions[idx] = results[idx] + " by " + file.name
+	}
+	return fmt.Sprintf("%s is in %s", addr, strings.Join(descriptions, ", "))
+}
@@ -0,0 +1,283 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ec2APIVersion   = "2016-11-15"
+	wafv2APIVersion = "AWSWAF_20190729"
+)
+
+type credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// loadCredentials uses the keys in config first, then falls back to
+// the standard AWS environment variables
+func loadCredentials(accessKeyID, secretAccessKey, sessionToken string) (*credentials, error) {
+	creds := &credentials{
+		AccessKeyID:     strings.TrimSpace(accessKeyID),
+		SecretAccessKey: strings.TrimSpace(secretAccessKey),
+		SessionToken:    strings.TrimSpace(sessionToken),
+	}
+
+	if creds.AccessKeyID == "" {
+		creds.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if creds.SecretAccessKey == "" {
+		creds.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if creds.SessionToken == "" {
+		creds.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("missing AWS credentials, set accessKeyID and secretAccessKey in config or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY in environment")
+	}
+
+	return creds, nil
+}
+
+// loadRegion uses the region in config first, then falls back to
+// the standard AWS environment variables
+func loadRegion(region string) (string, error) {
+	region = strings.TrimSpace(region)
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return "", errors.New("missing AWS region, set region in config or AWS_REGION in environment")
+	}
+	return region, nil
+}
+
+type client struct {
+	creds      *credentials
+	region     string
+	httpClient *http.Client
+}
+
+func newClient(creds *credentials, region string) *client {
+	return &client{
+		creds:      creds,
+		region:     region,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// do signs and sends a request, and returns the response body on success
+func (c *client) do(ctx context.Context, method, endpoint, service string, header http.Header, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	signRequest(req, body, c.creds, c.region, service, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &apiError{
+			StatusCode: resp.StatusCode,
+			Body:       respBody,
+		}
+	}
+
+	return respBody, nil
+}
+
+// ec2 calls an action of the EC2 Query API and decodes the XML response into out
+func (c *client) ec2(ctx context.Context, action string, params url.Values, out any) error {
+	if params == nil {
+		params = make(url.Values)
+	}
+	params.Set("Action", action)
+	params.Set("Version", ec2APIVersion)
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	endpoint := fmt.Sprintf("https://ec2.%s.amazonaws.com/", c.region)
+	body, err := c.do(ctx, http.MethodPost, endpoint, "ec2", header, []byte(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to call EC2 %s: %w", action, err)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(body, out)
+}
+
+// wafv2 calls an operation of the WAFv2 JSON API and decodes the response into out
+func (c *client) wafv2(ctx context.Context, operation string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/x-amz-json-1.1")
+	header.Set("X-Amz-Target", wafv2APIVersion+"."+operation)
+
+	endpoint := fmt.Sprintf("https://wafv2.%s.amazonaws.com/", c.region)
+	respBody, err := c.do(ctx, http.MethodPost, endpoint, "wafv2", header, body)
+	if err != nil {
+		return fmt.Errorf("failed to call WAFv2 %s: %w", operation, err)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// s3 puts the object to the key of the bucket at the endpoint of S3 compatible storage
+func (c *client) s3(ctx context.Context, endpoint, bucket, key string, pathStyle bool, header http.Header, body []byte) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	if pathStyle {
+		u.Path = "/" + bucket + "/" + key
+		u.RawPath = "/" + uriEncode(bucket) + "/" + strings.Join(segments, "/")
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + strings.Join(segments, "/")
+	}
+
+	if _, err := c.do(ctx, http.MethodPut, u.String(), "s3", header, body); err != nil {
+		return fmt.Errorf("failed to put object %s to bucket %s: %w", key, bucket, err)
+	}
+	return nil
+}
+
+// cloudFront calls an operation of the CloudFront REST API with the XML body,
+// which is a global service signed in us-east-1
+func (c *client) cloudFront(ctx context.Context, method, path string, in, out any) error {
+	body, err := xml.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+
+	global := *c
+	global.region = "us-east-1"
+	respBody, err := global.do(ctx, method, "https://cloudfront.amazonaws.com/2020-05-31"+path, "cloudfront", header, body)
+	if err != nil {
+		return fmt.Errorf("failed to call CloudFront %s %s: %w", method, path, err)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(respBody, out)
+}
+
+type apiError struct {
+	StatusCode int
+	Body       []byte
+}
+
+// code returns the error code returned by AWS
+func (e *apiError) code() (string, string) {
+	// EC2 Query API error
+	var ec2Err struct {
+		Errors []struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Errors>Error"`
+	}
+	if xml.Unmarshal(e.Body, &ec2Err) == nil && len(ec2Err.Errors) > 0 {
+		return ec2Err.Errors[0].Code, ec2Err.Errors[0].Message
+	}
+
+	// S3 and CloudFront REST API error, whose root element is Error or ErrorResponse
+	var restErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+		Error   struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if xml.Unmarshal(e.Body, &restErr) == nil {
+		if restErr.Code != "" {
+			return restErr.Code, restErr.Message
+		}
+		if restErr.Error.Code != "" {
+			return restErr.Error.Code, restErr.Error.Message
+		}
+	}
+
+	// JSON API error
+	var jsonErr struct {
+		Type    string `json:"__type"`
+		Message string `json:"Message"`
+	}
+	if json.Unmarshal(e.Body, &jsonErr) == nil && jsonErr.Type != "" {
+		// __type may be prefixed with a namespace like "com.amazonaws.wafv2#"
+		if _, after, found := strings.Cut(jsonErr.Type, "#"); found {
+			jsonErr.Type = after
+		}
+		return jsonErr.Type, jsonErr.Message
+	}
+
+	return "", ""
+}
+
+func (e *apiError) Error() string {
+	if code, message := e.code(); code != "" {
+		return fmt.Sprintf("http status code %d, %s: %s", e.StatusCode, code, message)
+	}
+
+	return fmt.Sprintf("http status code %d, %s", e.StatusCode, strings.TrimSpace(string(e.Body)))
+}
+
+// isAPIError reports whether err is an AWS API error with the given code
+func isAPIError(err error, code string) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	errCode, _ := apiErr.code()
+	return errCode == code
+}
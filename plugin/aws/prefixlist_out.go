@@ -0,0 +1,485 @@
+package aws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typePrefixListOut = "awsManagedPrefixList"
+	descPrefixListOut = "Sync data to AWS VPC managed prefix lists"
+)
+
+var (
+	defaultPrefixListNamePrefix = "geoip-"
+	maxEntriesPerModify         = 100 // AWS allows to add or remove at most 100 entries per request
+	prefixListPollInterval      = 2 * time.Second
+	prefixListPollTimeout       = 5 * time.Minute
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typePrefixListOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newPrefixListOut(action, data)
+	})
+	lib.RegisterOutputConverter(typePrefixListOut, &prefixListOut{
+		Description: descPrefixListOut,
+	})
+	lib.RegisterOutputArgs(typePrefixListOut, prefixListOutArgs{})
+}
+
+// prefixListOutArgs are the args of the output converter in config file
+type prefixListOutArgs struct {
+	Region          string            `json:"region"`
+	AccessKeyID     string            `json:"accessKeyID"`
+	SecretAccessKey string            `json:"secretAccessKey"`
+	SessionToken    string            `json:"sessionToken"`
+	NamePrefix      string            `json:"namePrefix"`
+	MaxEntries      int               `json:"maxEntries"`
+	Tags            map[string]string `json:"tags"`
+	DryRun          bool              `json:"dryRun"`
+	Want            []string          `json:"wantedList"`
+	Exclude         []string          `json:"excludedList"`
+	OnlyIPType      lib.IPType        `json:"onlyIPType"`
+}
+
+func newPrefixListOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp prefixListOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	region, err := loadRegion(tmp.Region)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typePrefixListOut, action, err)
+	}
+
+	creds, err := loadCredentials(tmp.AccessKeyID, tmp.SecretAccessKey, tmp.SessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typePrefixListOut, action, err)
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultPrefixListNamePrefix
+	}
+
+	if tmp.MaxEntries < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxEntries must not be negative", typePrefixListOut, action)
+	}
+
+	return &prefixListOut{
+		Type:        typePrefixListOut,
+		Action:      action,
+		Description: descPrefixListOut,
+		Region:      region,
+		NamePrefix:  tmp.NamePrefix,
+		MaxEntries:  tmp.MaxEntries,
+		Tags:        tmp.Tags,
+		DryRun:      tmp.DryRun,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+
+		client: newClient(creds, region),
+	}, nil
+}
+
+type prefixListOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Region      string
+	NamePrefix  string
+	MaxEntries  int
+	Tags        map[string]string
+	DryRun      bool
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+
+	client *client
+}
+
+type prefixList struct {
+	ID            string `xml:"prefixListId"`
+	Name          string `xml:"prefixListName"`
+	AddressFamily string `xml:"addressFamily"`
+	State         string `xml:"state"`
+	StateMessage  string `xml:"stateMessage"`
+	MaxEntries    int    `xml:"maxEntries"`
+	Version       int64  `xml:"version"`
+}
+
+func (p *prefixListOut) GetType() string {
+	return p.Type
+}
+
+func (p *prefixListOut) GetAction() lib.Action {
+	return p.Action
+}
+
+func (p *prefixListOut) GetDescription() string {
+	return p.Description
+}
+
+func (p *prefixListOut) Output(container lib.Container) error {
+	return p.OutputContext(context.Background(), container)
+}
+
+func (p *prefixListOut) OutputContext(ctx context.Context, container lib.Container) error {
+	for _, name := range p.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", p.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := p.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		ipv4CIDRs := make([]string, 0, len(prefixes))
+		ipv6CIDRs := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			if prefix.Addr().Is4() {
+				ipv4CIDRs = append(ipv4CIDRs, prefix.String())
+			} else {
+				ipv6CIDRs = append(ipv6CIDRs, prefix.String())
+			}
+		}
+
+		// A managed prefix list only holds one address family
+		if len(ipv4CIDRs) > 0 {
+			if err := p.sync(ctx, p.listName(name, lib.IPv4), "IPv4", ipv4CIDRs); err != nil {
+				return err
+			}
+		}
+		if len(ipv6CIDRs) > 0 {
+			if err := p.sync(ctx, p.listName(name, lib.IPv6), "IPv6", ipv6CIDRs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *prefixListOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(p.Exclude)
+
+	wantList := make([]string, 0, len(p.Want))
+	for _, want := range lib.ExpandWantedList(container, p.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(p.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (p *prefixListOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch p.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+func (p *prefixListOut) listName(name string, ipType lib.IPType) string {
+	return p.NamePrefix + strings.ToLower(name) + "-" + string(ipType)
+}
+
+// sync makes the prefix list called name contain exactly the desired CIDRs
+func (p *prefixListOut) sync(ctx context.Context, name, addressFamily string, desired []string) error {
+	if p.MaxEntries > 0 && len(desired) > p.MaxEntries {
+		return fmt.Errorf("❌ [type %s | action %s] prefix list %s needs %d entries, more than maxEntries %d", p.Type, p.Action, name, len(desired), p.MaxEntries)
+	}
+	// The capacity of the prefix list, the number of desired CIDRs without maxEntries
+	capacity := cmp.Or(p.MaxEntries, len(desired))
+
+	pl, err := p.describeByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var current []string
+	if pl != nil {
+		current, err = p.getEntries(ctx, pl.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	desiredMap := make(map[string]bool, len(desired))
+	for _, cidr := range desired {
+		desiredMap[cidr] = true
+	}
+	currentMap := make(map[string]bool, len(current))
+	for _, cidr := range current {
+		currentMap[cidr] = true
+	}
+
+	toAdd := make([]string, 0)
+	for _, cidr := range desired {
+		if !currentMap[cidr] {
+			toAdd = append(toAdd, cidr)
+		}
+	}
+	toRemove := make([]string, 0)
+	for _, cidr := range current {
+		if !desiredMap[cidr] {
+			toRemove = append(toRemove, cidr)
+		}
+	}
+
+	if p.DryRun {
+		slog.Info("prefix list planned (dry run)", "plugin", p.Type, "name", name, "add", len(toAdd), "remove", len(toRemove))
+		return nil
+	}
+
+	if pl == nil {
+		pl, err = p.create(ctx, name, addressFamily, capacity)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		slog.Info("prefix list up to date", "plugin", p.Type, "name", name, "id", pl.ID)
+		return nil
+	}
+
+	if len(desired) > pl.MaxEntries {
+		if pl, err = p.resize(ctx, pl, capacity); err != nil {
+			return err
+		}
+	}
+
+	// Entries are added and removed in the same requests, adds first as long as
+	// the prefix list has room for them, so that CIDRs kept are never missing
+	// and the list never holds more entries than its max entries
+	added, removed, size := len(toAdd), len(toRemove), len(current)
+	for len(toAdd) > 0 || len(toRemove) > 0 {
+		adds := min(len(toAdd), maxEntriesPerModify, max(pl.MaxEntries-size, 0))
+		// Every remove in the same request makes room for one more add
+		adds += min(len(toAdd)-adds, len(toRemove), (maxEntriesPerModify-adds)/2)
+		removes := min(len(toRemove), maxEntriesPerModify-adds)
+		if adds == 0 && removes == 0 {
+			return fmt.Errorf("❌ [type %s | action %s] prefix list %s has no room for %d entries", p.Type, p.Action, name, len(toAdd))
+		}
+
+		if pl, err = p.modify(ctx, pl, toAdd[:adds], toRemove[:removes]); err != nil {
+			return err
+		}
+		toAdd, toRemove = toAdd[adds:], toRemove[removes:]
+		size += adds - removes
+	}
+
+	slog.Info("prefix list updated", "plugin", p.Type, "name", name, "id", pl.ID, "added", added, "removed", removed)
+
+	return nil
+}
+
+func (p *prefixListOut) describe(ctx context.Context, params url.Values) (*prefixList, error) {
+	var resp struct {
+		PrefixLists []*prefixList `xml:"prefixListSet>item"`
+	}
+	if err := p.client.ec2(ctx, "DescribeManagedPrefixLists", params, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.PrefixLists) == 0 {
+		return nil, nil
+	}
+	return resp.PrefixLists[0], nil
+}
+
+func (p *prefixListOut) describeByName(ctx context.Context, name string) (*prefixList, error) {
+	params := make(url.Values)
+	params.Set("Filter.1.Name", "prefix-list-name")
+	params.Set("Filter.1.Value.1", name)
+	return p.describe(ctx, params)
+}
+
+func (p *prefixListOut) describeByID(ctx context.Context, id string) (*prefixList, error) {
+	params := make(url.Values)
+	params.Set("PrefixListId.1", id)
+	pl, err := p.describe(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if pl == nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] prefix list %s not found", p.Type, p.Action, id)
+	}
+	return pl, nil
+}
+
+func (p *prefixListOut) getEntries(ctx context.Context, id string) ([]string, error) {
+	cidrs := make([]string, 0)
+	nextToken := ""
+	for {
+		params := make(url.Values)
+		params.Set("PrefixListId", id)
+		params.Set("MaxResults", "100")
+		if nextToken != "" {
+			params.Set("NextToken", nextToken)
+		}
+
+		var resp struct {
+			Entries []struct {
+				CIDR string `xml:"cidr"`
+			} `xml:"entrySet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		if err := p.client.ec2(ctx, "GetManagedPrefixListEntries", params, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range resp.Entries {
+			// Normalize CIDR returned by AWS so that it can be compared with ours
+			prefix, err := netip.ParsePrefix(entry.CIDR)
+			if err != nil {
+				return nil, err
+			}
+			cidrs = append(cidrs, prefix.Masked().String())
+		}
+
+		if resp.NextToken == "" {
+			return cidrs, nil
+		}
+		nextToken = resp.NextToken
+	}
+}
+
+func (p *prefixListOut) create(ctx context.Context, name, addressFamily string, maxEntries int) (*prefixList, error) {
+	params := make(url.Values)
+	params.Set("PrefixListName", name)
+	params.Set("AddressFamily", addressFamily)
+	params.Set("MaxEntries", strconv.Itoa(max(maxEntries, 1)))
+
+	if len(p.Tags) > 0 {
+		params.Set("TagSpecification.1.ResourceType", "prefix-list")
+		keys := make([]string, 0, len(p.Tags))
+		for key := range p.Tags {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for i, key := range keys {
+			params.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i+1), key)
+			params.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Value", i+1), p.Tags[key])
+		}
+	}
+
+	var resp struct {
+		PrefixList *prefixList `xml:"prefixList"`
+	}
+	if err := p.client.ec2(ctx, "CreateManagedPrefixList", params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.PrefixList == nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] failed to create prefix list %s", p.Type, p.Action, name)
+	}
+
+	return p.waitForState(ctx, resp.PrefixList.ID)
+}
+
+func (p *prefixListOut) modify(ctx context.Context, pl *prefixList, toAdd, toRemove []string) (*prefixList, error) {
+	params := make(url.Values)
+	params.Set("PrefixListId", pl.ID)
+	params.Set("CurrentVersion", strconv.FormatInt(pl.Version, 10))
+	for i, cidr := range toAdd {
+		params.Set(fmt.Sprintf("AddEntry.%d.Cidr", i+1), cidr)
+	}
+	for i, cidr := range toRemove {
+		params.Set(fmt.Sprintf("RemoveEntry.%d.Cidr", i+1), cidr)
+	}
+
+	if err := p.client.ec2(ctx, "ModifyManagedPrefixList", params, nil); err != nil {
+		return nil, err
+	}
+
+	return p.waitForState(ctx, pl.ID)
+}
+
+func (p *prefixListOut) resize(ctx context.Context, pl *prefixList, maxEntries int) (*prefixList, error) {
+	params := make(url.Values)
+	params.Set("PrefixListId", pl.ID)
+	params.Set("MaxEntries", strconv.Itoa(maxEntries))
+
+	if err := p.client.ec2(ctx, "ModifyManagedPrefixList", params, nil); err != nil {
+		return nil, err
+	}
+
+	return p.waitForState(ctx, pl.ID)
+}
+
+// waitForState waits until the pending operation on the prefix list completes,
+// since AWS rejects modifications while another one is in progress
+func (p *prefixListOut) waitForState(ctx context.Context, id string) (*prefixList, error) {
+	deadline := time.Now().Add(prefixListPollTimeout)
+	for {
+		pl, err := p.describeByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasSuffix(pl.State, "-complete"):
+			return pl, nil
+		case strings.HasSuffix(pl.State, "-failed"):
+			return nil, fmt.Errorf("❌ [type %s | action %s] prefix list %s is in state %s: %s", p.Type, p.Action, id, pl.State, pl.StateMessage)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("❌ [type %s | action %s] timeout waiting for prefix list %s, current state %s", p.Type, p.Action, id, pl.State)
+		}
+		select {
+		case <-time.After(prefixListPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func chunk(list []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(list)+size-1)/size)
+	for start := 0; start < len(list); start += size {
+		chunks = append(chunks, list[start:min(start+size, len(list))])
+	}
+	return chunks
+}
@@ -0,0 +1,298 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeS3Out = "s3Upload"
+	descS3Out = "Upload output files to S3 compatible storage, like Amazon S3, Cloudflare R2 and Google Cloud Storage"
+)
+
+var (
+	defaultS3InputDir = filepath.Join("./", "output")
+	s3UploadTimeout   = 10 * time.Minute
+
+	// CloudFront allows at most 3000 paths of files in an invalidation,
+	// more files are invalidated by the wildcard path of the prefix
+	maxInvalidationPaths = 3000
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeS3Out, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newS3Out(action, data)
+	})
+	lib.RegisterOutputConverter(typeS3Out, &s3Out{
+		Description: descS3Out,
+	})
+	lib.RegisterOutputArgs(typeS3Out, s3OutArgs{})
+}
+
+// s3OutArgs are the args of the output converter in config file
+type s3OutArgs struct {
+	Region                   string   `json:"region"`
+	AccessKeyID              string   `json:"accessKeyID"`
+	SecretAccessKey          string   `json:"secretAccessKey"`
+	SessionToken             string   `json:"sessionToken"`
+	Endpoint                 string   `json:"endpoint"`
+	PathStyle                bool     `json:"pathStyle"`
+	Bucket                   string   `json:"bucket"`
+	Prefix                   string   `json:"prefix"`
+	InputDir                 string   `json:"inputDir"`
+	Files                    []string `json:"files"`
+	CacheControl             string   `json:"cacheControl"`
+	CloudFrontDistributionID string   `json:"cloudFrontDistributionID"`
+	DryRun                   bool     `json:"dryRun"`
+}
+
+func newS3Out(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp s3OutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	region, err := loadRegion(tmp.Region)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeS3Out, action, err)
+	}
+
+	creds, err := loadCredentials(tmp.AccessKeyID, tmp.SecretAccessKey, tmp.SessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeS3Out, action, err)
+	}
+
+	if tmp.Bucket = strings.TrimSpace(tmp.Bucket); tmp.Bucket == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] bucket must be specified in config", typeS3Out, action)
+	}
+
+	tmp.Endpoint = strings.TrimSuffix(strings.TrimSpace(tmp.Endpoint), "/")
+	if tmp.Endpoint == "" {
+		tmp.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	if !strings.HasPrefix(tmp.Endpoint, "https://") && !strings.HasPrefix(tmp.Endpoint, "http://") {
+		return nil, fmt.Errorf("❌ [type %s | action %s] endpoint must be an http or https URL", typeS3Out, action)
+	}
+
+	// Keys are relative to the bucket
+	tmp.Prefix = strings.TrimPrefix(tmp.Prefix, "/")
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultS3InputDir
+	}
+
+	for _, pattern := range tmp.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid pattern %s in files: %v", typeS3Out, action, pattern, err)
+		}
+	}
+
+	c := newClient(creds, region)
+	c.httpClient.Timeout = s3UploadTimeout
+
+	return &s3Out{
+		Type:                     typeS3Out,
+		Action:                   action,
+		Description:              descS3Out,
+		Region:                   region,
+		Endpoint:                 tmp.Endpoint,
+		PathStyle:                tmp.PathStyle,
+		Bucket:                   tmp.Bucket,
+		Prefix:                   tmp.Prefix,
+		InputDir:                 tmp.InputDir,
+		Files:                    tmp.Files,
+		CacheControl:             tmp.CacheControl,
+		CloudFrontDistributionID: strings.TrimSpace(tmp.CloudFrontDistributionID),
+		DryRun:                   tmp.DryRun,
+
+		client: c,
+	}, nil
+}
+
+type s3Out struct {
+	Type                     string
+	Action                   lib.Action
+	Description              string
+	Region                   string
+	Endpoint                 string
+	PathStyle                bool
+	Bucket                   string
+	Prefix                   string
+	InputDir                 string
+	Files                    []string
+	CacheControl             string
+	CloudFrontDistributionID string
+	DryRun                   bool
+
+	client *client
+}
+
+// invalidationBatch is the request of CloudFront CreateInvalidation
+type invalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Paths           []string `xml:"Paths>Items>Path"`
+	CallerReference string   `xml:"CallerReference"`
+}
+
+type invalidation struct {
+	ID     string `xml:"Id"`
+	Status string `xml:"Status"`
+}
+
+func (s *s3Out) GetType() string {
+	return s.Type
+}
+
+func (s *s3Out) GetAction() lib.Action {
+	return s.Action
+}
+
+func (s *s3Out) GetDescription() string {
+	return s.Description
+}
+
+func (s *s3Out) Output(container lib.Container) error {
+	return s.OutputContext(context.Background(), container)
+}
+
+// OutputContext ignores the container and uploads files written by previous
+// outputs in InputDir to the bucket, with keys of their paths relative to InputDir
+func (s *s3Out) OutputContext(ctx context.Context, container lib.Container) error {
+	prefix, err := lib.ExpandBuildTemplate(s.Prefix)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %v", s.Type, s.Action, err)
+	}
+
+	files, err := s.listFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no file found in %s", s.Type, s.Action, s.InputDir)
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		key := prefix + file
+		keys = append(keys, key)
+
+		if s.DryRun {
+			slog.Info("dry run: object would be uploaded", "plugin", s.Type, "bucket", s.Bucket, "key", key)
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.InputDir, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		if err := s.client.s3(ctx, s.Endpoint, s.Bucket, key, s.PathStyle, s.header(file), data); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] %v", s.Type, s.Action, err)
+		}
+		slog.Info("object uploaded", "plugin", s.Type, "bucket", s.Bucket, "key", key, "bytes", len(data))
+	}
+
+	if s.CloudFrontDistributionID != "" {
+		return s.invalidate(ctx, prefix, keys)
+	}
+	return nil
+}
+
+// listFiles returns sorted paths relative to InputDir with slashes, which match
+// any pattern of files by the path or the base name. All files match without patterns.
+func (s *s3Out) listFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(s.InputDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.InputDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if len(s.Files) > 0 && !slices.ContainsFunc(s.Files, func(pattern string) bool {
+			matched, _ := path.Match(pattern, rel)
+			matchedBase, _ := path.Match(pattern, path.Base(rel))
+			return matched || matchedBase
+		}) {
+			return nil
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+// header returns the headers of the object of the file
+func (s *s3Out) header(file string) http.Header {
+	header := make(http.Header)
+	contentType := mime.TypeByExtension(path.Ext(file))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	if s.CacheControl != "" {
+		header.Set("Cache-Control", s.CacheControl)
+	}
+	return header
+}
+
+// invalidate invalidates the uploaded keys in the CloudFront distribution
+func (s *s3Out) invalidate(ctx context.Context, prefix string, keys []string) error {
+	paths := make([]string, 0, len(keys))
+	if len(keys) > maxInvalidationPaths {
+		paths = append(paths, "/"+prefix+"*")
+	} else {
+		for _, key := range keys {
+			paths = append(paths, "/"+key)
+		}
+	}
+
+	if s.DryRun {
+		slog.Info("dry run: paths would be invalidated", "plugin", s.Type, "distribution", s.CloudFrontDistributionID, "paths", len(paths))
+		return nil
+	}
+
+	batch := &invalidationBatch{
+		Quantity:        len(paths),
+		Paths:           paths,
+		CallerReference: "geoip-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	var result invalidation
+	if err := s.client.cloudFront(ctx, http.MethodPost, "/distribution/"+s.CloudFrontDistributionID+"/invalidation", batch, &result); err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %v", s.Type, s.Action, err)
+	}
+
+	slog.Info("invalidation created", "plugin", s.Type, "distribution", s.CloudFrontDistributionID, "id", result.ID, "paths", len(paths))
+	return nil
+}
@@ -0,0 +1,451 @@
+package aws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeWAFIPSetOut = "awsWAFIPSet"
+	descWAFIPSetOut = "Sync data to AWS WAFv2 IP sets"
+)
+
+var (
+	defaultIPSetNamePrefix  = "geoip-"
+	defaultIPSetScope       = "REGIONAL"
+	maxAddressesPerIPSet    = 10000 // the max addresses of an IP set allowed by AWS WAF
+	maxOptimisticLockRetry  = 5
+	cloudFrontIPSetRegion   = "us-east-1"
+	invalidIPSetNameChar    = regexp.MustCompile(`[^\w\-]`)
+	optimisticLockErrorCode = "WAFOptimisticLockException"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeWAFIPSetOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newWAFIPSetOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeWAFIPSetOut, &wafIPSetOut{
+		Description: descWAFIPSetOut,
+	})
+	lib.RegisterOutputArgs(typeWAFIPSetOut, wafIPSetOutArgs{})
+}
+
+// wafIPSetOutArgs are the args of the output converter in config file
+type wafIPSetOutArgs struct {
+	Region          string            `json:"region"`
+	AccessKeyID     string            `json:"accessKeyID"`
+	SecretAccessKey string            `json:"secretAccessKey"`
+	SessionToken    string            `json:"sessionToken"`
+	Scope           string            `json:"scope"`
+	NamePrefix      string            `json:"namePrefix"`
+	MaxAddresses    int               `json:"maxAddresses"`
+	Tags            map[string]string `json:"tags"`
+	DryRun          bool              `json:"dryRun"`
+	Want            []string          `json:"wantedList"`
+	Exclude         []string          `json:"excludedList"`
+	OnlyIPType      lib.IPType        `json:"onlyIPType"`
+}
+
+func newWAFIPSetOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp wafIPSetOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp.Scope = strings.ToUpper(strings.TrimSpace(tmp.Scope))
+	switch tmp.Scope {
+	case "":
+		tmp.Scope = defaultIPSetScope
+	case "REGIONAL":
+	case "CLOUDFRONT":
+		// IP sets for CloudFront must be managed in us-east-1
+		tmp.Region = cloudFrontIPSetRegion
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid scope %s, the value must be REGIONAL or CLOUDFRONT", typeWAFIPSetOut, action, tmp.Scope)
+	}
+
+	region, err := loadRegion(tmp.Region)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeWAFIPSetOut, action, err)
+	}
+
+	creds, err := loadCredentials(tmp.AccessKeyID, tmp.SecretAccessKey, tmp.SessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeWAFIPSetOut, action, err)
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultIPSetNamePrefix
+	}
+
+	if tmp.MaxAddresses < 0 || tmp.MaxAddresses > maxAddressesPerIPSet {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxAddresses must be between 1 and %d", typeWAFIPSetOut, action, maxAddressesPerIPSet)
+	}
+	if tmp.MaxAddresses == 0 {
+		tmp.MaxAddresses = maxAddressesPerIPSet
+	}
+
+	return &wafIPSetOut{
+		Type:         typeWAFIPSetOut,
+		Action:       action,
+		Description:  descWAFIPSetOut,
+		Region:       region,
+		Scope:        tmp.Scope,
+		NamePrefix:   tmp.NamePrefix,
+		MaxAddresses: tmp.MaxAddresses,
+		Tags:         tmp.Tags,
+		DryRun:       tmp.DryRun,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+
+		client: newClient(creds, region),
+	}, nil
+}
+
+type wafIPSetOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	Region       string
+	Scope        string
+	NamePrefix   string
+	MaxAddresses int
+	Tags         map[string]string
+	DryRun       bool
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+
+	client *client
+}
+
+type ipSetSummary struct {
+	Name      string `json:"Name"`
+	ID        string `json:"Id"`
+	ARN       string `json:"ARN"`
+	LockToken string `json:"LockToken"`
+}
+
+type ipSetTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+func (w *wafIPSetOut) GetType() string {
+	return w.Type
+}
+
+func (w *wafIPSetOut) GetAction() lib.Action {
+	return w.Action
+}
+
+func (w *wafIPSetOut) GetDescription() string {
+	return w.Description
+}
+
+func (w *wafIPSetOut) Output(container lib.Container) error {
+	return w.OutputContext(context.Background(), container)
+}
+
+func (w *wafIPSetOut) OutputContext(ctx context.Context, container lib.Container) error {
+	existing, err := w.listIPSets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range w.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", w.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := w.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		ipv4CIDRs := make([]string, 0, len(prefixes))
+		ipv6CIDRs := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			for _, cidr := range w.splitDefaultRoute(prefix) {
+				if cidr.Addr().Is4() {
+					ipv4CIDRs = append(ipv4CIDRs, cidr.String())
+				} else {
+					ipv6CIDRs = append(ipv6CIDRs, cidr.String())
+				}
+			}
+		}
+
+		// An IP set only holds one address family
+		if err := w.syncAll(ctx, w.setName(name, lib.IPv4), "IPV4", ipv4CIDRs, existing); err != nil {
+			return err
+		}
+		if err := w.syncAll(ctx, w.setName(name, lib.IPv6), "IPV6", ipv6CIDRs, existing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *wafIPSetOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(w.Exclude)
+
+	wantList := make([]string, 0, len(w.Want))
+	for _, want := range lib.ExpandWantedList(container, w.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(w.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (w *wafIPSetOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch w.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// splitDefaultRoute splits /0 into two /1, because AWS WAF supports all CIDR ranges except /0
+func (w *wafIPSetOut) splitDefaultRoute(prefix netip.Prefix) []netip.Prefix {
+	if prefix.Bits() != 0 {
+		return []netip.Prefix{prefix}
+	}
+	lower := netip.PrefixFrom(prefix.Addr(), 1)
+	upper := netip.PrefixFrom(netipx.PrefixLastIP(lower).Next(), 1)
+	return []netip.Prefix{lower, upper}
+}
+
+func (w *wafIPSetOut) setName(name string, ipType lib.IPType) string {
+	return invalidIPSetNameChar.ReplaceAllString(w.NamePrefix+strings.ToLower(name)+"-"+string(ipType), "-")
+}
+
+// syncAll splits CIDRs into several IP sets named base, base-2, base-3, ...
+// and empties the IP sets of the same name series that are no longer needed
+func (w *wafIPSetOut) syncAll(ctx context.Context, base, ipVersion string, cidrs []string, existing map[string]*ipSetSummary) error {
+	chunks := chunk(cidrs, w.MaxAddresses)
+
+	for i, addresses := range chunks {
+		name := base
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", base, i+1)
+		}
+		if err := w.sync(ctx, name, ipVersion, addresses, existing); err != nil {
+			return err
+		}
+	}
+
+	for i := len(chunks); ; i++ {
+		name := base
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", base, i+1)
+		}
+		if _, found := existing[name]; !found {
+			return nil
+		}
+		if err := w.sync(ctx, name, ipVersion, []string{}, existing); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *wafIPSetOut) sync(ctx context.Context, name, ipVersion string, addresses []string, existing map[string]*ipSetSummary) error {
+	summary, found := existing[name]
+
+	if w.DryRun {
+		slog.Info("IP set planned (dry run)", "plugin", w.Type, "name", name, "addresses", len(addresses))
+		return nil
+	}
+
+	if !found {
+		if len(addresses) == 0 {
+			return nil
+		}
+		created, err := w.create(ctx, name, ipVersion, addresses)
+		if err != nil {
+			return err
+		}
+		existing[name] = created
+		slog.Info("IP set created", "plugin", w.Type, "name", name, "id", created.ID)
+		return nil
+	}
+
+	// Retry on optimistic lock failure, which means the IP set was modified
+	// by others since we got the lock token
+	for retry := 0; ; retry++ {
+		current, lockToken, err := w.get(ctx, summary)
+		if err != nil {
+			return err
+		}
+
+		if slices.Equal(current, addresses) {
+			slog.Info("IP set up to date", "plugin", w.Type, "name", name, "id", summary.ID)
+			return nil
+		}
+
+		err = w.update(ctx, summary, lockToken, addresses)
+		switch {
+		case err == nil:
+			slog.Info("IP set updated", "plugin", w.Type, "name", name, "id", summary.ID, "addresses", len(addresses))
+			return nil
+		case isAPIError(err, optimisticLockErrorCode) && retry < maxOptimisticLockRetry:
+			continue
+		default:
+			return err
+		}
+	}
+}
+
+func (w *wafIPSetOut) listIPSets(ctx context.Context) (map[string]*ipSetSummary, error) {
+	sets := make(map[string]*ipSetSummary)
+	nextMarker := ""
+	for {
+		req := map[string]any{
+			"Scope": w.Scope,
+			"Limit": 100,
+		}
+		if nextMarker != "" {
+			req["NextMarker"] = nextMarker
+		}
+
+		var resp struct {
+			IPSets     []*ipSetSummary `json:"IPSets"`
+			NextMarker string          `json:"NextMarker"`
+		}
+		if err := w.client.wafv2(ctx, "ListIPSets", req, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, set := range resp.IPSets {
+			sets[set.Name] = set
+		}
+
+		// ListIPSets always returns a marker, and an empty page means the end
+		if resp.NextMarker == "" || len(resp.IPSets) == 0 {
+			return sets, nil
+		}
+		nextMarker = resp.NextMarker
+	}
+}
+
+func (w *wafIPSetOut) get(ctx context.Context, summary *ipSetSummary) ([]string, string, error) {
+	var resp struct {
+		IPSet struct {
+			Addresses []string `json:"Addresses"`
+		} `json:"IPSet"`
+		LockToken string `json:"LockToken"`
+	}
+	if err := w.client.wafv2(ctx, "GetIPSet", map[string]any{
+		"Name":  summary.Name,
+		"Scope": w.Scope,
+		"Id":    summary.ID,
+	}, &resp); err != nil {
+		return nil, "", err
+	}
+
+	// Normalize and sort addresses so that they can be compared with ours
+	prefixes := make([]netip.Prefix, 0, len(resp.IPSet.Addresses))
+	for _, address := range resp.IPSet.Addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			return nil, "", err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	// Prefixes of the same address are ordered by their lengths, like ours
+	slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+		return cmp.Or(a.Addr().Compare(b.Addr()), cmp.Compare(a.Bits(), b.Bits()))
+	})
+	addresses := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		addresses = append(addresses, prefix.String())
+	}
+
+	return addresses, resp.LockToken, nil
+}
+
+func (w *wafIPSetOut) create(ctx context.Context, name, ipVersion string, addresses []string) (*ipSetSummary, error) {
+	req := map[string]any{
+		"Name":             name,
+		"Scope":            w.Scope,
+		"IPAddressVersion": ipVersion,
+		"Addresses":        addresses,
+		"Description":      "Managed by geoip",
+	}
+
+	if len(w.Tags) > 0 {
+		keys := make([]string, 0, len(w.Tags))
+		for key := range w.Tags {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		tags := make([]ipSetTag, 0, len(keys))
+		for _, key := range keys {
+			tags = append(tags, ipSetTag{Key: key, Value: w.Tags[key]})
+		}
+		req["Tags"] = tags
+	}
+
+	var resp struct {
+		Summary *ipSetSummary `json:"Summary"`
+	}
+	if err := w.client.wafv2(ctx, "CreateIPSet", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Summary == nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] failed to create IP set %s", w.Type, w.Action, name)
+	}
+
+	return resp.Summary, nil
+}
+
+func (w *wafIPSetOut) update(ctx context.Context, summary *ipSetSummary, lockToken string, addresses []string) error {
+	return w.client.wafv2(ctx, "UpdateIPSet", map[string]any{
+		"Name":        summary.Name,
+		"Scope":       w.Scope,
+		"Id":          summary.ID,
+		"Addresses":   addresses,
+		"LockToken":   lockToken,
+		"Description": "Managed by geoip",
+	}, nil)
+}
@@ -0,0 +1,463 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeTemplateOut = "azureTemplate"
+	descTemplateOut = "Convert data to Azure IP group or NSG ARM/Bicep templates"
+)
+
+const (
+	resourceIPGroup = "ipGroup"
+	resourceNSG     = "nsg"
+
+	formatARM   = "arm"
+	formatBicep = "bicep"
+
+	armSchema     = "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#"
+	apiVersion    = "2023-09-01"
+	ipGroupType   = "Microsoft.Network/ipGroups"
+	nsgType       = "Microsoft.Network/networkSecurityGroups"
+	locationParam = "[parameters('location')]"
+)
+
+var (
+	defaultOutputDir    = filepath.Join("./", "output", "azure")
+	defaultNamePrefix   = "geoip-"
+	defaultRuleAccess   = "Deny"
+	defaultDirection    = "Inbound"
+	defaultRulePriority = 100
+
+	// Max addresses of a resource allowed by Azure
+	maxAddressesPerResource = map[string]int{
+		resourceIPGroup: 5000,
+		resourceNSG:     4000,
+	}
+
+	invalidResourceNameChar = regexp.MustCompile(`[^A-Za-z0-9_.\-]`)
+	invalidSymbolicNameChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeTemplateOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newTemplateOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeTemplateOut, &templateOut{
+		Description: descTemplateOut,
+	})
+	lib.RegisterOutputArgs(typeTemplateOut, templateOutArgs{})
+}
+
+// templateOutArgs are the args of the output converter in config file
+type templateOutArgs struct {
+	OutputDir    string            `json:"outputDir"`
+	Format       string            `json:"format"`
+	ResourceType string            `json:"resourceType"`
+	NamePrefix   string            `json:"namePrefix"`
+	Tags         map[string]string `json:"tags"`
+	RuleAccess   string            `json:"ruleAccess"`
+	Direction    string            `json:"direction"`
+	RulePriority int               `json:"rulePriority"`
+	Want         []string          `json:"wantedList"`
+	Exclude      []string          `json:"excludedList"`
+	OnlyIPType   lib.IPType        `json:"onlyIPType"`
+}
+
+func newTemplateOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp templateOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	switch tmp.Format {
+	case "":
+		tmp.Format = formatARM
+	case formatARM, formatBicep:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be arm or bicep", typeTemplateOut, action, tmp.Format)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(tmp.ResourceType)) {
+	case "", strings.ToLower(resourceIPGroup):
+		tmp.ResourceType = resourceIPGroup
+	case resourceNSG:
+		tmp.ResourceType = resourceNSG
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid resourceType %s, the value must be ipGroup or nsg", typeTemplateOut, action, tmp.ResourceType)
+	}
+
+	// IP groups only support IPv4 addresses
+	if tmp.ResourceType == resourceIPGroup {
+		if tmp.OnlyIPType == lib.IPv6 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] resourceType ipGroup does not support IPv6", typeTemplateOut, action)
+		}
+		tmp.OnlyIPType = lib.IPv4
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultNamePrefix
+	}
+
+	switch strings.ToLower(strings.TrimSpace(tmp.RuleAccess)) {
+	case "", "deny":
+		tmp.RuleAccess = defaultRuleAccess
+	case "allow":
+		tmp.RuleAccess = "Allow"
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid ruleAccess %s, the value must be Allow or Deny", typeTemplateOut, action, tmp.RuleAccess)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(tmp.Direction)) {
+	case "", "inbound":
+		tmp.Direction = defaultDirection
+	case "outbound":
+		tmp.Direction = "Outbound"
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid direction %s, the value must be Inbound or Outbound", typeTemplateOut, action, tmp.Direction)
+	}
+
+	if tmp.RulePriority == 0 {
+		tmp.RulePriority = defaultRulePriority
+	}
+	if tmp.RulePriority < 100 || tmp.RulePriority > 4096 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] rulePriority must be between 100 and 4096", typeTemplateOut, action)
+	}
+
+	return &templateOut{
+		Type:         typeTemplateOut,
+		Action:       action,
+		Description:  descTemplateOut,
+		OutputDir:    tmp.OutputDir,
+		Format:       tmp.Format,
+		ResourceType: tmp.ResourceType,
+		NamePrefix:   tmp.NamePrefix,
+		Tags:         tmp.Tags,
+		RuleAccess:   tmp.RuleAccess,
+		Direction:    tmp.Direction,
+		RulePriority: tmp.RulePriority,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+	}, nil
+}
+
+type templateOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	OutputDir    string
+	Format       string
+	ResourceType string
+	NamePrefix   string
+	Tags         map[string]string
+	RuleAccess   string
+	Direction    string
+	RulePriority int
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+}
+
+// resource is one Azure resource to be declared in the template
+type resource struct {
+	Name      string
+	Addresses []string
+}
+
+func (t *templateOut) GetType() string {
+	return t.Type
+}
+
+func (t *templateOut) GetAction() lib.Action {
+	return t.Action
+}
+
+func (t *templateOut) GetDescription() string {
+	return t.Description
+}
+
+func (t *templateOut) Output(container lib.Container) error {
+	for _, name := range t.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", t.Type, "entry", name)
+			continue
+		}
+
+		cidrList, err := t.marshalText(entry)
+		if err != nil {
+			return err
+		}
+
+		resources := t.generateResources(entry.GetName(), cidrList)
+
+		var data []byte
+		var filename string
+		switch t.Format {
+		case formatARM:
+			data, err = t.marshalARM(resources)
+			filename = strings.ToLower(entry.GetName()) + ".json"
+		case formatBicep:
+			data = t.marshalBicep(resources)
+			filename = strings.ToLower(entry.GetName()) + ".bicep"
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := t.writeFile(filename, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *templateOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(t.Exclude)
+
+	wantList := make([]string, 0, len(t.Want))
+	for _, want := range lib.ExpandWantedList(container, t.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(t.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (t *templateOut) marshalText(entry *lib.Entry) ([]string, error) {
+	switch t.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalText()
+	}
+}
+
+// generateResources chunks the CIDR list into resources within the address limit of Azure
+func (t *templateOut) generateResources(name string, cidrList []string) []*resource {
+	limit := maxAddressesPerResource[t.ResourceType]
+	parts := (len(cidrList) + limit - 1) / limit
+	resources := make([]*resource, 0, parts)
+
+	for i := 0; i < parts; i++ {
+		resourceName := t.NamePrefix + strings.ToLower(name)
+		if parts > 1 {
+			resourceName = fmt.Sprintf("%s-%d", resourceName, i+1)
+		}
+		resources = append(resources, &resource{
+			Name:      invalidResourceNameChar.ReplaceAllString(resourceName, "-"),
+			Addresses: cidrList[i*limit : min((i+1)*limit, len(cidrList))],
+		})
+	}
+
+	return resources
+}
+
+func (t *templateOut) nsgRuleProperties(addresses []string) map[string]any {
+	properties := map[string]any{
+		"priority":  t.RulePriority,
+		"direction": t.Direction,
+		"access":    t.RuleAccess,
+		"protocol":  "*",
+
+		"sourcePortRange":      "*",
+		"destinationPortRange": "*",
+	}
+	if t.Direction == "Inbound" {
+		properties["sourceAddressPrefixes"] = addresses
+		properties["destinationAddressPrefix"] = "*"
+	} else {
+		properties["sourceAddressPrefix"] = "*"
+		properties["destinationAddressPrefixes"] = addresses
+	}
+	return properties
+}
+
+func (t *templateOut) marshalARM(resources []*resource) ([]byte, error) {
+	armResources := make([]map[string]any, 0, len(resources))
+	for _, r := range resources {
+		armResource := map[string]any{
+			"apiVersion": apiVersion,
+			"name":       r.Name,
+			"location":   locationParam,
+		}
+		if len(t.Tags) > 0 {
+			armResource["tags"] = t.Tags
+		}
+
+		switch t.ResourceType {
+		case resourceIPGroup:
+			armResource["type"] = ipGroupType
+			armResource["properties"] = map[string]any{
+				"ipAddresses": r.Addresses,
+			}
+		case resourceNSG:
+			armResource["type"] = nsgType
+			armResource["properties"] = map[string]any{
+				"securityRules": []map[string]any{
+					{
+						"name":       r.Name,
+						"properties": t.nsgRuleProperties(r.Addresses),
+					},
+				},
+			}
+		}
+
+		armResources = append(armResources, armResource)
+	}
+
+	template := map[string]any{
+		"$schema":        armSchema,
+		"contentVersion": "1.0.0.0",
+		"parameters": map[string]any{
+			"location": map[string]string{
+				"type":         "string",
+				"defaultValue": "[resourceGroup().location]",
+			},
+		},
+		"resources": armResources,
+	}
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (t *templateOut) marshalBicep(resources []*resource) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("param location string = resourceGroup().location\n")
+
+	for _, r := range resources {
+		symbolicName := invalidSymbolicNameChar.ReplaceAllString(r.Name, "_")
+
+		buf.WriteString("\n")
+		switch t.ResourceType {
+		case resourceIPGroup:
+			fmt.Fprintf(&buf, "resource %s '%s@%s' = {\n", symbolicName, ipGroupType, apiVersion)
+		case resourceNSG:
+			fmt.Fprintf(&buf, "resource %s '%s@%s' = {\n", symbolicName, nsgType, apiVersion)
+		}
+		fmt.Fprintf(&buf, "  name: '%s'\n", r.Name)
+		buf.WriteString("  location: location\n")
+
+		if len(t.Tags) > 0 {
+			keys := make([]string, 0, len(t.Tags))
+			for key := range t.Tags {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			buf.WriteString("  tags: {\n")
+			for _, key := range keys {
+				fmt.Fprintf(&buf, "    '%s': '%s'\n", bicepEscape(key), bicepEscape(t.Tags[key]))
+			}
+			buf.WriteString("  }\n")
+		}
+
+		buf.WriteString("  properties: {\n")
+		switch t.ResourceType {
+		case resourceIPGroup:
+			buf.WriteString("    ipAddresses: [\n")
+			for _, cidr := range r.Addresses {
+				fmt.Fprintf(&buf, "      '%s'\n", cidr)
+			}
+			buf.WriteString("    ]\n")
+
+		case resourceNSG:
+			addressKey, anyKey := "sourceAddressPrefixes", "destinationAddressPrefix"
+			if t.Direction == "Outbound" {
+				addressKey, anyKey = "destinationAddressPrefixes", "sourceAddressPrefix"
+			}
+			buf.WriteString("    securityRules: [\n")
+			buf.WriteString("      {\n")
+			fmt.Fprintf(&buf, "        name: '%s'\n", r.Name)
+			buf.WriteString("        properties: {\n")
+			fmt.Fprintf(&buf, "          priority: %d\n", t.RulePriority)
+			fmt.Fprintf(&buf, "          direction: '%s'\n", t.Direction)
+			fmt.Fprintf(&buf, "          access: '%s'\n", t.RuleAccess)
+			buf.WriteString("          protocol: '*'\n")
+			buf.WriteString("          sourcePortRange: '*'\n")
+			buf.WriteString("          destinationPortRange: '*'\n")
+			fmt.Fprintf(&buf, "          %s: '*'\n", anyKey)
+			fmt.Fprintf(&buf, "          %s: [\n", addressKey)
+			for _, cidr := range r.Addresses {
+				fmt.Fprintf(&buf, "            '%s'\n", cidr)
+			}
+			buf.WriteString("          ]\n")
+			buf.WriteString("        }\n")
+			buf.WriteString("      }\n")
+			buf.WriteString("    ]\n")
+		}
+		buf.WriteString("  }\n")
+		buf.WriteString("}\n")
+	}
+
+	return buf.Bytes()
+}
+
+func bicepEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `'`, `\'`)
+}
+
+func (t *templateOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(t.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", t.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package clash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeRuleSetOut = "clashRuleSet"
+	descRuleSetOut = "Convert data to Clash/mihomo rule providers, with IP-ASN rules for lists of autonomous systems"
+)
+
+const (
+	behaviorIPCIDR    = "ipcidr"
+	behaviorClassical = "classical"
+
+	formatYAML = "yaml"
+	formatText = "text"
+)
+
+var (
+	defaultOutputDir = filepath.Join("./", "output", "clash")
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeRuleSetOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newRuleSetOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeRuleSetOut, &ruleSetOut{
+		Description: descRuleSetOut,
+	})
+	lib.RegisterOutputArgs(typeRuleSetOut, ruleSetOutArgs{})
+}
+
+// ruleSetOutArgs are the args of the output converter in config file
+type ruleSetOutArgs struct {
+	OutputDir  string     `json:"outputDir"`
+	Behavior   string     `json:"behavior"`
+	Format     string     `json:"format"`
+	ASNRule    bool       `json:"asnRule"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newRuleSetOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp ruleSetOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Behavior = strings.ToLower(strings.TrimSpace(tmp.Behavior))
+	switch tmp.Behavior {
+	case "":
+		tmp.Behavior = behaviorIPCIDR
+	case behaviorIPCIDR, behaviorClassical:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid behavior %s, the value must be %s or %s", typeRuleSetOut, action, tmp.Behavior, behaviorIPCIDR, behaviorClassical)
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	switch tmp.Format {
+	case "":
+		tmp.Format = formatYAML
+	case formatYAML, formatText:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be %s or %s", typeRuleSetOut, action, tmp.Format, formatYAML, formatText)
+	}
+
+	if tmp.ASNRule && tmp.Behavior != behaviorClassical {
+		return nil, fmt.Errorf("❌ [type %s | action %s] asnRule must be used with behavior %s", typeRuleSetOut, action, behaviorClassical)
+	}
+
+	return &ruleSetOut{
+		Type:        typeRuleSetOut,
+		Action:      action,
+		Description: descRuleSetOut,
+		OutputDir:   tmp.OutputDir,
+		Behavior:    tmp.Behavior,
+		Format:      tmp.Format,
+		ASNRule:     tmp.ASNRule,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type ruleSetOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	Behavior    string
+	Format      string
+	ASNRule     bool
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (r *ruleSetOut) GetType() string {
+	return r.Type
+}
+
+func (r *ruleSetOut) GetAction() lib.Action {
+	return r.Action
+}
+
+func (r *ruleSetOut) GetDescription() string {
+	return r.Description
+}
+
+func (r *ruleSetOut) Output(container lib.Container) error {
+	for _, name := range r.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", r.Type, "entry", name)
+			continue
+		}
+
+		rules, err := r.generateRules(entry)
+		if err != nil {
+			return err
+		}
+
+		ext := ".yaml"
+		if r.Format == formatText {
+			ext = ".txt"
+		}
+		if err := r.writeFile(strings.ToLower(entry.GetName())+ext, rules); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateRules returns the rules of the entry. Lists of autonomous systems are
+// matched by the IP-ASN rule with asnRule, which relies on the ASN database of clients.
+func (r *ruleSetOut) generateRules(entry *lib.Entry) ([]string, error) {
+	if asn, ok := lib.ParseASN(entry.GetName()); ok && r.ASNRule {
+		return []string{"IP-ASN," + strconv.FormatUint(uint64(asn), 10)}, nil
+	}
+
+	var prefixes []netip.Prefix
+	var err error
+	switch r.OnlyIPType {
+	case lib.IPv4:
+		prefixes, err = entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		prefixes, err = entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		prefixes, err = entry.MarshalPrefix()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		switch {
+		case r.Behavior == behaviorIPCIDR:
+			rules = append(rules, prefix.String())
+		case prefix.Addr().Is4():
+			rules = append(rules, "IP-CIDR,"+prefix.String())
+		default:
+			rules = append(rules, "IP-CIDR6,"+prefix.String())
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *ruleSetOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(r.Exclude)
+
+	wantList := make([]string, 0, len(r.Want))
+	for _, want := range lib.ExpandWantedList(container, r.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(r.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (r *ruleSetOut) writeFile(filename string, rules []string) error {
+	var buf bytes.Buffer
+	if r.Format == formatYAML {
+		buf.WriteString("payload:\n")
+	}
+	for _, rule := range rules {
+		if r.Format == formatYAML {
+			fmt.Fprintf(&buf, "  - '%s'\n", rule)
+		} else {
+			buf.WriteString(rule)
+			buf.WriteString("\n")
+		}
+	}
+
+	dir, filename, err := lib.ResolveOutputPath(r.OutputDir, filename, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", r.Type, "file", filename, "dir", dir)
+
+	return nil
+}
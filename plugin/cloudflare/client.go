@@ -0,0 +1,117 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	apiEndpoint = "https://api.cloudflare.com/client/v4"
+)
+
+type client struct {
+	apiToken   string
+	accountID  string
+	httpClient *http.Client
+}
+
+// newClient uses the token and account ID in config first, then falls back
+// to CLOUDFLARE_API_TOKEN and CLOUDFLARE_ACCOUNT_ID environment variables
+func newClient(apiToken, accountID string) (*client, error) {
+	apiToken = strings.TrimSpace(apiToken)
+	if apiToken == "" {
+		apiToken = os.Getenv("CLOUDFLARE_API_TOKEN")
+	}
+	if apiToken == "" {
+		return nil, errors.New("missing Cloudflare API token, set apiToken in config or CLOUDFLARE_API_TOKEN in environment")
+	}
+
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		accountID = os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+	}
+	if accountID == "" {
+		return nil, errors.New("missing Cloudflare account ID, set accountID in config or CLOUDFLARE_ACCOUNT_ID in environment")
+	}
+
+	return &client{
+		apiToken:   apiToken,
+		accountID:  accountID,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// response is the envelope of every Cloudflare API v4 response
+type response struct {
+	Success bool            `json:"success"`
+	Errors  []apiMessage    `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+	Info    struct {
+		Cursors struct {
+			After string `json:"after"`
+		} `json:"cursors"`
+	} `json:"result_info"`
+}
+
+type apiMessage struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// do sends a request to the account-level API path and decodes its result into out.
+// It returns the cursor of the next page if there is one.
+func (c *client) do(ctx context.Context, method, path string, in, out any) (string, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	url := apiEndpoint + "/accounts/" + c.accountID + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", fmt.Errorf("failed to decode Cloudflare API response of %s %s, http status code %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if !r.Success {
+		messages := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		return "", fmt.Errorf("failed to call Cloudflare API %s %s, http status code %d: %s", method, path, resp.StatusCode, strings.Join(messages, "; "))
+	}
+
+	if out != nil && len(r.Result) > 0 {
+		if err := json.Unmarshal(r.Result, out); err != nil {
+			return "", err
+		}
+	}
+
+	return r.Info.Cursors.After, nil
+}
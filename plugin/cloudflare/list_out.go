@@ -0,0 +1,464 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeListOut = "cloudflareList"
+	descListOut = "Sync data to Cloudflare account-level IP lists"
+)
+
+var (
+	defaultListNamePrefix = "geoip_"
+	defaultListComment    = "Managed by geoip"
+	maxListNameLength     = 50
+	maxItemsPerRequest    = 1000
+	invalidListNameChar   = regexp.MustCompile(`[^a-z0-9_]`)
+
+	// Cloudflare IP lists only accept these prefix lengths
+	minIPv4Bits = 8
+	minIPv6Bits = 12
+	maxIPv6Bits = 64
+
+	bulkOperationPollInterval = 2 * time.Second
+	bulkOperationPollTimeout  = 5 * time.Minute
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeListOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newListOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeListOut, &listOut{
+		Description: descListOut,
+	})
+	lib.RegisterOutputArgs(typeListOut, listOutArgs{})
+}
+
+// listOutArgs are the args of the output converter in config file
+type listOutArgs struct {
+	APIToken     string     `json:"apiToken"`
+	AccountID    string     `json:"accountID"`
+	NamePrefix   string     `json:"namePrefix"`
+	Comment      string     `json:"comment"`
+	DryRun       bool       `json:"dryRun"`
+	SkipLongIPv6 bool       `json:"skipLongIPv6"`
+	Want         []string   `json:"wantedList"`
+	Exclude      []string   `json:"excludedList"`
+	OnlyIPType   lib.IPType `json:"onlyIPType"`
+}
+
+func newListOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp listOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := newClient(tmp.APIToken, tmp.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeListOut, action, err)
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultListNamePrefix
+	}
+
+	if tmp.Comment == "" {
+		tmp.Comment = defaultListComment
+	}
+
+	return &listOut{
+		Type:         typeListOut,
+		Action:       action,
+		Description:  descListOut,
+		NamePrefix:   tmp.NamePrefix,
+		Comment:      tmp.Comment,
+		DryRun:       tmp.DryRun,
+		SkipLongIPv6: tmp.SkipLongIPv6,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+
+		client: c,
+	}, nil
+}
+
+type listOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	NamePrefix   string
+	Comment      string
+	DryRun       bool
+	SkipLongIPv6 bool
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+
+	client *client
+}
+
+type ipList struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	NumItems int    `json:"num_items"`
+}
+
+type listItem struct {
+	ID      string `json:"id,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (l *listOut) GetType() string {
+	return l.Type
+}
+
+func (l *listOut) GetAction() lib.Action {
+	return l.Action
+}
+
+func (l *listOut) GetDescription() string {
+	return l.Description
+}
+
+func (l *listOut) Output(container lib.Container) error {
+	return l.OutputContext(context.Background(), container)
+}
+
+func (l *listOut) OutputContext(ctx context.Context, container lib.Container) error {
+	existing, err := l.getLists(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range l.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", l.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := l.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := l.sync(ctx, l.listName(name), l.normalize(name, prefixes), existing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *listOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(l.Exclude)
+
+	wantList := make([]string, 0, len(l.Want))
+	for _, want := range lib.ExpandWantedList(container, l.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(l.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (l *listOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch l.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// listName converts list name to a valid Cloudflare list name,
+// which only contains lowercase letters, digits and underscores
+func (l *listOut) listName(name string) string {
+	listName := invalidListNameChar.ReplaceAllString(strings.ToLower(l.NamePrefix+name), "_")
+	if len(listName) > maxListNameLength {
+		listName = listName[:maxListNameLength]
+	}
+	return listName
+}
+
+// normalize adapts prefixes to the lengths accepted by Cloudflare:
+// IPv4 prefixes shorter than /8 and IPv6 prefixes shorter than /12 are split,
+// and IPv6 prefixes longer than /64 (except single addresses) are widened to /64,
+// or skipped if SkipLongIPv6, as widened ones cover up to 2^64 more addresses.
+func (l *listOut) normalize(name string, prefixes []netip.Prefix) []netip.Prefix {
+	seen := make(map[netip.Prefix]bool, len(prefixes))
+	result := make([]netip.Prefix, 0, len(prefixes))
+	appendUnique := func(prefix netip.Prefix) {
+		if !seen[prefix] {
+			seen[prefix] = true
+			result = append(result, prefix)
+		}
+	}
+
+	long := 0
+	for _, prefix := range prefixes {
+		switch {
+		case prefix.Addr().Is4() && prefix.Bits() < minIPv4Bits:
+			for _, subnet := range splitPrefix(prefix, minIPv4Bits) {
+				appendUnique(subnet)
+			}
+		case prefix.Addr().Is6() && prefix.Bits() < minIPv6Bits:
+			for _, subnet := range splitPrefix(prefix, minIPv6Bits) {
+				appendUnique(subnet)
+			}
+		case prefix.Addr().Is6() && prefix.Bits() > maxIPv6Bits && !prefix.IsSingleIP():
+			long++
+			if l.SkipLongIPv6 {
+				continue
+			}
+			widened, _ := prefix.Addr().Prefix(maxIPv6Bits)
+			appendUnique(widened)
+		default:
+			appendUnique(prefix)
+		}
+	}
+
+	if long > 0 {
+		if l.SkipLongIPv6 {
+			slog.Warn("IPv6 prefixes longer than /64 skipped", "plugin", l.Type, "list", strings.ToLower(name), "count", long)
+		} else {
+			slog.Warn("IPv6 prefixes longer than /64 widened to /64", "plugin", l.Type, "list", strings.ToLower(name), "count", long)
+		}
+	}
+
+	return result
+}
+
+// splitPrefix splits prefix into subnets of the given length
+func splitPrefix(prefix netip.Prefix, bits int) []netip.Prefix {
+	subnets := make([]netip.Prefix, 0, 1<<(bits-prefix.Bits()))
+	addr := prefix.Masked().Addr()
+	for prefix.Contains(addr) {
+		subnet := netip.PrefixFrom(addr, bits)
+		subnets = append(subnets, subnet)
+		addr = netipx.PrefixLastIP(subnet).Next()
+		if !addr.IsValid() {
+			break
+		}
+	}
+	return subnets
+}
+
+// itemIP formats prefix as a Cloudflare list item, which uses bare address for single IP
+func itemIP(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+func parseItemIP(ip string) (netip.Prefix, error) {
+	if strings.Contains(ip, "/") {
+		prefix, err := netip.ParsePrefix(ip)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// sync makes the Cloudflare list called name contain exactly the desired prefixes
+func (l *listOut) sync(ctx context.Context, name string, desired []netip.Prefix, existing map[string]*ipList) error {
+	list, found := existing[name]
+
+	current := make(map[netip.Prefix]string)
+	if found {
+		items, err := l.getItems(ctx, list.ID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			prefix, err := parseItemIP(item.IP)
+			if err != nil {
+				return err
+			}
+			current[prefix] = item.ID
+		}
+	}
+
+	desiredMap := make(map[netip.Prefix]bool, len(desired))
+	toAdd := make([]listItem, 0)
+	for _, prefix := range desired {
+		desiredMap[prefix] = true
+		if _, found := current[prefix]; !found {
+			toAdd = append(toAdd, listItem{IP: itemIP(prefix), Comment: l.Comment})
+		}
+	}
+	toRemove := make([]listItem, 0)
+	for prefix, id := range current {
+		if !desiredMap[prefix] {
+			toRemove = append(toRemove, listItem{ID: id})
+		}
+	}
+
+	if l.DryRun {
+		slog.Info("list planned (dry run)", "plugin", l.Type, "name", name, "add", len(toAdd), "remove", len(toRemove))
+		return nil
+	}
+
+	if !found {
+		created, err := l.createList(ctx, name)
+		if err != nil {
+			return err
+		}
+		existing[name] = created
+		list = created
+	}
+
+	for start := 0; start < len(toRemove); start += maxItemsPerRequest {
+		batch := toRemove[start:min(start+maxItemsPerRequest, len(toRemove))]
+		if err := l.bulk(ctx, http.MethodDelete, list.ID, map[string]any{"items": batch}); err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(toAdd); start += maxItemsPerRequest {
+		batch := toAdd[start:min(start+maxItemsPerRequest, len(toAdd))]
+		if err := l.bulk(ctx, http.MethodPost, list.ID, batch); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("list updated", "plugin", l.Type, "name", name, "id", list.ID, "added", len(toAdd), "removed", len(toRemove))
+
+	return nil
+}
+
+func (l *listOut) getLists(ctx context.Context) (map[string]*ipList, error) {
+	var lists []*ipList
+	if _, err := l.client.do(ctx, http.MethodGet, "/rules/lists", nil, &lists); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*ipList, len(lists))
+	for _, list := range lists {
+		if list.Kind == "ip" {
+			result[list.Name] = list
+		}
+	}
+	return result, nil
+}
+
+func (l *listOut) createList(ctx context.Context, name string) (*ipList, error) {
+	var list ipList
+	if _, err := l.client.do(ctx, http.MethodPost, "/rules/lists", map[string]string{
+		"name":        name,
+		"kind":        "ip",
+		"description": l.Comment,
+	}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (l *listOut) getItems(ctx context.Context, listID string) ([]*listItem, error) {
+	items := make([]*listItem, 0)
+	cursor := ""
+	for {
+		path := "/rules/lists/" + listID + "/items?per_page=500"
+		if cursor != "" {
+			path += "&cursor=" + url.QueryEscape(cursor)
+		}
+
+		var page []*listItem
+		next, err := l.client.do(ctx, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		if next == "" {
+			return items, nil
+		}
+		cursor = next
+	}
+}
+
+// bulk sends an asynchronous bulk operation on list items and waits for it to finish,
+// since Cloudflare rejects new bulk operations while another one is pending
+func (l *listOut) bulk(ctx context.Context, method, listID string, body any) error {
+	var op struct {
+		ID string `json:"operation_id"`
+	}
+	if _, err := l.client.do(ctx, method, "/rules/lists/"+listID+"/items", body, &op); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(bulkOperationPollTimeout)
+	for {
+		var status struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if _, err := l.client.do(ctx, http.MethodGet, "/rules/lists/bulk_operations/"+op.ID, nil, &status); err != nil {
+			return err
+		}
+
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("❌ [type %s | action %s] bulk operation %s on list %s failed: %s", l.Type, l.Action, op.ID, listID, status.Error)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("❌ [type %s | action %s] timeout waiting for bulk operation %s on list %s", l.Type, l.Action, op.ID, listID)
+		}
+		select {
+		case <-time.After(bulkOperationPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
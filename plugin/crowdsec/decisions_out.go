@@ -0,0 +1,289 @@
+package crowdsec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeDecisionsOut = "crowdsecDecisions"
+	descDecisionsOut = "Convert data to CrowdSec decisions import format"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+
+	scopeIP    = "Ip"
+	scopeRange = "Range"
+)
+
+var (
+	defaultOutputDir       = filepath.Join("./", "output", "crowdsec")
+	defaultDuration        = "24h"
+	defaultDecisionType    = "ban"
+	defaultReasonPrefix    = "geoip/"
+	supportedFormats       = []string{formatJSON, formatCSV}
+	supportedDecisionTypes = []string{"ban", "captcha", "throttle"}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeDecisionsOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newDecisionsOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeDecisionsOut, &decisionsOut{
+		Description: descDecisionsOut,
+	})
+	lib.RegisterOutputArgs(typeDecisionsOut, decisionsOutArgs{})
+}
+
+// decisionsOutArgs are the args of the output converter in config file
+type decisionsOutArgs struct {
+	OutputDir    string     `json:"outputDir"`
+	Format       string     `json:"format"`
+	Duration     string     `json:"duration"`
+	DecisionType string     `json:"decisionType"`
+	ReasonPrefix string     `json:"reasonPrefix"`
+	Want         []string   `json:"wantedList"`
+	Exclude      []string   `json:"excludedList"`
+	OnlyIPType   lib.IPType `json:"onlyIPType"`
+}
+
+func newDecisionsOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp decisionsOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	if tmp.Format == "" {
+		tmp.Format = formatJSON
+	}
+	if !slices.Contains(supportedFormats, tmp.Format) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be json or csv", typeDecisionsOut, action, tmp.Format)
+	}
+
+	if tmp.Duration == "" {
+		tmp.Duration = defaultDuration
+	}
+	if d, err := time.ParseDuration(tmp.Duration); err != nil || d <= 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid duration %s", typeDecisionsOut, action, tmp.Duration)
+	}
+
+	tmp.DecisionType = strings.ToLower(strings.TrimSpace(tmp.DecisionType))
+	if tmp.DecisionType == "" {
+		tmp.DecisionType = defaultDecisionType
+	}
+	if !slices.Contains(supportedDecisionTypes, tmp.DecisionType) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid decisionType %s, the value must be ban, captcha or throttle", typeDecisionsOut, action, tmp.DecisionType)
+	}
+
+	if tmp.ReasonPrefix == "" {
+		tmp.ReasonPrefix = defaultReasonPrefix
+	}
+
+	return &decisionsOut{
+		Type:         typeDecisionsOut,
+		Action:       action,
+		Description:  descDecisionsOut,
+		OutputDir:    tmp.OutputDir,
+		Format:       tmp.Format,
+		Duration:     tmp.Duration,
+		DecisionType: tmp.DecisionType,
+		ReasonPrefix: tmp.ReasonPrefix,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+	}, nil
+}
+
+type decisionsOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	OutputDir    string
+	Format       string
+	Duration     string
+	DecisionType string
+	ReasonPrefix string
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+}
+
+// decision is an item of the file imported by "cscli decisions import"
+type decision struct {
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+	Scope    string `json:"scope"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+}
+
+func (d *decisionsOut) GetType() string {
+	return d.Type
+}
+
+func (d *decisionsOut) GetAction() lib.Action {
+	return d.Action
+}
+
+func (d *decisionsOut) GetDescription() string {
+	return d.Description
+}
+
+func (d *decisionsOut) Output(container lib.Container) error {
+	for _, name := range d.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", d.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := d.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		decisions := d.generateDecisions(strings.ToLower(entry.GetName()), prefixes)
+
+		var data []byte
+		switch d.Format {
+		case formatJSON:
+			data, err = d.marshalJSON(decisions)
+		case formatCSV:
+			data, err = d.marshalCSV(decisions)
+		}
+		if err != nil {
+			return err
+		}
+
+		filename := strings.ToLower(entry.GetName()) + "." + d.Format
+		if err := d.writeFile(filename, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *decisionsOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(d.Exclude)
+
+	wantList := make([]string, 0, len(d.Want))
+	for _, want := range lib.ExpandWantedList(container, d.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(d.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (d *decisionsOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch d.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// generateDecisions uses Ip scope for single addresses and Range scope for others
+func (d *decisionsOut) generateDecisions(name string, prefixes []netip.Prefix) []*decision {
+	decisions := make([]*decision, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		scope, value := scopeRange, prefix.String()
+		if prefix.IsSingleIP() {
+			scope, value = scopeIP, prefix.Addr().String()
+		}
+		decisions = append(decisions, &decision{
+			Duration: d.Duration,
+			Reason:   d.ReasonPrefix + name,
+			Scope:    scope,
+			Type:     d.DecisionType,
+			Value:    value,
+		})
+	}
+	return decisions
+}
+
+func (d *decisionsOut) marshalJSON(decisions []*decision) ([]byte, error) {
+	data, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (d *decisionsOut) marshalCSV(decisions []*decision) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"duration", "reason", "scope", "type", "value"}); err != nil {
+		return nil, err
+	}
+	for _, dec := range decisions {
+		if err := w.Write([]string{dec.Duration, dec.Reason, dec.Scope, dec.Type, dec.Value}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (d *decisionsOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(d.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", d.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const descExecIn = "Run an external plugin to load lists, which writes them in JSON lines to stdout"
+
+func init() {
+	lib.RegisterInputConfigCreator(typeExec, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newExecIn(action, data)
+	})
+	lib.RegisterInputConverter(typeExec, &execIn{
+		Description: descExecIn,
+	})
+	lib.RegisterInputArgs(typeExec, execInArgs{})
+}
+
+// execInArgs are the args of the input converter in config file
+type execInArgs struct {
+	Command    string            `json:"command"`
+	Args       []string          `json:"args"`
+	Env        map[string]string `json:"env"`
+	Dir        string            `json:"dir"`
+	Timeout    string            `json:"timeout"`
+	Config     json.RawMessage   `json:"config"`
+	Want       []string          `json:"wantedList"`
+	Exclude    []string          `json:"excludedList"`
+	OnlyIPType lib.IPType        `json:"onlyIPType"`
+}
+
+func newExecIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp execInArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	command, err := newCommand(action, strings.TrimSpace(tmp.Command), tmp.Args, tmp.Env, tmp.Dir, tmp.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := listMatcher(typeExec, action, tmp.Want, "wantedList")
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := listMatcher(typeExec, action, tmp.Exclude, "excludedList")
+	if err != nil {
+		return nil, err
+	}
+
+	return &execIn{
+		Type:        typeExec,
+		Action:      action,
+		Description: descExecIn,
+		Command:     command,
+		Config:      tmp.Config,
+		Want:        want,
+		Exclude:     exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type execIn struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Command     *command
+	Config      json.RawMessage
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (e *execIn) GetType() string {
+	return e.Type
+}
+
+func (e *execIn) GetAction() lib.Action {
+	return e.Action
+}
+
+func (e *execIn) GetDescription() string {
+	return e.Description
+}
+
+func (e *execIn) IsSourceInput() bool {
+	return true
+}
+
+func (e *execIn) Input(container lib.Container) (lib.Container, error) {
+	return e.InputContext(context.Background(), container)
+}
+
+func (e *execIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	entries, err := e.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", e.Type, e.Action)
+	}
+
+	if err := addEntries(container, e.Action, entries, e.OnlyIPType); err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
+
+// run runs the plugin with the request in stdin, and reads lists from its stdout
+func (e *execIn) run(ctx context.Context) (map[string]*lib.Entry, error) {
+	req, err := json.Marshal(&request{Protocol: protocolVersion, Kind: kindInput, Action: e.Action, Config: e.Config})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, cancel := e.Command.cmd(ctx, e.Action)
+	defer cancel()
+	cmd.Stdin = bytes.NewReader(append(req, '\n'))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, wrapError(e.Action, e.Command.Command, err)
+	}
+
+	entries, readErr := readLists(stdout, e.Want, e.Exclude)
+	if readErr != nil {
+		// Drain the rest of stdout so that the plugin is not blocked
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, wrapError(e.Action, e.Command.Command, err)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid output of plugin %s: %w", e.Type, e.Action, e.Command.Command, readErr)
+	}
+	return entries, nil
+}
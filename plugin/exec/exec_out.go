@@ -0,0 +1,112 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const descExecOut = "Run an external plugin to write lists, which are passed in JSON lines to stdin"
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeExec, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newExecOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeExec, &execOut{
+		Description: descExecOut,
+	})
+	lib.RegisterOutputArgs(typeExec, execOutArgs{})
+}
+
+// execOutArgs are the args of the output converter in config file
+type execOutArgs struct {
+	Command    string            `json:"command"`
+	Args       []string          `json:"args"`
+	Env        map[string]string `json:"env"`
+	Dir        string            `json:"dir"`
+	Timeout    string            `json:"timeout"`
+	Config     json.RawMessage   `json:"config"`
+	Want       []string          `json:"wantedList"`
+	Exclude    []string          `json:"excludedList"`
+	OnlyIPType lib.IPType        `json:"onlyIPType"`
+}
+
+func newExecOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp execOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	command, err := newCommand(action, strings.TrimSpace(tmp.Command), tmp.Args, tmp.Env, tmp.Dir, tmp.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execOut{
+		Type:        typeExec,
+		Action:      action,
+		Description: descExecOut,
+		Command:     command,
+		Config:      tmp.Config,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type execOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Command     *command
+	Config      json.RawMessage
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (e *execOut) GetType() string {
+	return e.Type
+}
+
+func (e *execOut) GetAction() lib.Action {
+	return e.Action
+}
+
+func (e *execOut) GetDescription() string {
+	return e.Description
+}
+
+func (e *execOut) Output(container lib.Container) error {
+	return e.OutputContext(context.Background(), container)
+}
+
+// OutputContext runs the plugin with the request and all lists in stdin,
+// stdout of the plugin is passed through to stderr, the same as its stderr
+func (e *execOut) OutputContext(ctx context.Context, container lib.Container) error {
+	cmd, cancel := e.Command.cmd(ctx, e.Action)
+	defer cancel()
+	cmd.Stdout = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return wrapError(e.Action, e.Command.Command, err)
+	}
+
+	req := &request{Protocol: protocolVersion, Kind: kindOutput, Action: e.Action, Config: e.Config}
+	writeErr := writeLists(stdin, e.Type, req, container, filterAndSortList(container, e.Want, e.Exclude), e.OnlyIPType)
+	stdin.Close()
+	// The error of the plugin is more helpful, e.g. when it exits before reading all lists
+	if err := cmd.Wait(); err != nil {
+		return wrapError(e.Action, e.Command.Command, err)
+	}
+	return writeErr
+}
@@ -0,0 +1,252 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+// Version of the protocol between geoip and plugins, passed to plugins in the
+// request and the GEOIP_PLUGIN_PROTOCOL environment variable
+const protocolVersion = 1
+
+const (
+	typeExec = "exec"
+
+	kindInput  = "input"
+	kindOutput = "output"
+)
+
+// request is the first line written to stdin of plugins
+type request struct {
+	Protocol int             `json:"protocol"`
+	Kind     string          `json:"kind"`
+	Action   lib.Action      `json:"action"`
+	Config   json.RawMessage `json:"config,omitempty"`
+}
+
+// list is a line of a list written to stdout of input plugins, or stdin of output plugins.
+// A list could be split into many lines, whose CIDRs, prefixes and tags are merged.
+type list struct {
+	Name     string   `json:"name"`
+	CIDRs    []string `json:"cidrs"`
+	Prefixes []prefix `json:"prefixes,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// prefix is a CIDR with its metadata. Input plugins could write CIDRs with metadata
+// in prefixes instead of cidrs, and output plugins get the ones with metadata in it,
+// besides all CIDRs in cidrs.
+type prefix struct {
+	CIDR string `json:"cidr"`
+	lib.Metadata
+}
+
+// command is the plugin to run, shared by the input and output
+type command struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+	Dir     string
+	Timeout time.Duration
+}
+
+func newCommand(action lib.Action, name string, args []string, env map[string]string, dir, timeout string) (*command, error) {
+	if name == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] command must be specified", typeExec, action)
+	}
+
+	c := &command{Command: name, Args: args, Env: env, Dir: dir}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid timeout %s", typeExec, action, timeout)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// cmd returns the command of the plugin, which is killed when the context is done
+// or the timeout is reached. Stderr of the plugin is passed through.
+func (c *command) cmd(ctx context.Context, action lib.Action) (*exec.Cmd, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GEOIP_PLUGIN_PROTOCOL="+strconv.Itoa(protocolVersion),
+		"GEOIP_PLUGIN_ACTION="+string(action),
+	)
+	for key, value := range c.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	return cmd, cancel
+}
+
+// wrapError returns the error of the plugin with its exit status
+func wrapError(action lib.Action, command string, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("❌ [type %s | action %s] plugin %s exited with status %d", typeExec, action, command, exitErr.ExitCode())
+	}
+	return fmt.Errorf("❌ [type %s | action %s] plugin %s failed: %w", typeExec, action, command, err)
+}
+
+// readLists reads lists written by the plugin, only the wanted and not excluded ones are kept
+func readLists(r io.Reader, want, exclude *lib.ListMatcher) (map[string]*lib.Entry, error) {
+	entries := make(map[string]*lib.Entry)
+	decoder := json.NewDecoder(r)
+	for {
+		var l list
+		if err := decoder.Decode(&l); errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := strings.ToUpper(strings.TrimSpace(l.Name))
+		if name == "" {
+			return nil, errors.New("list without name")
+		}
+		if (!want.IsEmpty() && !want.Match(name)) || exclude.Match(name) {
+			continue
+		}
+
+		entry, found := entries[name]
+		if !found {
+			entry = lib.NewEntry(name)
+			entries[name] = entry
+		}
+		entry.AddTag(l.Tags...)
+		for _, cidr := range l.CIDRs {
+			if err := entry.AddPrefix(strings.TrimSpace(cidr)); err != nil {
+				return nil, fmt.Errorf("invalid CIDR %s of list %s: %w", cidr, name, err)
+			}
+		}
+		for _, p := range l.Prefixes {
+			if err := entry.AddPrefixWithMetadata(strings.TrimSpace(p.CIDR), p.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid CIDR %s of list %s: %w", p.CIDR, name, err)
+			}
+		}
+	}
+}
+
+// addEntries adds the entries to, or removes them from the container according to the action
+func addEntries(container lib.Container, action lib.Action, entries map[string]*lib.Entry, onlyIPType lib.IPType) error {
+	var ignoreIPType lib.IgnoreIPOption
+	switch onlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return err
+			}
+		default:
+			return lib.ErrUnknownAction
+		}
+	}
+	return nil
+}
+
+// writeLists writes the request and the lists of the names to the plugin of the type
+func writeLists(w io.Writer, iType string, req *request, container lib.Container, names []string, onlyIPType lib.IPType) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(req); err != nil {
+		return err
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch onlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, name := range names {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", iType, "entry", name)
+			continue
+		}
+		records, err := entry.MarshalPrefixWithMetadata(ignoreIPType)
+		if err != nil {
+			// Lists without prefixes of the IP type are skipped
+			continue
+		}
+		l := &list{Name: strings.ToLower(name), CIDRs: make([]string, 0, len(records)), Tags: entry.GetTags()}
+		for _, record := range records {
+			l.CIDRs = append(l.CIDRs, record.Prefix.String())
+			if record.Metadata != nil {
+				l.Prefixes = append(l.Prefixes, prefix{CIDR: record.Prefix.String(), Metadata: *record.Metadata})
+			}
+		}
+		if err := encoder.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterAndSortList returns the sorted names of lists to be written to the plugin
+func filterAndSortList(container lib.Container, want, exclude []string) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(exclude)
+
+	wantList := make([]string, 0, len(want))
+	for _, name := range lib.ExpandWantedList(container, want) {
+		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" && !excludeList.Match(name) {
+			wantList = append(wantList, name)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(want) {
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, container.Len())
+	for entry := range container.Loop() {
+		if name := entry.GetName(); !excludeList.Match(name) {
+			list = append(list, name)
+		}
+	}
+	slices.Sort(list)
+
+	return list
+}
+
+// listMatcher returns the matcher of the wanted or excluded lists of inputs
+func listMatcher(iType string, action lib.Action, list []string, field string) (*lib.ListMatcher, error) {
+	m, err := lib.NewListMatcher(list)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %w in %s", iType, action, err, field)
+	}
+	return m, nil
+}
@@ -0,0 +1,218 @@
+package exec
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"github.com/v2fly/geoip/lib"
+)
+
+const typeWasm = "wasm"
+
+// Directories of the host mounted in the sandbox of WASM plugins
+const (
+	wasmInputDir  = "/input"
+	wasmOutputDir = "/output"
+)
+
+func init() {
+	lib.RegisterPluginLoader(".wasm", loadWasmPlugin)
+}
+
+var (
+	wasmOnce    sync.Once
+	wasmRuntime wazero.Runtime
+
+	wasmMu      sync.Mutex
+	wasmModules = make(map[string]*wasmModule) // compiled modules by path
+	wasmPlugins = make(map[string]string)      // paths of plugins by name in lower case
+)
+
+type wasmModule struct {
+	size     int64
+	modTime  time.Time
+	compiled wazero.CompiledModule
+}
+
+// compileWasm compiles the WASM module of the path, which is cached until the file changes
+func compileWasm(ctx context.Context, path string) (wazero.CompiledModule, error) {
+	wasmOnce.Do(func() {
+		wasmRuntime = wazero.NewRuntimeWithConfig(context.Background(), wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+		wasi_snapshot_preview1.MustInstantiate(context.Background(), wasmRuntime)
+	})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wasmMu.Lock()
+	defer wasmMu.Unlock()
+
+	if module, found := wasmModules[path]; found {
+		if module.size == info.Size() && module.modTime.Equal(info.ModTime()) {
+			return module.compiled, nil
+		}
+		module.compiled.Close(ctx)
+		delete(wasmModules, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lib.RecordSource(path)
+	compiled, err := wasmRuntime.CompileModule(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	wasmModules[path] = &wasmModule{size: info.Size(), modTime: info.ModTime(), compiled: compiled}
+
+	return compiled, nil
+}
+
+// loadWasmPlugin registers the WASM module of the path as the input and output type of the name
+func loadWasmPlugin(name, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(name)
+	wasmMu.Lock()
+	loaded, found := wasmPlugins[key]
+	wasmMu.Unlock()
+	if found {
+		if loaded != path {
+			return fmt.Errorf("plugin %s has already been loaded from %s", name, loaded)
+		}
+		return nil
+	}
+
+	// Fail early for an invalid module
+	if _, err := compileWasm(context.Background(), path); err != nil {
+		return err
+	}
+
+	if err := lib.RegisterInputConfigCreator(name, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newWasmIn(name, path, action, data)
+	}); err != nil {
+		return fmt.Errorf("type %s of input: %w", name, err)
+	}
+	lib.RegisterInputConverter(name, &wasmIn{
+		Description: "WASM plugin " + filepath.Base(path),
+	})
+	lib.RegisterInputArgs(name, wasmInArgs{})
+
+	if err := lib.RegisterOutputConfigCreator(name, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newWasmOut(name, path, action, data)
+	}); err != nil {
+		return fmt.Errorf("type %s of output: %w", name, err)
+	}
+	lib.RegisterOutputConverter(name, &wasmOut{
+		Description: "WASM plugin " + filepath.Base(path),
+	})
+	lib.RegisterOutputArgs(name, wasmOutArgs{})
+
+	wasmMu.Lock()
+	wasmPlugins[key] = path
+	wasmMu.Unlock()
+
+	return nil
+}
+
+// wasmCommand is the WASM plugin to run, shared by the input and output
+type wasmCommand struct {
+	Module  string
+	Timeout time.Duration
+}
+
+func newWasmCommand(iType, path string, action lib.Action, module, timeout string) (*wasmCommand, error) {
+	switch {
+	case path != "" && module != "":
+		return nil, fmt.Errorf("❌ [type %s | action %s] module must not be specified for plugin", iType, action)
+	case path == "" && module == "":
+		return nil, fmt.Errorf("❌ [type %s | action %s] module must be specified", iType, action)
+	case path == "":
+		path = module
+	}
+
+	c := &wasmCommand{Module: path}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid timeout %s", iType, action, timeout)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// run runs the WASM module as a WASI command. The module has no access to the
+// network, and to files other than the input and output directory if specified.
+func (c *wasmCommand) run(ctx context.Context, action lib.Action, stdin io.Reader, stdout io.Writer, inputDir, outputDir string) error {
+	compiled, err := compileWasm(ctx, c.Module)
+	if err != nil {
+		return err
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	fsConfig := wazero.NewFSConfig()
+	if inputDir != "" {
+		fsConfig = fsConfig.WithReadOnlyDirMount(inputDir, wasmInputDir)
+	}
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return err
+		}
+		fsConfig = fsConfig.WithDirMount(outputDir, wasmOutputDir)
+	}
+
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(filepath.Base(c.Module)).
+		WithEnv("GEOIP_PLUGIN_PROTOCOL", strconv.Itoa(protocolVersion)).
+		WithEnv("GEOIP_PLUGIN_ACTION", string(action)).
+		WithStdin(stdin).
+		WithStdout(stdout).
+		WithStderr(os.Stderr).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+
+	module, err := wasmRuntime.InstantiateModule(ctx, compiled, config)
+	if module != nil {
+		module.Close(ctx)
+	}
+
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if exitErr.ExitCode() != 0 {
+			return fmt.Errorf("exited with status %d", exitErr.ExitCode())
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const descWasmIn = "Run a WASM plugin in a sandbox to load lists, which writes them in JSON lines to stdout"
+
+func init() {
+	lib.RegisterInputConfigCreator(typeWasm, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newWasmIn(typeWasm, "", action, data)
+	})
+	lib.RegisterInputConverter(typeWasm, &wasmIn{
+		Description: descWasmIn,
+	})
+	lib.RegisterInputArgs(typeWasm, wasmInArgs{})
+}
+
+// wasmInArgs are the args of the input converter in config file
+type wasmInArgs struct {
+	Module     string          `json:"module"`
+	Timeout    string          `json:"timeout"`
+	Config     json.RawMessage `json:"config"`
+	InputDir   string          `json:"inputDir"`
+	Want       []string        `json:"wantedList"`
+	Exclude    []string        `json:"excludedList"`
+	OnlyIPType lib.IPType      `json:"onlyIPType"`
+}
+
+// newWasmIn creates the input of the WASM module in args,
+// or the one of the plugin loaded from the path if not empty
+func newWasmIn(iType, path string, action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp wasmInArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	command, err := newWasmCommand(iType, path, action, strings.TrimSpace(tmp.Module), tmp.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	description := descWasmIn
+	if path != "" {
+		description = "WASM plugin " + filepath.Base(path)
+	}
+
+	want, err := listMatcher(iType, action, tmp.Want, "wantedList")
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := listMatcher(iType, action, tmp.Exclude, "excludedList")
+	if err != nil {
+		return nil, err
+	}
+
+	return &wasmIn{
+		Type:        iType,
+		Action:      action,
+		Description: description,
+		Command:     command,
+		Config:      tmp.Config,
+		InputDir:    strings.TrimSpace(tmp.InputDir),
+		Want:        want,
+		Exclude:     exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type wasmIn struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Command     *wasmCommand
+	Config      json.RawMessage
+	InputDir    string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (w *wasmIn) GetType() string {
+	return w.Type
+}
+
+func (w *wasmIn) GetAction() lib.Action {
+	return w.Action
+}
+
+func (w *wasmIn) GetDescription() string {
+	return w.Description
+}
+
+func (w *wasmIn) IsSourceInput() bool {
+	return true
+}
+
+func (w *wasmIn) Input(container lib.Container) (lib.Container, error) {
+	return w.InputContext(context.Background(), container)
+}
+
+func (w *wasmIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	req, err := json.Marshal(&request{Protocol: protocolVersion, Kind: kindInput, Action: w.Action, Config: w.Config})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	if err := w.Command.run(ctx, w.Action, bytes.NewReader(append(req, '\n')), &stdout, w.InputDir, ""); err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] plugin %s failed: %w", w.Type, w.Action, w.Command.Module, err)
+	}
+
+	entries, err := readLists(&stdout, w.Want, w.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid output of plugin %s: %w", w.Type, w.Action, w.Command.Module, err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", w.Type, w.Action)
+	}
+
+	if err := addEntries(container, w.Action, entries, w.OnlyIPType); err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
@@ -0,0 +1,120 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const descWasmOut = "Run a WASM plugin in a sandbox to write lists, which are passed in JSON lines to stdin"
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeWasm, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newWasmOut(typeWasm, "", action, data)
+	})
+	lib.RegisterOutputConverter(typeWasm, &wasmOut{
+		Description: descWasmOut,
+	})
+	lib.RegisterOutputArgs(typeWasm, wasmOutArgs{})
+}
+
+// wasmOutArgs are the args of the output converter in config file
+type wasmOutArgs struct {
+	Module     string          `json:"module"`
+	Timeout    string          `json:"timeout"`
+	Config     json.RawMessage `json:"config"`
+	OutputDir  string          `json:"outputDir"`
+	Want       []string        `json:"wantedList"`
+	Exclude    []string        `json:"excludedList"`
+	OnlyIPType lib.IPType      `json:"onlyIPType"`
+}
+
+// newWasmOut creates the output of the WASM module in args,
+// or the one of the plugin loaded from the path if not empty
+func newWasmOut(iType, path string, action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp wasmOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	command, err := newWasmCommand(iType, path, action, strings.TrimSpace(tmp.Module), tmp.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	description := descWasmOut
+	if path != "" {
+		description = "WASM plugin " + filepath.Base(path)
+	}
+
+	return &wasmOut{
+		Type:        iType,
+		Action:      action,
+		Description: description,
+		Command:     command,
+		Config:      tmp.Config,
+		OutputDir:   strings.TrimSpace(tmp.OutputDir),
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type wasmOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Command     *wasmCommand
+	Config      json.RawMessage
+	OutputDir   string
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (w *wasmOut) GetType() string {
+	return w.Type
+}
+
+func (w *wasmOut) GetAction() lib.Action {
+	return w.Action
+}
+
+func (w *wasmOut) GetDescription() string {
+	return w.Description
+}
+
+func (w *wasmOut) Output(container lib.Container) error {
+	return w.OutputContext(context.Background(), container)
+}
+
+// OutputContext runs the plugin with the request and all lists in stdin,
+// stdout of the plugin is passed through to stderr, the same as its stderr
+func (w *wasmOut) OutputContext(ctx context.Context, container lib.Container) error {
+	stdin, lists := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		req := &request{Protocol: protocolVersion, Kind: kindOutput, Action: w.Action, Config: w.Config}
+		err := writeLists(lists, w.Type, req, container, filterAndSortList(container, w.Want, w.Exclude), w.OnlyIPType)
+		lists.CloseWithError(err)
+		written <- err
+	}()
+
+	err := w.Command.run(ctx, w.Action, stdin, os.Stderr, "", w.OutputDir)
+	// Unblock writing lists if the plugin exits before reading all of them
+	stdin.Close()
+	writeErr := <-written
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] plugin %s failed: %w", w.Type, w.Action, w.Command.Module, err)
+	}
+	return writeErr
+}
@@ -0,0 +1,368 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeCloudArmorOut = "gcpCloudArmor"
+	descCloudArmorOut = "Convert data to GCP Cloud Armor security policy rules"
+)
+
+const (
+	formatJSON      = "json"
+	formatGcloud    = "gcloud"
+	formatTerraform = "terraform"
+)
+
+var (
+	defaultOutputDir     = filepath.Join("./", "output", "cloudarmor")
+	defaultRuleAction    = "deny-403"
+	defaultStartPriority = 1000
+	maxRangesPerRule     = 10 // the max src-ip-ranges of a basic match rule allowed by Cloud Armor
+
+	ruleActions = map[string]string{
+		"allow":    "allow",
+		"deny-403": "deny(403)",
+		"deny-404": "deny(404)",
+		"deny-502": "deny(502)",
+	}
+	formatExtensions = map[string]string{
+		formatJSON:      ".json",
+		formatGcloud:    ".sh",
+		formatTerraform: ".tf",
+	}
+
+	invalidResourceNameChar = regexp.MustCompile(`[^a-z0-9_]`)
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeCloudArmorOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newCloudArmorOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeCloudArmorOut, &cloudArmorOut{
+		Description: descCloudArmorOut,
+	})
+	lib.RegisterOutputArgs(typeCloudArmorOut, cloudArmorOutArgs{})
+}
+
+// cloudArmorOutArgs are the args of the output converter in config file
+type cloudArmorOutArgs struct {
+	OutputDir      string     `json:"outputDir"`
+	Format         string     `json:"format"`
+	SecurityPolicy string     `json:"securityPolicy"`
+	Project        string     `json:"project"`
+	RuleAction     string     `json:"ruleAction"`
+	StartPriority  int        `json:"startPriority"`
+	Preview        bool       `json:"preview"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newCloudArmorOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp cloudArmorOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	if tmp.Format == "" {
+		tmp.Format = formatJSON
+	}
+	if _, found := formatExtensions[tmp.Format]; !found {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be json, gcloud or terraform", typeCloudArmorOut, action, tmp.Format)
+	}
+
+	if tmp.SecurityPolicy == "" && tmp.Format != formatJSON {
+		return nil, fmt.Errorf("❌ [type %s | action %s] securityPolicy must be specified for format %s", typeCloudArmorOut, action, tmp.Format)
+	}
+
+	tmp.RuleAction = strings.ToLower(strings.TrimSpace(tmp.RuleAction))
+	if tmp.RuleAction == "" {
+		tmp.RuleAction = defaultRuleAction
+	}
+	if _, found := ruleActions[tmp.RuleAction]; !found {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid ruleAction %s, the value must be allow, deny-403, deny-404 or deny-502", typeCloudArmorOut, action, tmp.RuleAction)
+	}
+
+	if tmp.StartPriority < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] startPriority must not be negative", typeCloudArmorOut, action)
+	}
+	if tmp.StartPriority == 0 {
+		tmp.StartPriority = defaultStartPriority
+	}
+
+	return &cloudArmorOut{
+		Type:           typeCloudArmorOut,
+		Action:         action,
+		Description:    descCloudArmorOut,
+		OutputDir:      tmp.OutputDir,
+		Format:         tmp.Format,
+		SecurityPolicy: tmp.SecurityPolicy,
+		Project:        tmp.Project,
+		RuleAction:     tmp.RuleAction,
+		StartPriority:  tmp.StartPriority,
+		Preview:        tmp.Preview,
+		Want:           tmp.Want,
+		Exclude:        tmp.Exclude,
+		OnlyIPType:     tmp.OnlyIPType,
+	}, nil
+}
+
+type cloudArmorOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	OutputDir      string
+	Format         string
+	SecurityPolicy string
+	Project        string
+	RuleAction     string
+	StartPriority  int
+	Preview        bool
+	Want           []string
+	Exclude        []string
+	OnlyIPType     lib.IPType
+}
+
+type rule struct {
+	Priority    int       `json:"priority"`
+	Description string    `json:"description"`
+	Action      string    `json:"action"`
+	Preview     bool      `json:"preview"`
+	Match       ruleMatch `json:"match"`
+
+	name string // name of the list the rule is generated from
+	part int
+}
+
+type ruleMatch struct {
+	VersionedExpr string `json:"versionedExpr"`
+	Config        struct {
+		SrcIPRanges []string `json:"srcIpRanges"`
+	} `json:"config"`
+}
+
+func (c *cloudArmorOut) GetType() string {
+	return c.Type
+}
+
+func (c *cloudArmorOut) GetAction() lib.Action {
+	return c.Action
+}
+
+func (c *cloudArmorOut) GetDescription() string {
+	return c.Description
+}
+
+func (c *cloudArmorOut) Output(container lib.Container) error {
+	// Priorities keep increasing across lists since they share the same security policy
+	priority := c.StartPriority
+
+	for _, name := range c.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", c.Type, "entry", name)
+			continue
+		}
+
+		cidrList, err := c.marshalText(entry)
+		if err != nil {
+			return err
+		}
+
+		rules := c.generateRules(entry.GetName(), cidrList, priority)
+		priority += len(rules)
+
+		var data []byte
+		switch c.Format {
+		case formatJSON:
+			data, err = c.marshalJSON(rules)
+		case formatGcloud:
+			data = c.marshalGcloud(rules)
+		case formatTerraform:
+			data = c.marshalTerraform(rules)
+		}
+		if err != nil {
+			return err
+		}
+
+		filename := strings.ToLower(entry.GetName()) + formatExtensions[c.Format]
+		if err := c.writeFile(filename, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cloudArmorOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(c.Exclude)
+
+	wantList := make([]string, 0, len(c.Want))
+	for _, want := range lib.ExpandWantedList(container, c.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(c.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (c *cloudArmorOut) marshalText(entry *lib.Entry) ([]string, error) {
+	switch c.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalText()
+	}
+}
+
+// generateRules chunks the CIDR list into rules with at most 10 ranges each
+func (c *cloudArmorOut) generateRules(name string, cidrList []string, priority int) []*rule {
+	parts := (len(cidrList) + maxRangesPerRule - 1) / maxRangesPerRule
+	rules := make([]*rule, 0, parts)
+
+	for i := 0; i < parts; i++ {
+		r := &rule{
+			Priority:    priority + i,
+			Description: fmt.Sprintf("geoip %s (%d/%d)", name, i+1, parts),
+			Action:      ruleActions[c.RuleAction],
+			Preview:     c.Preview,
+			name:        name,
+			part:        i + 1,
+		}
+		r.Match.VersionedExpr = "SRC_IPS_V1"
+		r.Match.Config.SrcIPRanges = cidrList[i*maxRangesPerRule : min((i+1)*maxRangesPerRule, len(cidrList))]
+		rules = append(rules, r)
+	}
+
+	return rules
+}
+
+func (c *cloudArmorOut) marshalJSON(rules []*rule) ([]byte, error) {
+	data, err := json.MarshalIndent(struct {
+		Rules []*rule `json:"rules"`
+	}{
+		Rules: rules,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (c *cloudArmorOut) marshalGcloud(rules []*rule) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/sh\nset -e\n\n")
+	for _, r := range rules {
+		buf.WriteString("gcloud compute security-policies rules create ")
+		buf.WriteString(strconv.Itoa(r.Priority))
+		buf.WriteString(" \\\n  --security-policy=")
+		buf.WriteString(quoteShell(c.SecurityPolicy))
+		if c.Project != "" {
+			buf.WriteString(" \\\n  --project=")
+			buf.WriteString(quoteShell(c.Project))
+		}
+		buf.WriteString(" \\\n  --description=")
+		buf.WriteString(quoteShell(r.Description))
+		buf.WriteString(" \\\n  --src-ip-ranges=")
+		buf.WriteString(quoteShell(strings.Join(r.Match.Config.SrcIPRanges, ",")))
+		buf.WriteString(" \\\n  --action=")
+		buf.WriteString(quoteShell(c.RuleAction))
+		if c.Preview {
+			buf.WriteString(" \\\n  --preview")
+		}
+		buf.WriteString("\n\n")
+	}
+	return buf.Bytes()
+}
+
+// quoteShell single-quotes the argument of the generated shell script,
+// so that no character of it is expanded by the shell
+func quoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (c *cloudArmorOut) marshalTerraform(rules []*rule) []byte {
+	var buf bytes.Buffer
+	for _, r := range rules {
+		resourceName := invalidResourceNameChar.ReplaceAllString(fmt.Sprintf("geoip_%s_%d", strings.ToLower(r.name), r.part), "_")
+		fmt.Fprintf(&buf, "resource \"google_compute_security_policy_rule\" %s {\n", lib.QuoteHCL(resourceName))
+		if c.Project != "" {
+			fmt.Fprintf(&buf, "  project         = %s\n", lib.QuoteHCL(c.Project))
+		}
+		fmt.Fprintf(&buf, "  security_policy = %s\n", lib.QuoteHCL(c.SecurityPolicy))
+		fmt.Fprintf(&buf, "  priority        = %d\n", r.Priority)
+		fmt.Fprintf(&buf, "  description     = %s\n", lib.QuoteHCL(r.Description))
+		fmt.Fprintf(&buf, "  action          = %s\n", lib.QuoteHCL(r.Action))
+		fmt.Fprintf(&buf, "  preview         = %t\n", r.Preview)
+		buf.WriteString("\n  match {\n")
+		fmt.Fprintf(&buf, "    versioned_expr = %s\n", lib.QuoteHCL(r.Match.VersionedExpr))
+		buf.WriteString("    config {\n")
+		buf.WriteString("      src_ip_ranges = [\n")
+		for _, cidr := range r.Match.Config.SrcIPRanges {
+			fmt.Fprintf(&buf, "        %s,\n", lib.QuoteHCL(cidr))
+		}
+		buf.WriteString("      ]\n    }\n  }\n}\n\n")
+	}
+	return buf.Bytes()
+}
+
+func (c *cloudArmorOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(c.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", c.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package geojson
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeGeoJSONOut = "geojson"
+	descGeoJSONOut = "Convert data to GeoJSON features located at country centroids"
+)
+
+var (
+	defaultOutputDir  = filepath.Join("./", "output", "geojson")
+	defaultOutputName = "geoip.geojson"
+	defaultSampleSize = 5
+
+	// centroids.csv contains approximate centroids of ISO 3166-1 countries
+	// and territories in "code,latitude,longitude" format
+	//go:embed centroids.csv
+	centroidsCSV []byte
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeGeoJSONOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newGeoJSONOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeGeoJSONOut, &geoJSONOut{
+		Description: descGeoJSONOut,
+	})
+	lib.RegisterOutputArgs(typeGeoJSONOut, geoJSONOutArgs{})
+}
+
+// geoJSONOutArgs are the args of the output converter in config file
+type geoJSONOutArgs struct {
+	OutputName     string     `json:"outputName"`
+	OutputDir      string     `json:"outputDir"`
+	LocationsFile  string     `json:"locationsFile"`
+	SampleSize     *int       `json:"sampleSize"`
+	IncludeUnknown bool       `json:"includeUnknown"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newGeoJSONOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp geoJSONOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	sampleSize := defaultSampleSize
+	if tmp.SampleSize != nil {
+		if *tmp.SampleSize < 0 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] sampleSize must not be negative", typeGeoJSONOut, action)
+		}
+		sampleSize = *tmp.SampleSize
+	}
+
+	locations, err := parseLocations(bytes.NewReader(centroidsCSV))
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] failed to parse built-in centroids: %v", typeGeoJSONOut, action, err)
+	}
+
+	// Locations from the file override the built-in ones
+	if tmp.LocationsFile != "" {
+		f, err := os.Open(tmp.LocationsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		custom, err := parseLocations(f)
+		if err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] failed to parse locationsFile %s: %v", typeGeoJSONOut, action, tmp.LocationsFile, err)
+		}
+		for code, loc := range custom {
+			locations[code] = loc
+		}
+	}
+
+	return &geoJSONOut{
+		Type:           typeGeoJSONOut,
+		Action:         action,
+		Description:    descGeoJSONOut,
+		OutputName:     tmp.OutputName,
+		OutputDir:      tmp.OutputDir,
+		SampleSize:     sampleSize,
+		IncludeUnknown: tmp.IncludeUnknown,
+		Want:           tmp.Want,
+		Exclude:        tmp.Exclude,
+		OnlyIPType:     tmp.OnlyIPType,
+
+		locations: locations,
+	}, nil
+}
+
+// parseLocations parses "code,latitude,longitude" lines, codes are uppercased
+func parseLocations(r io.Reader) (map[string][2]float64, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string][2]float64, len(records))
+	for _, record := range records {
+		code := strings.ToUpper(strings.TrimSpace(record[0]))
+		lat, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("invalid latitude %s of %s", record[1], code)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("invalid longitude %s of %s", record[2], code)
+		}
+		locations[code] = [2]float64{lat, lon}
+	}
+
+	return locations, nil
+}
+
+type geoJSONOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	OutputName     string
+	OutputDir      string
+	SampleSize     int
+	IncludeUnknown bool
+	Want           []string
+	Exclude        []string
+	OnlyIPType     lib.IPType
+
+	locations map[string][2]float64
+}
+
+type featureCollection struct {
+	Type     string     `json:"type"`
+	Features []*feature `json:"features"`
+}
+
+type feature struct {
+	Type       string      `json:"type"`
+	ID         string      `json:"id"`
+	Geometry   *geometry   `json:"geometry"` // null for lists without a location
+	Properties *properties `json:"properties"`
+}
+
+type geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // longitude, latitude
+}
+
+type properties struct {
+	Name          string   `json:"name"`
+	IPv4Prefixes  int      `json:"ipv4Prefixes"`
+	IPv6Prefixes  int      `json:"ipv6Prefixes"`
+	IPv4Addresses uint64   `json:"ipv4Addresses"`
+	IPv6Addresses float64  `json:"ipv6Addresses"`
+	SampleCIDRs   []string `json:"sampleCIDRs"`
+}
+
+func (g *geoJSONOut) GetType() string {
+	return g.Type
+}
+
+func (g *geoJSONOut) GetAction() lib.Action {
+	return g.Action
+}
+
+func (g *geoJSONOut) GetDescription() string {
+	return g.Description
+}
+
+func (g *geoJSONOut) Output(container lib.Container) error {
+	collection := &featureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]*feature, 0, 300),
+	}
+
+	for _, name := range g.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", g.Type, "entry", name)
+			continue
+		}
+
+		loc, located := g.locations[entry.GetName()]
+		if !located && !g.IncludeUnknown {
+			continue
+		}
+
+		prefixes, err := g.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		f := &feature{
+			Type:       "Feature",
+			ID:         entry.GetName(),
+			Properties: g.generateProperties(strings.ToLower(entry.GetName()), prefixes),
+		}
+		if located {
+			f.Geometry = &geometry{
+				Type:        "Point",
+				Coordinates: [2]float64{loc[1], loc[0]},
+			}
+		}
+		collection.Features = append(collection.Features, f)
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+
+	return g.writeFile(g.OutputName, data)
+}
+
+func (g *geoJSONOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(g.Exclude)
+
+	wantList := make([]string, 0, len(g.Want))
+	for _, want := range lib.ExpandWantedList(container, g.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(g.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (g *geoJSONOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// generateProperties counts prefixes and addresses, and picks the largest
+// prefixes as samples since they are the most representative ones
+func (g *geoJSONOut) generateProperties(name string, prefixes []netip.Prefix) *properties {
+	p := &properties{
+		Name:        name,
+		SampleCIDRs: make([]string, 0, g.SampleSize),
+	}
+
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			p.IPv4Prefixes++
+			p.IPv4Addresses += 1 << (32 - prefix.Bits())
+		} else {
+			p.IPv6Prefixes++
+			p.IPv6Addresses += math.Exp2(float64(128 - prefix.Bits()))
+		}
+	}
+
+	samples := slices.Clone(prefixes)
+	slices.SortStableFunc(samples, func(a, b netip.Prefix) int {
+		return (b.Addr().BitLen() - b.Bits()) - (a.Addr().BitLen() - a.Bits())
+	})
+	for _, prefix := range samples[:min(g.SampleSize, len(samples))] {
+		p.SampleCIDRs = append(p.SampleCIDRs, prefix.String())
+	}
+
+	return p
+}
+
+func (g *geoJSONOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(g.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", g.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	apiEndpoint = "https://api.github.com"
+
+	errNotFound = errors.New("not found")
+)
+
+type client struct {
+	token      string
+	repository string
+	apiURL     string
+	httpClient *http.Client
+}
+
+// newClient uses the token and repository in config first, then falls back to
+// GITHUB_TOKEN and GITHUB_REPOSITORY environment variables, which are set in GitHub Actions
+func newClient(token, repository, apiURL string) (*client, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("missing GitHub token, set token in config or GITHUB_TOKEN in environment")
+	}
+
+	repository = strings.TrimSpace(repository)
+	if repository == "" {
+		repository = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if owner, name, found := strings.Cut(repository, "/"); !found || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid GitHub repository %q, set repository in config or GITHUB_REPOSITORY in environment like owner/name", repository)
+	}
+
+	apiURL = strings.TrimSuffix(strings.TrimSpace(apiURL), "/")
+	if apiURL == "" {
+		apiURL = apiEndpoint
+	}
+
+	return &client{
+		token:      token,
+		repository: repository,
+		apiURL:     apiURL,
+		// Uploads of large assets take a while
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+type release struct {
+	ID        int64    `json:"id"`
+	TagName   string   `json:"tag_name"`
+	Draft     bool     `json:"draft"`
+	HTMLURL   string   `json:"html_url"`
+	UploadURL string   `json:"upload_url"`
+	Assets    []*asset `json:"assets"`
+}
+
+type asset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type releaseRequest struct {
+	TagName         string `json:"tag_name,omitempty"`
+	TargetCommitish string `json:"target_commitish,omitempty"`
+	Name            string `json:"name"`
+	Body            string `json:"body"`
+	Draft           bool   `json:"draft"`
+	Prerelease      bool   `json:"prerelease"`
+}
+
+// getRelease returns the release of the tag, including drafts, which are not found by tags
+func (c *client) getRelease(ctx context.Context, tag string) (*release, error) {
+	r := new(release)
+	err := c.do(ctx, http.MethodGet, c.repoURL("/releases/tags/"+url.PathEscape(tag)), "", nil, r)
+	if !errors.Is(err, errNotFound) {
+		return r, err
+	}
+
+	var releases []*release
+	if err := c.do(ctx, http.MethodGet, c.repoURL("/releases?per_page=100"), "", nil, &releases); err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		if r.Draft && r.TagName == tag {
+			return r, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (c *client) createRelease(ctx context.Context, req *releaseRequest) (*release, error) {
+	r := new(release)
+	return r, c.doJSON(ctx, http.MethodPost, c.repoURL("/releases"), req, r)
+}
+
+func (c *client) updateRelease(ctx context.Context, id int64, req *releaseRequest) (*release, error) {
+	r := new(release)
+	return r, c.doJSON(ctx, http.MethodPatch, c.repoURL(fmt.Sprintf("/releases/%d", id)), req, r)
+}
+
+func (c *client) deleteAsset(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, c.repoURL(fmt.Sprintf("/releases/assets/%d", id)), "", nil, nil)
+}
+
+// uploadAsset uploads the data as an asset of the release, which is read into
+// memory as uploads require the length of the content
+func (c *client) uploadAsset(ctx context.Context, r *release, name string, data []byte) error {
+	// The upload URL is a URI template like https://uploads.github.com/repos/o/r/releases/1/assets{?name,label}
+	uploadURL, _, _ := strings.Cut(r.UploadURL, "{")
+	return c.do(ctx, http.MethodPost, uploadURL+"?name="+url.QueryEscape(name), "application/octet-stream", bytes.NewReader(data), nil)
+}
+
+func (c *client) repoURL(path string) string {
+	return c.apiURL + "/repos/" + c.repository + path
+}
+
+func (c *client) doJSON(ctx context.Context, method, url string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, url, "application/json", bytes.NewReader(data), out)
+}
+
+// do sends a request to the GitHub API and decodes the JSON response into out if not nil.
+// It returns an error wrapping errNotFound if the status code is 404.
+func (c *client) do(ctx context.Context, method, url, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("failed to call GitHub API %s %s: %w", method, url, errNotFound)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+		return fmt.Errorf("failed to call GitHub API %s %s, http status code %d: %s", method, url, resp.StatusCode, apiErr.Message)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode GitHub API response of %s %s: %w", method, url, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeReleaseOut = "githubRelease"
+	descReleaseOut = "Publish output files to a GitHub release, created or updated by tag"
+)
+
+var (
+	defaultReleaseInputDir     = filepath.Join("./", "output")
+	defaultReleaseChecksumName = "sha256sums.txt"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeReleaseOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newReleaseOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeReleaseOut, &releaseOut{
+		Description: descReleaseOut,
+	})
+	lib.RegisterOutputArgs(typeReleaseOut, releaseOutArgs{})
+}
+
+// releaseOutArgs are the args of the output converter in config file
+type releaseOutArgs struct {
+	Token           string   `json:"token"`
+	Repository      string   `json:"repository"`
+	APIURL          string   `json:"apiURL"`
+	Tag             string   `json:"tag"`
+	Name            string   `json:"name"`
+	TargetCommitish string   `json:"targetCommitish"`
+	Draft           bool     `json:"draft"`
+	Prerelease      bool     `json:"prerelease"`
+	InputDir        string   `json:"inputDir"`
+	Files           []string `json:"files"`
+	Checksums       *bool    `json:"checksums"`
+	ChecksumName    string   `json:"checksumName"`
+	Notes           string   `json:"notes"`
+	ReportNotes     *bool    `json:"reportNotes"`
+	PreviousReport  string   `json:"previousReport"`
+	DryRun          bool     `json:"dryRun"`
+}
+
+func newReleaseOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp releaseOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := newClient(tmp.Token, tmp.Repository, tmp.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeReleaseOut, action, err)
+	}
+
+	if tmp.Tag = strings.TrimSpace(tmp.Tag); tmp.Tag == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] tag must be specified in config", typeReleaseOut, action)
+	}
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultReleaseInputDir
+	}
+
+	for _, pattern := range tmp.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid pattern %s in files: %v", typeReleaseOut, action, pattern, err)
+		}
+	}
+
+	checksums := true
+	if tmp.Checksums != nil {
+		checksums = *tmp.Checksums
+	}
+	if tmp.ChecksumName == "" {
+		tmp.ChecksumName = defaultReleaseChecksumName
+	}
+
+	reportNotes := true
+	if tmp.ReportNotes != nil {
+		reportNotes = *tmp.ReportNotes
+	}
+
+	return &releaseOut{
+		Type:            typeReleaseOut,
+		Action:          action,
+		Description:     descReleaseOut,
+		Repository:      c.repository,
+		Tag:             tmp.Tag,
+		Name:            tmp.Name,
+		TargetCommitish: tmp.TargetCommitish,
+		Draft:           tmp.Draft,
+		Prerelease:      tmp.Prerelease,
+		InputDir:        tmp.InputDir,
+		Files:           tmp.Files,
+		Checksums:       checksums,
+		ChecksumName:    tmp.ChecksumName,
+		Notes:           tmp.Notes,
+		ReportNotes:     reportNotes,
+		PreviousReport:  tmp.PreviousReport,
+		DryRun:          tmp.DryRun,
+
+		client: c,
+	}, nil
+}
+
+type releaseOut struct {
+	Type            string
+	Action          lib.Action
+	Description     string
+	Repository      string
+	Tag             string
+	Name            string
+	TargetCommitish string
+	Draft           bool
+	Prerelease      bool
+	InputDir        string
+	Files           []string
+	Checksums       bool
+	ChecksumName    string
+	Notes           string
+	ReportNotes     bool
+	PreviousReport  string
+	DryRun          bool
+
+	client *client
+}
+
+// releaseAsset is a file to upload, named after its base name
+type releaseAsset struct {
+	name string
+	data []byte
+}
+
+func (r *releaseOut) GetType() string {
+	return r.Type
+}
+
+func (r *releaseOut) GetAction() lib.Action {
+	return r.Action
+}
+
+func (r *releaseOut) GetDescription() string {
+	return r.Description
+}
+
+func (r *releaseOut) Output(container lib.Container) error {
+	return r.OutputContext(context.Background(), container)
+}
+
+// OutputContext uploads files written by previous outputs in InputDir to the
+// release of the tag, with the report of lists in the container as release notes
+func (r *releaseOut) OutputContext(ctx context.Context, container lib.Container) error {
+	tag, err := lib.ExpandBuildTemplate(r.Tag)
+	if err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] %v", r.Type, r.Action, err)
+	}
+	name := tag
+	if r.Name != "" {
+		if name, err = lib.ExpandBuildTemplate(r.Name); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] %v", r.Type, r.Action, err)
+		}
+	}
+
+	assets, err := r.readAssets()
+	if err != nil {
+		return err
+	}
+
+	body, err := r.releaseNotes(container)
+	if err != nil {
+		return err
+	}
+
+	if r.DryRun {
+		for _, asset := range assets {
+			slog.Info("dry run: asset would be uploaded", "plugin", r.Type, "repository", r.Repository, "tag", tag, "asset", asset.name, "bytes", len(asset.data))
+		}
+		return nil
+	}
+
+	req := &releaseRequest{
+		TargetCommitish: r.TargetCommitish,
+		Name:            name,
+		Body:            body,
+		Draft:           r.Draft,
+		Prerelease:      r.Prerelease,
+	}
+	rel, err := r.client.getRelease(ctx, tag)
+	switch {
+	case errors.Is(err, errNotFound):
+		req.TagName = tag
+		rel, err = r.client.createRelease(ctx, req)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] failed to create release %s: %v", r.Type, r.Action, tag, err)
+		}
+		slog.Info("release created", "plugin", r.Type, "repository", r.Repository, "tag", tag)
+	case err != nil:
+		return fmt.Errorf("❌ [type %s | action %s] failed to get release %s: %v", r.Type, r.Action, tag, err)
+	default:
+		// The assets of the existing release are kept to be replaced by name
+		existing := rel.Assets
+		rel, err = r.client.updateRelease(ctx, rel.ID, req)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] failed to update release %s: %v", r.Type, r.Action, tag, err)
+		}
+		rel.Assets = existing
+		slog.Info("release updated", "plugin", r.Type, "repository", r.Repository, "tag", tag)
+	}
+
+	for _, asset := range assets {
+		// Assets are unique by name, so the existing one is replaced
+		for _, existing := range rel.Assets {
+			if existing.Name == asset.name {
+				if err := r.client.deleteAsset(ctx, existing.ID); err != nil {
+					return fmt.Errorf("❌ [type %s | action %s] failed to delete asset %s: %v", r.Type, r.Action, asset.name, err)
+				}
+			}
+		}
+		if err := r.client.uploadAsset(ctx, rel, asset.name, asset.data); err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] failed to upload asset %s: %v", r.Type, r.Action, asset.name, err)
+		}
+		slog.Info("asset uploaded", "plugin", r.Type, "tag", tag, "asset", asset.name, "bytes", len(asset.data))
+	}
+
+	slog.Info("release published", "plugin", r.Type, "url", rel.HTMLURL, "assets", len(assets))
+	return nil
+}
+
+// readAssets reads the files in InputDir matching the patterns of files, and
+// the checksum file of them if enabled, sorted by name
+func (r *releaseOut) readAssets() ([]*releaseAsset, error) {
+	assets := make([]*releaseAsset, 0)
+	err := filepath.WalkDir(r.InputDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(r.InputDir, file)
+		if err != nil {
+			return err
+		}
+		if !r.matchFile(filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		assets = append(assets, &releaseAsset{name: filepath.Base(file), data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no file found in %s", r.Type, r.Action, r.InputDir)
+	}
+
+	slices.SortFunc(assets, func(a, b *releaseAsset) int {
+		return strings.Compare(a.name, b.name)
+	})
+	for i := 1; i < len(assets); i++ {
+		if assets[i].name == assets[i-1].name {
+			return nil, fmt.Errorf("❌ [type %s | action %s] files of assets must have unique names, %s is duplicated", r.Type, r.Action, assets[i].name)
+		}
+	}
+
+	if r.Checksums {
+		// The format is the same as the output of sha256sum
+		var checksums bytes.Buffer
+		for _, asset := range assets {
+			if asset.name == r.ChecksumName {
+				return nil, fmt.Errorf("❌ [type %s | action %s] file %s has the same name as the checksum file", r.Type, r.Action, asset.name)
+			}
+			sum := sha256.Sum256(asset.data)
+			checksums.WriteString(hex.EncodeToString(sum[:]) + "  " + asset.name + "\n")
+		}
+		assets = append(assets, &releaseAsset{name: r.ChecksumName, data: checksums.Bytes()})
+	}
+
+	return assets, nil
+}
+
+// matchFile reports whether the file relative to InputDir matches any pattern
+// of files, by its path or its base name. All files match without patterns.
+func (r *releaseOut) matchFile(file string) bool {
+	if len(r.Files) == 0 {
+		return true
+	}
+	for _, pattern := range r.Files {
+		if ok, _ := path.Match(pattern, file); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(file)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseNotes returns the notes followed by the report of lists in the container,
+// compared with the previous report if any
+func (r *releaseOut) releaseNotes(container lib.Container) (string, error) {
+	var b strings.Builder
+	b.WriteString(r.Notes)
+	if !r.ReportNotes {
+		return b.String(), nil
+	}
+
+	report := lib.NewBuildReport(container)
+	if r.PreviousReport != "" {
+		previous, err := lib.ReadBuildReport(r.PreviousReport)
+		if err != nil {
+			return "", fmt.Errorf("❌ [type %s | action %s] %v", r.Type, r.Action, err)
+		}
+		report.Compare(previous)
+	}
+
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+	if err := report.WriteMarkdown(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,295 @@
+package keenetic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeCLIOut = "keeneticCLI"
+	descCLIOut = "Convert data to Keenetic router CLI commands"
+)
+
+const (
+	modeRoute       = "route"
+	modeObjectGroup = "objectGroup"
+)
+
+var (
+	defaultOutputDir = filepath.Join("./", "output", "keenetic")
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeCLIOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newCLIOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeCLIOut, &cliOut{
+		Description: descCLIOut,
+	})
+	lib.RegisterOutputArgs(typeCLIOut, cliOutArgs{})
+}
+
+// cliOutArgs are the args of the output converter in config file
+type cliOutArgs struct {
+	OutputDir   string     `json:"outputDir"`
+	OutputExt   string     `json:"outputExtension"`
+	Mode        string     `json:"mode"`
+	Interface   string     `json:"interface"`
+	Gateway     string     `json:"gateway"`
+	Auto        *bool      `json:"auto"`
+	GroupPrefix string     `json:"groupPrefix"`
+	SaveConfig  bool       `json:"saveConfig"`
+	Want        []string   `json:"wantedList"`
+	Exclude     []string   `json:"excludedList"`
+	OnlyIPType  lib.IPType `json:"onlyIPType"`
+}
+
+func newCLIOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp cliOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.OutputExt == "" {
+		tmp.OutputExt = ".txt"
+	}
+
+	switch tmp.Mode {
+	case "":
+		tmp.Mode = modeRoute
+	case modeRoute, modeObjectGroup:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid mode %s, the value must be route or objectGroup", typeCLIOut, action, tmp.Mode)
+	}
+
+	if tmp.Mode == modeRoute {
+		if (tmp.Interface == "") == (tmp.Gateway == "") {
+			return nil, fmt.Errorf("❌ [type %s | action %s] one of interface and gateway must be specified in route mode", typeCLIOut, action)
+		}
+		if tmp.Gateway != "" {
+			gateway, err := netip.ParseAddr(tmp.Gateway)
+			if err != nil {
+				return nil, fmt.Errorf("❌ [type %s | action %s] invalid gateway %s: %v", typeCLIOut, action, tmp.Gateway, err)
+			}
+			// A gateway only routes addresses of its own family
+			if gateway.Is4() {
+				tmp.OnlyIPType = lib.IPv4
+			} else {
+				tmp.OnlyIPType = lib.IPv6
+			}
+		}
+	}
+
+	auto := true
+	if tmp.Auto != nil {
+		auto = *tmp.Auto
+	}
+
+	return &cliOut{
+		Type:        typeCLIOut,
+		Action:      action,
+		Description: descCLIOut,
+		OutputDir:   tmp.OutputDir,
+		OutputExt:   tmp.OutputExt,
+		Mode:        tmp.Mode,
+		Interface:   tmp.Interface,
+		Gateway:     tmp.Gateway,
+		Auto:        auto,
+		GroupPrefix: tmp.GroupPrefix,
+		SaveConfig:  tmp.SaveConfig,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type cliOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	OutputExt   string
+	Mode        string
+	Interface   string
+	Gateway     string
+	Auto        bool
+	GroupPrefix string
+	SaveConfig  bool
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (c *cliOut) GetType() string {
+	return c.Type
+}
+
+func (c *cliOut) GetAction() lib.Action {
+	return c.Action
+}
+
+func (c *cliOut) GetDescription() string {
+	return c.Description
+}
+
+func (c *cliOut) Output(container lib.Container) error {
+	for _, name := range c.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", c.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := c.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		switch c.Mode {
+		case modeRoute:
+			data = c.marshalRoutes(prefixes)
+		case modeObjectGroup:
+			data = c.marshalObjectGroup(strings.ToLower(entry.GetName()), prefixes)
+		}
+
+		filename := strings.ToLower(entry.GetName()) + c.OutputExt
+		if err := c.writeFile(filename, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cliOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(c.Exclude)
+
+	wantList := make([]string, 0, len(c.Want))
+	for _, want := range lib.ExpandWantedList(container, c.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(c.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (c *cliOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch c.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// marshalRoutes generates static routes. Keenetic expects IPv4 networks
+// with dotted decimal masks, and IPv6 networks in CIDR notation.
+func (c *cliOut) marshalRoutes(prefixes []netip.Prefix) []byte {
+	target := c.Interface
+	if c.Gateway != "" {
+		target = c.Gateway
+	}
+	suffix := ""
+	if c.Auto {
+		suffix = " auto"
+	}
+
+	var buf bytes.Buffer
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			mask := net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+			fmt.Fprintf(&buf, "ip route %s %s %s%s\n", prefix.Addr(), mask, target, suffix)
+		} else {
+			fmt.Fprintf(&buf, "ipv6 route %s %s%s\n", prefix, target, suffix)
+		}
+	}
+	c.writeSave(&buf)
+	return buf.Bytes()
+}
+
+// marshalObjectGroup generates an object group which could be routed by
+// "dns-proxy route object-group", routing is added when interface is specified
+func (c *cliOut) marshalObjectGroup(name string, prefixes []netip.Prefix) []byte {
+	group := c.GroupPrefix + name
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object-group fqdn %s\n", group)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(&buf, "include %s\n", prefix)
+	}
+	buf.WriteString("exit\n")
+
+	if c.Interface != "" {
+		fmt.Fprintf(&buf, "dns-proxy route object-group %s %s", group, c.Interface)
+		if c.Auto {
+			buf.WriteString(" auto")
+		}
+		buf.WriteString("\n")
+	}
+	c.writeSave(&buf)
+	return buf.Bytes()
+}
+
+func (c *cliOut) writeSave(buf *bytes.Buffer) {
+	if c.SaveConfig {
+		buf.WriteString("system configuration save\n")
+	}
+}
+
+func (c *cliOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(c.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", c.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeNetworkPolicyOut = "kubernetesNetworkPolicy"
+	descNetworkPolicyOut = "Convert data to Kubernetes NetworkPolicy or CiliumNetworkPolicy manifests"
+)
+
+const (
+	kindNetworkPolicy       = "NetworkPolicy"
+	kindCiliumNetworkPolicy = "CiliumNetworkPolicy"
+
+	directionEgress  = "egress"
+	directionIngress = "ingress"
+)
+
+var (
+	defaultOutputDir    = filepath.Join("./", "output", "kubernetes")
+	defaultNamePrefix   = "geoip-"
+	defaultMaxCIDRs     = 1000
+	maxPolicyNameLen    = 253
+	maxLabelValueLen    = 63
+	invalidNameChar     = regexp.MustCompile(`[^a-z0-9-]+`)
+	supportedKinds      = []string{kindNetworkPolicy, kindCiliumNetworkPolicy}
+	supportedDirections = []string{directionEgress, directionIngress}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeNetworkPolicyOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newNetworkPolicyOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeNetworkPolicyOut, &networkPolicyOut{
+		Description: descNetworkPolicyOut,
+	})
+	lib.RegisterOutputArgs(typeNetworkPolicyOut, networkPolicyOutArgs{})
+}
+
+// networkPolicyOutArgs are the args of the output converter in config file
+type networkPolicyOutArgs struct {
+	OutputDir   string            `json:"outputDir"`
+	Kind        string            `json:"kind"`
+	Direction   string            `json:"direction"`
+	Deny        bool              `json:"deny"`
+	Namespace   string            `json:"namespace"`
+	NamePrefix  string            `json:"namePrefix"`
+	PodSelector map[string]string `json:"podSelector"`
+	MaxCIDRs    int               `json:"maxCIDRsPerPolicy"`
+	Want        []string          `json:"wantedList"`
+	Exclude     []string          `json:"excludedList"`
+	OnlyIPType  lib.IPType        `json:"onlyIPType"`
+}
+
+func newNetworkPolicyOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp networkPolicyOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.Kind == "" {
+		tmp.Kind = kindNetworkPolicy
+	}
+	if !slices.Contains(supportedKinds, tmp.Kind) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid kind %s, the value must be NetworkPolicy or CiliumNetworkPolicy", typeNetworkPolicyOut, action, tmp.Kind)
+	}
+
+	tmp.Direction = strings.ToLower(strings.TrimSpace(tmp.Direction))
+	if tmp.Direction == "" {
+		tmp.Direction = directionEgress
+	}
+	if !slices.Contains(supportedDirections, tmp.Direction) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid direction %s, the value must be egress or ingress", typeNetworkPolicyOut, action, tmp.Direction)
+	}
+
+	// NetworkPolicy only allows traffic, denying is a feature of Cilium
+	if tmp.Deny && tmp.Kind != kindCiliumNetworkPolicy {
+		return nil, fmt.Errorf("❌ [type %s | action %s] deny is only supported by CiliumNetworkPolicy", typeNetworkPolicyOut, action)
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultNamePrefix
+	}
+
+	if tmp.MaxCIDRs < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxCIDRsPerPolicy must not be negative", typeNetworkPolicyOut, action)
+	}
+	if tmp.MaxCIDRs == 0 {
+		tmp.MaxCIDRs = defaultMaxCIDRs
+	}
+
+	return &networkPolicyOut{
+		Type:        typeNetworkPolicyOut,
+		Action:      action,
+		Description: descNetworkPolicyOut,
+		OutputDir:   tmp.OutputDir,
+		Kind:        tmp.Kind,
+		Direction:   tmp.Direction,
+		Deny:        tmp.Deny,
+		Namespace:   tmp.Namespace,
+		NamePrefix:  tmp.NamePrefix,
+		PodSelector: tmp.PodSelector,
+		MaxCIDRs:    tmp.MaxCIDRs,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type networkPolicyOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	Kind        string
+	Direction   string
+	Deny        bool
+	Namespace   string
+	NamePrefix  string
+	PodSelector map[string]string
+	MaxCIDRs    int
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (n *networkPolicyOut) GetType() string {
+	return n.Type
+}
+
+func (n *networkPolicyOut) GetAction() lib.Action {
+	return n.Action
+}
+
+func (n *networkPolicyOut) GetDescription() string {
+	return n.Description
+}
+
+func (n *networkPolicyOut) Output(container lib.Container) error {
+	for _, name := range n.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", n.Type, "entry", name)
+			continue
+		}
+
+		cidrList, err := n.marshalText(entry)
+		if err != nil {
+			return err
+		}
+
+		// Large lists are chunked across policies, since the size of
+		// a single object stored in etcd is limited
+		chunks, err := lib.SplitLines(cidrList, n.MaxCIDRs, 0)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		for i, chunk := range chunks {
+			policyName := n.policyName(entry.GetName(), "")
+			if len(chunks) > 1 {
+				policyName = n.policyName(entry.GetName(), fmt.Sprintf("-%d", i+1))
+			}
+
+			if i > 0 {
+				buf.WriteString("---\n")
+			}
+			n.writePolicy(&buf, policyName, strings.ToLower(entry.GetName()), chunk)
+		}
+
+		filename := strings.ToLower(entry.GetName()) + ".yaml"
+		if err := n.writeFile(filename, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *networkPolicyOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(n.Exclude)
+
+	wantList := make([]string, 0, len(n.Want))
+	for _, want := range lib.ExpandWantedList(container, n.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(n.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (n *networkPolicyOut) marshalText(entry *lib.Entry) ([]string, error) {
+	switch n.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalText()
+	}
+}
+
+// policyName converts list name to a valid DNS subdomain name. The name is cut
+// before the suffix of the chunk is added, so that chunks get different names.
+func (n *networkPolicyOut) policyName(name, suffix string) string {
+	policyName := invalidNameChar.ReplaceAllString(strings.ToLower(n.NamePrefix+name), "-")
+	if len(policyName) > maxPolicyNameLen-len(suffix) {
+		policyName = policyName[:maxPolicyNameLen-len(suffix)]
+	}
+	return strings.Trim(policyName, "-") + suffix
+}
+
+// labelValue returns the list name as a label value, whose length is limited.
+// Long names are cut and suffixed with their hash, so that they are still unique.
+func labelValue(list string) string {
+	if len(list) <= maxLabelValueLen {
+		return list
+	}
+	sum := sha256.Sum256([]byte(list))
+	hash := hex.EncodeToString(sum[:4])
+	return strings.TrimRight(list[:maxLabelValueLen-len(hash)-1], "-_.") + "-" + hash
+}
+
+func (n *networkPolicyOut) writePolicy(buf *bytes.Buffer, policyName, list string, cidrList []string) {
+	switch n.Kind {
+	case kindNetworkPolicy:
+		buf.WriteString("apiVersion: networking.k8s.io/v1\n")
+	case kindCiliumNetworkPolicy:
+		buf.WriteString("apiVersion: cilium.io/v2\n")
+	}
+	fmt.Fprintf(buf, "kind: %s\n", n.Kind)
+	buf.WriteString("metadata:\n")
+	fmt.Fprintf(buf, "  name: %s\n", policyName)
+	if n.Namespace != "" {
+		fmt.Fprintf(buf, "  namespace: %s\n", n.Namespace)
+	}
+	buf.WriteString("  labels:\n")
+	buf.WriteString("    app.kubernetes.io/managed-by: geoip\n")
+	fmt.Fprintf(buf, "    geoip/list: %q\n", labelValue(list))
+	buf.WriteString("spec:\n")
+
+	selector := "podSelector"
+	if n.Kind == kindCiliumNetworkPolicy {
+		selector = "endpointSelector"
+	}
+	n.writeSelector(buf, selector)
+
+	switch n.Kind {
+	case kindNetworkPolicy:
+		peer := "to"
+		if n.Direction == directionIngress {
+			peer = "from"
+		}
+		buf.WriteString("  policyTypes:\n")
+		fmt.Fprintf(buf, "    - %s\n", strings.ToUpper(n.Direction[:1])+n.Direction[1:])
+		fmt.Fprintf(buf, "  %s:\n", n.Direction)
+		fmt.Fprintf(buf, "    - %s:\n", peer)
+		for _, cidr := range cidrList {
+			buf.WriteString("        - ipBlock:\n")
+			fmt.Fprintf(buf, "            cidr: %s\n", cidr)
+		}
+
+	case kindCiliumNetworkPolicy:
+		rule, peer := n.Direction, "toCIDRSet"
+		if n.Direction == directionIngress {
+			peer = "fromCIDRSet"
+		}
+		if n.Deny {
+			rule += "Deny"
+		}
+		fmt.Fprintf(buf, "  %s:\n", rule)
+		fmt.Fprintf(buf, "    - %s:\n", peer)
+		for _, cidr := range cidrList {
+			fmt.Fprintf(buf, "        - cidr: %s\n", cidr)
+		}
+	}
+}
+
+// writeSelector selects all pods when no label is specified
+func (n *networkPolicyOut) writeSelector(buf *bytes.Buffer, selector string) {
+	if len(n.PodSelector) == 0 {
+		fmt.Fprintf(buf, "  %s: {}\n", selector)
+		return
+	}
+
+	fmt.Fprintf(buf, "  %s:\n", selector)
+	buf.WriteString("    matchLabels:\n")
+	keys := make([]string, 0, len(n.PodSelector))
+	for key := range n.PodSelector {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "      %s: %q\n", key, n.PodSelector[key])
+	}
+}
+
+func (n *networkPolicyOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(n.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", n.Type, "file", filename, "dir", dir)
+
+	return nil
+}
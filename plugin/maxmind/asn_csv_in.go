@@ -0,0 +1,240 @@
+package maxmind
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeASNCSV = "maxmindGeoLite2ASNCSV"
+	descASNCSV = "Convert MaxMind GeoLite2 ASN CSV data to lists of autonomous systems"
+)
+
+var (
+	defaultASNIPv4File = filepath.Join("./", "geolite2", "GeoLite2-ASN-Blocks-IPv4.csv")
+	defaultASNIPv6File = filepath.Join("./", "geolite2", "GeoLite2-ASN-Blocks-IPv6.csv")
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeASNCSV, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newGeoLite2ASNCSV(action, data)
+	})
+	lib.RegisterInputConverter(typeASNCSV, &geoLite2ASNCSV{
+		Description: descASNCSV,
+	})
+	lib.RegisterInputArgs(typeASNCSV, geoLite2ASNCSVArgs{})
+}
+
+// geoLite2ASNCSVArgs are the args of the input converter in config file
+type geoLite2ASNCSVArgs struct {
+	IPv4File   string     `json:"ipv4"`
+	IPv6File   string     `json:"ipv6"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newGeoLite2ASNCSV(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp geoLite2ASNCSVArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.IPv4File == "" {
+		tmp.IPv4File = defaultASNIPv4File
+	}
+
+	if tmp.IPv6File == "" {
+		tmp.IPv6File = defaultASNIPv6File
+	}
+
+	// Filter want list and exclude list, which could be ASNs like 13335 or AS13335, or patterns like /^AS1\d{4}$/
+	wantList, err := asnListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeASNCSV, action, err)
+	}
+
+	excludeList, err := asnListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeASNCSV, action, err)
+	}
+
+	return &geoLite2ASNCSV{
+		Type:        typeASNCSV,
+		Action:      action,
+		Description: descASNCSV,
+		IPv4File:    tmp.IPv4File,
+		IPv6File:    tmp.IPv6File,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+// asnListMatcher returns the matcher of the lists of ASNs and patterns
+func asnListMatcher(list []string) (*lib.ListMatcher, error) {
+	names := make([]string, 0, len(list))
+	for _, name := range list {
+		if name = strings.TrimSpace(name); name == "" || lib.IsListPattern(name) {
+			names = append(names, name)
+			continue
+		}
+		asn, err := lib.NormalizeASNName(name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, asn)
+	}
+	return lib.NewListMatcher(names)
+}
+
+type geoLite2ASNCSV struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	IPv4File    string
+	IPv6File    string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (g *geoLite2ASNCSV) GetType() string {
+	return g.Type
+}
+
+func (g *geoLite2ASNCSV) GetAction() lib.Action {
+	return g.Action
+}
+
+func (g *geoLite2ASNCSV) GetDescription() string {
+	return g.Description
+}
+
+func (g *geoLite2ASNCSV) IsSourceInput() bool {
+	return true
+}
+
+func (g *geoLite2ASNCSV) Input(container lib.Container) (lib.Container, error) {
+	return g.InputContext(context.Background(), container)
+}
+
+func (g *geoLite2ASNCSV) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	entries := make(map[string]*lib.Entry, 1024)
+
+	if g.IPv4File != "" && g.OnlyIPType != lib.IPv6 {
+		if err := g.process(ctx, g.IPv4File, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.IPv6File != "" && g.OnlyIPType != lib.IPv4 {
+		if err := g.process(ctx, g.IPv6File, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", typeASNCSV, g.Action)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch g.Action {
+		case lib.ActionAdd:
+			entry.AddTag(lib.TagASN)
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+// process reads records in the format "network,autonomous_system_number,autonomous_system_organization"
+func (g *geoLite2ASNCSV) process(ctx context.Context, file string, entries map[string]*lib.Entry) error {
+	var f io.ReadCloser
+	var err error
+	switch {
+	case strings.HasPrefix(strings.ToLower(file), "http://"), strings.HasPrefix(strings.ToLower(file), "https://"):
+		f, err = lib.GetRemoteURLReaderContext(ctx, file)
+	default:
+		lib.RecordSource(file)
+		f, err = os.Open(file)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Read() // skip header
+
+	lines, start := 0, time.Now()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if lines++; lines%lib.ProgressReportInterval == 0 {
+			lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines})
+		}
+
+		if len(record) < 2 {
+			return fmt.Errorf("❌ [type %s | action %s] invalid record: %v", typeASNCSV, g.Action, record)
+		}
+
+		asn, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] invalid ASN of record: %v", typeASNCSV, g.Action, record)
+		}
+
+		name := lib.ASNName(uint32(asn))
+		if (!g.Want.IsEmpty() && !g.Want.Match(name)) || g.Exclude.Match(name) {
+			continue
+		}
+
+		entry, found := entries[name]
+		if !found {
+			entry = lib.NewEntry(name)
+			entries[name] = entry
+		}
+		if err := entry.AddPrefix(strings.TrimSpace(record[0])); err != nil {
+			return err
+		}
+	}
+	lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines, Duration: time.Since(start), Done: true})
+
+	return nil
+}
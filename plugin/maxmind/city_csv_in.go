@@ -0,0 +1,343 @@
+package maxmind
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeCityCSV = "maxmindGeoLite2CityCSV"
+	descCityCSV = "Convert MaxMind GeoLite2 city CSV data to lists of countries, subdivisions or cities"
+)
+
+// Granularities of lists of the city CSV data
+const (
+	granularityCountry     = "country"
+	granularitySubdivision = "subdivision"
+	granularityCity        = "city"
+)
+
+var (
+	defaultCityLocationsFile = filepath.Join("./", "geolite2", "GeoLite2-City-Locations-en.csv")
+	defaultCityIPv4File      = filepath.Join("./", "geolite2", "GeoLite2-City-Blocks-IPv4.csv")
+	defaultCityIPv6File      = filepath.Join("./", "geolite2", "GeoLite2-City-Blocks-IPv6.csv")
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeCityCSV, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newGeoLite2CityCSV(action, data)
+	})
+	lib.RegisterInputConverter(typeCityCSV, &geoLite2CityCSV{
+		Description: descCityCSV,
+	})
+	lib.RegisterInputArgs(typeCityCSV, geoLite2CityCSVArgs{})
+}
+
+// geoLite2CityCSVArgs are the args of the input converter in config file
+type geoLite2CityCSVArgs struct {
+	LocationsFile string     `json:"locations"`
+	IPv4File      string     `json:"ipv4"`
+	IPv6File      string     `json:"ipv6"`
+	Granularity   string     `json:"granularity"`
+	Want          []string   `json:"wantedList"`
+	Exclude       []string   `json:"excludedList"`
+	OnlyIPType    lib.IPType `json:"onlyIPType"`
+	WithMetadata  bool       `json:"withMetadata"`
+}
+
+func newGeoLite2CityCSV(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp geoLite2CityCSVArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.LocationsFile == "" {
+		tmp.LocationsFile = defaultCityLocationsFile
+	}
+
+	if tmp.IPv4File == "" {
+		tmp.IPv4File = defaultCityIPv4File
+	}
+
+	if tmp.IPv6File == "" {
+		tmp.IPv6File = defaultCityIPv6File
+	}
+
+	tmp.Granularity = strings.ToLower(strings.TrimSpace(tmp.Granularity))
+	switch tmp.Granularity {
+	case "":
+		tmp.Granularity = granularitySubdivision
+	case granularityCountry, granularitySubdivision, granularityCity:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid granularity %s, the value must be %s, %s or %s", typeCityCSV, action, tmp.Granularity, granularityCountry, granularitySubdivision, granularityCity)
+	}
+
+	// Filter want list, which could be countries like CN, or lists like CN-GD
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeCityCSV, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeCityCSV, action, err)
+	}
+
+	return &geoLite2CityCSV{
+		Type:          typeCityCSV,
+		Action:        action,
+		Description:   descCityCSV,
+		LocationsFile: tmp.LocationsFile,
+		IPv4File:      tmp.IPv4File,
+		IPv6File:      tmp.IPv6File,
+		Granularity:   tmp.Granularity,
+		Want:          wantList,
+		Exclude:       excludeList,
+		OnlyIPType:    tmp.OnlyIPType,
+		WithMetadata:  tmp.WithMetadata,
+	}, nil
+}
+
+type geoLite2CityCSV struct {
+	Type          string
+	Action        lib.Action
+	Description   string
+	LocationsFile string
+	IPv4File      string
+	IPv6File      string
+	Granularity   string
+	Want          *lib.ListMatcher
+	Exclude       *lib.ListMatcher
+	OnlyIPType    lib.IPType
+	WithMetadata  bool
+}
+
+// cityLocation is the list and city name of a geoname ID
+type cityLocation struct {
+	list string
+	city string
+}
+
+func (g *geoLite2CityCSV) GetType() string {
+	return g.Type
+}
+
+func (g *geoLite2CityCSV) GetAction() lib.Action {
+	return g.Action
+}
+
+func (g *geoLite2CityCSV) GetDescription() string {
+	return g.Description
+}
+
+func (g *geoLite2CityCSV) IsSourceInput() bool {
+	return true
+}
+
+func (g *geoLite2CityCSV) Input(container lib.Container) (lib.Container, error) {
+	return g.InputContext(context.Background(), container)
+}
+
+func (g *geoLite2CityCSV) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	locations, err := g.getLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*lib.Entry, 4096)
+
+	if g.IPv4File != "" && g.OnlyIPType != lib.IPv6 {
+		if err := g.process(ctx, g.IPv4File, locations, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.IPv6File != "" && g.OnlyIPType != lib.IPv4 {
+		if err := g.process(ctx, g.IPv6File, locations, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", typeCityCSV, g.Action)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch g.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch g.Action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+// getLocations returns the locations by geoname ID. Lists are named by the granularity,
+// like CN for countries, CN-GD for subdivisions and CN-1809858 for cities, and
+// fall back to the coarser ones if the location has no subdivision or city.
+func (g *geoLite2CityCSV) getLocations(ctx context.Context) (map[string]*cityLocation, error) {
+	var f io.ReadCloser
+	var err error
+	switch {
+	case strings.HasPrefix(strings.ToLower(g.LocationsFile), "http://"), strings.HasPrefix(strings.ToLower(g.LocationsFile), "https://"):
+		f, err = lib.GetRemoteURLReaderContext(ctx, g.LocationsFile)
+	default:
+		lib.RecordSource(g.LocationsFile)
+		f, err = os.Open(g.LocationsFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid locations data", typeCityCSV, g.Action)
+	}
+
+	locations := make(map[string]*cityLocation, len(lines))
+	for _, line := range lines[1:] {
+		// geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name,
+		// subdivision_1_iso_code,subdivision_1_name,subdivision_2_iso_code,subdivision_2_name,city_name,...
+		if len(line) < 11 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid record: %v", typeCityCSV, g.Action, line)
+		}
+
+		id := strings.TrimSpace(line[0])
+		country := strings.ToUpper(strings.TrimSpace(line[4]))
+		if id == "" || country == "" {
+			continue
+		}
+		subdivision := strings.ToUpper(strings.TrimSpace(line[6]))
+		city := strings.TrimSpace(line[10])
+
+		list := country
+		switch g.Granularity {
+		case granularitySubdivision:
+			if subdivision != "" {
+				list = country + "-" + subdivision
+			}
+		case granularityCity:
+			switch {
+			case city != "":
+				list = country + "-" + id
+			case subdivision != "":
+				list = country + "-" + subdivision
+			}
+		}
+
+		if (!g.Want.IsEmpty() && !g.Want.Match(country) && !g.Want.Match(list)) || g.Exclude.Match(country) || g.Exclude.Match(list) {
+			continue
+		}
+
+		locations[id] = &cityLocation{list: list, city: city}
+	}
+
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid locations data", typeCityCSV, g.Action)
+	}
+
+	return locations, nil
+}
+
+func (g *geoLite2CityCSV) process(ctx context.Context, file string, locations map[string]*cityLocation, entries map[string]*lib.Entry) error {
+	var f io.ReadCloser
+	var err error
+	switch {
+	case strings.HasPrefix(strings.ToLower(file), "http://"), strings.HasPrefix(strings.ToLower(file), "https://"):
+		f, err = lib.GetRemoteURLReaderContext(ctx, file)
+	default:
+		lib.RecordSource(file)
+		f, err = os.Open(file)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Read() // skip header
+
+	lines, start := 0, time.Now()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if lines++; lines%lib.ProgressReportInterval == 0 {
+			lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines})
+		}
+
+		// network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,...
+		if len(record) < 4 {
+			return fmt.Errorf("❌ [type %s | action %s] invalid record: %v", typeCityCSV, g.Action, record)
+		}
+
+		var location *cityLocation
+		for _, id := range record[1:4] {
+			if id = strings.TrimSpace(id); id != "" {
+				location = locations[id]
+				break
+			}
+		}
+		if location == nil {
+			continue
+		}
+
+		entry, found := entries[location.list]
+		if !found {
+			entry = lib.NewEntry(location.list)
+			entries[location.list] = entry
+		}
+
+		cidr := strings.TrimSpace(record[0])
+		if g.WithMetadata && location.city != "" {
+			err = entry.AddPrefixWithMetadata(cidr, lib.Metadata{City: location.city, Source: "GeoLite2-City"})
+		} else {
+			err = entry.AddPrefix(cidr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines, Duration: time.Since(start), Done: true})
+
+	return nil
+}
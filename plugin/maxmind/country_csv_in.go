@@ -1,13 +1,16 @@
 package maxmind
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/v2fly/geoip/lib"
 )
@@ -17,6 +20,22 @@ const (
 	descCountryCSV = "Convert MaxMind GeoLite2 country CSV data to other formats"
 )
 
+// Fields of networks whose geoname IDs are preferred by the countryField arg
+const (
+	countryFieldCountry     = "country"
+	countryFieldRegistered  = "registered"
+	countryFieldRepresented = "represented"
+)
+
+// Modes of anycast networks by the anycast arg
+const (
+	anycastInclude  = "include"  // added to lists of their countries
+	anycastSkip     = "skip"     // not added
+	anycastSeparate = "separate" // added to the anycast list instead of lists of their countries
+)
+
+const anycastList = "anycast"
+
 var (
 	defaultCCFile   = filepath.Join("./", "geolite2", "GeoLite2-Country-Locations-en.csv")
 	defaultIPv4File = filepath.Join("./", "geolite2", "GeoLite2-Country-Blocks-IPv4.csv")
@@ -30,16 +49,24 @@ func init() {
 	lib.RegisterInputConverter(typeCountryCSV, &geoLite2CountryCSV{
 		Description: descCountryCSV,
 	})
+	lib.RegisterInputArgs(typeCountryCSV, geoLite2CountryCSVArgs{})
+}
+
+// geoLite2CountryCSVArgs are the args of the input converter in config file
+type geoLite2CountryCSVArgs struct {
+	CountryCodeFile string     `json:"country"`
+	IPv4File        string     `json:"ipv4"`
+	IPv6File        string     `json:"ipv6"`
+	Want            []string   `json:"wantedList"`
+	Exclude         []string   `json:"excludedList"`
+	OnlyIPType      lib.IPType `json:"onlyIPType"`
+	CountryField    string     `json:"countryField"`
+	Anycast         string     `json:"anycast"`
+	Continents      []string   `json:"continents"`
 }
 
 func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		CountryCodeFile string     `json:"country"`
-		IPv4File        string     `json:"ipv4"`
-		IPv6File        string     `json:"ipv6"`
-		Want            []string   `json:"wantedList"`
-		OnlyIPType      lib.IPType `json:"onlyIPType"`
-	}
+	var tmp geoLite2CountryCSVArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -60,11 +87,40 @@ func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputCo
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeCountryCSV, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeCountryCSV, action, err)
+	}
+
+	tmp.CountryField = strings.ToLower(strings.TrimSpace(tmp.CountryField))
+	switch tmp.CountryField {
+	case "":
+		tmp.CountryField = countryFieldCountry
+	case countryFieldCountry, countryFieldRegistered, countryFieldRepresented:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid countryField %q, the value must be %s, %s or %s", typeCountryCSV, action, tmp.CountryField, countryFieldCountry, countryFieldRegistered, countryFieldRepresented)
+	}
+
+	tmp.Anycast = strings.ToLower(strings.TrimSpace(tmp.Anycast))
+	switch tmp.Anycast {
+	case "":
+		tmp.Anycast = anycastInclude
+	case anycastInclude, anycastSkip, anycastSeparate:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid anycast %q, the value must be %s, %s or %s", typeCountryCSV, action, tmp.Anycast, anycastInclude, anycastSkip, anycastSeparate)
+	}
+
+	continents := make(map[string]bool, len(tmp.Continents))
+	for _, continent := range tmp.Continents {
+		if !lib.IsContinent(continent) {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid continent %q, the value must be one of %s", typeCountryCSV, action, continent, strings.Join(lib.Continents(), ", "))
 		}
+		continents[strings.ToUpper(strings.TrimSpace(continent))] = true
 	}
 
 	return &geoLite2CountryCSV{
@@ -75,7 +131,11 @@ func newGeoLite2CountryCSV(action lib.Action, data json.RawMessage) (lib.InputCo
 		IPv4File:        tmp.IPv4File,
 		IPv6File:        tmp.IPv6File,
 		Want:            wantList,
+		Exclude:         excludeList,
 		OnlyIPType:      tmp.OnlyIPType,
+		CountryField:    tmp.CountryField,
+		Anycast:         tmp.Anycast,
+		Continents:      continents,
 	}, nil
 }
 
@@ -86,8 +146,12 @@ type geoLite2CountryCSV struct {
 	CountryCodeFile string
 	IPv4File        string
 	IPv6File        string
-	Want            map[string]bool
+	Want            *lib.ListMatcher
+	Exclude         *lib.ListMatcher
 	OnlyIPType      lib.IPType
+	CountryField    string
+	Anycast         string
+	Continents      map[string]bool
 }
 
 func (g *geoLite2CountryCSV) GetType() string {
@@ -102,8 +166,16 @@ func (g *geoLite2CountryCSV) GetDescription() string {
 	return g.Description
 }
 
+func (g *geoLite2CountryCSV) IsSourceInput() bool {
+	return true
+}
+
 func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, error) {
-	ccMap, err := g.getCountryCode()
+	return g.InputContext(context.Background(), container)
+}
+
+func (g *geoLite2CountryCSV) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	ccMap, err := g.getCountryCode(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +183,13 @@ func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, erro
 	entries := make(map[string]*lib.Entry, 300)
 
 	if g.IPv4File != "" {
-		if err := g.process(g.IPv4File, ccMap, entries); err != nil {
+		if err := g.process(ctx, g.IPv4File, ccMap, entries); err != nil {
 			return nil, err
 		}
 	}
 
 	if g.IPv6File != "" {
-		if err := g.process(g.IPv6File, ccMap, entries); err != nil {
+		if err := g.process(ctx, g.IPv6File, ccMap, entries); err != nil {
 			return nil, err
 		}
 	}
@@ -152,13 +224,14 @@ func (g *geoLite2CountryCSV) Input(container lib.Container) (lib.Container, erro
 	return container, nil
 }
 
-func (g *geoLite2CountryCSV) getCountryCode() (map[string]string, error) {
+func (g *geoLite2CountryCSV) getCountryCode(ctx context.Context) (map[string]string, error) {
 	var f io.ReadCloser
 	var err error
 	switch {
 	case strings.HasPrefix(strings.ToLower(g.CountryCodeFile), "http://"), strings.HasPrefix(strings.ToLower(g.CountryCodeFile), "https://"):
-		f, err = lib.GetRemoteURLReader(g.CountryCodeFile)
+		f, err = lib.GetRemoteURLReaderContext(ctx, g.CountryCodeFile)
 	default:
+		lib.RecordSource(g.CountryCodeFile)
 		f, err = os.Open(g.CountryCodeFile)
 	}
 	if err != nil {
@@ -184,7 +257,11 @@ func (g *geoLite2CountryCSV) getCountryCode() (map[string]string, error) {
 			continue
 		}
 
-		if len(g.Want) > 0 && !g.Want[countryCode] {
+		if len(g.Continents) > 0 && !g.Continents[strings.ToUpper(strings.TrimSpace(line[2]))] {
+			continue
+		}
+
+		if (!g.Want.IsEmpty() && !g.Want.Match(countryCode)) || g.Exclude.Match(countryCode) {
 			continue
 		}
 
@@ -198,7 +275,29 @@ func (g *geoLite2CountryCSV) getCountryCode() (map[string]string, error) {
 	return ccMap, nil
 }
 
-func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entries map[string]*lib.Entry) error {
+// geonameID returns the geoname ID of the country of the network, which is the one of the
+// field of countryField if not empty, otherwise geoname_id, registered_country_geoname_id
+// and represented_country_geoname_id in order
+func (g *geoLite2CountryCSV) geonameID(record []string) string {
+	switch g.CountryField {
+	case countryFieldRegistered:
+		if id := strings.TrimSpace(record[2]); id != "" {
+			return id
+		}
+	case countryFieldRepresented:
+		if id := strings.TrimSpace(record[3]); id != "" {
+			return id
+		}
+	}
+	for _, field := range record[1:4] {
+		if id := strings.TrimSpace(field); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func (g *geoLite2CountryCSV) process(ctx context.Context, file string, ccMap map[string]string, entries map[string]*lib.Entry) error {
 	if len(ccMap) == 0 {
 		return fmt.Errorf("❌ [type %s | action %s] invalid country code data", typeCountryCSV, g.Action)
 	}
@@ -210,8 +309,9 @@ func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entri
 	var err error
 	switch {
 	case strings.HasPrefix(strings.ToLower(file), "http://"), strings.HasPrefix(strings.ToLower(file), "https://"):
-		f, err = lib.GetRemoteURLReader(file)
+		f, err = lib.GetRemoteURLReaderContext(ctx, file)
 	default:
+		lib.RecordSource(file)
 		f, err = os.Open(file)
 	}
 	if err != nil {
@@ -220,8 +320,17 @@ func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entri
 	defer f.Close()
 
 	reader := csv.NewReader(f)
-	reader.Read() // skip header
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	// is_anycast is only in recent files
+	anycastIdx := slices.Index(header, "is_anycast")
+	if anycastIdx < 0 && g.Anycast != anycastInclude {
+		return fmt.Errorf("❌ [type %s | action %s] no is_anycast column in %s for anycast %s", typeCountryCSV, g.Action, file, g.Anycast)
+	}
 
+	lines, start := 0, time.Now()
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
@@ -230,35 +339,45 @@ func (g *geoLite2CountryCSV) process(file string, ccMap map[string]string, entri
 		if err != nil {
 			return err
 		}
+		if lines++; lines%lib.ProgressReportInterval == 0 {
+			lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines})
+		}
 
 		if len(record) < 4 {
 			return fmt.Errorf("❌ [type %s | action %s] invalid record: %v", typeCountryCSV, g.Action, record)
 		}
 
-		ccID := ""
-		switch {
-		case strings.TrimSpace(record[1]) != "":
-			ccID = strings.TrimSpace(record[1])
-		case strings.TrimSpace(record[2]) != "":
-			ccID = strings.TrimSpace(record[2])
-		case strings.TrimSpace(record[3]) != "":
-			ccID = strings.TrimSpace(record[3])
-		default:
+		ccID := g.geonameID(record)
+		if ccID == "" {
 			continue
 		}
 
 		if countryCode, found := ccMap[ccID]; found {
+			name := countryCode
+			if anycastIdx >= 0 && anycastIdx < len(record) && strings.TrimSpace(record[anycastIdx]) == "1" {
+				switch g.Anycast {
+				case anycastSkip:
+					continue
+				case anycastSeparate:
+					name = anycastList
+				}
+			}
+
 			cidrStr := strings.ToLower(strings.TrimSpace(record[0]))
-			entry, found := entries[countryCode]
+			entry, found := entries[name]
 			if !found {
-				entry = lib.NewEntry(countryCode)
+				entry = lib.NewEntry(name)
+				if name == anycastList {
+					entry.AddTag(anycastList)
+				}
 			}
 			if err := entry.AddPrefix(cidrStr); err != nil {
 				return err
 			}
-			entries[countryCode] = entry
+			entries[name] = entry
 		}
 	}
+	lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: g.Type, URI: file, Lines: lines, Duration: time.Since(start), Done: true})
 
 	return nil
 }
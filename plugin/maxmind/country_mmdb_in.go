@@ -1,13 +1,13 @@
 package maxmind
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/oschwald/geoip2-golang"
 	"github.com/oschwald/maxminddb-golang"
 	"github.com/v2fly/geoip/lib"
 )
@@ -28,14 +28,20 @@ func init() {
 	lib.RegisterInputConverter(typeMaxmindMMDBIn, &maxmindMMDBIn{
 		Description: descMaxmindMMDBIn,
 	})
+	lib.RegisterInputArgs(typeMaxmindMMDBIn, maxmindMMDBInArgs{})
+}
+
+// maxmindMMDBInArgs are the args of the input converter in config file
+type maxmindMMDBInArgs struct {
+	URI          string     `json:"uri"`
+	Want         []string   `json:"wantedList"`
+	Exclude      []string   `json:"excludedList"`
+	OnlyIPType   lib.IPType `json:"onlyIPType"`
+	WithMetadata bool       `json:"withMetadata"`
 }
 
 func newMaxmindMMDBIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		URI        string     `json:"uri"`
-		Want       []string   `json:"wantedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
-	}
+	var tmp maxmindMMDBInArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -48,30 +54,55 @@ func newMaxmindMMDBIn(action lib.Action, data json.RawMessage) (lib.InputConvert
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeMaxmindMMDBIn, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeMaxmindMMDBIn, action, err)
 	}
 
 	return &maxmindMMDBIn{
-		Type:        typeMaxmindMMDBIn,
-		Action:      action,
-		Description: descMaxmindMMDBIn,
-		URI:         tmp.URI,
-		Want:        wantList,
-		OnlyIPType:  tmp.OnlyIPType,
+		Type:         typeMaxmindMMDBIn,
+		Action:       action,
+		Description:  descMaxmindMMDBIn,
+		URI:          tmp.URI,
+		Want:         wantList,
+		Exclude:      excludeList,
+		OnlyIPType:   tmp.OnlyIPType,
+		WithMetadata: tmp.WithMetadata,
 	}, nil
 }
 
 type maxmindMMDBIn struct {
-	Type        string
-	Action      lib.Action
-	Description string
-	URI         string
-	Want        map[string]bool
-	OnlyIPType  lib.IPType
+	Type         string
+	Action       lib.Action
+	Description  string
+	URI          string
+	Want         *lib.ListMatcher
+	Exclude      *lib.ListMatcher
+	OnlyIPType   lib.IPType
+	WithMetadata bool
+}
+
+// mmdbRecord is the record of country databases, and the city and ASN
+// of databases which also have them, like GeoLite2 City databases
+type mmdbRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	RepresentedCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"represented_country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN uint32 `maxminddb:"autonomous_system_number"`
 }
 
 func (m *maxmindMMDBIn) GetType() string {
@@ -86,13 +117,22 @@ func (m *maxmindMMDBIn) GetDescription() string {
 	return m.Description
 }
 
+func (m *maxmindMMDBIn) IsSourceInput() bool {
+	return true
+}
+
 func (m *maxmindMMDBIn) Input(container lib.Container) (lib.Container, error) {
+	return m.InputContext(context.Background(), container)
+}
+
+func (m *maxmindMMDBIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
 	var content []byte
 	var err error
 	switch {
 	case strings.HasPrefix(strings.ToLower(m.URI), "http://"), strings.HasPrefix(strings.ToLower(m.URI), "https://"):
-		content, err = lib.GetRemoteURLContent(m.URI)
+		content, err = lib.GetRemoteURLContentContext(ctx, m.URI)
 	default:
+		lib.RecordSource(m.URI)
 		content, err = os.ReadFile(m.URI)
 	}
 	if err != nil {
@@ -144,7 +184,7 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 
 	networks := db.Networks(maxminddb.SkipAliasedNetworks)
 	for networks.Next() {
-		var record geoip2.Country
+		var record mmdbRecord
 		subnet, err := networks.Network(&record)
 		if err != nil {
 			return err
@@ -162,7 +202,7 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 			continue
 		}
 
-		if len(m.Want) > 0 && !m.Want[name] {
+		if (!m.Want.IsEmpty() && !m.Want.Match(name)) || m.Exclude.Match(name) {
 			continue
 		}
 
@@ -171,7 +211,16 @@ func (m *maxmindMMDBIn) generateEntries(content []byte, entries map[string]*lib.
 			entry = lib.NewEntry(name)
 		}
 
-		if err := entry.AddPrefix(subnet); err != nil {
+		if m.WithMetadata {
+			metadata := lib.Metadata{
+				ASN:    record.ASN,
+				City:   record.City.Names["en"],
+				Source: db.Metadata.DatabaseType,
+			}
+			if err := entry.AddPrefixWithMetadata(subnet, metadata); err != nil {
+				return err
+			}
+		} else if err := entry.AddPrefix(subnet); err != nil {
 			return err
 		}
 
@@ -0,0 +1,229 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeMirrorOut = "mirror"
+	descMirrorOut = "Publish output files to a self-hosted mirror over SFTP, rsync over SSH or WebDAV atomically"
+)
+
+const (
+	protocolSFTP   = "sftp"
+	protocolRsync  = "rsync"
+	protocolWebDAV = "webdav"
+)
+
+var (
+	defaultMirrorInputDir = filepath.Join("./", "output")
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeMirrorOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newMirrorOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeMirrorOut, &mirrorOut{
+		Description: descMirrorOut,
+	})
+	lib.RegisterOutputArgs(typeMirrorOut, mirrorOutArgs{})
+}
+
+// mirrorOutArgs are the args of the output converter in config file
+type mirrorOutArgs struct {
+	Protocol     string   `json:"protocol"`
+	Destination  string   `json:"destination"`
+	InputDir     string   `json:"inputDir"`
+	Files        []string `json:"files"`
+	Port         int      `json:"port"`
+	IdentityFile string   `json:"identityFile"`
+	SSHCommand   string   `json:"sshCommand"`
+	SSHOptions   []string `json:"sshOptions"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	DryRun       bool     `json:"dryRun"`
+}
+
+// publisher uploads the files relative to the input directory to the destination,
+// so that all of them are replaced at once at the end
+type publisher interface {
+	publish(ctx context.Context, inputDir string, files []string) error
+}
+
+func newMirrorOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp mirrorOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.Destination = strings.TrimSpace(tmp.Destination); tmp.Destination == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] destination must be specified in config", typeMirrorOut, action)
+	}
+
+	if tmp.InputDir == "" {
+		tmp.InputDir = defaultMirrorInputDir
+	}
+
+	for _, pattern := range tmp.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid pattern %s in files: %v", typeMirrorOut, action, pattern, err)
+		}
+	}
+
+	if tmp.Port < 0 || tmp.Port > 65535 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid port %d", typeMirrorOut, action, tmp.Port)
+	}
+
+	var p publisher
+	var err error
+	switch tmp.Protocol = strings.ToLower(strings.TrimSpace(tmp.Protocol)); tmp.Protocol {
+	case protocolSFTP, protocolRsync:
+		p, err = newSSHPublisher(tmp.Protocol, tmp.Destination, tmp.Port, tmp.IdentityFile, tmp.SSHCommand, tmp.SSHOptions)
+	case protocolWebDAV:
+		p, err = newWebDAVPublisher(tmp.Destination, tmp.Username, tmp.Password)
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] unsupported protocol %q, the value must be %s, %s or %s", typeMirrorOut, action, tmp.Protocol, protocolSFTP, protocolRsync, protocolWebDAV)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v", typeMirrorOut, action, err)
+	}
+
+	return &mirrorOut{
+		Type:        typeMirrorOut,
+		Action:      action,
+		Description: descMirrorOut,
+		Protocol:    tmp.Protocol,
+		Destination: tmp.Destination,
+		InputDir:    tmp.InputDir,
+		Files:       tmp.Files,
+		DryRun:      tmp.DryRun,
+
+		publisher: p,
+	}, nil
+}
+
+type mirrorOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Protocol    string
+	Destination string
+	InputDir    string
+	Files       []string
+	DryRun      bool
+
+	publisher publisher
+}
+
+func (m *mirrorOut) GetType() string {
+	return m.Type
+}
+
+func (m *mirrorOut) GetAction() lib.Action {
+	return m.Action
+}
+
+func (m *mirrorOut) GetDescription() string {
+	return m.Description
+}
+
+func (m *mirrorOut) Output(container lib.Container) error {
+	return m.OutputContext(context.Background(), container)
+}
+
+// OutputContext ignores the container and publishes files written by previous
+// outputs in InputDir to the destination, keeping their paths relative to InputDir
+func (m *mirrorOut) OutputContext(ctx context.Context, container lib.Container) error {
+	files, err := m.listFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("❌ [type %s | action %s] no file found in %s", m.Type, m.Action, m.InputDir)
+	}
+
+	if m.DryRun {
+		for _, file := range files {
+			slog.Info("dry run: file would be published", "plugin", m.Type, "protocol", m.Protocol, "destination", m.Destination, "file", file)
+		}
+		return nil
+	}
+
+	if err := m.publisher.publish(ctx, m.InputDir, files); err != nil {
+		return fmt.Errorf("❌ [type %s | action %s] failed to publish to %s: %v", m.Type, m.Action, m.Destination, err)
+	}
+
+	slog.Info("files published", "plugin", m.Type, "protocol", m.Protocol, "destination", m.Destination, "files", len(files))
+	return nil
+}
+
+// listFiles returns sorted paths relative to InputDir with slashes, which match
+// any pattern of files by the path or the base name. All files match without patterns.
+func (m *mirrorOut) listFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(m.InputDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.InputDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if len(m.Files) > 0 && !slices.ContainsFunc(m.Files, func(pattern string) bool {
+			matched, _ := path.Match(pattern, rel)
+			matchedBase, _ := path.Match(pattern, path.Base(rel))
+			return matched || matchedBase
+		}) {
+			return nil
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+// parentDirs returns the sorted directories of the files, parents before children
+func parentDirs(files []string) []string {
+	dirs := make([]string, 0)
+	for _, file := range files {
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+// tempName returns the name of the temporary file the file is uploaded to before
+// it is renamed, which is hidden in the same directory
+func tempName(file string) string {
+	dir, name := path.Split(file)
+	return dir + "." + name + ".tmp"
+}
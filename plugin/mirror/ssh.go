@@ -0,0 +1,179 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var defaultSSHCommand = "ssh"
+
+// sshPublisher publishes files by the sftp or rsync command of the system, which
+// use the ssh command with the keys, known hosts and config of the user
+type sshPublisher struct {
+	protocol   string
+	host       string // [user@]host
+	dir        string // directory on the host, empty for the home directory
+	port       int
+	identity   string
+	sshCommand string
+	options    []string
+}
+
+// newSSHPublisher parses the destination like [user@]host:path, the same as scp
+func newSSHPublisher(protocol, destination string, port int, identity, sshCommand string, options []string) (*sshPublisher, error) {
+	host, dir, found := cutSSHDestination(destination)
+	if !found || host == "" {
+		return nil, fmt.Errorf("invalid destination %q of %s, must be like user@host:path", destination, protocol)
+	}
+	if sshCommand = strings.TrimSpace(sshCommand); sshCommand == "" {
+		sshCommand = defaultSSHCommand
+	}
+	return &sshPublisher{
+		protocol:   protocol,
+		host:       host,
+		dir:        strings.TrimSuffix(dir, "/"),
+		port:       port,
+		identity:   strings.TrimSpace(identity),
+		sshCommand: sshCommand,
+		options:    options,
+	}, nil
+}
+
+// cutSSHDestination cuts [user@]host:path at the colon after the host, which
+// could be an IPv6 address in brackets kept for sftp and rsync
+func cutSSHDestination(destination string) (string, string, bool) {
+	if end := strings.Index(destination, "]:"); end >= 0 && strings.Contains(destination[:end], "[") {
+		return destination[:end+1], destination[end+2:], true
+	}
+	return strings.Cut(destination, ":")
+}
+
+func (s *sshPublisher) publish(ctx context.Context, inputDir string, files []string) error {
+	switch s.protocol {
+	case protocolRsync:
+		return s.rsync(ctx, inputDir, files)
+	default:
+		return s.sftp(ctx, inputDir, files)
+	}
+}
+
+// sftp uploads all files to temporary names first, then renames them in the batch
+// mode of the sftp command, which replaces existing files atomically if the server
+// supports the posix-rename extension, like OpenSSH
+func (s *sshPublisher) sftp(ctx context.Context, inputDir string, files []string) error {
+	var batch strings.Builder
+	// Commands prefixed with - may fail, like creating existing directories
+	if s.dir != "" {
+		fmt.Fprintf(&batch, "-mkdir %s\n", quoteSFTP(s.dir))
+	}
+	for _, dir := range parentDirs(files) {
+		fmt.Fprintf(&batch, "-mkdir %s\n", quoteSFTP(s.remotePath(dir)))
+	}
+	for _, file := range files {
+		fmt.Fprintf(&batch, "put %s %s\n", quoteSFTP(filepath.Join(inputDir, filepath.FromSlash(file))), quoteSFTP(s.remotePath(tempName(file))))
+	}
+	for _, file := range files {
+		fmt.Fprintf(&batch, "rename %s %s\n", quoteSFTP(s.remotePath(tempName(file))), quoteSFTP(s.remotePath(file)))
+	}
+
+	args := []string{"-b", "-"}
+	if s.port > 0 {
+		args = append(args, "-P", strconv.Itoa(s.port))
+	}
+	if s.sshCommand != defaultSSHCommand {
+		args = append(args, "-S", s.sshCommand)
+	}
+	args = append(args, s.sshArgs()...)
+	args = append(args, s.host)
+
+	return run(ctx, "sftp", args, batch.String())
+}
+
+// rsync transfers the files with --delay-updates, which puts all updated files
+// in place at the end of the transfer
+func (s *sshPublisher) rsync(ctx context.Context, inputDir string, files []string) error {
+	shell := []string{s.sshCommand}
+	if s.port > 0 {
+		shell = append(shell, "-p", strconv.Itoa(s.port))
+	}
+	shell = append(shell, s.sshArgs()...)
+	for i, arg := range shell {
+		shell[i] = quoteShell(arg)
+	}
+
+	dir := s.dir
+	if dir == "" {
+		dir = "."
+	}
+	args := []string{
+		"--archive", "--delay-updates", "--files-from=-",
+		"--rsh=" + strings.Join(shell, " "),
+		strings.TrimSuffix(inputDir, string(filepath.Separator)) + string(filepath.Separator),
+		s.host + ":" + dir + "/",
+	}
+
+	return run(ctx, "rsync", args, strings.Join(files, "\n")+"\n")
+}
+
+// sshArgs returns the options of ssh shared by sftp and rsync, except the port
+func (s *sshPublisher) sshArgs() []string {
+	args := make([]string, 0, 2+2*len(s.options))
+	if s.identity != "" {
+		args = append(args, "-i", s.identity)
+	}
+	for _, option := range s.options {
+		args = append(args, "-o", option)
+	}
+	return args
+}
+
+func (s *sshPublisher) remotePath(file string) string {
+	if s.dir == "" {
+		return file
+	}
+	return path.Join(s.dir, file)
+}
+
+// run runs the command with the input to stdin, and returns its stderr in the error if it fails
+func run(ctx context.Context, name string, args []string, input string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	slog.Debug("running command", "command", name, "args", strings.Join(args, " "))
+	err := cmd.Run()
+	if stdout.Len() > 0 {
+		slog.Debug("output of command", "command", name, "stdout", strings.TrimSpace(stdout.String()))
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%s failed with exit code %d: %s", name, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return nil
+}
+
+// quoteSFTP quotes the path as an argument of commands of sftp batch files
+func quoteSFTP(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// quoteShell quotes the argument of the remote shell command of rsync if needed
+func quoteShell(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
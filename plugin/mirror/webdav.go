@@ -0,0 +1,155 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// webdavPublisher uploads files to temporary names by PUT first, then renames
+// them by MOVE, creating directories by MKCOL
+type webdavPublisher struct {
+	base       *url.URL
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// newWebDAVPublisher uses the username and password in config first, then falls
+// back to WEBDAV_USERNAME and WEBDAV_PASSWORD environment variables
+func newWebDAVPublisher(destination, username, password string) (*webdavPublisher, error) {
+	base, err := url.Parse(destination)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid destination %q of webdav, must be an http or https URL", destination)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	if username = strings.TrimSpace(username); username == "" {
+		username = os.Getenv("WEBDAV_USERNAME")
+	}
+	if password == "" {
+		password = os.Getenv("WEBDAV_PASSWORD")
+	}
+
+	return &webdavPublisher{
+		base:     base,
+		username: username,
+		password: password,
+		// Uploads of large files take a while
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (w *webdavPublisher) publish(ctx context.Context, inputDir string, files []string) error {
+	for _, dir := range parentDirs(files) {
+		if err := w.mkcol(ctx, dir); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(inputDir, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		err = w.put(ctx, tempName(file), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if err := w.move(ctx, tempName(file), file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkcol creates the directory, which may exist
+func (w *webdavPublisher) mkcol(ctx context.Context, dir string) error {
+	resp, err := w.do(ctx, "MKCOL", w.url(dir+"/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	// 405 Method Not Allowed if the directory exists
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("failed to create directory %s, http status code %d", dir, resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *webdavPublisher) put(ctx context.Context, file string, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	resp, err := w.do(ctx, http.MethodPut, w.url(file), f, func(req *http.Request) {
+		req.ContentLength = info.Size()
+		req.Header.Set("Content-Type", "application/octet-stream")
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload %s, http status code %d", file, resp.StatusCode)
+	}
+	return nil
+}
+
+// move renames the file, replacing the existing one
+func (w *webdavPublisher) move(ctx context.Context, from, to string) error {
+	resp, err := w.do(ctx, "MOVE", w.url(from), nil, func(req *http.Request) {
+		req.Header.Set("Destination", w.url(to))
+		req.Header.Set("Overwrite", "T")
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to rename %s to %s, http status code %d", from, to, resp.StatusCode)
+	}
+	return nil
+}
+
+// url returns the URL of the path relative to the destination
+func (w *webdavPublisher) url(p string) string {
+	return w.base.JoinPath(p).String()
+}
+
+// do sends the request and discards the response body
+func (w *webdavPublisher) do(ctx context.Context, method, url string, body io.Reader, prepare func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, errors.New("unauthorized, check username and password")
+	}
+	return resp, nil
+}
@@ -0,0 +1,285 @@
+package openwrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeIPSetOut = "openwrtIPSet"
+	descIPSetOut = "Convert data to OpenWrt firewall ipset uci config"
+)
+
+const (
+	modeEntry    = "entry"
+	modeLoadfile = "loadfile"
+)
+
+var (
+	defaultOutputDir   = filepath.Join("./", "output", "openwrt")
+	defaultOutputName  = "firewall.geoip"
+	defaultNamePrefix  = "geoip_"
+	defaultLoadfileDir = "/etc/geoip"
+	defaultMatch       = []string{"dest_net"}
+
+	invalidSetNameChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	validMatch         = regexp.MustCompile(`^(src|dest)_(ip|net)$`)
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeIPSetOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newIPSetOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeIPSetOut, &ipsetOut{
+		Description: descIPSetOut,
+	})
+	lib.RegisterOutputArgs(typeIPSetOut, ipsetOutArgs{})
+}
+
+// ipsetOutArgs are the args of the output converter in config file
+type ipsetOutArgs struct {
+	OutputName  string     `json:"outputName"`
+	OutputDir   string     `json:"outputDir"`
+	Mode        string     `json:"mode"`
+	LoadfileDir string     `json:"loadfileDir"`
+	NamePrefix  string     `json:"namePrefix"`
+	Match       []string   `json:"match"`
+	Want        []string   `json:"wantedList"`
+	Exclude     []string   `json:"excludedList"`
+	OnlyIPType  lib.IPType `json:"onlyIPType"`
+}
+
+func newIPSetOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp ipsetOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Mode = strings.ToLower(strings.TrimSpace(tmp.Mode))
+	switch tmp.Mode {
+	case "":
+		tmp.Mode = modeEntry
+	case modeEntry, modeLoadfile:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid mode %s, the value must be entry or loadfile", typeIPSetOut, action, tmp.Mode)
+	}
+
+	if tmp.LoadfileDir == "" {
+		tmp.LoadfileDir = defaultLoadfileDir
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultNamePrefix
+	}
+
+	for _, match := range tmp.Match {
+		if !validMatch.MatchString(match) {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid match %s, the value must be src_ip, src_net, dest_ip or dest_net", typeIPSetOut, action, match)
+		}
+	}
+	if len(tmp.Match) == 0 {
+		tmp.Match = defaultMatch
+	}
+
+	return &ipsetOut{
+		Type:        typeIPSetOut,
+		Action:      action,
+		Description: descIPSetOut,
+		OutputName:  tmp.OutputName,
+		OutputDir:   tmp.OutputDir,
+		Mode:        tmp.Mode,
+		LoadfileDir: strings.TrimRight(tmp.LoadfileDir, "/"),
+		NamePrefix:  tmp.NamePrefix,
+		Match:       tmp.Match,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type ipsetOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputName  string
+	OutputDir   string
+	Mode        string
+	LoadfileDir string
+	NamePrefix  string
+	Match       []string
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (i *ipsetOut) GetType() string {
+	return i.Type
+}
+
+func (i *ipsetOut) GetAction() lib.Action {
+	return i.Action
+}
+
+func (i *ipsetOut) GetDescription() string {
+	return i.Description
+}
+
+func (i *ipsetOut) Output(container lib.Container) error {
+	var buf bytes.Buffer
+
+	for _, name := range i.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", i.Type, "entry", name)
+			continue
+		}
+
+		// An ipset of fw4 only holds addresses of one family
+		for _, ipType := range []lib.IPType{lib.IPv4, lib.IPv6} {
+			if i.OnlyIPType != "" && i.OnlyIPType != ipType {
+				continue
+			}
+
+			cidrList, err := i.marshalText(entry, ipType)
+			if err != nil || len(cidrList) == 0 {
+				continue
+			}
+
+			setName := i.setName(entry.GetName(), ipType)
+			if err := i.writeSection(&buf, setName, ipType, cidrList); err != nil {
+				return err
+			}
+		}
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	return i.writeFile(i.OutputName, buf.Bytes())
+}
+
+func (i *ipsetOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(i.Exclude)
+
+	wantList := make([]string, 0, len(i.Want))
+	for _, want := range lib.ExpandWantedList(container, i.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(i.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+// marshalText returns the CIDR list of the specified IP type,
+// an error is returned when the entry has no prefix of the type
+func (i *ipsetOut) marshalText(entry *lib.Entry, ipType lib.IPType) ([]string, error) {
+	switch ipType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	default:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	}
+}
+
+// setName converts list name to a valid set name like geoip_cn_v4
+func (i *ipsetOut) setName(name string, ipType lib.IPType) string {
+	suffix := "_v4"
+	if ipType == lib.IPv6 {
+		suffix = "_v6"
+	}
+	return invalidSetNameChar.ReplaceAllString(strings.ToLower(i.NamePrefix+name)+suffix, "_")
+}
+
+func (i *ipsetOut) writeSection(buf *bytes.Buffer, setName string, ipType lib.IPType, cidrList []string) error {
+	buf.WriteString("config ipset\n")
+	fmt.Fprintf(buf, "\toption name '%s'\n", setName)
+	fmt.Fprintf(buf, "\toption family '%s'\n", ipType)
+	for _, match := range i.Match {
+		fmt.Fprintf(buf, "\tlist match '%s'\n", match)
+	}
+
+	switch i.Mode {
+	case modeEntry:
+		for _, cidr := range cidrList {
+			fmt.Fprintf(buf, "\tlist entry '%s'\n", cidr)
+		}
+
+	case modeLoadfile:
+		// The loadfile is written to the output directory,
+		// and should be copied to loadfileDir on the router
+		filename := setName + ".txt"
+		fmt.Fprintf(buf, "\toption loadfile '%s'\n", path.Join(i.LoadfileDir, filename))
+
+		var file bytes.Buffer
+		for _, cidr := range cidrList {
+			file.WriteString(cidr)
+			file.WriteString("\n")
+		}
+		if err := i.writeFile(filename, file.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteString("\n")
+	return nil
+}
+
+func (i *ipsetOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(i.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", i.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package paloalto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeEDLOut = "paloaltoEDL"
+	descEDLOut = "Convert data to Palo Alto Networks External Dynamic List format"
+)
+
+var (
+	defaultOutputDir  = filepath.Join("./", "output", "paloalto")
+	defaultMaxEntries = 150000 // the max IP addresses of a single IP list allowed by PAN-OS
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeEDLOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newEDLOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeEDLOut, &edlOut{
+		Description: descEDLOut,
+	})
+	lib.RegisterOutputArgs(typeEDLOut, edlOutArgs{})
+}
+
+// edlOutArgs are the args of the output converter in config file
+type edlOutArgs struct {
+	OutputDir  string     `json:"outputDir"`
+	OutputExt  string     `json:"outputExtension"`
+	MaxEntries int        `json:"maxEntries"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newEDLOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp edlOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.OutputExt == "" {
+		tmp.OutputExt = ".txt"
+	}
+
+	if tmp.MaxEntries < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxEntries must not be negative", typeEDLOut, action)
+	}
+	if tmp.MaxEntries == 0 {
+		tmp.MaxEntries = defaultMaxEntries
+	}
+
+	return &edlOut{
+		Type:        typeEDLOut,
+		Action:      action,
+		Description: descEDLOut,
+		OutputDir:   tmp.OutputDir,
+		OutputExt:   tmp.OutputExt,
+		MaxEntries:  tmp.MaxEntries,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type edlOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	OutputExt   string
+	MaxEntries  int
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (e *edlOut) GetType() string {
+	return e.Type
+}
+
+func (e *edlOut) GetAction() lib.Action {
+	return e.Action
+}
+
+func (e *edlOut) GetDescription() string {
+	return e.Description
+}
+
+func (e *edlOut) Output(container lib.Container) error {
+	for _, name := range e.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", e.Type, "entry", name)
+			continue
+		}
+
+		// IPv4 and IPv6 addresses are written to separate lists,
+		// so that each of them can be referenced by policies independently
+		for _, ipType := range []lib.IPType{lib.IPv4, lib.IPv6} {
+			if e.OnlyIPType != "" && e.OnlyIPType != ipType {
+				continue
+			}
+
+			cidrList, err := e.marshalText(entry, ipType)
+			if err != nil || len(cidrList) == 0 {
+				continue
+			}
+
+			if err := e.writeLists(entry.GetName(), ipType, cidrList); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *edlOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(e.Exclude)
+
+	wantList := make([]string, 0, len(e.Want))
+	for _, want := range lib.ExpandWantedList(container, e.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(e.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+// marshalText returns the CIDR list of the specified IP type in address order,
+// an error is returned when the entry has no prefix of the type
+func (e *edlOut) marshalText(entry *lib.Entry, ipType lib.IPType) ([]string, error) {
+	switch ipType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	default:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	}
+}
+
+// writeLists writes files like cn_ipv4.txt, or cn_ipv4_1.txt, cn_ipv4_2.txt
+// when the list exceeds MaxEntries. Addresses keep their order across runs,
+// so unchanged parts of the lists produce identical files.
+func (e *edlOut) writeLists(name string, ipType lib.IPType, cidrList []string) error {
+	chunks, err := lib.SplitLines(cidrList, e.MaxEntries, 0)
+	if err != nil {
+		return err
+	}
+
+	basename := strings.ToLower(name) + "_" + string(ipType)
+	for i, chunk := range chunks {
+		filename := basename + e.OutputExt
+		if len(chunks) > 1 {
+			filename = fmt.Sprintf("%s_%d%s", basename, i+1, e.OutputExt)
+		}
+
+		var buf bytes.Buffer
+		for _, cidr := range chunk {
+			buf.WriteString(cidr)
+			buf.WriteString("\n")
+		}
+
+		if err := e.writeFile(filename, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *edlOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(e.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", e.Type, "file", filename, "dir", dir)
+
+	return nil
+}
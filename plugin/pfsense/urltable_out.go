@@ -0,0 +1,344 @@
+package pfsense
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeURLTableOut = "pfsenseURLTable"
+	descURLTableOut = "Convert data to pfSense/OPNsense URL table alias format"
+)
+
+var (
+	defaultOutputDir    = filepath.Join("./", "output", "pfsense")
+	defaultMaxLines     = 400000 // default value of "Firewall Maximum Table Entries" in pfSense
+	defaultUpdateFreq   = 1
+	defaultIndexName    = "index.txt"
+	defaultManifestName = "manifest.json"
+
+	// pfSense and OPNsense only allow letters, digits and underscores in alias names
+	invalidAliasChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	maxAliasLength   = 31
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeURLTableOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newURLTableOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeURLTableOut, &urlTableOut{
+		Description: descURLTableOut,
+	})
+	lib.RegisterOutputArgs(typeURLTableOut, urlTableOutArgs{})
+}
+
+// urlTableOutArgs are the args of the output converter in config file
+type urlTableOutArgs struct {
+	OutputDir    string     `json:"outputDir"`
+	OutputExt    string     `json:"outputExtension"`
+	Want         []string   `json:"wantedList"`
+	Exclude      []string   `json:"excludedList"`
+	OnlyIPType   lib.IPType `json:"onlyIPType"`
+	AliasPrefix  string     `json:"aliasPrefix"`
+	MaxLines     int        `json:"maxLines"`
+	MaxBytes     int        `json:"maxBytes"`
+	BaseURL      string     `json:"baseURL"`
+	UpdateFreq   int        `json:"updateFrequency"`
+	IndexName    string     `json:"indexName"`
+	ManifestName string     `json:"manifestName"`
+}
+
+func newURLTableOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp urlTableOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.OutputExt == "" {
+		tmp.OutputExt = ".txt"
+	}
+
+	if tmp.MaxLines < 0 || tmp.MaxBytes < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxLines and maxBytes must not be negative", typeURLTableOut, action)
+	}
+	if tmp.MaxLines == 0 {
+		tmp.MaxLines = defaultMaxLines
+	}
+
+	if tmp.UpdateFreq <= 0 {
+		tmp.UpdateFreq = defaultUpdateFreq
+	}
+
+	if tmp.IndexName == "" {
+		tmp.IndexName = defaultIndexName
+	}
+
+	if tmp.ManifestName == "" {
+		tmp.ManifestName = defaultManifestName
+	}
+
+	return &urlTableOut{
+		Type:         typeURLTableOut,
+		Action:       action,
+		Description:  descURLTableOut,
+		OutputDir:    tmp.OutputDir,
+		OutputExt:    tmp.OutputExt,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+		AliasPrefix:  tmp.AliasPrefix,
+		MaxLines:     tmp.MaxLines,
+		MaxBytes:     tmp.MaxBytes,
+		BaseURL:      strings.TrimRight(tmp.BaseURL, "/"),
+		UpdateFreq:   tmp.UpdateFreq,
+		IndexName:    tmp.IndexName,
+		ManifestName: tmp.ManifestName,
+	}, nil
+}
+
+type urlTableOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	OutputDir    string
+	OutputExt    string
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+	AliasPrefix  string
+	MaxLines     int
+	MaxBytes     int
+	BaseURL      string
+	UpdateFreq   int
+	IndexName    string
+	ManifestName string
+}
+
+// alias describes one URL table alias in the manifest
+type alias struct {
+	Name       string `json:"name"`
+	List       string `json:"list"`
+	File       string `json:"file"`
+	URL        string `json:"url,omitempty"`
+	Lines      int    `json:"lines"`
+	SHA256     string `json:"sha256"`
+	UpdateFreq int    `json:"updateFrequency"`
+}
+
+func (u *urlTableOut) GetType() string {
+	return u.Type
+}
+
+func (u *urlTableOut) GetAction() lib.Action {
+	return u.Action
+}
+
+func (u *urlTableOut) GetDescription() string {
+	return u.Description
+}
+
+func (u *urlTableOut) Output(container lib.Container) error {
+	aliases := make([]*alias, 0, 300)
+	names := make(map[string]string)
+
+	for _, name := range u.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", u.Type, "entry", name)
+			continue
+		}
+
+		cidrList, err := u.marshalText(entry)
+		if err != nil {
+			return err
+		}
+
+		entryAliases, err := u.writeAliases(entry.GetName(), cidrList)
+		if err != nil {
+			return err
+		}
+		// Names of long lists could be the same after they are cut
+		for _, a := range entryAliases {
+			if list, found := names[a.Name]; found {
+				return fmt.Errorf("❌ [type %s | action %s] lists %s and %s have the same alias name %s", u.Type, u.Action, list, a.List, a.Name)
+			}
+			names[a.Name] = a.List
+		}
+		aliases = append(aliases, entryAliases...)
+	}
+
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	if err := u.writeIndex(aliases); err != nil {
+		return err
+	}
+
+	return u.writeManifest(aliases)
+}
+
+func (u *urlTableOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(u.Exclude)
+
+	wantList := make([]string, 0, len(u.Want))
+	for _, want := range lib.ExpandWantedList(container, u.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(u.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (u *urlTableOut) marshalText(entry *lib.Entry) ([]string, error) {
+	switch u.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalText()
+	}
+}
+
+// aliasName converts list name to a valid pfSense/OPNsense alias name. The name is
+// cut before the suffix of the chunk is added, so that chunks get different names.
+func (u *urlTableOut) aliasName(name, suffix string) string {
+	aliasName := invalidAliasChar.ReplaceAllString(u.AliasPrefix+name, "_")
+	if len(aliasName) > maxAliasLength-len(suffix) {
+		aliasName = aliasName[:maxAliasLength-len(suffix)]
+	}
+	return aliasName + suffix
+}
+
+// writeAliases writes the CIDR list of one entry, splitting it into
+// several numbered files and aliases when it exceeds the line or size limit
+func (u *urlTableOut) writeAliases(name string, cidrList []string) ([]*alias, error) {
+	chunks, err := lib.SplitLines(cidrList, u.MaxLines, u.MaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] failed to split list %s: %v", u.Type, u.Action, name, err)
+	}
+
+	aliases := make([]*alias, 0, len(chunks))
+	for i, chunk := range chunks {
+		aliasName := u.aliasName(name, "")
+		filename := strings.ToLower(name) + u.OutputExt
+		if len(chunks) > 1 {
+			aliasName = u.aliasName(name, fmt.Sprintf("_%d", i+1))
+			filename = fmt.Sprintf("%s_%d%s", strings.ToLower(name), i+1, u.OutputExt)
+		}
+
+		var buf bytes.Buffer
+		for _, cidr := range chunk {
+			buf.WriteString(cidr)
+			buf.WriteString("\n")
+		}
+
+		if err := u.writeFile(filename, buf.Bytes()); err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(buf.Bytes())
+		a := &alias{
+			Name:       aliasName,
+			List:       name,
+			File:       filename,
+			Lines:      len(chunk),
+			SHA256:     hex.EncodeToString(sum[:]),
+			UpdateFreq: u.UpdateFreq,
+		}
+		if u.BaseURL != "" {
+			a.URL = u.BaseURL + "/" + filename
+		}
+		aliases = append(aliases, a)
+	}
+
+	return aliases, nil
+}
+
+// writeIndex writes a plain list of "alias file-or-url" pairs
+func (u *urlTableOut) writeIndex(aliases []*alias) error {
+	var buf bytes.Buffer
+	for _, a := range aliases {
+		location := a.File
+		if a.URL != "" {
+			location = a.URL
+		}
+		buf.WriteString(a.Name)
+		buf.WriteString(" ")
+		buf.WriteString(location)
+		buf.WriteString("\n")
+	}
+
+	return u.writeFile(u.IndexName, buf.Bytes())
+}
+
+// writeManifest writes a JSON manifest to be consumed by the alias update cron job
+func (u *urlTableOut) writeManifest(aliases []*alias) error {
+	manifestBytes, err := json.MarshalIndent(struct {
+		Aliases []*alias `json:"aliases"`
+	}{
+		Aliases: aliases,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return u.writeFile(u.ManifestName, append(manifestBytes, '\n'))
+}
+
+func (u *urlTableOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(u.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", u.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -2,14 +2,15 @@ package plaintext
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/v2fly/geoip/lib"
 )
@@ -26,20 +27,25 @@ func init() {
 	lib.RegisterInputConverter(typeTextIn, &textIn{
 		Description: descTextIn,
 	})
+	lib.RegisterInputArgs(typeTextIn, textInArgs{})
+}
+
+// textInArgs are the args of the input converter in config file
+type textInArgs struct {
+	Name       string     `json:"name"`
+	URI        string     `json:"uri"`
+	IPOrCIDR   []string   `json:"ipOrCIDR"`
+	InputDir   string     `json:"inputDir"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+
+	RemovePrefixesInLine []string `json:"removePrefixesInLine"`
+	RemoveSuffixesInLine []string `json:"removeSuffixesInLine"`
 }
 
 func newTextIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		Name       string     `json:"name"`
-		URI        string     `json:"uri"`
-		IPOrCIDR   []string   `json:"ipOrCIDR"`
-		InputDir   string     `json:"inputDir"`
-		Want       []string   `json:"wantedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
-
-		RemovePrefixesInLine []string `json:"removePrefixesInLine"`
-		RemoveSuffixesInLine []string `json:"removeSuffixesInLine"`
-	}
+	var tmp textInArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -59,11 +65,14 @@ func newTextIn(action lib.Action, data json.RawMessage) (lib.InputConverter, err
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeTextIn, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeTextIn, action, err)
 	}
 
 	return &textIn{
@@ -75,6 +84,7 @@ func newTextIn(action lib.Action, data json.RawMessage) (lib.InputConverter, err
 		IPOrCIDR:    tmp.IPOrCIDR,
 		InputDir:    tmp.InputDir,
 		Want:        wantList,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
 
 		RemovePrefixesInLine: tmp.RemovePrefixesInLine,
@@ -90,7 +100,8 @@ type textIn struct {
 	URI         string
 	IPOrCIDR    []string
 	InputDir    string
-	Want        map[string]bool
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
 	OnlyIPType  lib.IPType
 
 	RemovePrefixesInLine []string
@@ -109,7 +120,15 @@ func (t *textIn) GetDescription() string {
 	return t.Description
 }
 
+func (t *textIn) IsSourceInput() bool {
+	return true
+}
+
 func (t *textIn) Input(container lib.Container) (lib.Container, error) {
+	return t.InputContext(context.Background(), container)
+}
+
+func (t *textIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entries := make(map[string]*lib.Entry)
 	var err error
 
@@ -120,7 +139,7 @@ func (t *textIn) Input(container lib.Container) (lib.Container, error) {
 	case t.Name != "" && t.URI != "":
 		switch {
 		case strings.HasPrefix(strings.ToLower(t.URI), "http://"), strings.HasPrefix(strings.ToLower(t.URI), "https://"):
-			err = t.walkRemoteFile(t.URI, t.Name, entries)
+			err = t.walkRemoteFile(ctx, t.URI, t.Name, entries)
 		default:
 			err = t.walkLocalFile(t.URI, t.Name, entries)
 		}
@@ -172,6 +191,7 @@ func (t *textIn) Input(container lib.Container) (lib.Container, error) {
 }
 
 func (t *textIn) walkDir(dir string, entries map[string]*lib.Entry) error {
+	lib.RecordSource(dir)
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -212,7 +232,7 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 
 	entryName = strings.ToUpper(entryName)
 
-	if len(t.Want) > 0 && !t.Want[entryName] {
+	if (!t.Want.IsEmpty() && !t.Want.Match(entryName)) || t.Exclude.Match(entryName) {
 		return nil
 	}
 	if _, found := entries[entryName]; found {
@@ -220,6 +240,7 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 	}
 
 	entry := lib.NewEntry(entryName)
+	lib.RecordSource(path)
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -234,25 +255,21 @@ func (t *textIn) walkLocalFile(path, name string, entries map[string]*lib.Entry)
 	return nil
 }
 
-func (t *textIn) walkRemoteFile(url, name string, entries map[string]*lib.Entry) error {
-	resp, err := http.Get(url)
+func (t *textIn) walkRemoteFile(ctx context.Context, url, name string, entries map[string]*lib.Entry) error {
+	body, err := lib.GetRemoteURLReaderContext(ctx, url)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to get remote file %s, http status code %d", url, resp.StatusCode)
-	}
+	defer body.Close()
 
 	name = strings.ToUpper(name)
 
-	if len(t.Want) > 0 && !t.Want[name] {
+	if (!t.Want.IsEmpty() && !t.Want.Match(name)) || t.Exclude.Match(name) {
 		return nil
 	}
 
 	entry := lib.NewEntry(name)
-	if err := t.scanFile(resp.Body, entry); err != nil {
+	if err := t.scanFile(body, entry); err != nil {
 		return err
 	}
 
@@ -263,8 +280,12 @@ func (t *textIn) walkRemoteFile(url, name string, entries map[string]*lib.Entry)
 
 func (t *textIn) scanFile(reader io.Reader, entry *lib.Entry) error {
 	scanner := bufio.NewScanner(reader)
+	lines, start := 0, time.Now()
 	for scanner.Scan() {
 		line := scanner.Text()
+		if lines++; lines%lib.ProgressReportInterval == 0 {
+			lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: t.Type, List: entry.GetName(), Lines: lines})
+		}
 
 		line, _, _ = strings.Cut(line, "#")
 		line, _, _ = strings.Cut(line, "//")
@@ -293,6 +314,7 @@ func (t *textIn) scanFile(reader io.Reader, entry *lib.Entry) error {
 	if err := scanner.Err(); err != nil {
 		return err
 	}
+	lib.ReportProgress(&lib.ProgressEvent{Stage: lib.ProgressParse, Plugin: t.Type, List: entry.GetName(), Lines: lines, Duration: time.Since(start), Done: true})
 
 	return nil
 }
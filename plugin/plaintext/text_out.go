@@ -3,7 +3,8 @@ package plaintext
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
@@ -28,19 +29,28 @@ func init() {
 	lib.RegisterOutputConverter(typeTextOut, &textOut{
 		Description: descTextOut,
 	})
+	lib.RegisterOutputArgs(typeTextOut, textOutArgs{})
 }
 
-func newTextOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
-	var tmp struct {
-		OutputDir  string     `json:"outputDir"`
-		OutputExt  string     `json:"outputExtension"`
-		Want       []string   `json:"wantedList"`
-		Exclude    []string   `json:"excludedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
+// textOutArgs are the args of the output converter in config file
+type textOutArgs struct {
+	OutputDir  string     `json:"outputDir"`
+	OutputExt  string     `json:"outputExtension"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
 
-		AddPrefixInLine string `json:"addPrefixInLine"`
-		AddSuffixInLine string `json:"addSuffixInLine"`
-	}
+	AddPrefixInLine string `json:"addPrefixInLine"`
+	AddSuffixInLine string `json:"addSuffixInLine"`
+
+	MaxLines int `json:"maxLines"`
+	MaxBytes int `json:"maxBytes"`
+
+	BuildInfo bool `json:"buildInfo"`
+}
+
+func newTextOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp textOutArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -56,6 +66,15 @@ func newTextOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, e
 		tmp.OutputExt = ".txt"
 	}
 
+	if tmp.MaxLines < 0 || tmp.MaxBytes < 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxLines and maxBytes must not be negative", typeTextOut, action)
+	}
+
+	// The comment line of build info would not be counted in the limits of consumers
+	if tmp.BuildInfo && (tmp.MaxLines > 0 || tmp.MaxBytes > 0) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] buildInfo must not be used with maxLines or maxBytes", typeTextOut, action)
+	}
+
 	return &textOut{
 		Type:        typeTextOut,
 		Action:      action,
@@ -68,6 +87,11 @@ func newTextOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, e
 
 		AddPrefixInLine: tmp.AddPrefixInLine,
 		AddSuffixInLine: tmp.AddSuffixInLine,
+
+		MaxLines: tmp.MaxLines,
+		MaxBytes: tmp.MaxBytes,
+
+		BuildInfo: tmp.BuildInfo,
 	}, nil
 }
 
@@ -83,6 +107,11 @@ type textOut struct {
 
 	AddPrefixInLine string
 	AddSuffixInLine string
+
+	MaxLines int
+	MaxBytes int
+
+	BuildInfo bool
 }
 
 func (t *textOut) GetType() string {
@@ -98,10 +127,15 @@ func (t *textOut) GetDescription() string {
 }
 
 func (t *textOut) Output(container lib.Container) error {
+	var header string
+	if t.BuildInfo {
+		header = "# " + lib.NewBuildInfo(container).Comment()
+	}
+
 	for _, name := range t.filterAndSortList(container) {
 		entry, found := container.GetEntry(name)
 		if !found {
-			log.Printf("❌ entry %s not found\n", name)
+			slog.Warn("entry not found", "plugin", t.Type, "entry", name)
 			continue
 		}
 
@@ -110,9 +144,25 @@ func (t *textOut) Output(container lib.Container) error {
 			return err
 		}
 
-		filename := strings.ToLower(entry.GetName()) + t.OutputExt
-		if err := t.writeFile(filename, cidrList); err != nil {
-			return err
+		lines := make([]string, 0, len(cidrList))
+		for _, cidr := range cidrList {
+			lines = append(lines, t.AddPrefixInLine+cidr+t.AddSuffixInLine)
+		}
+
+		chunks, err := lib.SplitLines(lines, t.MaxLines, t.MaxBytes)
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] failed to split list %s: %v", t.Type, t.Action, entry.GetName(), err)
+		}
+
+		// Split lists are written to numbered files like cn_1.txt, cn_2.txt
+		for i, chunk := range chunks {
+			filename := strings.ToLower(entry.GetName()) + t.OutputExt
+			if len(chunks) > 1 {
+				filename = fmt.Sprintf("%s_%d%s", strings.ToLower(entry.GetName()), i+1, t.OutputExt)
+			}
+			if err := t.writeFile(filename, header, chunk); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -120,21 +170,17 @@ func (t *textOut) Output(container lib.Container) error {
 }
 
 func (t *textOut) filterAndSortList(container lib.Container) []string {
-	excludeMap := make(map[string]bool)
-	for _, exclude := range t.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
-	}
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(t.Exclude)
 
 	wantList := make([]string, 0, len(t.Want))
-	for _, want := range t.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
+	for _, want := range lib.ExpandWantedList(container, t.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
 			wantList = append(wantList, want)
 		}
 	}
 
-	if len(wantList) > 0 {
+	if len(wantList) > 0 || lib.HasListPattern(t.Want) {
 		// Sort the list
 		slices.Sort(wantList)
 		return wantList
@@ -143,7 +189,7 @@ func (t *textOut) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] {
+		if excludeList.Match(name) {
 			continue
 		}
 		list = append(list, name)
@@ -179,29 +225,32 @@ func (t *textOut) marshalText(entry *lib.Entry) ([]string, error) {
 	return entryCidr, nil
 }
 
-func (t *textOut) writeFile(filename string, cidrList []string) error {
+// writeFile writes the lines to the file, after the header line if not empty
+func (t *textOut) writeFile(filename, header string, lines []string) error {
 	var buf bytes.Buffer
-	for _, cidr := range cidrList {
-		if t.AddPrefixInLine != "" {
-			buf.WriteString(t.AddPrefixInLine)
-		}
-		buf.WriteString(cidr)
-		if t.AddSuffixInLine != "" {
-			buf.WriteString(t.AddSuffixInLine)
-		}
+	if header != "" {
+		buf.WriteString(header)
+		buf.WriteString("\n")
+	}
+	for _, line := range lines {
+		buf.WriteString(line)
 		buf.WriteString("\n")
 	}
 	cidrBytes := buf.Bytes()
 
-	if err := os.MkdirAll(t.OutputDir, 0755); err != nil {
+	dir, filename, err := lib.ResolveOutputPath(t.OutputDir, filename, cidrBytes)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(filepath.Join(t.OutputDir, filename), cidrBytes, 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(dir, filename), cidrBytes, 0644); err != nil {
 		return err
 	}
 
-	log.Printf("✅ [%s] %s --> %s", t.Type, filename, t.OutputDir)
+	slog.Info("file written", "plugin", t.Type, "file", filename, "dir", dir)
 
 	return nil
 }
@@ -0,0 +1,259 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeTextfileOut = "prometheusTextfile"
+	descTextfileOut = "Convert data to Prometheus node_exporter textfile metrics"
+)
+
+var (
+	defaultOutputDir    = filepath.Join("./", "output", "prometheus")
+	defaultOutputName   = "geoip.prom"
+	defaultMetricPrefix = "geoip"
+
+	validMetricPrefix = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeTextfileOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newTextfileOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeTextfileOut, &textfileOut{
+		Description: descTextfileOut,
+	})
+	lib.RegisterOutputArgs(typeTextfileOut, textfileOutArgs{})
+}
+
+// textfileOutArgs are the args of the output converter in config file
+type textfileOutArgs struct {
+	OutputName   string     `json:"outputName"`
+	OutputDir    string     `json:"outputDir"`
+	MetricPrefix string     `json:"metricPrefix"`
+	Want         []string   `json:"wantedList"`
+	Exclude      []string   `json:"excludedList"`
+	OnlyIPType   lib.IPType `json:"onlyIPType"`
+}
+
+func newTextfileOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp textfileOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.MetricPrefix == "" {
+		tmp.MetricPrefix = defaultMetricPrefix
+	}
+	if !validMetricPrefix.MatchString(tmp.MetricPrefix) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid metricPrefix %s", typeTextfileOut, action, tmp.MetricPrefix)
+	}
+
+	return &textfileOut{
+		Type:         typeTextfileOut,
+		Action:       action,
+		Description:  descTextfileOut,
+		OutputName:   tmp.OutputName,
+		OutputDir:    tmp.OutputDir,
+		MetricPrefix: tmp.MetricPrefix,
+		Want:         tmp.Want,
+		Exclude:      tmp.Exclude,
+		OnlyIPType:   tmp.OnlyIPType,
+	}, nil
+}
+
+type textfileOut struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	OutputName   string
+	OutputDir    string
+	MetricPrefix string
+	Want         []string
+	Exclude      []string
+	OnlyIPType   lib.IPType
+}
+
+// sample is the value of a metric for one list and IP type
+type sample struct {
+	List      string
+	IPType    lib.IPType
+	Prefixes  int
+	Addresses float64
+}
+
+func (t *textfileOut) GetType() string {
+	return t.Type
+}
+
+func (t *textfileOut) GetAction() lib.Action {
+	return t.Action
+}
+
+func (t *textfileOut) GetDescription() string {
+	return t.Description
+}
+
+func (t *textfileOut) Output(container lib.Container) error {
+	samples := make([]*sample, 0, 600)
+
+	for _, name := range t.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", t.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := t.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		samples = append(samples, t.generateSamples(strings.ToLower(entry.GetName()), prefixes)...)
+	}
+
+	return t.writeFile(t.OutputName, t.marshal(samples, lib.BuildTime()))
+}
+
+func (t *textfileOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(t.Exclude)
+
+	wantList := make([]string, 0, len(t.Want))
+	for _, want := range lib.ExpandWantedList(container, t.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(t.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (t *textfileOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch t.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// generateSamples counts prefixes and covered addresses of every IP type.
+// Address counts are float64 since IPv6 counts overflow any integer type.
+func (t *textfileOut) generateSamples(name string, prefixes []netip.Prefix) []*sample {
+	ipv4 := &sample{List: name, IPType: lib.IPv4}
+	ipv6 := &sample{List: name, IPType: lib.IPv6}
+	for _, prefix := range prefixes {
+		s := ipv6
+		if prefix.Addr().Is4() {
+			s = ipv4
+		}
+		s.Prefixes++
+		s.Addresses += math.Exp2(float64(prefix.Addr().BitLen() - prefix.Bits()))
+	}
+
+	samples := make([]*sample, 0, 2)
+	if t.OnlyIPType != lib.IPv6 {
+		samples = append(samples, ipv4)
+	}
+	if t.OnlyIPType != lib.IPv4 {
+		samples = append(samples, ipv6)
+	}
+	return samples
+}
+
+func (t *textfileOut) marshal(samples []*sample, now time.Time) []byte {
+	var buf bytes.Buffer
+
+	prefixesMetric := t.MetricPrefix + "_list_prefixes"
+	fmt.Fprintf(&buf, "# HELP %s Number of CIDR prefixes in the list.\n", prefixesMetric)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", prefixesMetric)
+	for _, s := range samples {
+		fmt.Fprintf(&buf, "%s{list=%q,ip_type=%q} %d\n", prefixesMetric, s.List, s.IPType, s.Prefixes)
+	}
+
+	addressesMetric := t.MetricPrefix + "_list_addresses"
+	fmt.Fprintf(&buf, "# HELP %s Number of IP addresses covered by the list.\n", addressesMetric)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", addressesMetric)
+	for _, s := range samples {
+		fmt.Fprintf(&buf, "%s{list=%q,ip_type=%q} %s\n", addressesMetric, s.List, s.IPType, strconv.FormatFloat(s.Addresses, 'g', -1, 64))
+	}
+
+	timestampMetric := t.MetricPrefix + "_build_timestamp_seconds"
+	fmt.Fprintf(&buf, "# HELP %s Unix time when the lists were built.\n", timestampMetric)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", timestampMetric)
+	fmt.Fprintf(&buf, "%s %d\n", timestampMetric, now.Unix())
+
+	return buf.Bytes()
+}
+
+// writeFile writes to a temporary file and renames it, so that the textfile
+// collector of node_exporter never reads a partially written file
+func (t *textfileOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(t.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, filename)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", t.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package records
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeCSVOut = "csv"
+	descCSVOut = "Convert data to CSV rows of CIDRs with their lists and metadata"
+)
+
+var (
+	defaultCSVOutputDir  = filepath.Join("./", "output", "csv")
+	defaultCSVOutputName = "geoip.csv"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeCSVOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newCSVOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeCSVOut, &csvOut{
+		Description: descCSVOut,
+	})
+	lib.RegisterOutputArgs(typeCSVOut, csvOutArgs{})
+}
+
+// csvOutArgs are the args of the output converter in config file
+type csvOutArgs struct {
+	OutputName string     `json:"outputName"`
+	OutputDir  string     `json:"outputDir"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newCSVOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp csvOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultCSVOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultCSVOutputDir
+	}
+
+	return &csvOut{
+		Type:        typeCSVOut,
+		Action:      action,
+		Description: descCSVOut,
+		OutputName:  tmp.OutputName,
+		OutputDir:   tmp.OutputDir,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type csvOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputName  string
+	OutputDir   string
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (c *csvOut) GetType() string {
+	return c.Type
+}
+
+func (c *csvOut) GetAction() lib.Action {
+	return c.Action
+}
+
+func (c *csvOut) GetDescription() string {
+	return c.Description
+}
+
+func (c *csvOut) Output(container lib.Container) error {
+	records := generateRecords(c.Type, container, c.Want, c.Exclude, c.OnlyIPType)
+
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	w.Write([]string{"network", "list", "asn", "city", "source", "confidence"})
+	for _, r := range records {
+		row := []string{r.Network, r.List, "", r.City, r.Source, ""}
+		if r.ASN != 0 {
+			row[2] = strconv.FormatUint(uint64(r.ASN), 10)
+		}
+		if r.Confidence != 0 {
+			row[5] = strconv.FormatFloat(r.Confidence, 'f', -1, 64)
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return c.writeFile(c.OutputName, buf.Bytes())
+}
+
+func (c *csvOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(c.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", c.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package records
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeJSONOut = "json"
+	descJSONOut = "Convert data to JSON objects of CIDRs with their lists and metadata"
+)
+
+var (
+	defaultJSONOutputDir  = filepath.Join("./", "output", "json")
+	defaultJSONOutputName = "geoip.json"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeJSONOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newJSONOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeJSONOut, &jsonOut{
+		Description: descJSONOut,
+	})
+	lib.RegisterOutputArgs(typeJSONOut, jsonOutArgs{})
+}
+
+// jsonOutArgs are the args of the output converter in config file
+type jsonOutArgs struct {
+	OutputName string     `json:"outputName"`
+	OutputDir  string     `json:"outputDir"`
+	Indent     bool       `json:"indent"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newJSONOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp jsonOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultJSONOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultJSONOutputDir
+	}
+
+	return &jsonOut{
+		Type:        typeJSONOut,
+		Action:      action,
+		Description: descJSONOut,
+		OutputName:  tmp.OutputName,
+		OutputDir:   tmp.OutputDir,
+		Indent:      tmp.Indent,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type jsonOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputName  string
+	OutputDir   string
+	Indent      bool
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+func (j *jsonOut) GetType() string {
+	return j.Type
+}
+
+func (j *jsonOut) GetAction() lib.Action {
+	return j.Action
+}
+
+func (j *jsonOut) GetDescription() string {
+	return j.Description
+}
+
+func (j *jsonOut) Output(container lib.Container) error {
+	records := generateRecords(j.Type, container, j.Want, j.Exclude, j.OnlyIPType)
+
+	var data []byte
+	var err error
+	if j.Indent {
+		data, err = json.MarshalIndent(records, "", "  ")
+	} else {
+		data, err = json.Marshal(records)
+	}
+	if err != nil {
+		return err
+	}
+
+	return j.writeFile(j.OutputName, append(data, '\n'))
+}
+
+func (j *jsonOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(j.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", j.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package records
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+// record is a CIDR of a list with its metadata, written as a row of CSV or an object of JSON
+type record struct {
+	Network string `json:"network"`
+	List    string `json:"list"`
+	lib.Metadata
+}
+
+// generateRecords returns the records of the lists sorted by name, whose CIDRs are sorted
+func generateRecords(iType string, container lib.Container, want, exclude []string, onlyIPType lib.IPType) []record {
+	var ignoreIPType lib.IgnoreIPOption
+	switch onlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	records := make([]record, 0, 1024)
+	for _, name := range filterAndSortList(container, want, exclude) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", iType, "entry", name)
+			continue
+		}
+
+		prefixes, err := entry.MarshalPrefixWithMetadata(ignoreIPType)
+		if err != nil {
+			// Lists without prefixes of the IP type are skipped
+			continue
+		}
+		for _, prefix := range prefixes {
+			r := record{Network: prefix.Prefix.String(), List: strings.ToLower(name)}
+			if prefix.Metadata != nil {
+				r.Metadata = *prefix.Metadata
+			}
+			records = append(records, r)
+		}
+	}
+
+	return records
+}
+
+func filterAndSortList(container lib.Container, want, exclude []string) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(exclude)
+
+	wantList := make([]string, 0, len(want))
+	for _, name := range lib.ExpandWantedList(container, want) {
+		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" && !excludeList.Match(name) {
+			wantList = append(wantList, name)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(want) {
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		if name := entry.GetName(); !excludeList.Match(name) {
+			list = append(list, name)
+		}
+	}
+	slices.Sort(list)
+
+	return list
+}
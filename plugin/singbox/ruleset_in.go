@@ -0,0 +1,226 @@
+package singbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeRuleSetIn = "singboxRuleSet"
+	descRuleSetIn = "Convert sing-box source rule-sets to other formats"
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeRuleSetIn, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newRuleSetIn(action, data)
+	})
+	lib.RegisterInputConverter(typeRuleSetIn, &ruleSetIn{
+		Description: descRuleSetIn,
+	})
+	lib.RegisterInputArgs(typeRuleSetIn, ruleSetInArgs{})
+}
+
+// ruleSetInArgs are the args of the input converter in config file
+type ruleSetInArgs struct {
+	Name       string     `json:"name"`
+	URI        string     `json:"uri"`
+	InputDir   string     `json:"inputDir"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newRuleSetIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp ruleSetInArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.InputDir == "" {
+		if tmp.Name == "" || tmp.URI == "" {
+			return nil, fmt.Errorf("❌ [type %s | action %s] missing inputDir or name and uri", typeRuleSetIn, action)
+		}
+	} else if tmp.Name != "" || tmp.URI != "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] inputDir is not allowed to be used with name or uri", typeRuleSetIn, action)
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeRuleSetIn, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeRuleSetIn, action, err)
+	}
+
+	return &ruleSetIn{
+		Type:        typeRuleSetIn,
+		Action:      action,
+		Description: descRuleSetIn,
+		Name:        tmp.Name,
+		URI:         tmp.URI,
+		InputDir:    tmp.InputDir,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type ruleSetIn struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Name        string
+	URI         string
+	InputDir    string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (r *ruleSetIn) GetType() string {
+	return r.Type
+}
+
+func (r *ruleSetIn) GetAction() lib.Action {
+	return r.Action
+}
+
+func (r *ruleSetIn) GetDescription() string {
+	return r.Description
+}
+
+func (r *ruleSetIn) IsSourceInput() bool {
+	return true
+}
+
+func (r *ruleSetIn) Input(container lib.Container) (lib.Container, error) {
+	return r.InputContext(context.Background(), container)
+}
+
+func (r *ruleSetIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	entries := make(map[string]*lib.Entry)
+	var err error
+
+	switch {
+	case r.InputDir != "":
+		err = r.walkDir(r.InputDir, entries)
+	case strings.HasPrefix(strings.ToLower(r.URI), "http://"), strings.HasPrefix(strings.ToLower(r.URI), "https://"):
+		err = r.walkRemoteFile(ctx, r.URI, r.Name, entries)
+	default:
+		err = r.walkLocalFile(r.URI, r.Name, entries)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] no entry is generated", r.Type, r.Action)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch r.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, entry := range entries {
+		switch r.Action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+// walkDir reads every .json file in the directory as a list named after the file
+func (r *ruleSetIn) walkDir(dir string, entries map[string]*lib.Entry) error {
+	lib.RecordSource(dir)
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return nil
+		}
+		return r.walkLocalFile(path, strings.TrimSuffix(d.Name(), filepath.Ext(path)), entries)
+	})
+}
+
+func (r *ruleSetIn) walkLocalFile(path, name string, entries map[string]*lib.Entry) error {
+	lib.RecordSource(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return r.generateEntry(file, name, entries)
+}
+
+func (r *ruleSetIn) walkRemoteFile(ctx context.Context, url, name string, entries map[string]*lib.Entry) error {
+	body, err := lib.GetRemoteURLReaderContext(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return r.generateEntry(body, name, entries)
+}
+
+// generateEntry adds ip_cidr of all rules to the list. Rules of ip_asn are
+// skipped, as they rely on the ASN database of clients.
+func (r *ruleSetIn) generateEntry(reader io.Reader, name string, entries map[string]*lib.Entry) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if (!r.Want.IsEmpty() && !r.Want.Match(name)) || r.Exclude.Match(name) {
+		return nil
+	}
+	if _, found := entries[name]; found {
+		return fmt.Errorf("found duplicated list %s", name)
+	}
+
+	var rs ruleSet
+	if err := json.NewDecoder(reader).Decode(&rs); err != nil {
+		return fmt.Errorf("invalid rule-set of list %s: %w", name, err)
+	}
+
+	entry := lib.NewEntry(name)
+	for _, rule := range rs.Rules {
+		if len(rule.IPASN) > 0 {
+			slog.Warn("ip_asn rule skipped", "plugin", r.Type, "list", name)
+		}
+		for _, cidr := range rule.IPCIDR {
+			if err := entry.AddPrefix(cidr); err != nil {
+				return fmt.Errorf("invalid ip_cidr %s of list %s: %w", cidr, name, err)
+			}
+		}
+	}
+
+	entries[name] = entry
+	return nil
+}
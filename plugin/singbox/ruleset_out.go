@@ -0,0 +1,215 @@
+package singbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeRuleSetOut = "singboxRuleSet"
+	descRuleSetOut = "Convert data to sing-box source rule-sets, with ip_asn rules for lists of autonomous systems"
+)
+
+var (
+	defaultOutputDir = filepath.Join("./", "output", "sing-box")
+	defaultVersion   = 2
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeRuleSetOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newRuleSetOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeRuleSetOut, &ruleSetOut{
+		Description: descRuleSetOut,
+	})
+	lib.RegisterOutputArgs(typeRuleSetOut, ruleSetOutArgs{})
+}
+
+// ruleSetOutArgs are the args of the output converter in config file
+type ruleSetOutArgs struct {
+	OutputDir  string     `json:"outputDir"`
+	Version    int        `json:"version"`
+	ASNRule    bool       `json:"asnRule"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newRuleSetOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp ruleSetOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.Version == 0 {
+		tmp.Version = defaultVersion
+	}
+	if tmp.Version < 1 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid version %d", typeRuleSetOut, action, tmp.Version)
+	}
+
+	return &ruleSetOut{
+		Type:        typeRuleSetOut,
+		Action:      action,
+		Description: descRuleSetOut,
+		OutputDir:   tmp.OutputDir,
+		Version:     tmp.Version,
+		ASNRule:     tmp.ASNRule,
+		Want:        tmp.Want,
+		Exclude:     tmp.Exclude,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type ruleSetOut struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	OutputDir   string
+	Version     int
+	ASNRule     bool
+	Want        []string
+	Exclude     []string
+	OnlyIPType  lib.IPType
+}
+
+// ruleSet is the source format of sing-box rule-sets
+type ruleSet struct {
+	Version int     `json:"version"`
+	Rules   []*rule `json:"rules"`
+}
+
+type rule struct {
+	IPCIDR []string `json:"ip_cidr,omitempty"`
+	IPASN  []uint32 `json:"ip_asn,omitempty"`
+}
+
+func (r *ruleSetOut) GetType() string {
+	return r.Type
+}
+
+func (r *ruleSetOut) GetAction() lib.Action {
+	return r.Action
+}
+
+func (r *ruleSetOut) GetDescription() string {
+	return r.Description
+}
+
+func (r *ruleSetOut) Output(container lib.Container) error {
+	for _, name := range r.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", r.Type, "entry", name)
+			continue
+		}
+
+		rs, err := r.generateRuleSet(entry)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(rs, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := r.writeFile(strings.ToLower(entry.GetName())+".json", append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateRuleSet returns the rule-set of the entry. Lists of autonomous systems are
+// matched by ip_asn with asnRule, which relies on the ASN database of clients.
+func (r *ruleSetOut) generateRuleSet(entry *lib.Entry) (*ruleSet, error) {
+	rs := &ruleSet{Version: r.Version}
+
+	if asn, ok := lib.ParseASN(entry.GetName()); ok && r.ASNRule {
+		rs.Rules = []*rule{{IPASN: []uint32{asn}}}
+		return rs, nil
+	}
+
+	var cidrs []string
+	var err error
+	switch r.OnlyIPType {
+	case lib.IPv4:
+		cidrs, err = entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		cidrs, err = entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		cidrs, err = entry.MarshalText()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rs.Rules = []*rule{{IPCIDR: cidrs}}
+	return rs, nil
+}
+
+func (r *ruleSetOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(r.Exclude)
+
+	wantList := make([]string, 0, len(r.Want))
+	for _, want := range lib.ExpandWantedList(container, r.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(r.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (r *ruleSetOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(r.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", r.Type, "file", filename, "dir", dir)
+
+	return nil
+}
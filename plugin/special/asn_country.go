@@ -0,0 +1,307 @@
+package special
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeASNCountry = "asnCountry"
+	descASNCountry = "Join lists of autonomous systems and countries of previous steps into lists like as13335-us, or annotate countries with ASNs"
+)
+
+const (
+	asnCountrySplit    = "split"    // lists of autonomous systems split by countries
+	asnCountryAnnotate = "annotate" // prefixes of countries annotated with their origin ASNs
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeASNCountry, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newASNCountry(action, data)
+	})
+	lib.RegisterInputConverter(typeASNCountry, &asnCountry{
+		Description: descASNCountry,
+	})
+	lib.RegisterInputArgs(typeASNCountry, asnCountryArgs{})
+}
+
+// asnCountryArgs are the args of the input converter in config file
+type asnCountryArgs struct {
+	Mode        string     `json:"mode"`
+	ASNList     []string   `json:"asnList"`
+	CountryList []string   `json:"countryList"`
+	OnlyIPType  lib.IPType `json:"onlyIPType"`
+}
+
+func newASNCountry(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp asnCountryArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionAdd {
+		return nil, fmt.Errorf("type %s only supports `add` action", typeASNCountry)
+	}
+
+	switch tmp.Mode = strings.ToLower(strings.TrimSpace(tmp.Mode)); tmp.Mode {
+	case "":
+		tmp.Mode = asnCountrySplit
+	case asnCountrySplit, asnCountryAnnotate:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid mode %s, the value must be %s or %s", typeASNCountry, action, tmp.Mode, asnCountrySplit, asnCountryAnnotate)
+	}
+
+	asnList, err := lib.NewListMatcher(tmp.ASNList)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in asnList", typeASNCountry, action, err)
+	}
+
+	countryList, err := lib.NewListMatcher(tmp.CountryList)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in countryList", typeASNCountry, action, err)
+	}
+
+	return &asnCountry{
+		Type:        typeASNCountry,
+		Action:      action,
+		Description: descASNCountry,
+		Mode:        tmp.Mode,
+		ASNList:     asnList,
+		CountryList: countryList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type asnCountry struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Mode        string
+	ASNList     *lib.ListMatcher
+	CountryList *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (a *asnCountry) GetType() string {
+	return a.Type
+}
+
+func (a *asnCountry) GetAction() lib.Action {
+	return a.Action
+}
+
+func (a *asnCountry) GetDescription() string {
+	return a.Description
+}
+
+// countryRange is a range of a country, with the metadata of it
+type countryRange struct {
+	r        netipx.IPRange
+	country  string
+	metadata *lib.Metadata
+}
+
+// countryIndex finds the ranges of countries overlapping a range. Ranges are
+// sorted by their first addresses, and maxTo[i] is the max last address of
+// ranges[:i+1], as lists of countries may overlap.
+type countryIndex struct {
+	ranges []countryRange
+	maxTo  []netip.Addr
+}
+
+func newCountryIndex(ranges []countryRange) *countryIndex {
+	slices.SortFunc(ranges, func(a, b countryRange) int {
+		return a.r.From().Compare(b.r.From())
+	})
+	maxTo := make([]netip.Addr, len(ranges))
+	for i, cr := range ranges {
+		maxTo[i] = cr.r.To()
+		if i > 0 && maxTo[i-1].Compare(maxTo[i]) > 0 {
+			maxTo[i] = maxTo[i-1]
+		}
+	}
+	return &countryIndex{ranges: ranges, maxTo: maxTo}
+}
+
+// overlaps calls fn with every range of countries overlapping r, and the overlap
+func (idx *countryIndex) overlaps(r netipx.IPRange, fn func(cr countryRange, overlap netipx.IPRange)) {
+	end := sort.Search(len(idx.ranges), func(i int) bool {
+		return idx.ranges[i].r.From().Compare(r.To()) > 0
+	})
+	for i := end - 1; i >= 0 && idx.maxTo[i].Compare(r.From()) >= 0; i-- {
+		cr := idx.ranges[i]
+		if cr.r.To().Compare(r.From()) < 0 {
+			continue
+		}
+		from, to := cr.r.From(), cr.r.To()
+		if from.Compare(r.From()) < 0 {
+			from = r.From()
+		}
+		if to.Compare(r.To()) > 0 {
+			to = r.To()
+		}
+		fn(cr, netipx.IPRangeFrom(from, to))
+	}
+}
+
+// isASNList reports whether the list is of an autonomous system, tagged by ASN-aware
+// inputs or named like AS13335
+func isASNList(entry *lib.Entry) bool {
+	_, ok := lib.ParseASN(entry.GetName())
+	return ok || entry.HasTag(lib.TagASN)
+}
+
+func (a *asnCountry) Input(container lib.Container) (lib.Container, error) {
+	var ignoreIPType lib.IgnoreIPOption
+	switch a.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	asns := make([]*lib.Entry, 0)
+	ranges := make([]countryRange, 0)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		switch {
+		case a.ASNList.IsEmpty() && isASNList(entry), !a.ASNList.IsEmpty() && a.ASNList.Match(name):
+			asns = append(asns, entry)
+		case a.CountryList.IsEmpty() && lib.IsCountryCode(name), !a.CountryList.IsEmpty() && a.CountryList.Match(name):
+			prefixes, err := entry.MarshalPrefixWithMetadata(ignoreIPType)
+			if err != nil {
+				// Lists without prefixes of the IP type
+				continue
+			}
+			for _, p := range prefixes {
+				ranges = append(ranges, countryRange{r: netipx.RangeOfPrefix(p.Prefix), country: name, metadata: p.Metadata})
+			}
+		}
+	}
+	if len(asns) == 0 || len(ranges) == 0 {
+		slog.Warn("no list of autonomous systems or countries is found", "plugin", a.Type, "asns", len(asns), "countries", len(ranges))
+		return container, nil
+	}
+	index := newCountryIndex(ranges)
+
+	if a.Mode == asnCountryAnnotate {
+		return a.annotate(container, asns, index, ignoreIPType)
+	}
+	return a.split(container, asns, index, ignoreIPType)
+}
+
+// split adds lists of the overlaps of every autonomous system and every country,
+// named like AS13335-US, with the tags of the lists of autonomous systems
+func (a *asnCountry) split(container lib.Container, asns []*lib.Entry, index *countryIndex, ignoreIPType lib.IgnoreIPOption) (lib.Container, error) {
+	added := make([]*lib.Entry, 0)
+	for _, asn := range asns {
+		builders := make(map[string]*netipx.IPSetBuilder)
+		for _, r := range asnRanges(asn, a.OnlyIPType) {
+			index.overlaps(r, func(cr countryRange, overlap netipx.IPRange) {
+				if builders[cr.country] == nil {
+					builders[cr.country] = new(netipx.IPSetBuilder)
+				}
+				builders[cr.country].AddRange(overlap)
+			})
+		}
+
+		for country, builder := range builders {
+			set, err := builder.IPSet()
+			if err != nil {
+				return nil, err
+			}
+			entry := lib.NewEntry(asn.GetName() + "-" + country)
+			entry.AddTag(asn.GetTags()...)
+			for _, prefix := range set.Prefixes() {
+				if err := entry.AddPrefix(prefix); err != nil {
+					return nil, err
+				}
+			}
+			added = append(added, entry)
+		}
+	}
+
+	for _, entry := range added {
+		if err := container.Add(entry, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("lists of autonomous systems split by countries", "plugin", a.Type, "asns", len(asns), "lists", len(added))
+	return container, nil
+}
+
+// annotate sets the ASN of the metadata of prefixes of countries overlapping the
+// lists of autonomous systems named like AS13335, keeping their other metadata
+func (a *asnCountry) annotate(container lib.Container, asns []*lib.Entry, index *countryIndex, ignoreIPType lib.IgnoreIPOption) (lib.Container, error) {
+	annotated := make(map[string]*lib.Entry)
+	unnamed := 0
+	for _, asn := range asns {
+		number, ok := lib.ParseASN(asn.GetName())
+		if !ok {
+			unnamed++
+			continue
+		}
+		var err error
+		for _, r := range asnRanges(asn, a.OnlyIPType) {
+			index.overlaps(r, func(cr countryRange, overlap netipx.IPRange) {
+				entry, found := annotated[cr.country]
+				if !found {
+					entry = lib.NewEntry(cr.country)
+					annotated[cr.country] = entry
+				}
+				var metadata lib.Metadata
+				if cr.metadata != nil {
+					metadata = *cr.metadata
+				}
+				metadata.ASN = number
+				for _, prefix := range overlap.Prefixes() {
+					if e := entry.AddMetadata(prefix, metadata); e != nil && err == nil {
+						err = e
+					}
+				}
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if unnamed > 0 {
+		slog.Warn("lists of autonomous systems not named like AS13335 are skipped", "plugin", a.Type, "lists", unnamed)
+	}
+
+	for _, entry := range annotated {
+		// Only the metadata is added to the lists of countries
+		if err := container.Add(entry, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("prefixes of countries annotated with ASNs", "plugin", a.Type, "asns", len(asns)-unnamed, "countries", len(annotated))
+	return container, nil
+}
+
+// asnRanges returns the ranges of the list of the IP type, or both if empty
+func asnRanges(entry *lib.Entry, onlyIPType lib.IPType) []netipx.IPRange {
+	ranges := make([]netipx.IPRange, 0)
+	if onlyIPType != lib.IPv6 {
+		if set, err := entry.GetIPv4Set(); err == nil {
+			ranges = append(ranges, set.Ranges()...)
+		}
+	}
+	if onlyIPType != lib.IPv4 {
+		if set, err := entry.GetIPv6Set(); err == nil {
+			ranges = append(ranges, set.Ranges()...)
+		}
+	}
+	return ranges
+}
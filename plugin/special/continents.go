@@ -0,0 +1,232 @@
+package special
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeContinents = "continents"
+	descContinents = "Derive lists of continents from lists of country codes of previous steps"
+)
+
+// defaultContinentPrefix prefixes names of continent lists, as AS of Asia is
+// also the country code of American Samoa
+const defaultContinentPrefix = "continent-"
+
+func init() {
+	lib.RegisterInputConfigCreator(typeContinents, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newContinents(action, data)
+	})
+	lib.RegisterInputConverter(typeContinents, &continents{
+		Description: descContinents,
+	})
+	lib.RegisterInputArgs(typeContinents, continentsArgs{})
+}
+
+// continentsArgs are the args of the input converter in config file
+type continentsArgs struct {
+	Continents    []string   `json:"continents"`
+	Prefix        *string    `json:"prefix"`
+	LocationsFile string     `json:"locationsFile"`
+	Exclude       []string   `json:"excludedList"`
+	OnlyIPType    lib.IPType `json:"onlyIPType"`
+}
+
+func newContinents(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp continentsArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionAdd {
+		return nil, fmt.Errorf("type %s only supports `add` action", typeContinents)
+	}
+
+	codes := make([]string, 0, len(tmp.Continents))
+	for _, code := range tmp.Continents {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !lib.IsContinent(code) {
+			return nil, fmt.Errorf("❌ [type %s | action %s] unknown continent %q, the value must be one of %s", typeContinents, action, code, strings.Join(lib.Continents(), ", "))
+		}
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		codes = lib.Continents()
+	}
+
+	prefix := defaultContinentPrefix
+	if tmp.Prefix != nil {
+		prefix = strings.TrimSpace(*tmp.Prefix)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeContinents, action, err)
+	}
+
+	return &continents{
+		Type:          typeContinents,
+		Action:        action,
+		Description:   descContinents,
+		Continents:    codes,
+		Prefix:        prefix,
+		LocationsFile: tmp.LocationsFile,
+		Exclude:       excludeList,
+		OnlyIPType:    tmp.OnlyIPType,
+	}, nil
+}
+
+type continents struct {
+	Type          string
+	Action        lib.Action
+	Description   string
+	Continents    []string
+	Prefix        string
+	LocationsFile string
+	Exclude       *lib.ListMatcher
+	OnlyIPType    lib.IPType
+}
+
+func (c *continents) GetType() string {
+	return c.Type
+}
+
+func (c *continents) GetAction() lib.Action {
+	return c.Action
+}
+
+func (c *continents) GetDescription() string {
+	return c.Description
+}
+
+func (c *continents) Input(container lib.Container) (lib.Container, error) {
+	return c.InputContext(context.Background(), container)
+}
+
+func (c *continents) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	continentOf := lib.ContinentOf
+	if c.LocationsFile != "" {
+		mapping, err := c.readLocations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		continentOf = func(countryCode string) string {
+			return mapping[countryCode]
+		}
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch c.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	entries := make(map[string]*lib.Entry, len(c.Continents))
+	for _, code := range c.Continents {
+		name := c.Prefix + code
+		if _, found := container.GetEntry(name); found {
+			return nil, fmt.Errorf("❌ [type %s | action %s] list %s already exists, set another prefix", c.Type, c.Action, strings.ToLower(name))
+		}
+		entries[code] = lib.NewEntry(name)
+	}
+
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if !lib.IsCountryCode(name) || c.Exclude.Match(name) {
+			continue
+		}
+		continent, found := entries[continentOf(name)]
+		if !found {
+			continue
+		}
+		if set, err := entry.GetIPv4Set(); err == nil {
+			for _, prefix := range set.Prefixes() {
+				if err := continent.AddPrefix(prefix); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if set, err := entry.GetIPv6Set(); err == nil {
+			for _, prefix := range set.Prefixes() {
+				if err := continent.AddPrefix(prefix); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, code := range c.Continents {
+		entry := entries[code]
+		// Do not create an empty list
+		if _, err := entry.MarshalPrefix(ignoreIPType); err != nil {
+			slog.Warn("no list of countries in the continent, skipped", "plugin", c.Type, "continent", code)
+			continue
+		}
+		if err := container.Add(entry, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
+
+// readLocations reads the continent codes of country codes from the locations
+// CSV file of MaxMind, like GeoLite2-Country-Locations-en.csv
+func (c *continents) readLocations(ctx context.Context) (map[string]string, error) {
+	var f io.ReadCloser
+	var err error
+	switch {
+	case strings.HasPrefix(strings.ToLower(c.LocationsFile), "http://"), strings.HasPrefix(strings.ToLower(c.LocationsFile), "https://"):
+		f, err = lib.GetRemoteURLReaderContext(ctx, c.LocationsFile)
+	default:
+		lib.RecordSource(c.LocationsFile)
+		f, err = os.Open(c.LocationsFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string)
+	for _, line := range lines[min(len(lines), 1):] {
+		// geoname_id,locale_code,continent_code,continent_name,country_iso_code,...
+		if len(line) < 5 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid record: %v", c.Type, c.Action, line)
+		}
+		continent := strings.ToUpper(strings.TrimSpace(line[2]))
+		countryCode := strings.ToUpper(strings.TrimSpace(line[4]))
+		if continent == "" || countryCode == "" {
+			continue
+		}
+		mapping[countryCode] = continent
+	}
+
+	if len(mapping) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid locations data", c.Type, c.Action)
+	}
+
+	return mapping, nil
+}
@@ -3,7 +3,6 @@ package special
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/v2fly/geoip/lib"
 )
@@ -20,13 +19,18 @@ func init() {
 	lib.RegisterInputConverter(typeCutter, &cutter{
 		Description: descCutter,
 	})
+	lib.RegisterInputArgs(typeCutter, cutterArgs{})
+}
+
+// cutterArgs are the args of the input converter in config file
+type cutterArgs struct {
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
 }
 
 func newCutter(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		Want       []string   `json:"wantedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
-	}
+	var tmp cutterArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -39,14 +43,17 @@ func newCutter(action lib.Action, data json.RawMessage) (lib.InputConverter, err
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeCutter, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeCutter, action, err)
 	}
 
-	if len(wantList) == 0 {
+	if wantList.IsEmpty() {
 		return nil, fmt.Errorf("type %s wantedList must be specified", typeCutter)
 	}
 
@@ -55,6 +62,7 @@ func newCutter(action lib.Action, data json.RawMessage) (lib.InputConverter, err
 		Action:      action,
 		Description: descCutter,
 		Want:        wantList,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
 	}, nil
 }
@@ -63,7 +71,8 @@ type cutter struct {
 	Type        string
 	Action      lib.Action
 	Description string
-	Want        map[string]bool
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
 	OnlyIPType  lib.IPType
 }
 
@@ -89,7 +98,7 @@ func (c *cutter) Input(container lib.Container) (lib.Container, error) {
 	}
 
 	for entry := range container.Loop() {
-		if len(c.Want) > 0 && !c.Want[entry.GetName()] {
+		if (!c.Want.IsEmpty() && !c.Want.Match(entry.GetName())) || c.Exclude.Match(entry.GetName()) {
 			continue
 		}
 		if err := container.Remove(entry, lib.CaseRemoveEntry, ignoreIPType); err != nil {
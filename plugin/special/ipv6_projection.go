@@ -0,0 +1,206 @@
+package special
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeIPv6Projection = "ipv6Projection"
+	descIPv6Projection = "Project IPv4 prefixes of lists from previous steps to IPv6 ones under a NAT64 prefix or 6to4"
+)
+
+// Modes of the projection
+const (
+	projectionNAT64 = "nat64"
+	projection6to4  = "6to4"
+	defaultNAT64    = "64:ff9b::/96"
+	sixToFourPrefix = "2002::/16"
+)
+
+// nat64PrefixBits are the lengths of NAT64 prefixes allowed by RFC 6052
+var nat64PrefixBits = []int{32, 40, 48, 56, 64, 96}
+
+func init() {
+	lib.RegisterInputConfigCreator(typeIPv6Projection, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newIPv6Projection(action, data)
+	})
+	lib.RegisterInputConverter(typeIPv6Projection, &ipv6Projection{
+		Description: descIPv6Projection,
+	})
+	lib.RegisterInputArgs(typeIPv6Projection, ipv6ProjectionArgs{})
+}
+
+// ipv6ProjectionArgs are the args of the input converter in config file
+type ipv6ProjectionArgs struct {
+	Mode    string   `json:"mode"`
+	Prefix  string   `json:"prefix"`
+	Suffix  *string  `json:"suffix"`
+	Want    []string `json:"wantedList"`
+	Exclude []string `json:"excludedList"`
+}
+
+func newIPv6Projection(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp ipv6ProjectionArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionAdd {
+		return nil, fmt.Errorf("type %s only supports `add` action", typeIPv6Projection)
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(tmp.Mode))
+	switch mode {
+	case "":
+		mode = projectionNAT64
+	case projectionNAT64, projection6to4:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] unknown mode %q, the value must be %s or %s", typeIPv6Projection, action, tmp.Mode, projectionNAT64, projection6to4)
+	}
+
+	var prefix netip.Prefix
+	switch mode {
+	case projectionNAT64:
+		cidr := strings.TrimSpace(tmp.Prefix)
+		if cidr == "" {
+			cidr = defaultNAT64
+		}
+		var err error
+		prefix, err = netip.ParsePrefix(cidr)
+		if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid NAT64 prefix %q", typeIPv6Projection, action, tmp.Prefix)
+		}
+		if !slices.Contains(nat64PrefixBits, prefix.Bits()) {
+			return nil, fmt.Errorf("❌ [type %s | action %s] invalid length of NAT64 prefix %s, the value must be one of /32, /40, /48, /56, /64 or /96", typeIPv6Projection, action, prefix)
+		}
+		prefix = prefix.Masked()
+	case projection6to4:
+		if strings.TrimSpace(tmp.Prefix) != "" {
+			return nil, fmt.Errorf("❌ [type %s | action %s] prefix must not be specified in %s mode", typeIPv6Projection, action, projection6to4)
+		}
+		prefix = netip.MustParsePrefix(sixToFourPrefix)
+	}
+
+	suffix := "-" + mode
+	if tmp.Suffix != nil {
+		suffix = strings.TrimSpace(*tmp.Suffix)
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeIPv6Projection, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeIPv6Projection, action, err)
+	}
+
+	return &ipv6Projection{
+		Type:        typeIPv6Projection,
+		Action:      action,
+		Description: descIPv6Projection,
+		Mode:        mode,
+		Prefix:      prefix,
+		Suffix:      suffix,
+		Want:        wantList,
+		Exclude:     excludeList,
+	}, nil
+}
+
+type ipv6Projection struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Mode        string
+	Prefix      netip.Prefix
+	Suffix      string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+}
+
+func (p *ipv6Projection) GetType() string {
+	return p.Type
+}
+
+func (p *ipv6Projection) GetAction() lib.Action {
+	return p.Action
+}
+
+func (p *ipv6Projection) GetDescription() string {
+	return p.Description
+}
+
+func (p *ipv6Projection) Input(container lib.Container) (lib.Container, error) {
+	// Project all lists before changing the container,
+	// so that companion lists are not projected again
+	projected := make([]*lib.Entry, 0)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if (!p.Want.IsEmpty() && !p.Want.Match(name)) || p.Exclude.Match(name) {
+			continue
+		}
+		set, err := entry.GetIPv4Set()
+		if err != nil {
+			continue
+		}
+
+		companion := lib.NewEntry(name + p.Suffix)
+		companion.AddTag(entry.GetTags()...)
+		for _, prefix := range set.Prefixes() {
+			if err := companion.AddPrefix(p.project(prefix)); err != nil {
+				return nil, err
+			}
+		}
+		projected = append(projected, companion)
+	}
+
+	if len(projected) == 0 {
+		slog.Warn("no list with IPv4 prefixes to project", "plugin", p.Type)
+	}
+
+	for _, entry := range projected {
+		if err := container.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
+
+// project returns the IPv6 prefix of the IPv4 prefix under the prefix of the mode.
+// Following RFC 6052, bits 64 to 71 of NAT64 addresses are zero, so IPv4 addresses
+// under NAT64 prefixes shorter than /64 are split around them.
+func (p *ipv6Projection) project(prefix netip.Prefix) netip.Prefix {
+	b := p.Prefix.Addr().As16()
+	ipv4 := prefix.Addr().As4()
+
+	if p.Mode == projection6to4 {
+		copy(b[2:6], ipv4[:])
+		return netip.PrefixFrom(netip.AddrFrom16(b), p.Prefix.Bits()+prefix.Bits())
+	}
+
+	start, bits := p.Prefix.Bits()/8, p.Prefix.Bits()+prefix.Bits()
+	if p.Prefix.Bits() == 64 || (p.Prefix.Bits() < 64 && bits > 64) {
+		bits += 8
+	}
+	for _, v := range ipv4 {
+		if start == 8 {
+			start++
+		}
+		b[start] = v
+		start++
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(b), bits)
+}
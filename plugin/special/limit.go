@@ -0,0 +1,215 @@
+package special
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeLimit = "limit"
+	descLimit = "Cap lists of previous steps at a number of prefixes, for targets with capacity limits"
+)
+
+// Strategies selecting the prefixes kept
+const (
+	limitCoverage = "coverage" // largest prefixes first
+	limitSample   = "sample"   // seeded sampling
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeLimit, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newLimit(action, data)
+	})
+	lib.RegisterInputConverter(typeLimit, &limit{
+		Description: descLimit,
+	})
+	lib.RegisterInputArgs(typeLimit, limitArgs{})
+}
+
+// limitArgs are the args of the input converter in config file
+type limitArgs struct {
+	MaxPrefixes int        `json:"maxPrefixes"`
+	Strategy    string     `json:"strategy"`
+	Seed        string     `json:"seed"`
+	Want        []string   `json:"wantedList"`
+	Exclude     []string   `json:"excludedList"`
+	OnlyIPType  lib.IPType `json:"onlyIPType"`
+}
+
+func newLimit(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp limitArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionRemove {
+		return nil, fmt.Errorf("type %s only supports `remove` action", typeLimit)
+	}
+
+	if tmp.MaxPrefixes <= 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] maxPrefixes must be greater than 0", typeLimit, action)
+	}
+
+	strategy := strings.ToLower(strings.TrimSpace(tmp.Strategy))
+	switch strategy {
+	case "":
+		strategy = limitCoverage
+	case limitCoverage, limitSample:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] unknown strategy %q, the value must be %s or %s", typeLimit, action, tmp.Strategy, limitCoverage, limitSample)
+	}
+
+	// Sizes of prefixes of different IP types are not comparable
+	if strategy == limitCoverage && tmp.OnlyIPType != lib.IPv4 && tmp.OnlyIPType != lib.IPv6 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] onlyIPType must be %s or %s for the %s strategy, use one step for every IP type", typeLimit, action, lib.IPv4, lib.IPv6, limitCoverage)
+	}
+
+	if tmp.Seed != "" && strategy != limitSample {
+		return nil, fmt.Errorf("❌ [type %s | action %s] seed is only used by the %s strategy", typeLimit, action, limitSample)
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeLimit, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeLimit, action, err)
+	}
+
+	return &limit{
+		Type:        typeLimit,
+		Action:      action,
+		Description: descLimit,
+		MaxPrefixes: tmp.MaxPrefixes,
+		Strategy:    strategy,
+		Seed:        tmp.Seed,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type limit struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	MaxPrefixes int
+	Strategy    string
+	Seed        string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (l *limit) GetType() string {
+	return l.Type
+}
+
+func (l *limit) GetAction() lib.Action {
+	return l.Action
+}
+
+func (l *limit) GetDescription() string {
+	return l.Description
+}
+
+// RequiresAggregation reports the prefixes are capped after aggregation, which does not
+// hold for the prefixes exactly as they are added
+func (l *limit) RequiresAggregation() bool {
+	return true
+}
+
+func (l *limit) Input(container lib.Container) (lib.Container, error) {
+	var ignoreIPType lib.IgnoreIPOption
+	switch l.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	// Select the prefixes to drop from all lists before changing the container
+	dropped := make([]*lib.Entry, 0)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if (!l.Want.IsEmpty() && !l.Want.Match(name)) || l.Exclude.Match(name) {
+			continue
+		}
+		prefixes := make([]netip.Prefix, 0)
+		for prefix, err := range entry.Prefixes(ignoreIPType) {
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		if len(prefixes) <= l.MaxPrefixes {
+			continue
+		}
+
+		l.sort(name, prefixes)
+		drop := lib.NewEntry(name)
+		for _, prefix := range prefixes[l.MaxPrefixes:] {
+			if err := drop.AddPrefix(prefix); err != nil {
+				return nil, err
+			}
+		}
+		dropped = append(dropped, drop)
+
+		reason := fmt.Sprintf("limited to %d prefixes by %s", l.MaxPrefixes, l.Strategy)
+		slog.Warn("prefixes dropped", "plugin", l.Type, "list", strings.ToLower(name), "kept", l.MaxPrefixes, "dropped", len(prefixes)-l.MaxPrefixes, "strategy", l.Strategy)
+		lib.RecordDropped(name, reason, prefixes[l.MaxPrefixes:])
+	}
+
+	for _, entry := range dropped {
+		if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
+
+// sort sorts the prefixes of the list by the strategy, the ones kept first. The order
+// only depends on the prefixes, and the seed and the name of the list if sampled,
+// so that the same prefixes are kept by every run.
+func (l *limit) sort(name string, prefixes []netip.Prefix) {
+	switch l.Strategy {
+	case limitSample:
+		keys := make(map[netip.Prefix]uint64, len(prefixes))
+		for _, prefix := range prefixes {
+			h := fnv.New64a()
+			h.Write([]byte(l.Seed + "\x00" + name + "\x00" + prefix.String()))
+			keys[prefix] = h.Sum64()
+		}
+		slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+			return cmp.Or(cmp.Compare(keys[a], keys[b]), comparePrefix(a, b))
+		})
+	default:
+		// Prefixes covering more addresses first, which are all of the same IP type
+		slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+			return cmp.Or(
+				cmp.Compare(b.Addr().BitLen()-b.Bits(), a.Addr().BitLen()-a.Bits()),
+				comparePrefix(a, b),
+			)
+		})
+	}
+}
+
+// comparePrefix orders prefixes by addresses, IPv4 ones first
+func comparePrefix(a, b netip.Prefix) int {
+	return cmp.Or(a.Addr().Compare(b.Addr()), cmp.Compare(a.Bits(), b.Bits()))
+}
@@ -43,12 +43,16 @@ func init() {
 	lib.RegisterInputConverter(typePrivate, &private{
 		Description: descPrivate,
 	})
+	lib.RegisterInputArgs(typePrivate, privateArgs{})
+}
+
+// privateArgs are the args of the input converter in config file
+type privateArgs struct {
+	OnlyIPType lib.IPType `json:"onlyIPType"`
 }
 
 func newPrivate(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		OnlyIPType lib.IPType `json:"onlyIPType"`
-	}
+	var tmp privateArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -83,6 +87,10 @@ func (p *private) GetDescription() string {
 	return p.Description
 }
 
+func (p *private) IsSourceInput() bool {
+	return true
+}
+
 func (p *private) Input(container lib.Container) (lib.Container, error) {
 	entry, found := container.GetEntry(entryNamePrivate)
 	if !found {
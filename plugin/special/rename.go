@@ -0,0 +1,142 @@
+package special
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeRename = "rename"
+	descRename = "Rename lists or define aliases of lists from previous steps"
+)
+
+func init() {
+	lib.RegisterInputConfigCreator(typeRename, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newRename(action, data)
+	})
+	lib.RegisterInputConverter(typeRename, &rename{
+		Description: descRename,
+	})
+	lib.RegisterInputArgs(typeRename, renameArgs{})
+}
+
+// renameArgs are the args of the input converter in config file
+type renameArgs struct {
+	Mapping      map[string]string `json:"mapping"`
+	KeepOriginal bool              `json:"keepOriginal"`
+	OnlyIPType   lib.IPType        `json:"onlyIPType"`
+}
+
+func newRename(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp renameArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionAdd {
+		return nil, fmt.Errorf("type %s only supports `add` action", typeRename)
+	}
+
+	mapping := make(map[string]string)
+	for from, to := range tmp.Mapping {
+		from, to = strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(strings.TrimSpace(to))
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("type %s mapping must not contain empty list name", typeRename)
+		}
+		if from != to {
+			mapping[from] = to
+		}
+	}
+
+	if len(mapping) == 0 {
+		return nil, fmt.Errorf("type %s mapping must be specified", typeRename)
+	}
+
+	return &rename{
+		Type:         typeRename,
+		Action:       action,
+		Description:  descRename,
+		Mapping:      mapping,
+		KeepOriginal: tmp.KeepOriginal,
+		OnlyIPType:   tmp.OnlyIPType,
+	}, nil
+}
+
+type rename struct {
+	Type         string
+	Action       lib.Action
+	Description  string
+	Mapping      map[string]string
+	KeepOriginal bool
+	OnlyIPType   lib.IPType
+}
+
+func (r *rename) GetType() string {
+	return r.Type
+}
+
+func (r *rename) GetAction() lib.Action {
+	return r.Action
+}
+
+func (r *rename) GetDescription() string {
+	return r.Description
+}
+
+func (r *rename) Input(container lib.Container) (lib.Container, error) {
+	var ignoreIPType lib.IgnoreIPOption
+	switch r.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	froms := make([]string, 0, len(r.Mapping))
+	for from := range r.Mapping {
+		froms = append(froms, from)
+	}
+	slices.Sort(froms)
+
+	// Copy all lists before changing the container,
+	// so that lists could be swapped or renamed in chains
+	originals := make([]*lib.Entry, 0, len(froms))
+	copies := make([]*lib.Entry, 0, len(froms))
+	for _, from := range froms {
+		entry, found := container.GetEntry(from)
+		if !found {
+			slog.Warn("entry not found", "plugin", r.Type, "entry", from)
+			continue
+		}
+		copied, err := entry.Copy(r.Mapping[from])
+		if err != nil {
+			return nil, err
+		}
+		originals = append(originals, entry)
+		copies = append(copies, copied)
+	}
+
+	if !r.KeepOriginal {
+		for _, entry := range originals {
+			if err := container.Remove(entry, lib.CaseRemoveEntry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, entry := range copies {
+		if err := container.Add(entry, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
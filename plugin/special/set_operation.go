@@ -0,0 +1,211 @@
+package special
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeSetOperation = "setOperation"
+	descSetOperation = "Compute a list from set operations on lists of previous steps"
+)
+
+const (
+	operationUnion        = "union"
+	operationIntersection = "intersection"
+	operationDifference   = "difference"
+)
+
+var supportedOperations = []string{operationUnion, operationIntersection, operationDifference}
+
+func init() {
+	lib.RegisterInputConfigCreator(typeSetOperation, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newSetOperation(action, data)
+	})
+	lib.RegisterInputConverter(typeSetOperation, &setOperation{
+		Description: descSetOperation,
+	})
+	lib.RegisterInputArgs(typeSetOperation, setOperationArgs{})
+}
+
+// setOperationArgs are the args of the input converter in config file
+type setOperationArgs struct {
+	Name       string     `json:"name"`
+	Operation  string     `json:"operation"`
+	Lists      []string   `json:"lists"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newSetOperation(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp setOperationArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp.Name = strings.TrimSpace(tmp.Name)
+	if tmp.Name == "" {
+		return nil, fmt.Errorf("❌ [type %s | action %s] name must be specified", typeSetOperation, action)
+	}
+
+	tmp.Operation = strings.ToLower(strings.TrimSpace(tmp.Operation))
+	if !slices.Contains(supportedOperations, tmp.Operation) {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid operation %s, the value must be union, intersection or difference", typeSetOperation, action, tmp.Operation)
+	}
+
+	lists := make([]string, 0, len(tmp.Lists))
+	for _, list := range tmp.Lists {
+		if list = strings.ToUpper(strings.TrimSpace(list)); list != "" {
+			lists = append(lists, list)
+		}
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] lists must be specified", typeSetOperation, action)
+	}
+
+	return &setOperation{
+		Type:        typeSetOperation,
+		Action:      action,
+		Description: descSetOperation,
+		Name:        tmp.Name,
+		Operation:   tmp.Operation,
+		Lists:       lists,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type setOperation struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Name        string
+	Operation   string
+	Lists       []string
+	OnlyIPType  lib.IPType
+}
+
+func (s *setOperation) GetType() string {
+	return s.Type
+}
+
+func (s *setOperation) GetAction() lib.Action {
+	return s.Action
+}
+
+func (s *setOperation) GetDescription() string {
+	return s.Description
+}
+
+// RequiresAggregation reports whether results are added, which are built from the
+// aggregated sets of the lists instead of their prefixes exactly as they are added
+func (s *setOperation) RequiresAggregation() bool {
+	return s.Action == lib.ActionAdd
+}
+
+func (s *setOperation) Input(container lib.Container) (lib.Container, error) {
+	entries := make([]*lib.Entry, 0, len(s.Lists))
+	for _, name := range s.Lists {
+		entry, found := container.GetEntry(name)
+		if !found {
+			return nil, fmt.Errorf("❌ [type %s | action %s] entry %s not found", s.Type, s.Action, name)
+		}
+		entries = append(entries, entry)
+	}
+
+	var ignoreIPType lib.IgnoreIPOption
+	switch s.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	entry := lib.NewEntry(s.Name)
+	count := 0
+	if s.OnlyIPType != lib.IPv6 {
+		n, err := s.compute(entry, entries, (*lib.Entry).GetIPv4Set)
+		if err != nil {
+			return nil, err
+		}
+		count += n
+	}
+	if s.OnlyIPType != lib.IPv4 {
+		n, err := s.compute(entry, entries, (*lib.Entry).GetIPv6Set)
+		if err != nil {
+			return nil, err
+		}
+		count += n
+	}
+
+	// Do not create an empty list
+	if count == 0 {
+		slog.Warn("result is empty, skipped", "plugin", s.Type, "action", s.Action, "entry", entry.GetName())
+		return container, nil
+	}
+
+	switch s.Action {
+	case lib.ActionAdd:
+		if err := container.Add(entry, ignoreIPType); err != nil {
+			return nil, err
+		}
+	case lib.ActionRemove:
+		if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, lib.ErrUnknownAction
+	}
+
+	return container, nil
+}
+
+// compute applies the operation to the sets of one IP type of the entries in order,
+// adds the prefixes of the result to dst and returns the number of them
+func (s *setOperation) compute(dst *lib.Entry, entries []*lib.Entry, getSet func(*lib.Entry) (*netipx.IPSet, error)) (int, error) {
+	var builder netipx.IPSetBuilder
+	for i, entry := range entries {
+		// An entry without prefixes of the IP type has no set,
+		// which is the same as an empty set here
+		set, err := getSet(entry)
+		switch {
+		case errors.Is(err, lib.ErrNoIPv4Set), errors.Is(err, lib.ErrNoIPv6Set):
+			set = new(netipx.IPSet)
+		case err != nil:
+			return 0, err
+		}
+
+		switch {
+		case i == 0:
+			builder.AddSet(set)
+		case s.Operation == operationUnion:
+			builder.AddSet(set)
+		case s.Operation == operationIntersection:
+			builder.Intersect(set)
+		case s.Operation == operationDifference:
+			builder.RemoveSet(set)
+		}
+	}
+
+	result, err := builder.IPSet()
+	if err != nil {
+		return 0, err
+	}
+
+	prefixes := result.Prefixes()
+	for _, prefix := range prefixes {
+		if err := dst.AddPrefix(prefix); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(prefixes), nil
+}
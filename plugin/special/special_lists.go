@@ -0,0 +1,266 @@
+package special
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeSpecialLists = "specialLists"
+	descSpecialLists = "Convert built-in special lists, like bogons and special-purpose addresses, to other formats"
+)
+
+// Names of built-in special lists
+const (
+	specialListPrivate    = "private"
+	specialListBogons     = "bogons"
+	specialListFullbogons = "fullbogons"
+	specialListIANA       = "special"
+	specialListCGNAT      = "cgnat"
+)
+
+// defaultFullbogonsURLs are the IPv4 and IPv6 full bogons maintained by Team Cymru,
+// which are the bogons plus the prefixes not allocated by RIRs yet and change over time
+var defaultFullbogonsURLs = []string{
+	"https://www.team-cymru.org/Services/Bogons/fullbogons-ipv4.txt",
+	"https://www.team-cymru.org/Services/Bogons/fullbogons-ipv6.txt",
+}
+
+// bogonCIDRs are the prefixes never routed on the Internet, including
+// the deprecated site-local and 6bone prefixes of IPv6
+var bogonCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/8",
+	"100::/64",
+	"2001:2::/48",
+	"2001:10::/28",
+	"2001:db8::/32",
+	"3ffe::/16",
+	"3fff::/20",
+	"5f00::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"fec0::/10",
+	"ff00::/8",
+}
+
+// ianaSpecialCIDRs are the prefixes in the IANA IPv4 and IPv6 Special-Purpose
+// Address Registries, see https://www.iana.org/assignments/iana-ipv4-special-registry
+// and https://www.iana.org/assignments/iana-ipv6-special-registry. The IPv4-mapped
+// ::ffff:0:0/96 is left out, as IPv4-mapped addresses are taken as IPv4 ones.
+var ianaSpecialCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.31.196.0/24",
+	"192.52.193.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"192.175.48.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"255.255.255.255/32",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001::/23",
+	"2001:db8::/32",
+	"2002::/16",
+	"2620:4f:8000::/48",
+	"3fff::/20",
+	"5f00::/16",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+var cgnatCIDRs = []string{
+	"100.64.0.0/10",
+}
+
+// specialCIDRs are the prefixes of built-in special lists generated in code
+var specialCIDRs = map[string][]string{
+	specialListPrivate: privateCIDRs,
+	specialListBogons:  bogonCIDRs,
+	specialListIANA:    ianaSpecialCIDRs,
+	specialListCGNAT:   cgnatCIDRs,
+}
+
+func init() {
+	lib.RegisterInputConfigCreator(typeSpecialLists, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newSpecialLists(action, data)
+	})
+	lib.RegisterInputConverter(typeSpecialLists, &specialLists{
+		Description: descSpecialLists,
+	})
+	lib.RegisterInputArgs(typeSpecialLists, specialListsArgs{})
+}
+
+// specialListsArgs are the args of the input converter in config file
+type specialListsArgs struct {
+	Lists          []string   `json:"lists"`
+	FullbogonsURLs []string   `json:"fullbogonsURLs"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newSpecialLists(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp specialListsArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tmp.Lists) == 0 {
+		return nil, fmt.Errorf("❌ [type %s | action %s] lists must be specified in config", typeSpecialLists, action)
+	}
+
+	lists := make([]string, 0, len(tmp.Lists))
+	for _, name := range tmp.Lists {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, found := specialCIDRs[name]; !found && name != specialListFullbogons {
+			return nil, fmt.Errorf("❌ [type %s | action %s] unknown list %q, the value must be %s, %s, %s, %s or %s", typeSpecialLists, action, name, specialListPrivate, specialListBogons, specialListFullbogons, specialListIANA, specialListCGNAT)
+		}
+		if !slices.Contains(lists, name) {
+			lists = append(lists, name)
+		}
+	}
+
+	if len(tmp.FullbogonsURLs) == 0 {
+		tmp.FullbogonsURLs = defaultFullbogonsURLs
+	}
+
+	return &specialLists{
+		Type:           typeSpecialLists,
+		Action:         action,
+		Description:    descSpecialLists,
+		Lists:          lists,
+		FullbogonsURLs: tmp.FullbogonsURLs,
+		OnlyIPType:     tmp.OnlyIPType,
+	}, nil
+}
+
+type specialLists struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	Lists          []string
+	FullbogonsURLs []string
+	OnlyIPType     lib.IPType
+}
+
+func (s *specialLists) GetType() string {
+	return s.Type
+}
+
+func (s *specialLists) GetAction() lib.Action {
+	return s.Action
+}
+
+func (s *specialLists) GetDescription() string {
+	return s.Description
+}
+
+func (s *specialLists) IsSourceInput() bool {
+	return true
+}
+
+func (s *specialLists) Input(container lib.Container) (lib.Container, error) {
+	return s.InputContext(context.Background(), container)
+}
+
+func (s *specialLists) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
+	var ignoreIPType lib.IgnoreIPOption
+	switch s.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	for _, name := range s.Lists {
+		entry := lib.NewEntry(name)
+		if name == specialListFullbogons {
+			if err := s.fetchFullbogons(ctx, entry); err != nil {
+				return nil, err
+			}
+		} else {
+			for _, cidr := range specialCIDRs[name] {
+				if err := entry.AddPrefix(cidr); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		switch s.Action {
+		case lib.ActionAdd:
+			if err := container.Add(entry, ignoreIPType); err != nil {
+				return nil, err
+			}
+		case lib.ActionRemove:
+			if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lib.ErrUnknownAction
+		}
+	}
+
+	return container, nil
+}
+
+// fetchFullbogons adds the prefixes of all full bogons files to the entry
+func (s *specialLists) fetchFullbogons(ctx context.Context, entry *lib.Entry) error {
+	for _, url := range s.FullbogonsURLs {
+		body, err := lib.GetRemoteURLReaderContext(ctx, url)
+		if err != nil {
+			return err
+		}
+		err = addBogonLines(body, entry)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("❌ [type %s | action %s] invalid full bogons of %s: %w", s.Type, s.Action, url, err)
+		}
+	}
+	return nil
+}
+
+// addBogonLines adds a CIDR per line, where empty lines and comments like "# last updated" are ignored
+func addBogonLines(reader io.Reader, entry *lib.Entry) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if err := entry.AddPrefix(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
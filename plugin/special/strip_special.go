@@ -0,0 +1,156 @@
+package special
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeStripSpecial = "stripSpecial"
+	descStripSpecial = "Remove special-purpose ranges, like multicast and documentation ones, from lists of previous steps"
+)
+
+// stripRanges are the special-purpose ranges leaked by some sources, which
+// are never reachable on the Internet, by categories
+var stripRanges = map[string][]string{
+	"multicast":     {"224.0.0.0/4", "ff00::/8"},
+	"linkLocal":     {"169.254.0.0/16", "fe80::/10"},
+	"loopback":      {"127.0.0.0/8", "::1/128"},
+	"documentation": {"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32", "3fff::/20"},
+	"benchmarking":  {"198.18.0.0/15", "2001:2::/48"},
+}
+
+func init() {
+	lib.RegisterInputConfigCreator(typeStripSpecial, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+		return newStripSpecial(action, data)
+	})
+	lib.RegisterInputConverter(typeStripSpecial, &stripSpecial{
+		Description: descStripSpecial,
+	})
+	lib.RegisterInputArgs(typeStripSpecial, stripSpecialArgs{})
+}
+
+// stripSpecialArgs are the args of the input converter in config file
+type stripSpecialArgs struct {
+	Ranges     []string   `json:"ranges"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
+}
+
+func newStripSpecial(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
+	var tmp stripSpecialArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if action != lib.ActionRemove {
+		return nil, fmt.Errorf("type %s only supports `remove` action", typeStripSpecial)
+	}
+
+	categories := make([]string, 0, len(stripRanges))
+	for category := range stripRanges {
+		categories = append(categories, category)
+	}
+	slices.Sort(categories)
+
+	ranges := make([]string, 0, len(tmp.Ranges))
+	for _, name := range tmp.Ranges {
+		idx := slices.IndexFunc(categories, func(category string) bool {
+			return strings.EqualFold(category, strings.TrimSpace(name))
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("❌ [type %s | action %s] unknown ranges %q, the value must be one of %s", typeStripSpecial, action, name, strings.Join(categories, ", "))
+		}
+		if !slices.Contains(ranges, categories[idx]) {
+			ranges = append(ranges, categories[idx])
+		}
+	}
+	if len(ranges) == 0 {
+		ranges = categories
+	}
+
+	// Filter want list
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeStripSpecial, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeStripSpecial, action, err)
+	}
+
+	return &stripSpecial{
+		Type:        typeStripSpecial,
+		Action:      action,
+		Description: descStripSpecial,
+		Ranges:      ranges,
+		Want:        wantList,
+		Exclude:     excludeList,
+		OnlyIPType:  tmp.OnlyIPType,
+	}, nil
+}
+
+type stripSpecial struct {
+	Type        string
+	Action      lib.Action
+	Description string
+	Ranges      []string
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
+	OnlyIPType  lib.IPType
+}
+
+func (s *stripSpecial) GetType() string {
+	return s.Type
+}
+
+func (s *stripSpecial) GetAction() lib.Action {
+	return s.Action
+}
+
+func (s *stripSpecial) GetDescription() string {
+	return s.Description
+}
+
+func (s *stripSpecial) Input(container lib.Container) (lib.Container, error) {
+	var ignoreIPType lib.IgnoreIPOption
+	switch s.OnlyIPType {
+	case lib.IPv4:
+		ignoreIPType = lib.IgnoreIPv6
+	case lib.IPv6:
+		ignoreIPType = lib.IgnoreIPv4
+	}
+
+	names := make([]string, 0, container.Len())
+	for entry := range container.Loop() {
+		if (!s.Want.IsEmpty() && !s.Want.Match(entry.GetName())) || s.Exclude.Match(entry.GetName()) {
+			continue
+		}
+		names = append(names, entry.GetName())
+	}
+
+	for _, name := range names {
+		entry := lib.NewEntry(name)
+		for _, category := range s.Ranges {
+			for _, cidr := range stripRanges[category] {
+				if err := entry.AddPrefix(cidr); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := container.Remove(entry, lib.CaseRemovePrefix, ignoreIPType); err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
@@ -23,6 +23,7 @@ func init() {
 	lib.RegisterInputConverter(typeTest, &test{
 		Description: descTest,
 	})
+	lib.RegisterInputArgs(typeTest, struct{}{})
 }
 
 func newTest(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
@@ -51,6 +52,10 @@ func (t *test) GetDescription() string {
 	return t.Description
 }
 
+func (t *test) IsSourceInput() bool {
+	return true
+}
+
 func (t *test) Input(container lib.Container) (lib.Container, error) {
 	entry := lib.NewEntry(entryNameTest)
 	for _, cidr := range testCIDRs {
@@ -0,0 +1,253 @@
+package suricata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeIPRepOut = "suricataIPRep"
+	descIPRepOut = "Convert data to Suricata IP reputation format"
+)
+
+var (
+	defaultOutputDir      = filepath.Join("./", "output", "suricata")
+	defaultOutputName     = "geoip.list"
+	defaultCategoriesName = "categories.txt"
+	defaultScore          = 127
+	defaultStartID        = 1
+
+	maxCategoryID = 60  // the max category ID allowed by Suricata
+	maxScore      = 127 // the max reputation score allowed by Suricata
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeIPRepOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newIPRepOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeIPRepOut, &ipRepOut{
+		Description: descIPRepOut,
+	})
+	lib.RegisterOutputArgs(typeIPRepOut, ipRepOutArgs{})
+}
+
+// ipRepOutArgs are the args of the output converter in config file
+type ipRepOutArgs struct {
+	OutputName     string     `json:"outputName"`
+	OutputDir      string     `json:"outputDir"`
+	OneFilePerList bool       `json:"oneFilePerList"`
+	CategoriesName string     `json:"categoriesName"`
+	Score          int        `json:"score"`
+	StartID        int        `json:"startID"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newIPRepOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp ipRepOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.CategoriesName == "" {
+		tmp.CategoriesName = defaultCategoriesName
+	}
+
+	if tmp.Score == 0 {
+		tmp.Score = defaultScore
+	}
+	if tmp.Score < 1 || tmp.Score > maxScore {
+		return nil, fmt.Errorf("❌ [type %s | action %s] score must be between 1 and %d", typeIPRepOut, action, maxScore)
+	}
+
+	if tmp.StartID == 0 {
+		tmp.StartID = defaultStartID
+	}
+	if tmp.StartID < 1 || tmp.StartID > maxCategoryID {
+		return nil, fmt.Errorf("❌ [type %s | action %s] startID must be between 1 and %d", typeIPRepOut, action, maxCategoryID)
+	}
+
+	return &ipRepOut{
+		Type:           typeIPRepOut,
+		Action:         action,
+		Description:    descIPRepOut,
+		OutputName:     tmp.OutputName,
+		OutputDir:      tmp.OutputDir,
+		OneFilePerList: tmp.OneFilePerList,
+		CategoriesName: tmp.CategoriesName,
+		Score:          tmp.Score,
+		StartID:        tmp.StartID,
+		Want:           tmp.Want,
+		Exclude:        tmp.Exclude,
+		OnlyIPType:     tmp.OnlyIPType,
+	}, nil
+}
+
+type ipRepOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	OutputName     string
+	OutputDir      string
+	OneFilePerList bool
+	CategoriesName string
+	Score          int
+	StartID        int
+	Want           []string
+	Exclude        []string
+	OnlyIPType     lib.IPType
+}
+
+func (i *ipRepOut) GetType() string {
+	return i.Type
+}
+
+func (i *ipRepOut) GetAction() lib.Action {
+	return i.Action
+}
+
+func (i *ipRepOut) GetDescription() string {
+	return i.Description
+}
+
+func (i *ipRepOut) Output(container lib.Container) error {
+	list := i.filterAndSortList(container)
+
+	// Every list is a category with an ID in the order of list names
+	if i.StartID+len(list)-1 > maxCategoryID {
+		return fmt.Errorf("❌ [type %s | action %s] too many lists (%d) for categories %d-%d, use wantedList to reduce them", i.Type, i.Action, len(list), i.StartID, maxCategoryID)
+	}
+
+	var categories, reputations bytes.Buffer
+	id := i.StartID
+	for _, name := range list {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", i.Type, "entry", name)
+			continue
+		}
+
+		cidrList, err := i.marshalText(entry)
+		if err != nil {
+			return err
+		}
+
+		shortname := strings.ToLower(entry.GetName())
+		categories.WriteString(strconv.Itoa(id) + "," + shortname + ",geoip list " + shortname + "\n")
+
+		if i.OneFilePerList {
+			var listReputations bytes.Buffer
+			i.writeReputations(&listReputations, id, cidrList)
+			if err := i.writeFile(shortname+".list", listReputations.Bytes()); err != nil {
+				return err
+			}
+		} else {
+			i.writeReputations(&reputations, id, cidrList)
+		}
+
+		id++
+	}
+
+	if categories.Len() == 0 {
+		return nil
+	}
+
+	if !i.OneFilePerList {
+		if err := i.writeFile(i.OutputName, reputations.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return i.writeFile(i.CategoriesName, categories.Bytes())
+}
+
+func (i *ipRepOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(i.Exclude)
+
+	wantList := make([]string, 0, len(i.Want))
+	for _, want := range lib.ExpandWantedList(container, i.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(i.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (i *ipRepOut) marshalText(entry *lib.Entry) ([]string, error) {
+	switch i.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalText(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalText(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalText()
+	}
+}
+
+// writeReputations writes lines in "cidr,category,score" format
+func (i *ipRepOut) writeReputations(buf *bytes.Buffer, id int, cidrList []string) {
+	suffix := "," + strconv.Itoa(id) + "," + strconv.Itoa(i.Score) + "\n"
+	for _, cidr := range cidrList {
+		buf.WriteString(cidr)
+		buf.WriteString(suffix)
+	}
+}
+
+func (i *ipRepOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(i.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", i.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeHCLOut = "terraform"
+	descHCLOut = "Convert data to Terraform HCL format"
+)
+
+const (
+	declareLocals   = "locals"
+	declareVariable = "variable"
+
+	resourceAWSPrefixList = "aws_ec2_managed_prefix_list"
+)
+
+var (
+	defaultOutputDir  = filepath.Join("./", "output", "terraform")
+	defaultOutputName = "geoip.tf"
+	defaultNamePrefix = "geoip_"
+
+	invalidIdentifierChar = regexp.MustCompile(`[^a-z0-9_]`)
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeHCLOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newHCLOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeHCLOut, &hclOut{
+		Description: descHCLOut,
+	})
+	lib.RegisterOutputArgs(typeHCLOut, hclOutArgs{})
+}
+
+// hclOutArgs are the args of the output converter in config file
+type hclOutArgs struct {
+	OutputName     string     `json:"outputName"`
+	OutputDir      string     `json:"outputDir"`
+	OneFilePerList bool       `json:"oneFilePerList"`
+	DeclareAs      string     `json:"declareAs"`
+	NamePrefix     string     `json:"namePrefix"`
+	SeparateIPType bool       `json:"separateIPType"`
+	Resource       string     `json:"resource"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newHCLOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp hclOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.DeclareAs = strings.ToLower(strings.TrimSpace(tmp.DeclareAs))
+	switch tmp.DeclareAs {
+	case "":
+		tmp.DeclareAs = declareLocals
+	case declareLocals, declareVariable:
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid declareAs %s, the value must be locals or variable", typeHCLOut, action, tmp.DeclareAs)
+	}
+
+	if tmp.NamePrefix == "" {
+		tmp.NamePrefix = defaultNamePrefix
+	}
+
+	tmp.Resource = strings.ToLower(strings.TrimSpace(tmp.Resource))
+	switch tmp.Resource {
+	case "":
+	case resourceAWSPrefixList:
+		// A managed prefix list only holds one address family
+		tmp.SeparateIPType = true
+	default:
+		return nil, fmt.Errorf("❌ [type %s | action %s] unsupported resource %s", typeHCLOut, action, tmp.Resource)
+	}
+
+	return &hclOut{
+		Type:           typeHCLOut,
+		Action:         action,
+		Description:    descHCLOut,
+		OutputName:     tmp.OutputName,
+		OutputDir:      tmp.OutputDir,
+		OneFilePerList: tmp.OneFilePerList,
+		DeclareAs:      tmp.DeclareAs,
+		NamePrefix:     tmp.NamePrefix,
+		SeparateIPType: tmp.SeparateIPType,
+		Resource:       tmp.Resource,
+		Want:           tmp.Want,
+		Exclude:        tmp.Exclude,
+		OnlyIPType:     tmp.OnlyIPType,
+	}, nil
+}
+
+type hclOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	OutputName     string
+	OutputDir      string
+	OneFilePerList bool
+	DeclareAs      string
+	NamePrefix     string
+	SeparateIPType bool
+	Resource       string
+	Want           []string
+	Exclude        []string
+	OnlyIPType     lib.IPType
+}
+
+// declaration is a named list of CIDRs declared as a local value or variable
+type declaration struct {
+	Name     string
+	IPType   lib.IPType
+	CIDRList []string
+}
+
+func (h *hclOut) GetType() string {
+	return h.Type
+}
+
+func (h *hclOut) GetAction() lib.Action {
+	return h.Action
+}
+
+func (h *hclOut) GetDescription() string {
+	return h.Description
+}
+
+func (h *hclOut) Output(container lib.Container) error {
+	declarations := make([]*declaration, 0, 300)
+
+	for _, name := range h.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", h.Type, "entry", name)
+			continue
+		}
+
+		entryDeclarations, err := h.generateDeclarations(entry)
+		if err != nil {
+			return err
+		}
+
+		if h.OneFilePerList {
+			filename := strings.ToLower(entry.GetName()) + ".tf"
+			if err := h.writeFile(filename, h.marshal(entryDeclarations)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		declarations = append(declarations, entryDeclarations...)
+	}
+
+	if !h.OneFilePerList && len(declarations) > 0 {
+		if err := h.writeFile(h.OutputName, h.marshal(declarations)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *hclOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(h.Exclude)
+
+	wantList := make([]string, 0, len(h.Want))
+	for _, want := range lib.ExpandWantedList(container, h.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(h.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (h *hclOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch h.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// identifier converts list name to a valid Terraform identifier
+func (h *hclOut) identifier(name string) string {
+	id := invalidIdentifierChar.ReplaceAllString(strings.ToLower(h.NamePrefix+name), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "_" + id
+	}
+	return id
+}
+
+func (h *hclOut) generateDeclarations(entry *lib.Entry) ([]*declaration, error) {
+	prefixes, err := h.marshalPrefix(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if !h.SeparateIPType {
+		cidrList := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			cidrList = append(cidrList, prefix.String())
+		}
+		return []*declaration{{
+			Name:     h.identifier(entry.GetName()),
+			CIDRList: cidrList,
+		}}, nil
+	}
+
+	ipv4 := &declaration{Name: h.identifier(entry.GetName() + "_" + string(lib.IPv4)), IPType: lib.IPv4}
+	ipv6 := &declaration{Name: h.identifier(entry.GetName() + "_" + string(lib.IPv6)), IPType: lib.IPv6}
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			ipv4.CIDRList = append(ipv4.CIDRList, prefix.String())
+		} else {
+			ipv6.CIDRList = append(ipv6.CIDRList, prefix.String())
+		}
+	}
+
+	declarations := make([]*declaration, 0, 2)
+	for _, d := range []*declaration{ipv4, ipv6} {
+		if len(d.CIDRList) > 0 {
+			declarations = append(declarations, d)
+		}
+	}
+	return declarations, nil
+}
+
+func (h *hclOut) marshal(declarations []*declaration) []byte {
+	var buf bytes.Buffer
+
+	switch h.DeclareAs {
+	case declareLocals:
+		buf.WriteString("locals {\n")
+		for i, d := range declarations {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "  %s = [\n", d.Name)
+			for _, cidr := range d.CIDRList {
+				fmt.Fprintf(&buf, "    %s,\n", lib.QuoteHCL(cidr))
+			}
+			buf.WriteString("  ]\n")
+		}
+		buf.WriteString("}\n")
+
+	case declareVariable:
+		for i, d := range declarations {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "variable %s {\n", lib.QuoteHCL(d.Name))
+			buf.WriteString("  type    = list(string)\n")
+			buf.WriteString("  default = [\n")
+			for _, cidr := range d.CIDRList {
+				fmt.Fprintf(&buf, "    %s,\n", lib.QuoteHCL(cidr))
+			}
+			buf.WriteString("  ]\n}\n")
+		}
+	}
+
+	if h.Resource == resourceAWSPrefixList {
+		reference := "local."
+		if h.DeclareAs == declareVariable {
+			reference = "var."
+		}
+
+		for _, d := range declarations {
+			addressFamily := "IPv4"
+			if d.IPType == lib.IPv6 {
+				addressFamily = "IPv6"
+			}
+
+			buf.WriteString("\n")
+			fmt.Fprintf(&buf, "resource %s %s {\n", lib.QuoteHCL(resourceAWSPrefixList), lib.QuoteHCL(d.Name))
+			fmt.Fprintf(&buf, "  name           = %s\n", lib.QuoteHCL(strings.ReplaceAll(d.Name, "_", "-")))
+			fmt.Fprintf(&buf, "  address_family = %s\n", lib.QuoteHCL(addressFamily))
+			fmt.Fprintf(&buf, "  max_entries    = length(%s%s)\n", reference, d.Name)
+			buf.WriteString("\n  dynamic \"entry\" {\n")
+			fmt.Fprintf(&buf, "    for_each = %s%s\n", reference, d.Name)
+			buf.WriteString("    content {\n")
+			buf.WriteString("      cidr = entry.value\n")
+			buf.WriteString("    }\n  }\n}\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (h *hclOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(h.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", h.Type, "file", filename, "dir", dir)
+
+	return nil
+}
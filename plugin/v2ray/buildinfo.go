@@ -0,0 +1,59 @@
+package v2ray
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/v2fly/geoip/lib"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// buildInfoField is the number of the field of GeoIPList the build info is embedded
+// in as JSON, which is unknown to V2Ray and other consumers and skipped by them.
+// Its tag is a single byte like the one of entries, as some consumers scan entries
+// without unmarshaling the whole list.
+const buildInfoField protowire.Number = 15
+
+func init() {
+	lib.RegisterBuildInfoReader(typeGeoIPdatIn, readBuildInfo)
+}
+
+// appendBuildInfo appends the build info to the marshaled GeoIPList, after all entries
+func appendBuildInfo(b []byte, info *lib.BuildInfo) ([]byte, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	b = protowire.AppendTag(b, buildInfoField, protowire.BytesType)
+	return protowire.AppendBytes(b, data), nil
+}
+
+// readBuildInfo returns the build info embedded in the marshaled GeoIPList, nil if none
+func readBuildInfo(b []byte) (*lib.BuildInfo, error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid dat file: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == buildInfoField && typ == protowire.BytesType {
+			data, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, fmt.Errorf("invalid dat file: %w", protowire.ParseError(n))
+			}
+			info := new(lib.BuildInfo)
+			if err := json.Unmarshal(data, info); err != nil {
+				return nil, fmt.Errorf("invalid build info: %w", err)
+			}
+			return info, nil
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid dat file: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil, nil
+}
@@ -1,15 +1,16 @@
 package v2ray
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
-	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 
 	"github.com/v2fly/geoip/lib"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -18,6 +19,13 @@ const (
 	descGeoIPdatIn = "Convert V2Ray GeoIP dat to other formats"
 )
 
+// Field numbers of GeoIPList and GeoIP in geoip.proto, which are decoded as streams
+const (
+	geoIPListEntryField   protowire.Number = 1
+	geoIPCountryCodeField protowire.Number = 1
+	geoIPCIDRField        protowire.Number = 2
+)
+
 func init() {
 	lib.RegisterInputConfigCreator(typeGeoIPdatIn, func(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
 		return newGeoIPDatIn(action, data)
@@ -25,14 +33,19 @@ func init() {
 	lib.RegisterInputConverter(typeGeoIPdatIn, &geoIPDatIn{
 		Description: descGeoIPdatIn,
 	})
+	lib.RegisterInputArgs(typeGeoIPdatIn, geoIPDatInArgs{})
+}
+
+// geoIPDatInArgs are the args of the input converter in config file
+type geoIPDatInArgs struct {
+	URI        string     `json:"uri"`
+	Want       []string   `json:"wantedList"`
+	Exclude    []string   `json:"excludedList"`
+	OnlyIPType lib.IPType `json:"onlyIPType"`
 }
 
 func newGeoIPDatIn(action lib.Action, data json.RawMessage) (lib.InputConverter, error) {
-	var tmp struct {
-		URI        string     `json:"uri"`
-		Want       []string   `json:"wantedList"`
-		OnlyIPType lib.IPType `json:"onlyIPType"`
-	}
+	var tmp geoIPDatInArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -45,11 +58,14 @@ func newGeoIPDatIn(action lib.Action, data json.RawMessage) (lib.InputConverter,
 	}
 
 	// Filter want list
-	wantList := make(map[string]bool)
-	for _, want := range tmp.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" {
-			wantList[want] = true
-		}
+	wantList, err := lib.NewListMatcher(tmp.Want)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in wantedList", typeGeoIPdatIn, action, err)
+	}
+
+	excludeList, err := lib.NewListMatcher(tmp.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("❌ [type %s | action %s] %v in excludedList", typeGeoIPdatIn, action, err)
 	}
 
 	return &geoIPDatIn{
@@ -58,6 +74,7 @@ func newGeoIPDatIn(action lib.Action, data json.RawMessage) (lib.InputConverter,
 		Description: descGeoIPdatIn,
 		URI:         tmp.URI,
 		Want:        wantList,
+		Exclude:     excludeList,
 		OnlyIPType:  tmp.OnlyIPType,
 	}, nil
 }
@@ -67,7 +84,8 @@ type geoIPDatIn struct {
 	Action      lib.Action
 	Description string
 	URI         string
-	Want        map[string]bool
+	Want        *lib.ListMatcher
+	Exclude     *lib.ListMatcher
 	OnlyIPType  lib.IPType
 }
 
@@ -83,13 +101,21 @@ func (g *geoIPDatIn) GetDescription() string {
 	return g.Description
 }
 
+func (g *geoIPDatIn) IsSourceInput() bool {
+	return true
+}
+
 func (g *geoIPDatIn) Input(container lib.Container) (lib.Container, error) {
+	return g.InputContext(context.Background(), container)
+}
+
+func (g *geoIPDatIn) InputContext(ctx context.Context, container lib.Container) (lib.Container, error) {
 	entries := make(map[string]*lib.Entry)
 	var err error
 
 	switch {
 	case strings.HasPrefix(strings.ToLower(g.URI), "http://"), strings.HasPrefix(strings.ToLower(g.URI), "https://"):
-		err = g.walkRemoteFile(g.URI, entries)
+		err = g.walkRemoteFile(ctx, g.URI, entries)
 	default:
 		err = g.walkLocalFile(g.URI, entries)
 	}
@@ -129,6 +155,7 @@ func (g *geoIPDatIn) Input(container lib.Container) (lib.Container, error) {
 }
 
 func (g *geoIPDatIn) walkLocalFile(path string, entries map[string]*lib.Entry) error {
+	lib.RecordSource(path)
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -142,55 +169,122 @@ func (g *geoIPDatIn) walkLocalFile(path string, entries map[string]*lib.Entry) e
 	return nil
 }
 
-func (g *geoIPDatIn) walkRemoteFile(url string, entries map[string]*lib.Entry) error {
-	resp, err := http.Get(url)
+func (g *geoIPDatIn) walkRemoteFile(ctx context.Context, url string, entries map[string]*lib.Entry) error {
+	body, err := lib.GetRemoteURLReaderContext(ctx, url)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to get remote file %s, http status code %d", url, resp.StatusCode)
-	}
+	defer body.Close()
 
-	if err := g.generateEntries(resp.Body, entries); err != nil {
+	if err := g.generateEntries(body, entries); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// generateEntries decodes the GeoIPList entry by entry from the reader, instead of
+// unmarshaling the whole list into memory, and skips entries not wanted without
+// decoding their CIDRs, so that very large dat files could be consumed.
 func (g *geoIPDatIn) generateEntries(reader io.Reader, entries map[string]*lib.Entry) error {
-	geoipBytes, err := io.ReadAll(reader)
-	if err != nil {
-		return err
-	}
+	list := newDatReader(reader)
+	for {
+		num, typ, err := list.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	var geoipList GeoIPList
-	if err := proto.Unmarshal(geoipBytes, &geoipList); err != nil {
-		return err
+		// Fields other than entries, like the build info, are skipped
+		if num != geoIPListEntryField || typ != protowire.BytesType {
+			if err := list.skip(typ); err != nil {
+				return err
+			}
+			continue
+		}
+
+		geoip, err := list.message()
+		if err != nil {
+			return err
+		}
+		if err := g.readEntry(geoip, entries); err != nil {
+			return err
+		}
+		if err := geoip.skipAll(); err != nil {
+			return err
+		}
 	}
+}
 
-	for _, geoip := range geoipList.Entry {
-		name := strings.ToUpper(strings.TrimSpace(geoip.CountryCode))
+// readEntry reads a GeoIP into entries, if its country code is wanted
+func (g *geoIPDatIn) readEntry(geoip *datReader, entries map[string]*lib.Entry) error {
+	var entry *lib.Entry
+	// CIDRs are kept until the country code is read, as fields could be in any order
+	var pending []netip.Prefix
 
-		if len(g.Want) > 0 && !g.Want[name] {
-			continue
+	for {
+		num, typ, err := geoip.next()
+		if err == io.EOF {
+			break
 		}
-
-		entry, found := entries[name]
-		if !found {
-			entry = lib.NewEntry(name)
+		if err != nil {
+			return err
 		}
 
-		for _, v2rayCIDR := range geoip.Cidr {
-			ipStr := net.IP(v2rayCIDR.GetIp()).String() + "/" + fmt.Sprint(v2rayCIDR.GetPrefix())
-			if err := entry.AddPrefix(ipStr); err != nil {
+		switch {
+		case num == geoIPCountryCodeField && typ == protowire.BytesType:
+			code, err := geoip.bytes()
+			if err != nil {
 				return err
 			}
-		}
+			name := strings.ToUpper(strings.TrimSpace(string(code)))
+			if (!g.Want.IsEmpty() && !g.Want.Match(name)) || g.Exclude.Match(name) {
+				return nil
+			}
+
+			var found bool
+			entry, found = entries[name]
+			if !found {
+				entry = lib.NewEntry(name)
+				entries[name] = entry
+			}
+			for _, prefix := range pending {
+				if err := entry.AddPrefix(prefix); err != nil {
+					return err
+				}
+			}
+			pending = nil
 
-		entries[name] = entry
+		case num == geoIPCIDRField && typ == protowire.BytesType:
+			b, err := geoip.bytes()
+			if err != nil {
+				return err
+			}
+			var v2rayCIDR CIDR
+			if err := proto.Unmarshal(b, &v2rayCIDR); err != nil {
+				return err
+			}
+			ip, ok := netip.AddrFromSlice(v2rayCIDR.GetIp())
+			if !ok {
+				return lib.ErrInvalidIP
+			}
+			// IPv4 addresses could be stored as IPv4-mapped IPv6 addresses with IPv4 prefix length
+			prefix := netip.PrefixFrom(ip.Unmap(), int(v2rayCIDR.GetPrefix()))
+			if entry == nil {
+				pending = append(pending, prefix)
+				continue
+			}
+			if err := entry.AddPrefix(prefix); err != nil {
+				return err
+			}
+
+		default:
+			if err := geoip.skip(typ); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -3,7 +3,7 @@ package v2ray
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/netip"
 	"os"
 	"path/filepath"
@@ -32,17 +32,22 @@ func init() {
 	lib.RegisterOutputConverter(typeGeoIPdatOut, &geoIPDatOut{
 		Description: descGeoIPdatOut,
 	})
+	lib.RegisterOutputArgs(typeGeoIPdatOut, geoIPDatOutArgs{})
+}
+
+// geoIPDatOutArgs are the args of the output converter in config file
+type geoIPDatOutArgs struct {
+	OutputName     string     `json:"outputName"`
+	OutputDir      string     `json:"outputDir"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OneFilePerList bool       `json:"oneFilePerList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+	BuildInfo      bool       `json:"buildInfo"`
 }
 
 func newGeoIPDat(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
-	var tmp struct {
-		OutputName     string     `json:"outputName"`
-		OutputDir      string     `json:"outputDir"`
-		Want           []string   `json:"wantedList"`
-		Exclude        []string   `json:"excludedList"`
-		OneFilePerList bool       `json:"oneFilePerList"`
-		OnlyIPType     lib.IPType `json:"onlyIPType"`
-	}
+	var tmp geoIPDatOutArgs
 
 	if len(data) > 0 {
 		if err := json.Unmarshal(data, &tmp); err != nil {
@@ -68,6 +73,7 @@ func newGeoIPDat(action lib.Action, data json.RawMessage) (lib.OutputConverter,
 		Exclude:        tmp.Exclude,
 		OneFilePerList: tmp.OneFilePerList,
 		OnlyIPType:     tmp.OnlyIPType,
+		BuildInfo:      tmp.BuildInfo,
 	}, nil
 }
 
@@ -81,6 +87,7 @@ type geoIPDatOut struct {
 	Exclude        []string
 	OneFilePerList bool
 	OnlyIPType     lib.IPType
+	BuildInfo      bool
 }
 
 func (g *geoIPDatOut) GetType() string {
@@ -100,10 +107,15 @@ func (g *geoIPDatOut) Output(container lib.Container) error {
 	geoIPList.Entry = make([]*GeoIP, 0, 300)
 	updated := false
 
+	var buildInfo *lib.BuildInfo
+	if g.BuildInfo {
+		buildInfo = lib.NewBuildInfo(container)
+	}
+
 	for _, name := range g.filterAndSortList(container) {
 		entry, found := container.GetEntry(name)
 		if !found {
-			log.Printf("❌ entry %s not found\n", name)
+			slog.Warn("entry not found", "plugin", g.Type, "entry", name)
 			continue
 		}
 
@@ -115,7 +127,7 @@ func (g *geoIPDatOut) Output(container lib.Container) error {
 		updated = true
 
 		if g.OneFilePerList {
-			geoIPBytes, err := proto.Marshal(geoIPList)
+			geoIPBytes, err := g.marshal(geoIPList, buildInfo)
 			if err != nil {
 				return err
 			}
@@ -133,7 +145,7 @@ func (g *geoIPDatOut) Output(container lib.Container) error {
 		// Sort to make reproducible builds
 		g.sort(geoIPList)
 
-		geoIPBytes, err := proto.Marshal(geoIPList)
+		geoIPBytes, err := g.marshal(geoIPList, buildInfo)
 		if err != nil {
 			return err
 		}
@@ -145,22 +157,27 @@ func (g *geoIPDatOut) Output(container lib.Container) error {
 	return nil
 }
 
-func (g *geoIPDatOut) filterAndSortList(container lib.Container) []string {
-	excludeMap := make(map[string]bool)
-	for _, exclude := range g.Exclude {
-		if exclude = strings.ToUpper(strings.TrimSpace(exclude)); exclude != "" {
-			excludeMap[exclude] = true
-		}
+// marshal marshals the list, with the build info embedded if not nil
+func (g *geoIPDatOut) marshal(list *GeoIPList, buildInfo *lib.BuildInfo) ([]byte, error) {
+	geoIPBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(list)
+	if err != nil || buildInfo == nil {
+		return geoIPBytes, err
 	}
+	return appendBuildInfo(geoIPBytes, buildInfo)
+}
+
+func (g *geoIPDatOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(g.Exclude)
 
 	wantList := make([]string, 0, len(g.Want))
-	for _, want := range g.Want {
-		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeMap[want] {
+	for _, want := range lib.ExpandWantedList(container, g.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
 			wantList = append(wantList, want)
 		}
 	}
 
-	if len(wantList) > 0 {
+	if len(wantList) > 0 || lib.HasListPattern(g.Want) {
 		// Sort the list
 		slices.Sort(wantList)
 		return wantList
@@ -169,7 +186,7 @@ func (g *geoIPDatOut) filterAndSortList(container lib.Container) []string {
 	list := make([]string, 0, 300)
 	for entry := range container.Loop() {
 		name := entry.GetName()
-		if excludeMap[name] {
+		if excludeList.Match(name) {
 			continue
 		}
 		list = append(list, name)
@@ -222,15 +239,19 @@ func (g *geoIPDatOut) sort(list *GeoIPList) {
 }
 
 func (g *geoIPDatOut) writeFile(filename string, geoIPBytes []byte) error {
-	if err := os.MkdirAll(g.OutputDir, 0755); err != nil {
+	dir, filename, err := lib.ResolveOutputPath(g.OutputDir, filename, geoIPBytes)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(filepath.Join(g.OutputDir, filename), geoIPBytes, 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(dir, filename), geoIPBytes, 0644); err != nil {
 		return err
 	}
 
-	log.Printf("✅ [%s] %s --> %s", g.Type, filename, g.OutputDir)
+	slog.Info("file written", "plugin", g.Type, "file", filename, "dir", dir)
 
 	return nil
 }
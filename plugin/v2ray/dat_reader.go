@@ -0,0 +1,149 @@
+package v2ray
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// errInvalidDat is returned if the dat file is not a marshaled GeoIPList
+var errInvalidDat = errors.New("invalid dat file")
+
+// datReader reads the fields of a marshaled message from a stream one by one, so that
+// large dat files are decoded without reading them into memory. The message is limited
+// to n remaining bytes, or to the end of the stream if n is negative.
+type datReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func newDatReader(r io.Reader) *datReader {
+	return &datReader{r: bufio.NewReader(r), n: -1}
+}
+
+func (d *datReader) ReadByte() (byte, error) {
+	if d.n == 0 {
+		return 0, io.EOF
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if d.n > 0 {
+		d.n--
+	}
+	return b, nil
+}
+
+// next returns the number and wire type of the next field, io.EOF at the end of the message
+func (d *datReader) next() (protowire.Number, protowire.Type, error) {
+	tag, err := binary.ReadUvarint(d)
+	if err != nil {
+		if err == io.EOF {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, d.wrap(err)
+	}
+	num, typ := protowire.DecodeTag(tag)
+	if !num.IsValid() {
+		return 0, 0, fmt.Errorf("%w: invalid field number %d", errInvalidDat, num)
+	}
+	return num, typ, nil
+}
+
+// length returns the length of the bytes field value to read
+func (d *datReader) length() (int64, error) {
+	v, err := binary.ReadUvarint(d)
+	if err != nil {
+		return 0, d.wrap(err)
+	}
+	if v > uint64(1<<31-1) || (d.n >= 0 && int64(v) > d.n) {
+		return 0, fmt.Errorf("%w: invalid length %d", errInvalidDat, v)
+	}
+	return int64(v), nil
+}
+
+// bytes returns the value of a bytes field
+func (d *datReader) bytes() ([]byte, error) {
+	n, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, d.wrap(err)
+	}
+	if d.n > 0 {
+		d.n -= n
+	}
+	return b, nil
+}
+
+// message returns the reader of an embedded message field, which must be read or
+// skipped before reading the next field of d
+func (d *datReader) message() (*datReader, error) {
+	n, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	if d.n > 0 {
+		d.n -= n
+	}
+	return &datReader{r: d.r, n: n}, nil
+}
+
+// skip skips the value of a field of the wire type
+func (d *datReader) skip(typ protowire.Type) error {
+	switch typ {
+	case protowire.VarintType:
+		_, err := binary.ReadUvarint(d)
+		return d.wrap(err)
+	case protowire.Fixed32Type:
+		return d.discard(4)
+	case protowire.Fixed64Type:
+		return d.discard(8)
+	case protowire.BytesType:
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		return d.discard(n)
+	default:
+		return fmt.Errorf("%w: unsupported wire type %d", errInvalidDat, typ)
+	}
+}
+
+// skipAll skips the remaining bytes of a limited message
+func (d *datReader) skipAll() error {
+	if d.n <= 0 {
+		return nil
+	}
+	return d.discard(d.n)
+}
+
+func (d *datReader) discard(n int64) error {
+	if d.n >= 0 && n > d.n {
+		return fmt.Errorf("%w: %w", errInvalidDat, io.ErrUnexpectedEOF)
+	}
+	if _, err := d.r.Discard(int(n)); err != nil {
+		return d.wrap(err)
+	}
+	if d.n > 0 {
+		d.n -= n
+	}
+	return nil
+}
+
+func (d *datReader) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %w", errInvalidDat, io.ErrUnexpectedEOF)
+	}
+	return err
+}
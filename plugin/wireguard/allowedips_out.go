@@ -0,0 +1,254 @@
+package wireguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+)
+
+const (
+	typeAllowedIPsOut = "wireguardAllowedIPs"
+	descAllowedIPsOut = "Convert data to WireGuard AllowedIPs"
+)
+
+const (
+	formatConf = "conf"
+	formatText = "text"
+)
+
+var (
+	defaultOutputDir = filepath.Join("./", "output", "wireguard")
+
+	formatExtensions = map[string]string{
+		formatConf: ".conf",
+		formatText: ".txt",
+	}
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeAllowedIPsOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newAllowedIPsOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeAllowedIPsOut, &allowedIPsOut{
+		Description: descAllowedIPsOut,
+	})
+	lib.RegisterOutputArgs(typeAllowedIPsOut, allowedIPsOutArgs{})
+}
+
+// allowedIPsOutArgs are the args of the output converter in config file
+type allowedIPsOutArgs struct {
+	OutputDir     string     `json:"outputDir"`
+	Format        string     `json:"format"`
+	Invert        bool       `json:"invert"`
+	InvertExclude []string   `json:"invertExclude"`
+	Want          []string   `json:"wantedList"`
+	Exclude       []string   `json:"excludedList"`
+	OnlyIPType    lib.IPType `json:"onlyIPType"`
+}
+
+func newAllowedIPsOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp allowedIPsOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	tmp.Format = strings.ToLower(strings.TrimSpace(tmp.Format))
+	if tmp.Format == "" {
+		tmp.Format = formatConf
+	}
+	if _, found := formatExtensions[tmp.Format]; !found {
+		return nil, fmt.Errorf("❌ [type %s | action %s] invalid format %s, the value must be conf or text", typeAllowedIPsOut, action, tmp.Format)
+	}
+
+	invertExclude := make([]netip.Prefix, 0, len(tmp.InvertExclude))
+	for _, cidr := range tmp.InvertExclude {
+		cidr = strings.TrimSpace(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("❌ [type %s | action %s] invalid CIDR %s in invertExclude: %v", typeAllowedIPsOut, action, cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		invertExclude = append(invertExclude, prefix.Masked())
+	}
+
+	return &allowedIPsOut{
+		Type:          typeAllowedIPsOut,
+		Action:        action,
+		Description:   descAllowedIPsOut,
+		OutputDir:     tmp.OutputDir,
+		Format:        tmp.Format,
+		Invert:        tmp.Invert,
+		InvertExclude: invertExclude,
+		Want:          tmp.Want,
+		Exclude:       tmp.Exclude,
+		OnlyIPType:    tmp.OnlyIPType,
+	}, nil
+}
+
+type allowedIPsOut struct {
+	Type          string
+	Action        lib.Action
+	Description   string
+	OutputDir     string
+	Format        string
+	Invert        bool
+	InvertExclude []netip.Prefix
+	Want          []string
+	Exclude       []string
+	OnlyIPType    lib.IPType
+}
+
+func (a *allowedIPsOut) GetType() string {
+	return a.Type
+}
+
+func (a *allowedIPsOut) GetAction() lib.Action {
+	return a.Action
+}
+
+func (a *allowedIPsOut) GetDescription() string {
+	return a.Description
+}
+
+func (a *allowedIPsOut) Output(container lib.Container) error {
+	for _, name := range a.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", a.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := a.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		if a.Invert {
+			if prefixes, err = a.invert(prefixes); err != nil {
+				return err
+			}
+		}
+
+		cidrList := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			cidrList = append(cidrList, prefix.String())
+		}
+
+		allowedIPs := strings.Join(cidrList, ", ")
+		if a.Format == formatConf {
+			allowedIPs = "AllowedIPs = " + allowedIPs
+		}
+
+		filename := strings.ToLower(entry.GetName()) + formatExtensions[a.Format]
+		if err := a.writeFile(filename, []byte(allowedIPs+"\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *allowedIPsOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(a.Exclude)
+
+	wantList := make([]string, 0, len(a.Want))
+	for _, want := range lib.ExpandWantedList(container, a.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(a.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (a *allowedIPsOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch a.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// invert computes the complement of prefixes within the address space of
+// the IP types to output, with InvertExclude also removed
+func (a *allowedIPsOut) invert(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+	var builder netipx.IPSetBuilder
+	if a.OnlyIPType != lib.IPv6 {
+		builder.AddPrefix(netip.MustParsePrefix("0.0.0.0/0"))
+	}
+	if a.OnlyIPType != lib.IPv4 {
+		builder.AddPrefix(netip.MustParsePrefix("::/0"))
+	}
+
+	for _, prefix := range prefixes {
+		builder.RemovePrefix(prefix)
+	}
+	for _, prefix := range a.InvertExclude {
+		builder.RemovePrefix(prefix)
+	}
+
+	set, err := builder.IPSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return set.Prefixes(), nil
+}
+
+func (a *allowedIPsOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(a.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", a.Type, "file", filename, "dir", dir)
+
+	return nil
+}
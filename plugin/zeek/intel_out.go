@@ -0,0 +1,247 @@
+package zeek
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+const (
+	typeIntelOut = "zeekIntel"
+	descIntelOut = "Convert data to Zeek intelligence framework format"
+)
+
+var (
+	defaultOutputDir    = filepath.Join("./", "output", "zeek")
+	defaultOutputName   = "geoip.intel"
+	defaultSourcePrefix = "geoip-"
+)
+
+func init() {
+	lib.RegisterOutputConfigCreator(typeIntelOut, func(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+		return newIntelOut(action, data)
+	})
+	lib.RegisterOutputConverter(typeIntelOut, &intelOut{
+		Description: descIntelOut,
+	})
+	lib.RegisterOutputArgs(typeIntelOut, intelOutArgs{})
+}
+
+// intelOutArgs are the args of the output converter in config file
+type intelOutArgs struct {
+	OutputName     string     `json:"outputName"`
+	OutputDir      string     `json:"outputDir"`
+	OneFilePerList bool       `json:"oneFilePerList"`
+	SourcePrefix   string     `json:"sourcePrefix"`
+	Desc           string     `json:"desc"`
+	DoNotice       bool       `json:"doNotice"`
+	Want           []string   `json:"wantedList"`
+	Exclude        []string   `json:"excludedList"`
+	OnlyIPType     lib.IPType `json:"onlyIPType"`
+}
+
+func newIntelOut(action lib.Action, data json.RawMessage) (lib.OutputConverter, error) {
+	var tmp intelOutArgs
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmp.OutputName == "" {
+		tmp.OutputName = defaultOutputName
+	}
+
+	if tmp.OutputDir == "" {
+		tmp.OutputDir = defaultOutputDir
+	}
+
+	if tmp.SourcePrefix == "" {
+		tmp.SourcePrefix = defaultSourcePrefix
+	}
+
+	return &intelOut{
+		Type:           typeIntelOut,
+		Action:         action,
+		Description:    descIntelOut,
+		OutputName:     tmp.OutputName,
+		OutputDir:      tmp.OutputDir,
+		OneFilePerList: tmp.OneFilePerList,
+		SourcePrefix:   tmp.SourcePrefix,
+		Desc:           tmp.Desc,
+		DoNotice:       tmp.DoNotice,
+		Want:           tmp.Want,
+		Exclude:        tmp.Exclude,
+		OnlyIPType:     tmp.OnlyIPType,
+	}, nil
+}
+
+type intelOut struct {
+	Type           string
+	Action         lib.Action
+	Description    string
+	OutputName     string
+	OutputDir      string
+	OneFilePerList bool
+	SourcePrefix   string
+	Desc           string
+	DoNotice       bool
+	Want           []string
+	Exclude        []string
+	OnlyIPType     lib.IPType
+}
+
+func (i *intelOut) GetType() string {
+	return i.Type
+}
+
+func (i *intelOut) GetAction() lib.Action {
+	return i.Action
+}
+
+func (i *intelOut) GetDescription() string {
+	return i.Description
+}
+
+func (i *intelOut) Output(container lib.Container) error {
+	var buf bytes.Buffer
+	i.writeHeader(&buf)
+	headerLen := buf.Len()
+
+	for _, name := range i.filterAndSortList(container) {
+		entry, found := container.GetEntry(name)
+		if !found {
+			slog.Warn("entry not found", "plugin", i.Type, "entry", name)
+			continue
+		}
+
+		prefixes, err := i.marshalPrefix(entry)
+		if err != nil {
+			return err
+		}
+
+		if i.OneFilePerList {
+			var listBuf bytes.Buffer
+			i.writeHeader(&listBuf)
+			i.writeIndicators(&listBuf, entry.GetName(), prefixes)
+
+			filename := strings.ToLower(entry.GetName()) + ".intel"
+			if err := i.writeFile(filename, listBuf.Bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		i.writeIndicators(&buf, entry.GetName(), prefixes)
+	}
+
+	if !i.OneFilePerList && buf.Len() > headerLen {
+		if err := i.writeFile(i.OutputName, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *intelOut) filterAndSortList(container lib.Container) []string {
+	// Patterns of excluded lists are validated when the output is created
+	excludeList, _ := lib.NewListMatcher(i.Exclude)
+
+	wantList := make([]string, 0, len(i.Want))
+	for _, want := range lib.ExpandWantedList(container, i.Want) {
+		if want = strings.ToUpper(strings.TrimSpace(want)); want != "" && !excludeList.Match(want) {
+			wantList = append(wantList, want)
+		}
+	}
+
+	if len(wantList) > 0 || lib.HasListPattern(i.Want) {
+		// Sort the list
+		slices.Sort(wantList)
+		return wantList
+	}
+
+	list := make([]string, 0, 300)
+	for entry := range container.Loop() {
+		name := entry.GetName()
+		if excludeList.Match(name) {
+			continue
+		}
+		list = append(list, name)
+	}
+
+	// Sort the list
+	slices.Sort(list)
+
+	return list
+}
+
+func (i *intelOut) marshalPrefix(entry *lib.Entry) ([]netip.Prefix, error) {
+	switch i.OnlyIPType {
+	case lib.IPv4:
+		return entry.MarshalPrefix(lib.IgnoreIPv6)
+	case lib.IPv6:
+		return entry.MarshalPrefix(lib.IgnoreIPv4)
+	default:
+		return entry.MarshalPrefix()
+	}
+}
+
+// writeHeader writes the "#fields" line required by the input framework of Zeek
+func (i *intelOut) writeHeader(buf *bytes.Buffer) {
+	fields := []string{"#fields", "indicator", "indicator_type", "meta.source", "meta.desc"}
+	if i.DoNotice {
+		fields = append(fields, "meta.do_notice")
+	}
+	buf.WriteString(strings.Join(fields, "\t"))
+	buf.WriteString("\n")
+}
+
+// writeIndicators writes single addresses as Intel::ADDR and others as Intel::SUBNET
+func (i *intelOut) writeIndicators(buf *bytes.Buffer, name string, prefixes []netip.Prefix) {
+	source := i.SourcePrefix + strings.ToLower(name)
+	desc := i.Desc
+	if desc == "" {
+		desc = "-" // the unset value of Zeek
+	}
+
+	for _, prefix := range prefixes {
+		indicator, indicatorType := prefix.String(), "Intel::SUBNET"
+		if prefix.IsSingleIP() {
+			indicator, indicatorType = prefix.Addr().String(), "Intel::ADDR"
+		}
+
+		fields := []string{indicator, indicatorType, source, desc}
+		if i.DoNotice {
+			fields = append(fields, "T")
+		}
+		buf.WriteString(strings.Join(fields, "\t"))
+		buf.WriteString("\n")
+	}
+}
+
+func (i *intelOut) writeFile(filename string, data []byte) error {
+	dir, filename, err := lib.ResolveOutputPath(i.OutputDir, filename, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return err
+	}
+
+	slog.Info("file written", "plugin", i.Type, "file", filename, "dir", dir)
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "schema",
+		usage:       "",
+		description: "Print the JSON schema of the config file",
+		run:         runSchema,
+	})
+}
+
+func runSchema(args []string) error {
+	fs := commands["schema"].newFlagSet()
+	fs.Parse(args)
+
+	schema, err := lib.ConfigSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
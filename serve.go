@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "serve",
+		usage:       "[flags] [-schedule <cron expression> | -interval <duration>]",
+		description: "Run the config file periodically, and serve generated files, lookups, health and status over HTTP",
+		run:         runServe,
+	})
+}
+
+// serveStatus is the status of scheduled runs, served over HTTP
+type serveStatus struct {
+	mu sync.Mutex
+
+	Config      string     `json:"config"`
+	Schedule    string     `json:"schedule"`
+	Running     bool       `json:"running"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+	LastRun     *runResult `json:"lastRun,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	NextRun     *time.Time `json:"nextRun,omitempty"`
+}
+
+type runResult struct {
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func runServe(args []string) error {
+	cmd := commands["serve"]
+	fs := cmd.newFlagSet()
+	var configFiles configFlag
+	fs.Var(&configFiles, "c", "Path to the config file or directory, which is read again before every run, could be specified multiple times to merge them in order (default config.json)")
+	cronSpec := fs.String("schedule", "", `Cron expression of runs in local time, like "0 4 * * *" or "@daily"`)
+	interval := fs.Duration("interval", 0, "Interval between the end of a run and the start of the next one, like 6h")
+	runNow := fs.Bool("run-now", true, "Run once at startup before following the schedule")
+	listen := fs.String("listen", ":8080", "Address to serve /healthz, /status and generated files over HTTP, empty to disable")
+	filesDir := fs.String("files", "", "Directory of generated files to serve under /files/, subdirectories included")
+	lookupFiles := fs.String("lookup", "", "Comma separated generated files to look up IP addresses in by /lookup and /lists, reloaded after every successful run")
+	grpcListen := fs.String("grpc-listen", "", "Address to serve the gRPC API of lookups and builds, empty to disable")
+	lookupFormat := fs.String("lookup-format", "", "Input format of the files to look up, detected by file extension if not specified")
+	concurrency := fs.Int("concurrency", 1, "Max number of inputs loading data from their sources concurrently")
+	offline := fs.Bool("offline", false, "Forbid network access and read all remote files from the download cache")
+	profile := fs.String("profile", "", "Name of the build profile, which selects inputs and outputs by their profiles args and enabled expressions")
+	stateFile := fs.String("state", "", "Path to the state file of incremental builds, which skip the run or outputs if unchanged since the last run")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	var sched schedule
+	var spec string
+	switch {
+	case *cronSpec != "" && *interval != 0:
+		return errors.New("only one of -schedule and -interval could be specified")
+	case *cronSpec != "":
+		s, err := parseCron(*cronSpec)
+		if err != nil {
+			return err
+		}
+		sched, spec = s, *cronSpec
+	case *interval > 0:
+		sched, spec = intervalSchedule(*interval), "every "+interval.String()
+	case *interval < 0:
+		return errors.New("-interval must be positive")
+	case *listen == "" && *grpcListen == "":
+		fs.Usage()
+		return errors.New("-schedule or -interval must be specified if -listen and -grpc-listen are empty")
+	}
+
+	lib.SetProfile(*profile)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	status := &serveStatus{Config: strings.Join(configFiles.files(), ","), Schedule: spec}
+	artifacts := newArtifactServer(*filesDir, splitList(*lookupFiles), *lookupFormat)
+	// Files generated before are looked up until the first run succeeds
+	artifacts.reload()
+
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		status.register(mux)
+		artifacts.register(mux)
+		server := &http.Server{Handler: mux}
+		go server.Serve(ln)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		slog.Info("serving status", "addr", ln.Addr().String())
+	}
+
+	b := &builder{run: func() error {
+		status.start()
+		start := time.Now()
+		err := runOnce(ctx, configFiles.files(), *concurrency, *stateFile, *offline)
+		status.finish(start, err)
+		if err != nil {
+			// Outputs are run only after all inputs succeed, so a failed download keeps the files of the previous run
+			if ctx.Err() == nil {
+				slog.Error("run failed", "error", err, "duration", time.Since(start))
+			}
+			return err
+		}
+		slog.Info("run done", "duration", time.Since(start))
+		artifacts.reload()
+		return nil
+	}}
+
+	if *grpcListen != "" {
+		stopGRPC, err := serveGRPC(*grpcListen, artifacts, b)
+		if err != nil {
+			return err
+		}
+		defer stopGRPC()
+	}
+
+	if *runNow {
+		b.runNow()
+	}
+	// Without a schedule, generated files are served until stopped
+	if sched == nil {
+		<-ctx.Done()
+	}
+	for ctx.Err() == nil {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("no time matches the schedule %s", spec)
+		}
+		status.setNextRun(next)
+		slog.Info("next run scheduled", "time", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+			b.runNow()
+		}
+	}
+
+	slog.Info("stopped")
+	return nil
+}
+
+// builder runs the config file, one run at a time, on schedule or triggered by the gRPC API
+type builder struct {
+	mu  sync.Mutex
+	run func() error
+}
+
+// runNow runs after the run in progress if any
+func (b *builder) runNow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.run()
+}
+
+// start runs unless another run is in progress, and waits until it is done if wait is true
+func (b *builder) start(wait bool) (bool, error) {
+	if !b.mu.TryLock() {
+		return false, nil
+	}
+	if !wait {
+		go func() {
+			defer b.mu.Unlock()
+			b.run()
+		}()
+		return true, nil
+	}
+	defer b.mu.Unlock()
+	return true, b.run()
+}
+
+// runOnce runs the config files with a new instance, so that changes of the config files are applied.
+// Download options are reset first, as they are kept by the process and merged by config files.
+func runOnce(ctx context.Context, configFiles []string, concurrency int, stateFile string, offline bool) error {
+	lib.ResetDownloadOptions()
+	if offline {
+		lib.SetDownloadOptions(&lib.DownloadOptions{Offline: true})
+	}
+	instance, err := lib.NewInstance()
+	if err != nil {
+		return err
+	}
+	if err := initConfigs(instance, configFiles); err != nil {
+		return err
+	}
+	instance.SetConcurrency(concurrency)
+	instance.SetStateFile(stateFile)
+	return instance.RunContext(ctx)
+}
+
+func (s *serveStatus) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Running = true
+	s.NextRun = nil
+}
+
+func (s *serveStatus) finish(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Running = false
+	s.Runs++
+	s.LastRun = &runResult{Start: start, Duration: time.Since(start).String()}
+	if err != nil {
+		s.Failures++
+		s.LastRun.Error = err.Error()
+		return
+	}
+	end := time.Now()
+	s.LastSuccess = &end
+}
+
+func (s *serveStatus) setNextRun(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NextRun = &next
+}
+
+// register serves /healthz, which fails if the last run failed, and /status in JSON
+func (s *serveStatus) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.LastRun != nil && s.LastRun.Error != "" {
+			http.Error(w, "last run failed: "+s.LastRun.Error, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, s)
+	})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content types of generated files unknown to the mime package
+var artifactContentTypes = map[string]string{
+	".dat":       "application/octet-stream",
+	".mmdb":      "application/octet-stream",
+	".minisig":   "text/plain; charset=utf-8",
+	".sha256sum": "text/plain; charset=utf-8",
+	".sha512sum": "text/plain; charset=utf-8",
+	".sha1sum":   "text/plain; charset=utf-8",
+	".md5":       "text/plain; charset=utf-8",
+}
+
+// Extensions of files already compressed, which are not compressed again
+var compressedExtensions = []string{".gz", ".tgz", ".zip", ".xz", ".zst", ".br", ".bz2", ".7z"}
+
+// artifactServer serves generated files, and looks up IP addresses in some of them
+type artifactServer struct {
+	dir         string
+	lookupPaths []string
+	format      string
+
+	mu    sync.RWMutex
+	files []*lookupFile // files loaded for lookups, reloaded after every successful run
+
+	etagsMu sync.Mutex
+	etags   map[string]*fileETag // ETags of served files by path
+}
+
+// fileETag is the hash of the content of a file, valid until its size or modification time changes
+type fileETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+func newArtifactServer(dir string, lookupPaths []string, format string) *artifactServer {
+	return &artifactServer{
+		dir:         dir,
+		lookupPaths: lookupPaths,
+		format:      format,
+		etags:       make(map[string]*fileETag),
+	}
+}
+
+// register serves files under /files/, and /lists and /lookup if there are files to look up
+func (s *artifactServer) register(mux *http.ServeMux) {
+	if s.dir != "" {
+		mux.HandleFunc("GET /files/{path...}", s.serveFile)
+	}
+	if len(s.lookupPaths) > 0 {
+		mux.HandleFunc("GET /lists", s.serveLists)
+		mux.HandleFunc("GET /lookup", s.serveLookup)
+	}
+}
+
+// reload loads the files to look up again, keeping the loaded ones on failure
+func (s *artifactServer) reload() {
+	if len(s.lookupPaths) == 0 {
+		return
+	}
+
+	files := make([]*lookupFile, 0, len(s.lookupPaths))
+	for _, path := range s.lookupPaths {
+		file, err := loadLookupFile(path, s.format)
+		if err != nil {
+			slog.Warn("failed to load file for lookups", "file", path, "error", err)
+			return
+		}
+		files = append(files, file)
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.mu.Unlock()
+	slog.Info("files for lookups loaded", "files", len(files))
+}
+
+func (s *artifactServer) loadedFiles() []*lookupFile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.files
+}
+
+func (s *artifactServer) serveLists(w http.ResponseWriter, r *http.Request) {
+	files := s.loadedFiles()
+	if files == nil {
+		http.Error(w, "files for lookups are not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	results := make([]*lookupMatch, 0, len(files))
+	for _, file := range files {
+		results = append(results, &lookupMatch{File: file.path, Lists: file.names})
+	}
+	writeJSON(w, results)
+}
+
+// serveLookup looks up every ip query parameter, the same as the lookup command with -json
+func (s *artifactServer) serveLookup(w http.ResponseWriter, r *http.Request) {
+	queries := r.URL.Query()["ip"]
+	if len(queries) == 0 {
+		http.Error(w, "ip must be specified", http.StatusBadRequest)
+		return
+	}
+
+	files := s.loadedFiles()
+	if files == nil {
+		http.Error(w, "files for lookups are not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	results := make([]*lookupResult, 0, len(queries))
+	for _, query := range queries {
+		prefix, err := parseQuery(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result := &lookupResult{Query: query, Matches: make([]*lookupMatch, 0, len(files))}
+		for _, file := range files {
+			result.Matches = append(result.Matches, &lookupMatch{
+				File:  file.path,
+				Lists: file.lookup(prefix),
+			})
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, results)
+}
+
+// serveFile serves a file in the directory with its content type and ETag,
+// compressed by gzip if accepted by the client
+func (s *artifactServer) serveFile(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.PathValue("path"))
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag, err := s.etag(f, info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contentType, err := artifactContentType(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Vary", "Accept-Encoding")
+
+	if !acceptsGzip(r) || slices.Contains(compressedExtensions, strings.ToLower(filepath.Ext(name))) {
+		header.Set("ETag", `"`+etag+`"`)
+		// Conditional and range requests are handled by ServeContent
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		return
+	}
+
+	// The compressed content is another representation with its own ETag
+	etag = `"` + etag + `-gzip"`
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == "*" || slices.Contains(strings.Split(strings.ReplaceAll(match, " ", ""), ","), etag)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	if r.Method == http.MethodHead {
+		return
+	}
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	io.Copy(gz, f)
+}
+
+// etag returns the hash of the content of the file, cached until the file changes,
+// so that identical files generated by reproducible builds have the same ETag
+func (s *artifactServer) etag(f *os.File, info fs.FileInfo) (string, error) {
+	s.etagsMu.Lock()
+	cached, found := s.etags[f.Name()]
+	s.etagsMu.Unlock()
+	if found && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(h.Sum(nil))[:32]
+
+	s.etagsMu.Lock()
+	s.etags[f.Name()] = &fileETag{size: info.Size(), modTime: info.ModTime(), etag: etag}
+	s.etagsMu.Unlock()
+	return etag, nil
+}
+
+// artifactContentType returns the content type by file extension, or detected by content
+func artifactContentType(f *os.File) (string, error) {
+	ext := strings.ToLower(filepath.Ext(f.Name()))
+	if contentType, found := artifactContentTypes[ext]; found {
+		return contentType, nil
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType, nil
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/v2fly/geoip/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// grpcServer implements the gRPC API with the files loaded for lookups and the builder
+type grpcServer struct {
+	service.UnimplementedGeoIPServer
+
+	artifacts *artifactServer
+	builder   *builder
+}
+
+// serveGRPC serves the gRPC API on the address, and returns the function to stop it
+func serveGRPC(addr string, artifacts *artifactServer, b *builder) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := grpc.NewServer()
+	service.RegisterGeoIPServer(server, &grpcServer{artifacts: artifacts, builder: b})
+	go server.Serve(ln)
+	slog.Info("serving gRPC API", "addr", ln.Addr().String())
+
+	return func() {
+		// Stop waiting builds after a while, the same as the HTTP server
+		timer := time.AfterFunc(5*time.Second, server.Stop)
+		server.GracefulStop()
+		timer.Stop()
+	}, nil
+}
+
+func (s *grpcServer) loadedFiles() ([]*lookupFile, error) {
+	files := s.artifacts.loadedFiles()
+	if files == nil {
+		return nil, status.Error(codes.Unavailable, "files for lookups are not loaded yet")
+	}
+	return files, nil
+}
+
+func (s *grpcServer) Lookup(ctx context.Context, req *service.LookupRequest) (*service.LookupResponse, error) {
+	if len(req.GetQueries()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "queries must be specified")
+	}
+	files, err := s.loadedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &service.LookupResponse{Results: make([]*service.LookupResult, 0, len(req.GetQueries()))}
+	for _, query := range req.GetQueries() {
+		prefix, err := parseQuery(query)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		result := &service.LookupResult{Query: query, Matches: make([]*service.FileMatch, 0, len(files))}
+		for _, file := range files {
+			result.Matches = append(result.Matches, &service.FileMatch{
+				File:  file.path,
+				Lists: file.lookup(prefix),
+			})
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) ListEntries(ctx context.Context, req *service.ListEntriesRequest) (*service.ListEntriesResponse, error) {
+	files, err := s.loadedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make([]string, 0, len(req.GetLists()))
+	for _, name := range req.GetLists() {
+		wanted = append(wanted, strings.ToUpper(strings.TrimSpace(name)))
+	}
+
+	resp := &service.ListEntriesResponse{Entries: make([]*service.Entry, 0)}
+	for _, file := range files {
+		if req.GetFile() != "" && req.GetFile() != file.path {
+			continue
+		}
+		for _, name := range file.names {
+			if len(wanted) > 0 && !slices.Contains(wanted, name) {
+				continue
+			}
+			entry := &service.Entry{File: file.path, Name: name}
+			if req.GetWithCidrs() {
+				list, _ := file.container.GetEntry(name)
+				for prefix, err := range list.Prefixes() {
+					if err != nil {
+						return nil, status.Error(codes.Internal, err.Error())
+					}
+					entry.Cidrs = append(entry.Cidrs, prefix.String())
+				}
+			}
+			resp.Entries = append(resp.Entries, entry)
+		}
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) TriggerBuild(ctx context.Context, req *service.TriggerBuildRequest) (*service.TriggerBuildResponse, error) {
+	start := time.Now()
+	started, err := s.builder.start(req.GetWait())
+	resp := &service.TriggerBuildResponse{Started: started}
+	if started && req.GetWait() {
+		resp.Duration = durationpb.New(time.Since(start))
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return resp, nil
+}
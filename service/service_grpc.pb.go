@@ -0,0 +1,209 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: service.proto
+
+package service
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GeoIP_Lookup_FullMethodName       = "/geoip.service.GeoIP/Lookup"
+	GeoIP_ListEntries_FullMethodName  = "/geoip.service.GeoIP/ListEntries"
+	GeoIP_TriggerBuild_FullMethodName = "/geoip.service.GeoIP/TriggerBuild"
+)
+
+// GeoIPClient is the client API for GeoIP service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GeoIP looks up IP addresses in generated files, and runs the config file,
+// served by the serve command with -grpc-listen
+type GeoIPClient interface {
+	// Lookup returns the lists containing every IP address or CIDR in every file.
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+	// ListEntries returns the lists in the files, optionally with their CIDRs.
+	ListEntries(ctx context.Context, in *ListEntriesRequest, opts ...grpc.CallOption) (*ListEntriesResponse, error)
+	// TriggerBuild runs the config file, unless another run is in progress.
+	TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error)
+}
+
+type geoIPClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeoIPClient(cc grpc.ClientConnInterface) GeoIPClient {
+	return &geoIPClient{cc}
+}
+
+func (c *geoIPClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupResponse)
+	err := c.cc.Invoke(ctx, GeoIP_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geoIPClient) ListEntries(ctx context.Context, in *ListEntriesRequest, opts ...grpc.CallOption) (*ListEntriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListEntriesResponse)
+	err := c.cc.Invoke(ctx, GeoIP_ListEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geoIPClient) TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerBuildResponse)
+	err := c.cc.Invoke(ctx, GeoIP_TriggerBuild_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GeoIPServer is the server API for GeoIP service.
+// All implementations must embed UnimplementedGeoIPServer
+// for forward compatibility.
+//
+// GeoIP looks up IP addresses in generated files, and runs the config file,
+// served by the serve command with -grpc-listen
+type GeoIPServer interface {
+	// Lookup returns the lists containing every IP address or CIDR in every file.
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	// ListEntries returns the lists in the files, optionally with their CIDRs.
+	ListEntries(context.Context, *ListEntriesRequest) (*ListEntriesResponse, error)
+	// TriggerBuild runs the config file, unless another run is in progress.
+	TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error)
+	mustEmbedUnimplementedGeoIPServer()
+}
+
+// UnimplementedGeoIPServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGeoIPServer struct{}
+
+func (UnimplementedGeoIPServer) Lookup(context.Context, *LookupRequest) (*LookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedGeoIPServer) ListEntries(context.Context, *ListEntriesRequest) (*ListEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEntries not implemented")
+}
+func (UnimplementedGeoIPServer) TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerBuild not implemented")
+}
+func (UnimplementedGeoIPServer) mustEmbedUnimplementedGeoIPServer() {}
+func (UnimplementedGeoIPServer) testEmbeddedByValue()               {}
+
+// UnsafeGeoIPServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeoIPServer will
+// result in compilation errors.
+type UnsafeGeoIPServer interface {
+	mustEmbedUnimplementedGeoIPServer()
+}
+
+func RegisterGeoIPServer(s grpc.ServiceRegistrar, srv GeoIPServer) {
+	// If the following call pancis, it indicates UnimplementedGeoIPServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GeoIP_ServiceDesc, srv)
+}
+
+func _GeoIP_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoIPServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoIP_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoIPServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GeoIP_ListEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoIPServer).ListEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoIP_ListEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoIPServer).ListEntries(ctx, req.(*ListEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GeoIP_TriggerBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerBuildRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoIPServer).TriggerBuild(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoIP_TriggerBuild_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoIPServer).TriggerBuild(ctx, req.(*TriggerBuildRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GeoIP_ServiceDesc is the grpc.ServiceDesc for GeoIP service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GeoIP_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "geoip.service.GeoIP",
+	HandlerType: (*GeoIPServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _GeoIP_Lookup_Handler,
+		},
+		{
+			MethodName: "ListEntries",
+			Handler:    _GeoIP_ListEntries_Handler,
+		},
+		{
+			MethodName: "TriggerBuild",
+			Handler:    _GeoIP_TriggerBuild_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "service.proto",
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "stats",
+		usage:       "[flags] <file>...",
+		description: "Print the build info embedded in generated files, and the number of prefixes of their lists",
+		run:         runStats,
+	})
+}
+
+// fileStats is the build info and lists of a generated file
+type fileStats struct {
+	File      string         `json:"file"`
+	Format    string         `json:"format"`
+	BuildInfo *lib.BuildInfo `json:"buildInfo"` // nil if the file has no build info
+	IPv4      int            `json:"ipv4"`      // number of IPv4 prefixes of all lists
+	IPv6      int            `json:"ipv6"`      // number of IPv6 prefixes of all lists
+	Lists     []*listStats   `json:"lists"`
+}
+
+type listStats struct {
+	Name string `json:"name"`
+	IPv4 int    `json:"ipv4"`
+	IPv6 int    `json:"ipv6"`
+}
+
+func runStats(args []string) error {
+	cmd := commands["stats"]
+	fs := cmd.newFlagSet()
+	format := fs.String("format", "", "Input format of the files, detected by file extension if not specified")
+	showLists := fs.Bool("lists", false, "Print the number of prefixes of every list")
+	jsonOutput := fs.Bool("json", false, "Print the stats in JSON, always with every list")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("files must be specified")
+	}
+
+	stats := make([]*fileStats, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		s, err := readFileStats(path, *format)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		stats = append(stats, s)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	for idx, s := range stats {
+		if idx > 0 {
+			fmt.Println()
+		}
+		if err := s.write(os.Stdout, *showLists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFileStats(path, format string) (*fileStats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileStats{File: path, Format: artifactFormat(path, format, info.IsDir()), Lists: make([]*listStats, 0)}
+
+	if s.BuildInfo, err = readArtifactBuildInfo(path, s.Format, info.IsDir()); err != nil {
+		return nil, err
+	}
+
+	container, err := loadArtifact(path, format, nil)
+	if err != nil {
+		return nil, err
+	}
+	for entry := range container.Entries() {
+		list := &listStats{Name: strings.ToLower(entry.GetName())}
+		for prefix, err := range entry.Prefixes() {
+			if err != nil {
+				return nil, err
+			}
+			if prefix.Addr().Is4() {
+				list.IPv4++
+			} else {
+				list.IPv6++
+			}
+		}
+		s.IPv4 += list.IPv4
+		s.IPv6 += list.IPv6
+		s.Lists = append(s.Lists, list)
+	}
+	slices.SortFunc(s.Lists, func(a, b *listStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return s, nil
+}
+
+// readArtifactBuildInfo returns the build info embedded in the file, or the first
+// file of the directory which has it, nil if none
+func readArtifactBuildInfo(path, format string, isDir bool) (*lib.BuildInfo, error) {
+	files := []string{path}
+	if isDir {
+		dirEntries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, de := range dirEntries {
+			if de.Type().IsRegular() {
+				files = append(files, filepath.Join(path, de.Name()))
+			}
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := lib.ReadBuildInfo(format, data)
+		if err != nil || info != nil {
+			return info, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *fileStats) write(w io.Writer, showLists bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "File:\t%s\n", s.File)
+	fmt.Fprintf(tw, "Format:\t%s\n", s.Format)
+	if info := s.BuildInfo; info != nil {
+		fmt.Fprintf(tw, "Built by:\t%s %s\n", info.Tool, info.Version)
+		if info.Commit != "" {
+			fmt.Fprintf(tw, "Commit:\t%s\n", info.Commit)
+		}
+		fmt.Fprintf(tw, "Build time:\t%s\n", info.BuildTime.Format(time.RFC3339))
+		fmt.Fprintf(tw, "Manifest:\t%s\n", info.Manifest)
+	} else {
+		fmt.Fprintf(tw, "Build info:\tnone\n")
+	}
+	fmt.Fprintf(tw, "Lists:\t%d\n", len(s.Lists))
+	fmt.Fprintf(tw, "Prefixes:\t%d IPv4, %d IPv6\n", s.IPv4, s.IPv6)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if !showLists || len(s.Lists) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIST\tIPV4\tIPV6")
+	for _, list := range s.Lists {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", list.Name, list.IPv4, list.IPv6)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/v2fly/geoip/lib"
+)
+
+// runSummary is the machine-readable summary of a run, collected from progress
+// events and log records. Durations are in nanoseconds in JSON.
+type runSummary struct {
+	Start     time.Time        `json:"start"`
+	Duration  time.Duration    `json:"duration"`
+	Success   bool             `json:"success"`
+	ExitCode  int              `json:"exitCode"`
+	Error     string           `json:"error,omitempty"`
+	ErrorKind string           `json:"errorKind,omitempty"`
+	Sources   []*sourceSummary `json:"sources"` // remote files fetched
+	Bytes     int64            `json:"bytes"`   // bytes of all remote files fetched
+	Inputs    []*stepSummary   `json:"inputs"`
+	Entries   int              `json:"entries"` // number of lists loaded by inputs
+	Outputs   []*stepSummary   `json:"outputs"`
+	Warnings  []*warning       `json:"warnings"`
+
+	mu      sync.Mutex
+	next    lib.ProgressReporter
+	written []string // files written by the running output
+}
+
+type sourceSummary struct {
+	URI   string `json:"uri"`
+	Bytes int64  `json:"bytes"`
+}
+
+// stepSummary is an input or output done
+type stepSummary struct {
+	Index    int           `json:"index"`
+	Plugin   string        `json:"plugin"`
+	Duration time.Duration `json:"duration"`
+	Entries  int           `json:"entries,omitempty"` // number of lists after the input
+	Files    []string      `json:"files,omitempty"`   // files written by the output
+}
+
+// warning is a log record at or above the warn level
+type warning struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		Start:    time.Now(),
+		Sources:  make([]*sourceSummary, 0),
+		Inputs:   make([]*stepSummary, 0),
+		Outputs:  make([]*stepSummary, 0),
+		Warnings: make([]*warning, 0),
+	}
+}
+
+// Report records the event, and passes it to the next reporter if any
+func (s *runSummary) Report(ev *lib.ProgressEvent) {
+	s.mu.Lock()
+	switch {
+	case !ev.Done:
+	case ev.Stage == lib.ProgressDownload:
+		s.Sources = append(s.Sources, &sourceSummary{URI: ev.URI, Bytes: ev.Bytes})
+		s.Bytes += ev.Bytes
+	case ev.Stage == lib.ProgressInput:
+		s.Inputs = append(s.Inputs, &stepSummary{Index: ev.Index, Plugin: ev.Plugin, Duration: ev.Duration, Entries: ev.Entries})
+		s.Entries = ev.Entries
+	case ev.Stage == lib.ProgressOutput:
+		s.Outputs = append(s.Outputs, &stepSummary{Index: ev.Index, Plugin: ev.Plugin, Duration: ev.Duration, Files: s.written})
+		s.written = nil
+	}
+	s.mu.Unlock()
+
+	if s.next != nil {
+		s.next.Report(ev)
+	}
+}
+
+// finish records the result of the run
+func (s *runSummary) finish(err error) *runSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Duration = time.Since(s.Start)
+	s.Success = err == nil
+	if err != nil {
+		s.ExitCode = exitCode(err)
+		s.Error = err.Error()
+		s.ErrorKind = lib.ErrorKind(err)
+	}
+	return s
+}
+
+// write writes the summary in JSON to the file, or stdout if the path is -
+func (s *runSummary) write(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// summaryHandler records warnings and files written in the summary, and passes
+// records enabled by the wrapped handler to it
+type summaryHandler struct {
+	slog.Handler
+	summary *runSummary
+	attrs   []slog.Attr
+}
+
+func (h *summaryHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// Files written are logged at the info level
+	return level >= slog.LevelInfo || h.Handler.Enabled(ctx, level)
+}
+
+func (h *summaryHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := make(map[string]string)
+	for _, a := range h.attrs {
+		attrs[a.Key] = a.Value.String()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.String()
+		return true
+	})
+
+	h.summary.mu.Lock()
+	switch {
+	case r.Level >= slog.LevelWarn:
+		h.summary.Warnings = append(h.summary.Warnings, &warning{Time: r.Time, Level: r.Level.String(), Message: r.Message, Attrs: attrs})
+	case r.Message == "file written":
+		h.summary.written = append(h.summary.written, filepath.Join(attrs["dir"], attrs["file"]))
+	}
+	h.summary.mu.Unlock()
+
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *summaryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &summaryHandler{Handler: h.Handler.WithAttrs(attrs), summary: h.summary, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *summaryHandler) WithGroup(name string) slog.Handler {
+	return &summaryHandler{Handler: h.Handler.WithGroup(name), summary: h.summary, attrs: h.attrs}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/v2fly/geoip/lib"
+	"go4.org/netipx"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func init() {
+	registerCommand(&command{
+		name:        "verify",
+		usage:       "[flags] <file>...",
+		description: "Verify generated files parse, and their lists match the build report",
+		run:         runVerify,
+	})
+}
+
+// Fields of the V2Ray dat format, see plugin/v2ray/geoip.proto
+const (
+	datEntryField       protowire.Number = 1 // GeoIPList.entry
+	datCountryCodeField protowire.Number = 1 // GeoIP.country_code
+	datCIDRField        protowire.Number = 2 // GeoIP.cidr
+	datIPField          protowire.Number = 1 // CIDR.ip
+	datPrefixField      protowire.Number = 2 // CIDR.prefix
+)
+
+// verifyResult is the result of verifying a generated file
+type verifyResult struct {
+	File     string
+	Format   string
+	Lists    []*listStats
+	Problems []string
+}
+
+// artifactReaders read generated files without the input converters, so that
+// bugs shared by the writer and the reader of a format could be found. They
+// return the number of prefixes of every list.
+var artifactReaders = map[string]func(path string) ([]*listStats, error){
+	"v2rayGeoIPDat":  readDatStats,
+	"text":           readTextStats,
+	"singboxRuleSet": readRuleSetStats,
+	"maxmindMMDB":    readMMDBStats,
+}
+
+func runVerify(args []string) error {
+	cmd := commands["verify"]
+	fs := cmd.newFlagSet()
+	format := fs.String("format", "", "Format of the files, v2rayGeoIPDat, text, singboxRuleSet or maxmindMMDB, detected by file extension if not specified")
+	reportFile := fs.String("report", "", "Path to the build report written by -report-file, which lists and their prefixes of the files must match")
+	partial := fs.Bool("partial", false, "Allow files with a part of the lists of the build report, like the ones written with wantedList")
+	logLevel := fs.String("log-level", "info", "Log level, the value is debug, info, warn or error")
+	logFormat := fs.String("log-format", lib.LogFormatText, "Log format, the value is text or json")
+	fs.Parse(args)
+
+	if err := lib.SetupLogger(os.Stderr, *logLevel, *logFormat); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("files must be specified")
+	}
+
+	var report *lib.BuildReport
+	if *reportFile != "" {
+		var err error
+		if report, err = lib.ReadBuildReport(*reportFile); err != nil {
+			return err
+		}
+		if report == nil {
+			return fmt.Errorf("build report %s not found", *reportFile)
+		}
+	}
+
+	results := make([]*verifyResult, 0, fs.NArg())
+	failed := 0
+	for _, path := range fs.Args() {
+		result := verifyArtifact(path, *format, report, *partial)
+		if len(result.Problems) > 0 {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	printVerifyResults(os.Stdout, results)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(results))
+	}
+	return nil
+}
+
+// verifyArtifact reads the file and compares its lists with the report if not nil
+func verifyArtifact(path, format string, report *lib.BuildReport, partial bool) *verifyResult {
+	result := &verifyResult{File: path, Problems: make([]string, 0)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return result
+	}
+	result.Format = artifactFormat(path, format, info.IsDir())
+
+	reader, found := artifactReaders[result.Format]
+	if !found {
+		result.Problems = append(result.Problems, fmt.Sprintf("unsupported format %s", result.Format))
+		return result
+	}
+	if result.Lists, err = reader(path); err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return result
+	}
+	if len(result.Lists) == 0 {
+		result.Problems = append(result.Problems, "no list found")
+	}
+
+	if report == nil {
+		return result
+	}
+
+	buildInfo, err := readArtifactBuildInfo(path, result.Format, info.IsDir())
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+	} else if buildInfo != nil && report.Manifest != "" && buildInfo.Manifest != report.Manifest {
+		result.Problems = append(result.Problems, fmt.Sprintf("manifest %s of the build info differs from %s of the build report", buildInfo.Manifest, report.Manifest))
+	}
+
+	result.Problems = append(result.Problems, compareWithReport(result.Format, result.Lists, report, partial)...)
+	return result
+}
+
+// compareWithReport returns the differences of lists and their prefixes versus the report.
+// Networks of MMDB files are split by the search tree, so only names of their lists are compared.
+func compareWithReport(format string, lists []*listStats, report *lib.BuildReport, partial bool) []string {
+	problems := make([]string, 0)
+	expected := make(map[string]*lib.ListReport, len(report.Lists))
+	for _, list := range report.Lists {
+		expected[list.Name] = list
+	}
+
+	for _, list := range lists {
+		want, found := expected[list.Name]
+		if !found {
+			problems = append(problems, fmt.Sprintf("list %s is not in the build report", list.Name))
+			continue
+		}
+		delete(expected, list.Name)
+		if format == "maxmindMMDB" {
+			continue
+		}
+		if list.IPv4 != want.IPv4Prefixes || list.IPv6 != want.IPv6Prefixes {
+			problems = append(problems, fmt.Sprintf("list %s has %d IPv4 and %d IPv6 prefixes, %d and %d in the build report", list.Name, list.IPv4, list.IPv6, want.IPv4Prefixes, want.IPv6Prefixes))
+		}
+	}
+
+	if !partial {
+		missing := make([]string, 0, len(expected))
+		for name := range expected {
+			missing = append(missing, name)
+		}
+		slices.Sort(missing)
+		for _, name := range missing {
+			problems = append(problems, fmt.Sprintf("list %s of the build report is missing", name))
+		}
+	}
+	return problems
+}
+
+func printVerifyResults(w io.Writer, results []*verifyResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tFORMAT\tLISTS\tIPV4\tIPV6\tRESULT")
+	for _, result := range results {
+		ipv4, ipv6 := 0, 0
+		for _, list := range result.Lists {
+			ipv4 += list.IPv4
+			ipv6 += list.IPv6
+		}
+		status := "ok"
+		if len(result.Problems) > 0 {
+			status = fmt.Sprintf("%d problems", len(result.Problems))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", result.File, result.Format, len(result.Lists), ipv4, ipv6, status)
+	}
+	tw.Flush()
+
+	for _, result := range results {
+		for _, problem := range result.Problems {
+			fmt.Fprintf(w, "%s: %s\n", result.File, problem)
+		}
+	}
+}
+
+// countPrefix adds the prefix to the list, which must be valid and masked
+func countPrefix(list *listStats, prefix netip.Prefix) error {
+	if !prefix.IsValid() {
+		return fmt.Errorf("invalid prefix %s of list %s", prefix, list.Name)
+	}
+	if prefix != prefix.Masked() {
+		return fmt.Errorf("prefix %s of list %s has host bits set", prefix, list.Name)
+	}
+	if prefix.Addr().Is4() {
+		list.IPv4++
+	} else {
+		list.IPv6++
+	}
+	return nil
+}
+
+// addListStats adds the list to the sorted lists, failing if duplicated
+func addListStats(lists []*listStats, list *listStats) ([]*listStats, error) {
+	idx, found := slices.BinarySearchFunc(lists, list.Name, func(l *listStats, name string) int {
+		return strings.Compare(l.Name, name)
+	})
+	if found {
+		return nil, fmt.Errorf("duplicated list %s", list.Name)
+	}
+	return slices.Insert(lists, idx, list), nil
+}
+
+// readDatStats parses the GeoIPList by protowire instead of the generated code
+func readDatStats(path string) ([]*listStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]*listStats, 0)
+	err = consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		// Other fields, like the build info, are skipped by consumers
+		if num != datEntryField || typ != protowire.BytesType {
+			return nil
+		}
+		list, err := parseDatEntry(value)
+		if err != nil {
+			return err
+		}
+		lists, err = addListStats(lists, list)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid dat file: %w", err)
+	}
+	return lists, nil
+}
+
+func parseDatEntry(b []byte) (*listStats, error) {
+	list := new(listStats)
+	prefixes := make([]netip.Prefix, 0)
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == datCountryCodeField && typ == protowire.BytesType:
+			list.Name = strings.ToLower(string(value))
+		case num == datCIDRField && typ == protowire.BytesType:
+			prefix, err := parseDatCIDR(value)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if list.Name == "" {
+		return nil, errors.New("list without country code")
+	}
+	for _, prefix := range prefixes {
+		if err := countPrefix(list, prefix); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func parseDatCIDR(b []byte) (netip.Prefix, error) {
+	var ip []byte
+	var bits uint64
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == datIPField && typ == protowire.BytesType:
+			ip = value
+		case num == datPrefixField && typ == protowire.VarintType:
+			bits, _ = protowire.ConsumeVarint(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("invalid IP of %d bytes", len(ip))
+	}
+	if bits > uint64(addr.BitLen()) {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix length %d of %s", bits, addr)
+	}
+	return netip.PrefixFrom(addr, int(bits)), nil
+}
+
+// consumeFields calls fn with the value of every field of the message, which is the
+// content of bytes fields, or the encoded value of other fields
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		value := b[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// readTextStats reads a file, or every file of the directory as a list named after
+// the file, whose lines are CIDRs or IP addresses, besides empty and comment lines
+func readTextStats(path string) ([]*listStats, error) {
+	return readListFiles(path, "", func(r io.Reader, list *listStats) error {
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "//") {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(text)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(text)
+				if addrErr != nil {
+					return fmt.Errorf("line %d: invalid CIDR or IP address %q", line, text)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			if err := countPrefix(list, prefix); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+// readRuleSetStats reads a sing-box source rule-set, or every .json file of the directory
+func readRuleSetStats(path string) ([]*listStats, error) {
+	return readListFiles(path, ".json", func(r io.Reader, list *listStats) error {
+		var rs struct {
+			Version int `json:"version"`
+			Rules   []struct {
+				IPCIDR []string `json:"ip_cidr"`
+			} `json:"rules"` // rules of ip_asn are not counted
+		}
+		if err := json.NewDecoder(r).Decode(&rs); err != nil {
+			return err
+		}
+		if rs.Version < 1 {
+			return fmt.Errorf("invalid version %d", rs.Version)
+		}
+		for _, rule := range rs.Rules {
+			for _, cidr := range rule.IPCIDR {
+				prefix, err := netip.ParsePrefix(cidr)
+				if err != nil {
+					return fmt.Errorf("invalid ip_cidr %q", cidr)
+				}
+				if err := countPrefix(list, prefix); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// readListFiles reads the file, or every file of the directory with the extension if
+// not empty, as a list named after the file without the extension
+func readListFiles(path, ext string, read func(io.Reader, *listStats) error) ([]*listStats, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		files = files[:0]
+		err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && (ext == "" || strings.EqualFold(filepath.Ext(file), ext)) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lists := make([]*listStats, 0, len(files))
+	for _, file := range files {
+		name := filepath.Base(file)
+		list := &listStats{Name: strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		err = read(f, list)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if lists, err = addListStats(lists, list); err != nil {
+			return nil, err
+		}
+	}
+	return lists, nil
+}
+
+// readMMDBStats verifies the search tree and data of the MMDB file, and counts the
+// networks of every country, registered country or represented country
+func readMMDBStats(path string) ([]*listStats, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := db.Verify(); err != nil {
+		return nil, err
+	}
+
+	var record struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+		RepresentedCountry struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"represented_country"`
+	}
+
+	byName := make(map[string]*listStats)
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		record.Country.IsoCode, record.RegisteredCountry.IsoCode, record.RepresentedCountry.IsoCode = "", "", ""
+		network, err := networks.Network(&record)
+		if err != nil {
+			return nil, err
+		}
+		name := record.Country.IsoCode
+		if name == "" {
+			name = record.RegisteredCountry.IsoCode
+		}
+		if name == "" {
+			name = record.RepresentedCountry.IsoCode
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+
+		list, found := byName[name]
+		if !found {
+			list = &listStats{Name: name}
+			byName[name] = list
+		}
+		prefix, ok := netipx.FromStdIPNet(network)
+		if !ok {
+			return nil, fmt.Errorf("invalid network %s", network)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		if err := countPrefix(list, prefix); err != nil {
+			return nil, err
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+
+	lists := make([]*listStats, 0, len(byName))
+	for _, list := range byName {
+		lists = append(lists, list)
+	}
+	slices.SortFunc(lists, func(a, b *listStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return lists, nil
+}